@@ -6,26 +6,92 @@ package cache
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/cszatmary/shed/errors"
 	"github.com/cszatmary/shed/internal/util"
 	"github.com/cszatmary/shed/tool"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
 )
 
+// layoutVersion is the version of the layout used to store tools in the cache.
+// It must be incremented whenever a change is made to how tools are stored
+// in the cache, and a corresponding entry must be added to layoutMigrations.
+const layoutVersion = 2
+
+// layoutVersionFilename is the name of the file in the root of the cache
+// that contains the layout version of the cache.
+const layoutVersionFilename = "layout-version"
+
+// layoutMigrations contains functions to migrate a cache from one layout version
+// to the next. The function at index i migrates the cache from version i to i+1.
+// A nil function signifies that the tools cannot be migrated, in which case
+// they are removed so that they will be re-installed.
+var layoutMigrations = [layoutVersion]func(c *Cache) error{
+	// Version 0 is a cache that was created before layout versions were introduced.
+	// It uses the same layout as version 1 so nothing needs to be done.
+	0: func(c *Cache) error { return nil },
+	// Version 2 added subdirectories to tool directories for binaries built for other targets (GOOS_GOARCH)
+	// or with build flags (build-<hash>), and moved binaries installed under an alias to the .alias subdirectory.
+	// Existing binaries stay where they are, only aliases need to be moved.
+	1: removeLegacyAliases,
+}
+
 // Cache manages tools in an OS filesystem directory.
 type Cache struct {
 	rootDir string
 	// Used to download and build tools.
 	goClient Go
+	// Used to record the go commands run by the default Go client.
+	recorder Recorder
 	// For diagnostics.
 	logger logrus.FieldLogger
+	// progress is where human readable progress messages are written, if set.
+	// progressMu makes sure concurrent installs don't interleave messages.
+	progress   io.Writer
+	progressMu sync.Mutex
+	// workDir is where tools are downloaded and built if set.
+	workDir string
+	// env contains environment variables that are set when running the go command.
+	env []string
+	// releaseURL is the base URL that binary release assets are downloaded from.
+	releaseURL string
+	// retryAttempts is the max number of times to try downloading a tool, see WithRetry.
+	retryAttempts int
+	// retryBackoff is how long to wait before the first retry, it doubles after each attempt.
+	retryBackoff time.Duration
+	// goInstall is set if tools should be installed with go install when possible, see WithGoInstall.
+	goInstall bool
+
+	// Used to make sure the layout is only checked once. layoutMu protects layoutChecked and layoutErr,
+	// and is held while checking the layout. Clean resets layoutChecked so the layout is checked again.
+	layoutMu      sync.Mutex
+	layoutChecked bool
+	layoutErr     error
+
+	// maxSize is the max size in bytes of the installed tools.
+	// If it is 0, the size is unlimited.
+	maxSize int64
+	// mu protects the fields below and is held while evicting tools.
+	mu sync.Mutex
+	// protected contains the filepaths of tools that must never be evicted.
+	protected map[string]bool
+	// installing contains the filepaths of tools that are currently being installed.
+	installing map[string]int
 }
 
 // New creates a new Cache instance that uses the directory dir.
@@ -37,7 +103,7 @@ func New(dir string, opts ...Option) *Cache {
 	}
 	// Set defaults
 	if c.goClient == nil {
-		c.goClient = NewGo()
+		c.goClient = realGo{recorder: c.recorder}
 	}
 	if c.logger == nil {
 		// Logging is disabled by default, but we don't want to have to check
@@ -68,19 +134,490 @@ func WithLogger(logger logrus.FieldLogger) Option {
 	}
 }
 
+// WithProgressWriter sets a writer that human readable progress messages are written to while
+// installing tools. This is separate from the logger, which is meant for debugging, so progress
+// can be shown without enabling debug logs. By default no progress messages are written.
+//
+// Each message is written as a single line, with a single call to w.Write, in one of the formats:
+//
+//	Downloading TOOL
+//	Building TOOL
+//	Installed TOOL
+//	Removing TOOL from the cache
+//
+// Downloading is written before a tool is downloaded, TOOL may not have a version yet if the latest
+// version is being resolved. Building is written before a tool is built. Installed is written once a
+// tool was downloaded or built, it is not written if the tool was already installed. Removing is written
+// when a tool is evicted from the cache because of WithMaxSize. Messages for tools that are installed
+// concurrently may be interleaved, but a message is never split.
+func WithProgressWriter(w io.Writer) Option {
+	return func(c *Cache) {
+		c.progress = w
+	}
+}
+
+// WithCommandRecorder sets a Recorder that is used to record every go command
+// that is run to download and build tools. It only has an effect if the
+// default Go client is used, that is WithGo is not used.
+func WithCommandRecorder(r Recorder) Option {
+	return func(c *Cache) {
+		c.recorder = r
+	}
+}
+
+// WithWorkDir sets a working directory that is used to download and build tools.
+// Once a tool is built, only the go.mod, go.sum and binary are moved into the cache.
+// This can speed up installs if the cache is on a slow filesystem, like a network mount,
+// and dir is on a fast local filesystem. By default tools are downloaded and built
+// directly in the cache.
+func WithWorkDir(dir string) Option {
+	return func(c *Cache) {
+		c.workDir = dir
+	}
+}
+
+// WithEnv sets environment variables, in the form 'key=value', that are set when running the go
+// command to download, build, and list tools. They are merged over the environment of the current
+// process, so they can be used to override variables like GOPROXY, GOFLAGS, and GONOSUMDB, for example
+// to use a private module proxy. Custom implementations of Go receive them through GoEnv.
+func WithEnv(env []string) Option {
+	return func(c *Cache) {
+		c.env = append(c.env, env...)
+	}
+}
+
+// WithMaxSize sets the max size in bytes of the installed tools in the cache.
+// If an install causes the cache to exceed the max size, the least recently
+// used tools will be evicted until the size is under the max. Use Cache.Protect
+// to prevent tools from being evicted. By default the size is unlimited.
+func WithMaxSize(size int64) Option {
+	return func(c *Cache) {
+		c.maxSize = size
+	}
+}
+
+// WithRetry sets how downloading a tool is retried if it fails because of a transient network error,
+// such as the module proxy being unreachable. attempts is the max number of times to try downloading
+// the tool, including the first attempt. backoff is how long to wait before the first retry, and is
+// doubled before each retry after that. Errors that aren't caused by the network, such as an invalid
+// module path, are never retried. By default downloads are not retried.
+func WithRetry(attempts int, backoff time.Duration) Option {
+	return func(c *Cache) {
+		c.retryAttempts = attempts
+		c.retryBackoff = backoff
+	}
+}
+
+// WithGoInstall makes the cache install tools using 'go install IMPORT_PATH@VERSION' when possible,
+// instead of downloading them with 'go get -d' into a generated module and building them with 'go build'.
+// This requires Go 1.16 or newer. The binary is placed at the same path as with the default method,
+// and a go.mod recording the module that provides the tool and a go.sum with its hash, taken from the
+// build info of the binary, are still written, so installed tools are found the same way.
+//
+// go install is only used for tools with an exact version that are built for the host platform
+// and don't need their module hash verified, since go install builds the tool before the hash can be checked.
+// It is also not used on Windows or for import paths ending in a major version suffix, since
+// go install names those binaries differently. In all other cases the default method is used.
+func WithGoInstall() Option {
+	return func(c *Cache) {
+		c.goInstall = true
+	}
+}
+
 // Dir returns the OS filesystem directory used by this Cache.
 func (c *Cache) Dir() string {
 	return c.rootDir
 }
 
+// Size returns the total size in bytes of all files in the cache directory.
+// If the cache directory does not exist, 0 is returned.
+func (c *Cache) Size() (int64, error) {
+	const op = errors.Op("Cache.Size")
+	size, err := dirSize(c.rootDir)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, errors.New(errors.IO, fmt.Sprintf("failed to compute size of %q", c.rootDir), op, err)
+	}
+	return size, nil
+}
+
 // Clean removes the cache directory and all contents from the filesystem.
 func (c *Cache) Clean() error {
 	if err := os.RemoveAll(c.rootDir); err != nil {
 		return errors.New(errors.IO, "cache clean failed", errors.Op("Cache.Clean"), err)
 	}
+	// The layout version file was removed so the layout needs to be checked again.
+	c.layoutMu.Lock()
+	c.layoutChecked = false
+	c.layoutMu.Unlock()
 	return nil
 }
 
+// LayoutVersion returns the layout version of the cache directory. If the cache
+// was created before layout versions were introduced, or if the cache directory
+// does not exist, 0 is returned.
+func (c *Cache) LayoutVersion() (int, error) {
+	const op = errors.Op("Cache.LayoutVersion")
+	p := filepath.Join(c.rootDir, layoutVersionFilename)
+	data, err := os.ReadFile(p)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, errors.New(errors.IO, fmt.Sprintf("failed to read file %q", p), op, err)
+	}
+	v, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, errors.New(errors.BadState, fmt.Sprintf("invalid cache layout version in %q", p), op, err)
+	}
+	return v, nil
+}
+
+// ensureLayout makes sure the cache directory uses the current layout version,
+// migrating it if necessary. The check is only performed once.
+func (c *Cache) ensureLayout() error {
+	c.layoutMu.Lock()
+	defer c.layoutMu.Unlock()
+	if c.layoutChecked {
+		return c.layoutErr
+	}
+	c.layoutErr = c.migrateLayout()
+	if c.layoutErr == nil {
+		c.layoutErr = c.writeCacheDirTag()
+	}
+	c.layoutChecked = true
+	return c.layoutErr
+}
+
+// cacheDirTagFilename is the name of the file that marks the cache as a cache directory.
+const cacheDirTagFilename = "CACHEDIR.TAG"
+
+// cacheDirTag is the contents of the cache directory tag. The first line is the signature
+// required by the Cache Directory Tagging Specification. See https://bford.info/cachedir/.
+const cacheDirTag = `Signature: 8a477f597d28d172789f06886806bc55
+# This file is a cache directory tag created by shed.
+# For information about cache directory tags, see:
+#	https://bford.info/cachedir/
+`
+
+// writeCacheDirTag creates a CACHEDIR.TAG file in the cache root if one does not exist.
+// This excludes the cache from backups by backup software that supports the tag,
+// since the cache can always be recreated.
+func (c *Cache) writeCacheDirTag() error {
+	const op = errors.Op("Cache.writeCacheDirTag")
+	p := filepath.Join(c.rootDir, cacheDirTagFilename)
+	if util.FileOrDirExists(p) {
+		return nil
+	}
+	if err := os.MkdirAll(c.rootDir, 0o755); err != nil {
+		return errors.New(errors.IO, fmt.Sprintf("failed to create directory %q", c.rootDir), op, err)
+	}
+	if err := os.WriteFile(p, []byte(cacheDirTag), 0o644); err != nil {
+		return errors.New(errors.IO, fmt.Sprintf("failed to write file %q", p), op, err)
+	}
+	return nil
+}
+
+// migrateLayout migrates the cache directory to the current layout version
+// and records the version in the cache.
+func (c *Cache) migrateLayout() error {
+	const op = errors.Op("Cache.migrateLayout")
+	v, err := c.LayoutVersion()
+	if err != nil {
+		return err
+	}
+	if v == layoutVersion {
+		return nil
+	}
+	if v > layoutVersion {
+		// Don't touch the cache since we don't know anything about the layout.
+		c.logger.WithFields(logrus.Fields{
+			"version": v,
+			"current": layoutVersion,
+		}).Warn("cache was created by a newer version of shed, tools may need to be re-installed")
+		return nil
+	}
+
+	for ; v < layoutVersion; v++ {
+		migrate := layoutMigrations[v]
+		if migrate == nil {
+			c.logger.WithFields(logrus.Fields{
+				"version": v,
+				"current": layoutVersion,
+			}).Warn("cache layout is out of date, existing tools will be re-installed")
+			if err := os.RemoveAll(c.toolsDir()); err != nil {
+				return errors.New(errors.IO, "failed to remove outdated tools", op, err)
+			}
+			break
+		}
+		if err := migrate(c); err != nil {
+			return errors.New(fmt.Sprintf("failed to migrate cache layout from version %d", v), op, err)
+		}
+		c.logger.Debugf("migrated cache layout from version %d to %d", v, v+1)
+	}
+
+	if err := os.MkdirAll(c.rootDir, 0o755); err != nil {
+		return errors.New(errors.IO, fmt.Sprintf("failed to create directory %q", c.rootDir), op, err)
+	}
+	// Write atomically since other processes sharing the cache may be reading the file.
+	p := filepath.Join(c.rootDir, layoutVersionFilename)
+	err = util.WriteFileAtomic(p, 0o644, func(w io.Writer) error {
+		_, err := io.WriteString(w, strconv.Itoa(layoutVersion)+"\n")
+		return err
+	})
+	if err != nil {
+		return errors.New(errors.IO, fmt.Sprintf("failed to write file %q", p), op, err)
+	}
+	return nil
+}
+
+// toolFiles are the names of the files other than the binary that can be in the directory of a tool,
+// or in the directory of a binary built with build flags.
+var toolFiles = map[string]bool{
+	modfileName:        true,
+	gosumName:          true,
+	reproducibleMarker: true,
+	toolchainMarker:    true,
+	buildFlagsMarker:   true,
+	releaseMarker:      true,
+	releaseHashMarker:  true,
+}
+
+// removeLegacyAliases removes binaries that were installed under an alias next to the binary of the tool,
+// before aliases were moved to their own directory. They are any files that are not part of the tool.
+// The aliases are installed again in their own directory the next time the tool is installed.
+func removeLegacyAliases(c *Cache) error {
+	baseDir := c.toolsDir()
+	return filepath.WalkDir(baseDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == baseDir && os.IsNotExist(err) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		// Tool directories have the format IMPORT_PATH@VERSION
+		if !d.IsDir() || strings.LastIndexByte(d.Name(), '@') == -1 {
+			return nil
+		}
+		fp, err := filepath.Rel(baseDir, p)
+		if err != nil {
+			return err
+		}
+		t, err := toolFromFilepath(fp)
+		if err != nil {
+			// Not a tool dir, leave it alone
+			return filepath.SkipDir
+		}
+		// Aliases of binaries built with build flags were in the build flags directory
+		dirs, err := filepath.Glob(filepath.Join(p, buildFlagsDirPrefix+"*"))
+		if err != nil {
+			return err
+		}
+		for _, dir := range append(dirs, p) {
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				return err
+			}
+			for _, e := range entries {
+				if !e.Type().IsRegular() || e.Name() == t.Name() || toolFiles[e.Name()] {
+					continue
+				}
+				if err := os.Remove(filepath.Join(dir, e.Name())); err != nil {
+					return err
+				}
+				c.logger.WithFields(logrus.Fields{
+					"tool":  t,
+					"alias": e.Name(),
+				}).Debug("removed legacy alias")
+			}
+		}
+		return filepath.SkipDir
+	})
+}
+
+// InstallOption is a function that configures a single call to Cache.Install.
+type InstallOption func(*installOptions)
+
+type installOptions struct {
+	downloaded      func(t tool.Tool)
+	direct          bool
+	hash            string
+	reproducible    bool
+	offlineFallback bool
+	fallbackMin     string
+	force           bool
+	toolchain       string
+	alias           string
+	buildFlags      []string
+	target          tool.Target
+	release         *binaryRelease
+	releaseHash     string
+}
+
+// WithTarget causes the tool to be cross-compiled for target by setting GOOS and GOARCH when building it.
+// The binary is placed in a directory named after the target so it doesn't collide with the binary
+// for the host or other targets, see tool.Tool.TargetBinaryFilepath. Use Cache.TargetToolPath to find it.
+// Cross-compiled binaries are only evicted from the cache along with the host binary.
+func WithTarget(target tool.Target) InstallOption {
+	return func(o *installOptions) {
+		o.target = target
+	}
+}
+
+// WithOfflineFallback causes the installed version of the tool in the cache to be used if the tool
+// cannot be downloaded because of a network error. It only applies if the tool does not have an exact
+// version, for example if it is being updated to the latest version. If multiple versions are installed,
+// the highest one is used. A warning is logged when the cached version is used.
+// This allows installs to keep working during network outages.
+//
+// If minVersion is not empty, only versions greater than or equal to it are used. This prevents
+// an update from silently downgrading a tool, for example to a version lower than the one in a lockfile.
+func WithOfflineFallback(minVersion string) InstallOption {
+	return func(o *installOptions) {
+		o.offlineFallback = true
+		o.fallbackMin = minVersion
+	}
+}
+
+// reproducibleMarker is the name of the file written next to a binary that was built
+// with reproducible build flags.
+const reproducibleMarker = ".reproducible"
+
+// WithReproducible causes the tool to be built with flags that make the binary reproducible,
+// so that building the same version of a tool with the same toolchain on the same platform
+// always produces an identical binary. Currently this builds with -trimpath.
+// If the binary in the cache was not built reproducibly, it is rebuilt.
+func WithReproducible() InstallOption {
+	return func(o *installOptions) {
+		o.reproducible = true
+	}
+}
+
+// WithBuildFlags sets extra flags that are passed to go build when building the tool,
+// for example '-ldflags=-X main.version=v1.0.0' or '-tags=netgo'. See tool.ValidateBuildFlags
+// for the flags that are allowed.
+//
+// The flags are part of the key of the binary in the cache. The binary is placed in a directory named
+// after a hash of the flags, so binaries of the same tool built with different flags don't replace each other.
+// The flags are also recorded next to the binary, and it is rebuilt if they differ from flags.
+// Use ForBuildFlags to find it. Tools built with flags are never installed using go install, see WithGoInstall.
+func WithBuildFlags(flags ...string) InstallOption {
+	return func(o *installOptions) {
+		o.buildFlags = flags
+	}
+}
+
+// WithHash sets the expected hash of the module that provides the tool. This is the 'h1:' hash
+// recorded in go.sum, see Cache.ModuleHash. If the hash of the downloaded module is different,
+// Install returns an error with kind errors.BadState and the tool is not built.
+// hash should only be used if the tool has an exact version, since it only applies to that version.
+func WithHash(hash string) InstallOption {
+	return func(o *installOptions) {
+		o.hash = hash
+	}
+}
+
+// WithDirect causes the tool to be downloaded directly from version control instead of
+// through the module proxy, by setting GOPROXY=direct when downloading it.
+// This is useful for tools that are not available from the configured proxy.
+// GOSUMDB is left as is, so the checksum of the module is still verified against the checksum database.
+// Private modules that are not in the checksum database must be excluded using GONOSUMDB or GOPRIVATE,
+// for example with WithEnv.
+func WithDirect() InstallOption {
+	return func(o *installOptions) {
+		o.direct = true
+	}
+}
+
+// WithToolchain causes the tool to be downloaded and built with the given version of the Go toolchain,
+// for example '1.21.0', by setting GOTOOLCHAIN when running the go command. Go 1.21 and newer download
+// the toolchain if it is not installed. This makes builds reproducible across machines with different
+// Go installations. If goVersion is empty, the installed Go toolchain is used.
+//
+// The toolchain is recorded next to the binary, and a binary in the cache that was built with a different
+// toolchain is rebuilt.
+func WithToolchain(goVersion string) InstallOption {
+	return func(o *installOptions) {
+		o.toolchain = goVersion
+	}
+}
+
+// WithAlias causes the binary of the tool to also be installed under the name alias, in a separate directory
+// so that it never replaces other files of the tool, see tool.Tool.AliasBinaryFilepath. This allows tools with
+// the same binary name to be told apart. The binary is hard linked if possible, otherwise it is copied.
+// Use Cache.AliasToolPath to find it.
+// alias only applies to the binary for the host, it is ignored if WithTarget is used.
+func WithAlias(alias string) InstallOption {
+	return func(o *installOptions) {
+		o.alias = alias
+	}
+}
+
+// WithDownloaded sets a function that is called once the tool has been downloaded,
+// before it is built. t is the tool with the resolved version. fn is called on the
+// same goroutine as Install, so Install waits for fn to return before building.
+func WithDownloaded(fn func(t tool.Tool)) InstallOption {
+	return func(o *installOptions) {
+		o.downloaded = fn
+	}
+}
+
+// PathOption is a function that configures which binary of a tool is used by methods like Cache.ToolPath.
+type PathOption func(*pathOptions)
+
+type pathOptions struct {
+	buildFlags []string
+	toolchain  string
+}
+
+// ForBuildFlags selects the binary that was built with flags by installing with WithBuildFlags.
+// If flags is empty, the binary built without build flags is used, which is the default.
+func ForBuildFlags(flags ...string) PathOption {
+	return func(o *pathOptions) {
+		o.buildFlags = flags
+	}
+}
+
+// ForToolchain requires the binary to have been built with the Go toolchain goVersion by installing with
+// WithToolchain. A binary built with a different toolchain is treated as not built.
+// If goVersion is empty, a binary built with any toolchain is used, which is the default.
+func ForToolchain(goVersion string) PathOption {
+	return func(o *pathOptions) {
+		o.toolchain = goVersion
+	}
+}
+
+func newPathOptions(opts []PathOption) pathOptions {
+	var pathOpts pathOptions
+	for _, opt := range opts {
+		opt(&pathOpts)
+	}
+	return pathOpts
+}
+
+// binaryFilepath returns the path to the binary of t for target built with buildFlags, relative to the tools directory.
+// Binaries built with build flags are placed in a subdirectory named after a hash of the flags, next to where the
+// binary built without flags would be. This way binaries built with different flags can be installed at the same time.
+func binaryFilepath(t tool.Tool, target tool.Target, buildFlags []string) (string, error) {
+	bfp, err := t.TargetBinaryFilepath(target)
+	if err != nil || len(buildFlags) == 0 {
+		return bfp, err
+	}
+	dir, name := filepath.Split(bfp)
+	return filepath.Join(dir, buildFlagsDir(buildFlags), name), nil
+}
+
+// buildFlagsDir returns the name of the directory that contains binaries built with buildFlags.
+func buildFlagsDir(buildFlags []string) string {
+	h := sha256.Sum256([]byte(strings.Join(buildFlags, "\x00")))
+	return buildFlagsDirPrefix + hex.EncodeToString(h[:8])
+}
+
+// buildFlagsDirPrefix is the prefix of the directories that contain binaries built with build flags.
+const buildFlagsDirPrefix = "build-"
+
 // toolsDir returns the path to the directory where tools are installed.
 func (c *Cache) toolsDir() string {
 	return filepath.Join(c.rootDir, "tools")
@@ -93,78 +630,572 @@ func (c *Cache) toolsDir() string {
 //
 // The provided context is used to terminate the install if the context becomes
 // done before the install completes on its own.
-func (c *Cache) Install(ctx context.Context, t tool.Tool) (tool.Tool, error) {
+//
+// If the install fails because the disk is full, an error with kind errors.IO
+// that wraps syscall.ENOSPC is returned.
+//
+// opts can be used to configure this specific install, for example to be notified
+// of its progress.
+func (c *Cache) Install(ctx context.Context, t tool.Tool, opts ...InstallOption) (tool.Tool, error) {
 	const op = errors.Op("Cache.Install")
+	var installOpts installOptions
+	for _, opt := range opts {
+		opt(&installOpts)
+	}
+	installed, err := c.install(ctx, op, t, installOpts)
+	if err != nil && errors.Is(err, syscall.ENOSPC) {
+		// The original error could be buried under many layers and have a confusing message,
+		// replace it with a clear one so it's obvious what needs to be done.
+		c.logger.WithFields(logrus.Fields{
+			"tool":  t,
+			"error": err,
+		}).Debug("install failed because the disk is full")
+		msg := fmt.Sprintf(
+			"no space left on device while installing tool %s, free up disk space, for example by running 'shed cache prune' to remove tools that are no longer used, and try again",
+			t,
+		)
+		return installed, errors.New(errors.IO, msg, op, syscall.ENOSPC)
+	}
+	if err != nil && installOpts.offlineFallback && !t.HasSemver() && errors.Is(err, ErrNetwork) {
+		cached, ok := c.cachedVersion(op, t, installOpts.fallbackMin)
+		if ok {
+			c.logger.WithFields(logrus.Fields{
+				"tool":  t,
+				"error": err,
+			}).Debug("failed to download tool because of a network error")
+			c.logger.Warnf("Unable to download tool %s because of a network error, using cached version %s", t, cached.Version)
+			installed, err = cached, nil
+		}
+	}
+	if err == nil && installOpts.alias != "" && installOpts.target.IsHost() {
+		if err := c.installAlias(op, installed, installOpts.alias, installOpts.buildFlags); err != nil {
+			return installed, err
+		}
+	}
+	return installed, err
+}
+
+// Reinstall is like Install but always downloads and builds tool t, even if it is already installed.
+// If t has an exact version, its module and binaries are removed from the cache first so it is installed
+// from scratch. Otherwise, the latest version is resolved and rebuilt. This is useful to recover from
+// a corrupt binary, or one that was built with a different Go toolchain.
+func (c *Cache) Reinstall(ctx context.Context, t tool.Tool, opts ...InstallOption) (tool.Tool, error) {
+	return c.Install(ctx, t, append(opts, func(o *installOptions) {
+		o.force = true
+	})...)
+}
+
+// progressf writes a progress message to the progress writer, if one was set. See WithProgressWriter.
+func (c *Cache) progressf(format string, args ...interface{}) {
+	if c.progress == nil {
+		return
+	}
+	c.progressMu.Lock()
+	defer c.progressMu.Unlock()
+	// Progress is best effort, it isn't worth failing an install over.
+	_, _ = fmt.Fprintf(c.progress, format+"\n", args...)
+}
+
+// cachedVersion returns the highest version of the tool with the same import path as t that is installed in the cache.
+// If no version is installed, or the highest version is lower than minVersion, false is returned.
+func (c *Cache) cachedVersion(op errors.Op, t tool.Tool, minVersion string) (tool.Tool, bool) {
+	versions, err := c.installedVersions(op, t.ImportPath)
+	if err != nil {
+		c.logger.WithError(err).Debug("failed to read installed tools")
+		return t, false
+	}
+	if len(versions) == 0 {
+		return t, false
+	}
+	highest := versions[len(versions)-1]
+	if minVersion != "" && semver.Compare(highest, minVersion) < 0 {
+		c.logger.Debugf("cached version %s of tool %s is lower than %s", highest, t.ImportPath, minVersion)
+		return t, false
+	}
+	return t.WithVersion(highest), true
+}
+
+// InstalledVersions returns the versions of the tool with the given import path that are installed in the cache,
+// sorted from lowest to highest. This can be used to switch to a version of a tool that is already installed,
+// for example to downgrade, without downloading it again. If no versions are installed, nil is returned.
+// importPath must not have a version.
+func (c *Cache) InstalledVersions(importPath string) ([]string, error) {
+	return c.installedVersions(errors.Op("Cache.InstalledVersions"), importPath)
+}
+
+// installedVersions does the actual work of InstalledVersions.
+func (c *Cache) installedVersions(op errors.Op, importPath string) ([]string, error) {
+	t, err := tool.ParseLax(importPath)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("invalid import path %q", importPath), op, err)
+	}
+	if t.Version != "" {
+		return nil, errors.Errorf(errors.Invalid, op, "import path %q must not have a version", importPath)
+	}
+	fp, err := t.Filepath()
+	if err != nil {
+		return nil, err
+	}
+	// Each version is a separate directory named IMPORT_PATH@VERSION, so they all share the same parent directory.
+	dir, name := filepath.Split(filepath.Join(c.toolsDir(), fp))
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, errors.IO, op, fmt.Sprintf("failed to read directory %q", dir))
+	}
+	var versions []string
+	for _, e := range entries {
+		if !e.IsDir() || !strings.HasPrefix(e.Name(), name+"@") {
+			continue
+		}
+		version, err := module.UnescapeVersion(strings.TrimPrefix(e.Name(), name+"@"))
+		if err != nil {
+			// Not a tool dir, ignore it
+			continue
+		}
+		tv := t.WithVersion(version)
+		if !tv.HasSemver() {
+			continue
+		}
+		installed, err := c.installed(op, tv, tool.Target{}, nil)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("failed to check if tool %s is installed", tv), op, err)
+		}
+		if installed {
+			versions = append(versions, version)
+		}
+	}
+	semver.Sort(versions)
+	return versions, nil
+}
+
+// install does the actual work of Install.
+func (c *Cache) install(ctx context.Context, op errors.Op, t tool.Tool, opts installOptions) (tool.Tool, error) {
 	select {
 	case <-ctx.Done():
 		return t, ctx.Err()
 	default:
 	}
-
-	// Make sure import path is set as it's required for download
-	if t.ImportPath == "" {
-		return t, errors.New(errors.Internal, "import path is missing from tool")
+
+	// Make sure import path is set as it's required for download
+	if t.ImportPath == "" {
+		return t, errors.New(errors.Internal, "import path is missing from tool")
+	}
+	if err := opts.target.Validate(); err != nil {
+		return t, err
+	}
+	if err := tool.ValidateBuildFlags(opts.buildFlags); err != nil {
+		return t, errors.New(fmt.Sprintf("invalid build flags for tool %s", t), op, err)
+	}
+	if err := c.ensureLayout(); err != nil {
+		return t, errors.New("failed to check cache layout", op, err)
+	}
+	if opts.toolchain != "" {
+		ctx = withGoEnv(ctx, "GOTOOLCHAIN=go"+opts.toolchain)
+	}
+
+	// Other processes might be installing the same tool using the same cache, wait for them
+	// to finish. If one of them installs the tool, it will be found below and reused.
+	unlock, err := c.lockTool(ctx, op, t)
+	if err != nil {
+		return t, err
+	}
+	defer unlock()
+
+	// Make sure the tool isn't evicted by another install while it is being installed.
+	if t.HasSemver() {
+		if fp, err := t.Filepath(); err == nil {
+			defer c.markInstalling(fp)()
+		}
+	}
+
+	if opts.force && t.HasSemver() {
+		fp, err := t.Filepath()
+		if err != nil {
+			return t, err
+		}
+		dir := filepath.Join(c.toolsDir(), fp)
+		c.logger.WithFields(logrus.Fields{
+			"tool": t,
+			"path": dir,
+		}).Debug("removing tool to reinstall it")
+		if err := os.RemoveAll(dir); err != nil {
+			return t, errors.New(errors.IO, fmt.Sprintf("failed to remove directory %q", dir), op, err)
+		}
+	}
+
+	// Binary releases are downloaded as is, they don't go through the download and build steps.
+	if opts.release != nil {
+		return c.installRelease(ctx, op, t, opts)
+	}
+
+	// When a work dir is used, tools are downloaded and built in a staging directory
+	// and then moved to the cache. The staging directory is always empty so check
+	// the cache directly to see if the tool is already installed.
+	baseDir := c.toolsDir()
+	if c.workDir != "" {
+		if t.HasSemver() {
+			installed, err := c.installed(op, t, opts.target, opts.buildFlags)
+			if err != nil {
+				return t, errors.New(fmt.Sprintf("failed to check if tool %s is installed", t), op, err)
+			}
+			if installed && !c.upToDate(c.toolsDir(), t, opts) {
+				installed = false
+			}
+			if installed {
+				if err := c.verifyHash(op, c.toolsDir(), t, opts.hash); err != nil {
+					return t, err
+				}
+				c.logger.WithFields(logrus.Fields{
+					"tool": t,
+				}).Debug("tool already installed, skipping download and build")
+				return t, nil
+			}
+		}
+		if err := os.MkdirAll(c.workDir, 0o755); err != nil {
+			return t, errors.New(errors.IO, fmt.Sprintf("failed to create directory %q", c.workDir), op, err)
+		}
+		stageDir, err := os.MkdirTemp(c.workDir, "shed-install-")
+		if err != nil {
+			return t, errors.New(errors.IO, fmt.Sprintf("failed to create staging directory in %q", c.workDir), op, err)
+		}
+		defer os.RemoveAll(stageDir)
+		baseDir = stageDir
+	}
+
+	if c.canGoInstall(ctx, t, opts) {
+		return c.installWithGoInstall(ctx, op, t, baseDir, opts)
+	}
+
+	// Download step
+
+	downloadCtx := ctx
+	if opts.direct {
+		downloadCtx = withGoEnv(ctx, "GOPROXY=direct")
+	}
+	downloadedTool, err := c.download(downloadCtx, op, t, baseDir, opts.toolchain)
+	if err != nil {
+		return t, errors.New(fmt.Sprintf("failed to download tool %s", t), op, err)
+	}
+	if err := c.verifyHash(op, baseDir, downloadedTool, opts.hash); err != nil {
+		return downloadedTool, err
+	}
+	if opts.downloaded != nil {
+		opts.downloaded(downloadedTool)
+	}
+
+	// Build step
+
+	fp, err := downloadedTool.Filepath()
+	if err != nil {
+		return downloadedTool, err
+	}
+	// Paths are escaped so that they are all lower case. Guard against this ever changing,
+	// since it would cause tools to collide on case-insensitive filesystems.
+	if fp != strings.ToLower(fp) {
+		msg := fmt.Sprintf("path %q for tool %s is not case-insensitive safe", fp, downloadedTool)
+		return downloadedTool, errors.New(errors.Internal, msg, op)
+	}
+	if !t.HasSemver() {
+		defer c.markInstalling(fp)()
+	}
+	binDir := filepath.Join(baseDir, fp)
+
+	bfp, err := binaryFilepath(downloadedTool, opts.target, opts.buildFlags)
+	if err != nil {
+		return downloadedTool, err
+	}
+	binPath := filepath.Join(baseDir, bfp)
+
+	// Check if already built
+	if !opts.force && util.FileOrDirExists(binPath) {
+		if c.upToDate(baseDir, downloadedTool, opts) {
+			c.logger.WithFields(logrus.Fields{
+				"tool": downloadedTool,
+				"path": binPath,
+			}).Debug("tool binary already exists, skipping build")
+			return downloadedTool, nil
+		}
+		c.logger.WithFields(logrus.Fields{
+			"tool": downloadedTool,
+			"path": binPath,
+		}).Debug("tool binary was not built with the requested options, rebuilding")
+	}
+	if baseDir != c.toolsDir() && !t.HasSemver() && !opts.force {
+		// The resolved version might already be installed in the cache
+		installed, err := c.installed(op, downloadedTool, opts.target, opts.buildFlags)
+		if err != nil {
+			return downloadedTool, errors.New(fmt.Sprintf("failed to check if tool %s is installed", downloadedTool), op, err)
+		}
+		if installed && !c.upToDate(c.toolsDir(), downloadedTool, opts) {
+			installed = false
+		}
+		if installed {
+			c.logger.WithFields(logrus.Fields{
+				"tool": downloadedTool,
+			}).Debug("tool already installed, skipping build")
+			return downloadedTool, nil
+		}
+	}
+
+	buildCtx := ctx
+	markerPath := filepath.Join(filepath.Dir(binPath), reproducibleMarker)
+	if opts.reproducible {
+		buildCtx = withGoEnv(buildCtx, c.reproducibleGoFlags())
+	}
+	if !opts.target.IsHost() {
+		buildCtx = withGoEnv(buildCtx, "GOOS="+opts.target.GOOS, "GOARCH="+opts.target.GOARCH)
+	}
+	if !opts.target.IsHost() || len(opts.buildFlags) > 0 {
+		// The binary is in a subdirectory of the tool directory
+		outDir := filepath.Dir(binPath)
+		if err := os.MkdirAll(outDir, 0o755); err != nil {
+			return downloadedTool, errors.New(errors.IO, fmt.Sprintf("failed to create directory %q", outDir), op, err)
+		}
+	}
+	toolchainPath := filepath.Join(filepath.Dir(binPath), toolchainMarker)
+	buildFlagsPath := filepath.Join(filepath.Dir(binPath), buildFlagsMarker)
+	// Remove the markers before building so they never refer to a binary that was built differently.
+	for _, p := range []string{markerPath, toolchainPath, buildFlagsPath} {
+		if err := os.RemoveAll(p); err != nil {
+			return downloadedTool, errors.New(errors.IO, fmt.Sprintf("failed to remove file %q", p), op, err)
+		}
+	}
+	c.progressf("Building %s", downloadedTool)
+	buildStart := time.Now()
+	err = c.goClient.Build(c.goContext(buildCtx), downloadedTool.ImportPath, binPath, binDir, opts.buildFlags)
+	buildDuration := time.Since(buildStart)
+	if err != nil {
+		return downloadedTool, errors.New(fmt.Sprintf("failed to build tool %s", downloadedTool), op, err)
+	}
+	if err := validateBinary(op, downloadedTool, binPath); err != nil {
+		// Remove the bad binary so it isn't mistaken for a successful build by the next install.
+		if rmErr := os.Remove(binPath); rmErr != nil && !os.IsNotExist(rmErr) {
+			c.logger.WithError(rmErr).Debugf("failed to remove invalid binary %s", binPath)
+		}
+		return downloadedTool, err
+	}
+	if opts.reproducible {
+		if err := os.WriteFile(markerPath, nil, 0o644); err != nil {
+			return downloadedTool, errors.New(errors.IO, fmt.Sprintf("failed to write file %q", markerPath), op, err)
+		}
+	}
+	if opts.toolchain != "" {
+		if err := os.WriteFile(toolchainPath, []byte(opts.toolchain), 0o644); err != nil {
+			return downloadedTool, errors.New(errors.IO, fmt.Sprintf("failed to write file %q", toolchainPath), op, err)
+		}
+	}
+	if len(opts.buildFlags) > 0 {
+		if err := os.WriteFile(buildFlagsPath, []byte(strings.Join(opts.buildFlags, "\x00")), 0o644); err != nil {
+			return downloadedTool, errors.New(errors.IO, fmt.Sprintf("failed to write file %q", buildFlagsPath), op, err)
+		}
+	}
+
+	c.logger.WithFields(logrus.Fields{
+		"tool":     downloadedTool,
+		"path":     binPath,
+		"duration": buildDuration,
+	}).Debug("tool built")
+
+	if baseDir != c.toolsDir() {
+		if err := c.moveToCache(op, downloadedTool, opts.target, opts.buildFlags, baseDir); err != nil {
+			return downloadedTool, err
+		}
+	}
+
+	c.progressf("Installed %s", downloadedTool)
+
+	if err := c.evict(op); err != nil {
+		return downloadedTool, errors.New("failed to evict tools from cache", op, err)
+	}
+	return downloadedTool, nil
+}
+
+// minGoInstallVersion is the first version of Go that supports 'go install IMPORT_PATH@VERSION'.
+const minGoInstallVersion = "1.16"
+
+// canGoInstall reports whether t can be installed with go install, see WithGoInstall.
+func (c *Cache) canGoInstall(ctx context.Context, t tool.Tool, opts installOptions) bool {
+	if !c.goInstall || !t.HasSemver() || !opts.target.IsHost() || opts.hash != "" || len(opts.buildFlags) > 0 || runtime.GOOS == "windows" {
+		return false
+	}
+	// go install names the binary after the element before a major version suffix,
+	// for example 'foo' for 'example.org/foo/v2', so it wouldn't match the name of the tool.
+	if _, pathMajor, ok := module.SplitPathVersion(t.ImportPath); ok && pathMajor != "" {
+		return false
+	}
+	goVersion, err := GoVersion(ctx)
+	if err != nil {
+		c.logger.WithError(err).Debug("failed to find go version, not using go install")
+		return false
+	}
+	// The semver package requires strings to be prefixed with 'v' to be considered valid
+	return semver.Compare("v"+goVersion, "v"+minGoInstallVersion) >= 0
+}
+
+// installWithGoInstall does the work of install using go install instead of downloading and building the tool
+// separately. t must have an exact version. Like download, a go.mod requiring the module that provides t and a go.sum
+// with the hash of the module are written to the directory of t in baseDir, so that the tool is found by status and
+// its hash can be recorded.
+func (c *Cache) installWithGoInstall(ctx context.Context, op errors.Op, t tool.Tool, baseDir string, opts installOptions) (tool.Tool, error) {
+	if baseDir == c.toolsDir() && !opts.force {
+		installed, err := c.installed(op, t, opts.target, nil)
+		if err != nil {
+			return t, errors.New(fmt.Sprintf("failed to check if tool %s is installed", t), op, err)
+		}
+		if installed && !c.upToDate(baseDir, t, opts) {
+			installed = false
+		}
+		if installed {
+			c.logger.WithFields(logrus.Fields{
+				"tool": t,
+			}).Debug("tool already installed, skipping go install")
+			return t, nil
+		}
+	}
+
+	fp, err := t.Filepath()
+	if err != nil {
+		return t, err
+	}
+	binDir := filepath.Join(baseDir, fp)
+	binPath := filepath.Join(binDir, t.Name())
+	// Start from scratch so nothing is left over from a previous install, like a go.mod for a different version.
+	if err := os.RemoveAll(binDir); err != nil {
+		return t, errors.New(errors.IO, fmt.Sprintf("failed to remove directory %q", binDir), op, err)
+	}
+	if err := os.MkdirAll(binDir, 0o755); err != nil {
+		return t, errors.New(errors.IO, fmt.Sprintf("failed to create directory %q", binDir), op, err)
+	}
+
+	installCtx := ctx
+	if opts.direct {
+		installCtx = withGoEnv(installCtx, "GOPROXY=direct")
+	}
+	if opts.reproducible {
+		installCtx = withGoEnv(installCtx, c.reproducibleGoFlags())
+	}
+	c.progressf("Building %s", t)
+	start := time.Now()
+	gm, err := c.goClient.Install(c.goContext(installCtx), t.Module(), binDir)
+	duration := time.Since(start)
+	if err != nil {
+		return t, errors.New(fmt.Sprintf("failed to install tool %s", t), op, err)
+	}
+	if gm.Version != t.Version {
+		return t, errors.New(errors.Internal, fmt.Sprintf("incorrect version of tool %s was installed, got %s", t, gm.Version), op)
+	}
+	if err := validateBinary(op, t, binPath); err != nil {
+		if rmErr := os.Remove(binPath); rmErr != nil && !os.IsNotExist(rmErr) {
+			c.logger.WithError(rmErr).Debugf("failed to remove invalid binary %s", binPath)
+		}
+		return t, err
+	}
+	if opts.downloaded != nil {
+		opts.downloaded(t)
 	}
 
-	// Download step
-
-	downloadedTool, err := c.download(ctx, op, t)
+	if err := createGoModFile(ctx, op, "_", binDir, opts.toolchain); err != nil {
+		return t, err
+	}
+	modfilePath := filepath.Join(binDir, modfileName)
+	modFile, err := readGoModFile(op, errors.Internal, modfilePath)
 	if err != nil {
-		return t, errors.New(fmt.Sprintf("failed to download tool %s", t), op, err)
+		return t, err
+	}
+	if err := modFile.AddRequire(gm.Path, gm.Version); err != nil {
+		return t, errors.New(errors.Internal, fmt.Sprintf("failed to add require for %s", gm.Path), op, err)
+	}
+	if err := writeGoModFile(op, modFile, modfilePath); err != nil {
+		return t, err
+	}
+	// Record the module hash in go.sum like go get does, so that ModuleHash works.
+	if gm.Sum != "" {
+		gosumPath := filepath.Join(binDir, gosumName)
+		line := fmt.Sprintf("%s %s %s\n", gm.Path, gm.Version, gm.Sum)
+		if err := os.WriteFile(gosumPath, []byte(line), 0o644); err != nil {
+			return t, errors.New(errors.IO, fmt.Sprintf("failed to write file %q", gosumPath), op, err)
+		}
+	}
+	if opts.reproducible {
+		markerPath := filepath.Join(binDir, reproducibleMarker)
+		if err := os.WriteFile(markerPath, nil, 0o644); err != nil {
+			return t, errors.New(errors.IO, fmt.Sprintf("failed to write file %q", markerPath), op, err)
+		}
+	}
+	if opts.toolchain != "" {
+		toolchainPath := filepath.Join(binDir, toolchainMarker)
+		if err := os.WriteFile(toolchainPath, []byte(opts.toolchain), 0o644); err != nil {
+			return t, errors.New(errors.IO, fmt.Sprintf("failed to write file %q", toolchainPath), op, err)
+		}
 	}
 
-	// Build step
+	c.logger.WithFields(logrus.Fields{
+		"tool":     t,
+		"path":     binPath,
+		"duration": duration,
+	}).Debug("tool installed with go install")
 
-	fp, err := downloadedTool.Filepath()
-	if err != nil {
-		return downloadedTool, err
+	if baseDir != c.toolsDir() {
+		if err := c.moveToCache(op, t, opts.target, nil, baseDir); err != nil {
+			return t, err
+		}
 	}
-	baseDir := c.toolsDir()
-	binDir := filepath.Join(baseDir, fp)
 
-	bfp, err := downloadedTool.BinaryFilepath()
-	if err != nil {
-		return downloadedTool, err
-	}
-	binPath := filepath.Join(baseDir, bfp)
+	c.progressf("Installed %s", t)
 
-	// Check if already built
-	if util.FileOrDirExists(binPath) {
-		c.logger.WithFields(logrus.Fields{
-			"tool": downloadedTool,
-			"path": binPath,
-		}).Debug("tool binary already exists, skipping build")
-		return downloadedTool, nil
+	if err := c.evict(op); err != nil {
+		return t, errors.New("failed to evict tools from cache", op, err)
 	}
+	return t, nil
+}
 
-	err = c.goClient.Build(ctx, downloadedTool.ImportPath, binPath, binDir)
+// validateBinary checks that the binary of tool t at binPath looks usable after it was built.
+// The go command can exit successfully without producing a working binary in some cases,
+// so this catches it at install time instead of when the tool is run.
+// The binary must exist, be non-empty, and be executable on platforms other than Windows.
+func validateBinary(op errors.Op, t tool.Tool, binPath string) error {
+	fi, err := os.Stat(binPath)
+	if os.IsNotExist(err) {
+		return errors.Errorf(errors.Internal, op, "building tool %s did not produce a binary at %q", t, binPath)
+	}
 	if err != nil {
-		return downloadedTool, errors.New(fmt.Sprintf("failed to build tool %s", downloadedTool), op, err)
+		return errors.Wrap(err, errors.IO, op, fmt.Sprintf("failed to check binary %q", binPath))
 	}
-
-	c.logger.WithFields(logrus.Fields{
-		"tool": downloadedTool,
-		"path": binPath,
-	}).Debug("tool built")
-	return downloadedTool, nil
+	if !fi.Mode().IsRegular() {
+		return errors.Errorf(errors.Internal, op, "binary %q for tool %s is not a regular file", binPath, t)
+	}
+	if fi.Size() == 0 {
+		return errors.Errorf(errors.Internal, op, "binary %q for tool %s is empty", binPath, t)
+	}
+	if runtime.GOOS != "windows" && fi.Mode().Perm()&0o111 == 0 {
+		return errors.Errorf(errors.Internal, op, "binary %q for tool %s is not executable", binPath, t)
+	}
+	return nil
 }
 
 // download does half the work of Install. It is responsible for downloading the tool
 // using go get -d. It does this by creating an empty go.mod which can then be used to install
 // the desired tool. If no version is specified for the tool, the latest version will be resolved
-// by go get.
+// by go get. If the resolved version has been retracted, the newest version that has not been
+// retracted is downloaded instead.
 //
 // go.mod files are stored in a directory the is represented by the tool import path.
 // For example if the import path is golang.org/x/tools/cmd/stringer then download will create
 // BASE_DIR/golang.org/x/tools/cmd/stringer@VERSION/go.mod where BASE_DIR is the baseDir parameter
 // and VERSION is the version of the tool (either explicit or resolved).
-func (c *Cache) download(ctx context.Context, op errors.Op, t tool.Tool) (tool.Tool, error) {
+//
+// toolchain is the Go version used in the go directive of the go.mod file. If it is empty,
+// the version of the installed Go toolchain is used.
+func (c *Cache) download(ctx context.Context, op errors.Op, t tool.Tool, baseDir, toolchain string) (tool.Tool, error) {
 	// Get the path to where the tool will be installed. This is where the go.mod file will be.
 	fp, err := t.Filepath()
 	if err != nil {
 		return t, err
 	}
-	modDir := filepath.Join(c.toolsDir(), fp)
+	modDir := filepath.Join(baseDir, fp)
 	modfilePath := filepath.Join(modDir, modfileName)
 
 	// If we have the version see if the tool already exists and whether or not we need to re-download it.
@@ -172,6 +1203,9 @@ func (c *Cache) download(ctx context.Context, op errors.Op, t tool.Tool) (tool.T
 	if t.HasSemver() {
 		modFile, err := readGoModFile(op, errors.BadState, modfilePath)
 		if modFile != nil {
+			if err := checkCaseCollision(op, modFile, t); err != nil {
+				return t, err
+			}
 			// Perform some additional validations specific to download
 			var mod module.Version
 			mod, err = getModule(op, errors.BadState, modFile, t)
@@ -221,16 +1255,22 @@ func (c *Cache) download(ctx context.Context, op errors.Op, t tool.Tool) (tool.T
 
 	// Create empty go.mod file so we can download the tool.
 	// Can just use _ as the module name since this is a "fake" module.
-	if err := createGoModFile(ctx, op, "_", modDir); err != nil {
+	if err := createGoModFile(ctx, op, "_", modDir, toolchain); err != nil {
 		return t, err
 	}
 
 	// Download the module source. What's nice here is we leverage the power of
 	// go get so we don't need to reinvent the module resolution & downloading.
 	// Also we can reuse an existing download that's already cached.
-	if err := c.goClient.GetD(ctx, t.Module(), modDir); err != nil {
+	c.progressf("Downloading %s", t)
+	start := time.Now()
+	if err := c.getD(ctx, t, modDir); err != nil {
 		return t, err
 	}
+	c.logger.WithFields(logrus.Fields{
+		"tool":     t,
+		"duration": time.Since(start),
+	}).Debug("tool downloaded")
 
 	// Need to read go.mod file so we can figure out what version was installed
 	modFile, err := readGoModFile(op, errors.Internal, modfilePath)
@@ -259,6 +1299,25 @@ func (c *Cache) download(ctx context.Context, op errors.Op, t tool.Tool) (tool.T
 		return t, errors.New(errors.Internal, fmt.Sprintf("no installed module found matching tool %s", t), op)
 	}
 
+	if t.Version == "" || t.Version == "latest" {
+		// The latest version might have been retracted, if so fall back to the newest version that isn't.
+		v, err := c.latestUnretracted(ctx, op, mod, modDir)
+		if err != nil {
+			return t, err
+		}
+		if v != mod.Version {
+			c.logger.WithFields(logrus.Fields{
+				"tool":      t,
+				"retracted": mod.Version,
+				"version":   v,
+			}).Debug("latest version is retracted, using newest version that is not retracted")
+			if err := os.RemoveAll(modDir); err != nil {
+				return t, errors.New(errors.IO, fmt.Sprintf("failed to remove directory %q", modDir), op, err)
+			}
+			return c.download(ctx, op, t.WithVersion(v), baseDir, toolchain)
+		}
+	}
+
 	if t.HasSemver() {
 		// Make sure we actually got the version we asked for
 		if mod.Version != t.Version {
@@ -266,13 +1325,13 @@ func (c *Cache) download(ctx context.Context, op errors.Op, t tool.Tool) (tool.T
 		}
 	} else {
 		// We got the version, now we need to rename the dir so it includes the version
-		t.Version = mod.Version
+		t = t.WithVersion(mod.Version)
 		vfp, err := t.Filepath()
 		if err != nil {
 			return t, err
 		}
 
-		modVersionDir := filepath.Join(c.toolsDir(), vfp)
+		modVersionDir := filepath.Join(baseDir, vfp)
 		if !util.FileOrDirExists(modVersionDir) {
 			if err := os.Rename(modDir, modVersionDir); err != nil {
 				return t, errors.New(errors.IO, fmt.Sprintf("failed to rename %q to %q", modDir, modVersionDir), op, err)
@@ -302,60 +1361,563 @@ func (c *Cache) download(ctx context.Context, op errors.Op, t tool.Tool) (tool.T
 	return t, nil
 }
 
-// ToolPath returns the absolute path the the installed binary for the given tool.
-// If the binary cannot be found, an error is returned.
-func (c *Cache) ToolPath(t tool.Tool) (string, error) {
-	bfp, err := t.BinaryFilepath()
+// getD downloads the module for t using the go client. If it fails because of a network
+// error, it is retried according to the retry policy set by WithRetry.
+func (c *Cache) getD(ctx context.Context, t tool.Tool, modDir string) error {
+	backoff := c.retryBackoff
+	for attempt := 1; ; attempt++ {
+		err := c.goClient.GetD(c.goContext(ctx), t.Module(), modDir)
+		if err == nil || attempt >= c.retryAttempts || !errors.Is(err, ErrNetwork) {
+			return err
+		}
+		c.logger.WithFields(logrus.Fields{
+			"tool":    t,
+			"attempt": attempt,
+			"backoff": backoff,
+			"error":   err,
+		}).Debug("failed to download tool because of a network error, retrying")
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		backoff *= 2
+	}
+}
+
+// ToolStatus describes the state of a tool in the cache.
+type ToolStatus int
+
+const (
+	// StatusInstalled means the tool has been downloaded and built.
+	StatusInstalled ToolStatus = iota
+	// StatusNotDownloaded means the tool has not been downloaded.
+	StatusNotDownloaded
+	// StatusVersionMismatch means the tool was downloaded, but the go.mod in the cache
+	// does not require the version of the tool, or is invalid.
+	StatusVersionMismatch
+	// StatusNotBuilt means the tool was downloaded, but the binary does not exist.
+	StatusNotBuilt
+)
+
+// String returns a description of the status.
+func (s ToolStatus) String() string {
+	switch s {
+	case StatusInstalled:
+		return "installed"
+	case StatusNotDownloaded:
+		return "not downloaded"
+	case StatusVersionMismatch:
+		return "version mismatch"
+	case StatusNotBuilt:
+		return "not built"
+	default:
+		return "unknown"
+	}
+}
+
+// Installed reports whether tool t is installed in the cache. A tool is installed if it
+// has been downloaded, that is it has a valid go.mod for the version of t, and has been built.
+// A non-nil error is only returned if an unexpected error occurs while checking,
+// if the tool is not installed false and a nil error are returned.
+// opts select which binary of t must be built, see ForBuildFlags.
+func (c *Cache) Installed(t tool.Tool, opts ...PathOption) (bool, error) {
+	status, err := c.Status(t, opts...)
 	if err != nil {
-		return "", err
+		return false, err
+	}
+	return status == StatusInstalled, nil
+}
+
+// Status reports the state of tool t in the cache. Unlike Installed, it reports why
+// a tool is not installed. Status never modifies the cache.
+// A non-nil error is only returned if an unexpected error occurs while checking.
+// opts select which binary of t must be built, see ForBuildFlags.
+func (c *Cache) Status(t tool.Tool, opts ...PathOption) (ToolStatus, error) {
+	pathOpts := newPathOptions(opts)
+	status, err := c.status(errors.Op("Cache.Status"), t, tool.Target{}, pathOpts.buildFlags)
+	if err == nil && status == StatusInstalled && !c.builtWithToolchain(c.toolsDir(), t, tool.Target{}, pathOpts.buildFlags, pathOpts.toolchain) {
+		return StatusNotBuilt, nil
+	}
+	return status, err
+}
+
+// installed is like Installed but checks for the binary built for target with buildFlags.
+func (c *Cache) installed(op errors.Op, t tool.Tool, target tool.Target, buildFlags []string) (bool, error) {
+	status, err := c.status(op, t, target, buildFlags)
+	if err != nil {
+		return false, err
+	}
+	return status == StatusInstalled, nil
+}
+
+// status does the actual work of Status. It checks for the binary built for target with buildFlags.
+func (c *Cache) status(op errors.Op, t tool.Tool, target tool.Target, buildFlags []string) (ToolStatus, error) {
+	fp, err := t.Filepath()
+	if err != nil {
+		return 0, err
+	}
+	modfilePath := filepath.Join(c.toolsDir(), fp, modfileName)
+	modFile, err := readGoModFile(op, errors.BadState, modfilePath)
+	if err != nil {
+		// An invalid modfile just means the tool needs to be re-installed
+		if rootErr := errors.Root(err); rootErr != nil && rootErr.Kind == errors.BadState {
+			c.logger.WithFields(logrus.Fields{
+				"tool":  t,
+				"error": err,
+			}).Debug("tool has invalid modfile")
+			return StatusVersionMismatch, nil
+		}
+		return 0, err
+	}
+	if modFile == nil {
+		// Tools downloaded from a binary release have no go.mod, only the binary needs to be checked.
+		if !c.installedFromRelease(fp) {
+			return StatusNotDownloaded, nil
+		}
+	} else {
+		mod, err := getModule(op, errors.BadState, modFile, t)
+		if err != nil || mod.Version != t.Version {
+			return StatusVersionMismatch, nil
+		}
+	}
+
+	bfp, err := binaryFilepath(t, target, buildFlags)
+	if err != nil {
+		return 0, err
 	}
 	binPath := filepath.Join(c.toolsDir(), bfp)
-	if !util.FileOrDirExists(binPath) {
-		return "", errors.New(
-			errors.NotInstalled,
-			fmt.Sprintf("binary for tool %s does not exist", t),
-			errors.Op("Cache.ToolPath"),
-		)
+	if _, err := os.Stat(binPath); err != nil {
+		if os.IsNotExist(err) {
+			return StatusNotBuilt, nil
+		}
+		return 0, errors.New(errors.IO, fmt.Sprintf("failed to check if %q exists", binPath), op, err)
 	}
-	return binPath, nil
+	return StatusInstalled, nil
 }
 
-// FindUpdate checks if there is a newer version available for tool t.
-// If no newer version is found, an empty string is returned.
-func (c *Cache) FindUpdate(ctx context.Context, t tool.Tool) (string, error) {
-	const op = errors.Op("Cache.FindUpdate")
+// Module returns the module that provides the installed tool t.
+// If t is not installed, an error with kind errors.NotInstalled is returned.
+func (c *Cache) Module(t tool.Tool) (module.Version, error) {
+	const op = errors.Op("Cache.Module")
 	fp, err := t.Filepath()
 	if err != nil {
-		return "", err
+		return module.Version{}, err
+	}
+	modfilePath := filepath.Join(c.toolsDir(), fp, modfileName)
+	modFile, err := readGoModFile(op, errors.BadState, modfilePath)
+	if err != nil {
+		return module.Version{}, err
+	}
+	if modFile == nil {
+		if c.installedFromRelease(fp) {
+			return module.Version{}, errors.New(errors.Invalid, fmt.Sprintf("tool %s was installed from a binary release and has no module", t), op)
+		}
+		return module.Version{}, errors.New(errors.NotInstalled, fmt.Sprintf("tool %s does not exist", t), op)
 	}
+	return getModule(op, errors.BadState, modFile, t)
+}
 
+// ModuleGoVersion returns the Go version declared by the go directive in the go.mod file
+// of the module that provides the installed tool t. If the module has no go directive,
+// for example because it predates modules, an empty string is returned.
+// If t is not installed, an error with kind errors.NotInstalled is returned.
+func (c *Cache) ModuleGoVersion(ctx context.Context, t tool.Tool) (string, error) {
+	const op = errors.Op("Cache.ModuleGoVersion")
+	mod, err := c.Module(t)
+	if err != nil {
+		return "", err
+	}
+	fp, err := t.Filepath()
+	if err != nil {
+		return "", err
+	}
 	c.logger.WithFields(logrus.Fields{
-		"tool": t,
-	}).Debug("finding module that tool belongs to")
-	dir := filepath.Join(c.toolsDir(), fp)
-	modfilePath := filepath.Join(dir, modfileName)
-	modFile, err := readGoModFile(op, errors.BadState, modfilePath)
+		"tool":   t,
+		"module": mod,
+	}).Debug("finding go version of module")
+	gm, err := c.goClient.List(c.goContext(ctx), mod.Path, filepath.Join(c.toolsDir(), fp))
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("failed to list module %s", mod.Path), op, err)
+	}
+	return gm.GoVersion, nil
+}
+
+// ModuleHash returns the hash of the content of the module that provides the installed tool t.
+// This is the 'h1:' hash recorded in go.sum when the module was downloaded. It can be passed to
+// WithHash to make sure future installs of t use the exact same module content.
+// If t is not installed, an error with kind errors.NotInstalled is returned.
+func (c *Cache) ModuleHash(t tool.Tool) (string, error) {
+	const op = errors.Op("Cache.ModuleHash")
+	mod, err := c.Module(t)
+	if err != nil {
+		return "", err
+	}
+	fp, err := t.Filepath()
+	if err != nil {
+		return "", err
+	}
+	return readModuleHash(op, filepath.Join(c.toolsDir(), fp), mod)
+}
+
+// BinaryHash returns the SHA-256 hash of the installed binary for tool t, in the form 'sha256:<hex digest>'.
+// The hash is only stable across installs if the tool was installed using WithReproducible, and is
+// specific to the platform and Go toolchain used to build it.
+// If t is not installed, an error with kind errors.NotInstalled is returned.
+// opts select which binary of t is hashed, see ForBuildFlags.
+func (c *Cache) BinaryHash(t tool.Tool, opts ...PathOption) (string, error) {
+	const op = errors.Op("Cache.BinaryHash")
+	binPath, err := c.toolPath(op, t, tool.Target{}, newPathOptions(opts))
 	if err != nil {
 		return "", err
 	}
+	f, err := os.Open(binPath)
+	if err != nil {
+		return "", errors.New(errors.IO, fmt.Sprintf("failed to open %q", binPath), op, err)
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", errors.New(errors.IO, fmt.Sprintf("failed to read %q", binPath), op, err)
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// builtReproducibly reports whether the binary of t for target built with buildFlags in baseDir
+// was built using WithReproducible.
+func (c *Cache) builtReproducibly(baseDir string, t tool.Tool, target tool.Target, buildFlags []string) bool {
+	bfp, err := binaryFilepath(t, target, buildFlags)
+	if err != nil {
+		return false
+	}
+	return util.FileOrDirExists(filepath.Join(baseDir, filepath.Dir(bfp), reproducibleMarker))
+}
+
+// toolchainMarker is the name of the file written next to a binary that was built with the Go toolchain
+// set by WithToolchain. It contains the version of the toolchain.
+const toolchainMarker = ".toolchain"
+
+// builtWithToolchain reports whether the binary of t for target built with buildFlags in baseDir was built
+// with the Go toolchain goVersion. If goVersion is empty, any toolchain is accepted.
+func (c *Cache) builtWithToolchain(baseDir string, t tool.Tool, target tool.Target, buildFlags []string, goVersion string) bool {
+	if goVersion == "" {
+		return true
+	}
+	bfp, err := binaryFilepath(t, target, buildFlags)
+	if err != nil {
+		return false
+	}
+	data, err := os.ReadFile(filepath.Join(baseDir, filepath.Dir(bfp), toolchainMarker))
+	return err == nil && string(data) == goVersion
+}
+
+// buildFlagsMarker is the name of the file written next to a binary that was built with build flags.
+// It contains the flags separated by NUL bytes.
+const buildFlagsMarker = ".build-flags"
+
+// builtWithBuildFlags reports whether the binary of t for target in baseDir was built with exactly buildFlags.
+// The directory of the binary already depends on the flags, but the flags are recorded as well so that a binary
+// built with different flags is never used, regardless of how binaries are laid out.
+func (c *Cache) builtWithBuildFlags(baseDir string, t tool.Tool, target tool.Target, buildFlags []string) bool {
+	bfp, err := binaryFilepath(t, target, buildFlags)
+	if err != nil {
+		return false
+	}
+	data, err := os.ReadFile(filepath.Join(baseDir, filepath.Dir(bfp), buildFlagsMarker))
+	if os.IsNotExist(err) {
+		// Binaries built without build flags have no marker
+		return len(buildFlags) == 0
+	}
+	return err == nil && string(data) == strings.Join(buildFlags, "\x00")
+}
+
+// upToDate reports whether the binary of t in baseDir was built the way opts require, that is with the
+// build flags from WithBuildFlags, reproducibly if WithReproducible was used, and with the toolchain from
+// WithToolchain. Otherwise it must be rebuilt.
+func (c *Cache) upToDate(baseDir string, t tool.Tool, opts installOptions) bool {
+	if !c.builtWithBuildFlags(baseDir, t, opts.target, opts.buildFlags) {
+		return false
+	}
+	if opts.reproducible && !c.builtReproducibly(baseDir, t, opts.target, opts.buildFlags) {
+		return false
+	}
+	return c.builtWithToolchain(baseDir, t, opts.target, opts.buildFlags, opts.toolchain)
+}
+
+// reproducibleGoFlags returns the GOFLAGS environment variable to use for reproducible builds.
+// Any flags set by the user or using WithEnv are kept.
+func (c *Cache) reproducibleGoFlags() string {
+	goflags := os.Getenv("GOFLAGS")
+	for _, kv := range c.env {
+		if strings.HasPrefix(kv, "GOFLAGS=") {
+			goflags = strings.TrimPrefix(kv, "GOFLAGS=")
+		}
+	}
+	return "GOFLAGS=" + strings.TrimSpace(goflags+" -trimpath")
+}
+
+// goContext returns a copy of ctx that sets the environment variables from WithEnv when running the go command.
+// They are set before any variables already in ctx, so that variables for specific tools take precedence.
+func (c *Cache) goContext(ctx context.Context) context.Context {
+	if len(c.env) == 0 {
+		return ctx
+	}
+	env := append(append([]string(nil), c.env...), GoEnv(ctx)...)
+	return context.WithValue(ctx, goEnvKey{}, env)
+}
+
+// verifyHash checks that the module of the downloaded tool t in baseDir has the hash want.
+// If want is empty, nothing is checked.
+func (c *Cache) verifyHash(op errors.Op, baseDir string, t tool.Tool, want string) error {
+	if want == "" {
+		return nil
+	}
+	fp, err := t.Filepath()
+	if err != nil {
+		return err
+	}
+	modDir := filepath.Join(baseDir, fp)
+	modFile, err := readGoModFile(op, errors.BadState, filepath.Join(modDir, modfileName))
+	if err != nil {
+		return err
+	}
 	if modFile == nil {
-		return "", errors.New(errors.NotInstalled, fmt.Sprintf("tool %s does not exist", t), op)
+		return errors.New(errors.BadState, fmt.Sprintf("cannot verify hash of tool %s, it has not been downloaded", t), op)
 	}
 	mod, err := getModule(op, errors.BadState, modFile, t)
+	if err != nil {
+		return err
+	}
+	got, err := readModuleHash(op, modDir, mod)
+	if err != nil {
+		return err
+	}
+	if got != want {
+		msg := fmt.Sprintf("hash of module %s for tool %s does not match, expected %s but got %s", mod, t, want, got)
+		return errors.New(errors.BadState, msg, op)
+	}
+	c.logger.WithFields(logrus.Fields{
+		"tool": t,
+		"hash": got,
+	}).Debug("verified module hash")
+	return nil
+}
+
+// ToolPath returns the absolute path the the installed binary for the given tool.
+// If the binary does not exist, an error is returned.
+// Only the binary is checked since ToolPath is called every time a tool is run,
+// use Installed to also check that the module of the tool was downloaded.
+// opts select which binary of t is used, see ForBuildFlags.
+func (c *Cache) ToolPath(t tool.Tool, opts ...PathOption) (string, error) {
+	return c.toolPath(errors.Op("Cache.ToolPath"), t, tool.Target{}, newPathOptions(opts))
+}
+
+// TargetToolPath is like ToolPath but returns the path to the binary that was built for target
+// by installing with WithTarget.
+func (c *Cache) TargetToolPath(t tool.Tool, target tool.Target, opts ...PathOption) (string, error) {
+	const op = errors.Op("Cache.TargetToolPath")
+	if err := target.Validate(); err != nil {
+		return "", errors.New(fmt.Sprintf("invalid target for tool %s", t), op, err)
+	}
+	return c.toolPath(op, t, target, newPathOptions(opts))
+}
+
+// toolPath does the actual work of ToolPath and TargetToolPath.
+func (c *Cache) toolPath(op errors.Op, t tool.Tool, target tool.Target, pathOpts pathOptions) (string, error) {
+	buildFlags := pathOpts.buildFlags
+	bfp, err := binaryFilepath(t, target, buildFlags)
 	if err != nil {
 		return "", err
 	}
+	binPath := filepath.Join(c.toolsDir(), bfp)
+	if _, err := os.Stat(binPath); err != nil {
+		if !os.IsNotExist(err) {
+			return "", errors.New(errors.IO, fmt.Sprintf("failed to check if %q exists", binPath), op, err)
+		}
+		msg := fmt.Sprintf("binary for tool %s does not exist", t)
+		if !target.IsHost() {
+			msg = fmt.Sprintf("binary for tool %s and target %s does not exist", t, target)
+		}
+		return "", errors.New(errors.NotInstalled, msg, op)
+	}
+	if !c.builtWithToolchain(c.toolsDir(), t, target, buildFlags, pathOpts.toolchain) {
+		return "", errors.New(errors.NotInstalled, fmt.Sprintf("binary for tool %s was not built with go%s", t, pathOpts.toolchain), op)
+	}
+	return binPath, nil
+}
+
+// AliasToolPath is like ToolPath but returns the path to the binary that was installed under alias
+// by installing with WithAlias. If alias is empty, AliasToolPath is the same as ToolPath.
+func (c *Cache) AliasToolPath(t tool.Tool, alias string, opts ...PathOption) (string, error) {
+	const op = errors.Op("Cache.AliasToolPath")
+	pathOpts := newPathOptions(opts)
+	buildFlags := pathOpts.buildFlags
+	if alias == "" {
+		return c.toolPath(op, t, tool.Target{}, pathOpts)
+	}
+	afp, err := aliasBinaryFilepath(t, alias, buildFlags)
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("invalid alias for tool %s", t), op, err)
+	}
+	aliasPath := filepath.Join(c.toolsDir(), afp)
+	if !util.FileOrDirExists(aliasPath) {
+		return "", errors.New(errors.NotInstalled, fmt.Sprintf("binary for tool %s with alias %s does not exist", t, alias), op)
+	}
+	if !c.builtWithToolchain(c.toolsDir(), t, tool.Target{}, buildFlags, pathOpts.toolchain) {
+		return "", errors.New(errors.NotInstalled, fmt.Sprintf("binary for tool %s was not built with go%s", t, pathOpts.toolchain), op)
+	}
+	return aliasPath, nil
+}
+
+// aliasBinaryFilepath is like tool.Tool.AliasBinaryFilepath but for the binary built with buildFlags.
+// The alias directory is placed in the directory of the binary, see binaryFilepath.
+func aliasBinaryFilepath(t tool.Tool, alias string, buildFlags []string) (string, error) {
+	afp, err := t.AliasBinaryFilepath(alias)
+	if err != nil || len(buildFlags) == 0 {
+		return afp, err
+	}
+	aliasDir, name := filepath.Split(afp)
+	toolDir, aliasDirName := filepath.Split(filepath.Clean(aliasDir))
+	return filepath.Join(toolDir, buildFlagsDir(buildFlags), aliasDirName, name), nil
+}
+
+// installAlias makes the installed binary of tool t built with buildFlags available under alias.
+// The binary is hard linked if possible, otherwise it is copied.
+func (c *Cache) installAlias(op errors.Op, t tool.Tool, alias string, buildFlags []string) error {
+	bfp, err := binaryFilepath(t, tool.Target{}, buildFlags)
+	if err != nil {
+		return err
+	}
+	afp, err := aliasBinaryFilepath(t, alias, buildFlags)
+	if err != nil {
+		return errors.New(fmt.Sprintf("invalid alias for tool %s", t), op, err)
+	}
+	binPath := filepath.Join(c.toolsDir(), bfp)
+	aliasPath := filepath.Join(c.toolsDir(), afp)
+	if err := os.MkdirAll(filepath.Dir(aliasPath), 0o755); err != nil {
+		return errors.New(errors.IO, fmt.Sprintf("failed to create directory %q", filepath.Dir(aliasPath)), op, err)
+	}
+	// Always replace the alias, since the binary may have been rebuilt.
+	if err := os.Remove(aliasPath); err != nil && !os.IsNotExist(err) {
+		return errors.New(errors.IO, fmt.Sprintf("failed to remove file %q", aliasPath), op, err)
+	}
+	if err := os.Link(binPath, aliasPath); err == nil {
+		return nil
+	}
+
+	// Hard links are not supported by all filesystems, fallback to copying.
+	in, err := os.Open(binPath)
+	if err != nil {
+		return errors.New(errors.IO, fmt.Sprintf("failed to open file %q", binPath), op, err)
+	}
+	defer in.Close()
+	err = util.WriteFileAtomic(aliasPath, 0o755, func(w io.Writer) error {
+		_, err := io.Copy(w, in)
+		return err
+	})
+	if err != nil {
+		return errors.New(errors.IO, fmt.Sprintf("failed to copy %q to %q", binPath, aliasPath), op, err)
+	}
+	c.logger.WithFields(logrus.Fields{
+		"tool":  t,
+		"alias": alias,
+	}).Debug("copied tool binary to alias")
+	return nil
+}
+
+// latestUnretracted returns the newest version of mod that has not been retracted.
+// If mod.Version has not been retracted, it is returned as is.
+func (c *Cache) latestUnretracted(ctx context.Context, op errors.Op, mod module.Version, dir string) (string, error) {
+	// Pseudo-versions are never listed so there is no way to tell if they are retracted.
+	if module.IsPseudoVersion(mod.Version) {
+		return mod.Version, nil
+	}
+	gm, err := c.goClient.ListVersions(c.goContext(ctx), mod.Path, dir)
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("failed to list versions of %s", mod.Path), op, err)
+	}
+	// Same as go, prefer releases over pre-releases.
+	var latestRelease, latestPrerelease string
+	for _, v := range gm.Versions {
+		if v == mod.Version {
+			return mod.Version, nil
+		}
+		if semver.Prerelease(v) == "" {
+			if semver.Compare(v, latestRelease) > 0 {
+				latestRelease = v
+			}
+		} else if semver.Compare(v, latestPrerelease) > 0 {
+			latestPrerelease = v
+		}
+	}
+	if latestRelease != "" {
+		return latestRelease, nil
+	}
+	if latestPrerelease != "" {
+		return latestPrerelease, nil
+	}
+	// All versions are retracted, nothing better to use.
+	return mod.Version, nil
+}
+
+// FindUpdate checks if there is a newer version available for tool t.
+// If no newer version is found, an empty string is returned.
+// Tools with a pseudo-version are pinned to a commit, so no update is ever found for them.
+//
+// To check multiple tools, use an UpdateChecker instead to avoid checking the same module multiple times.
+func (c *Cache) FindUpdate(ctx context.Context, t tool.Tool) (string, error) {
+	return c.NewUpdateChecker().FindUpdate(ctx, t)
+}
 
+// FindModuleUpdate is like FindUpdate but uses modulePath as the module that provides tool t
+// instead of resolving it from the installed go.mod file. This is useful if the module is
+// already known, for example because it is recorded in the lockfile.
+func (c *Cache) FindModuleUpdate(ctx context.Context, t tool.Tool, modulePath string) (string, error) {
+	return c.NewUpdateChecker().FindModuleUpdate(ctx, t, modulePath)
+}
+
+// findUpdate checks if module modPath has a newer version using the go.mod file in dir.
+func (c *Cache) findUpdate(ctx context.Context, op errors.Op, t tool.Tool, modPath, dir string) (string, error) {
 	c.logger.WithFields(logrus.Fields{
 		"tool":   t,
-		"module": mod,
+		"module": modPath,
 	}).Debug("finding latest version of tool")
-	gm, err := c.goClient.ListU(ctx, mod.Path, dir)
+	gm, err := c.goClient.ListU(c.goContext(ctx), modPath, dir)
 	if err != nil {
-		return "", errors.New(fmt.Sprintf("failed to list module update for %s", mod.Path), op, err)
+		return "", errors.New(fmt.Sprintf("failed to list module update for %s", modPath), op, err)
 	}
 	if gm.Update == nil {
 		return "", nil
 	}
 	return gm.Update.Version, nil
 }
+
+// findMajorUpdate returns the newest version of mod that has the same major version as mod.Version
+// and is newer than it. If there is no such version, an empty string is returned.
+// Same as go, releases are preferred over pre-releases.
+func (c *Cache) findMajorUpdate(ctx context.Context, op errors.Op, mod module.Version, dir string) (string, error) {
+	gm, err := c.goClient.ListVersions(c.goContext(ctx), mod.Path, dir)
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("failed to list versions of %s", mod.Path), op, err)
+	}
+	major := semver.Major(mod.Version)
+	var latestRelease, latestPrerelease string
+	for _, v := range gm.Versions {
+		if semver.Major(v) != major || semver.Compare(v, mod.Version) <= 0 {
+			continue
+		}
+		if semver.Prerelease(v) == "" {
+			if semver.Compare(v, latestRelease) > 0 {
+				latestRelease = v
+			}
+		} else if semver.Compare(v, latestPrerelease) > 0 {
+			latestPrerelease = v
+		}
+	}
+	if latestRelease != "" {
+		return latestRelease, nil
+	}
+	return latestPrerelease, nil
+}
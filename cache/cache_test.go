@@ -0,0 +1,2467 @@
+package cache_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/cszatmary/shed/cache"
+	"github.com/cszatmary/shed/errors"
+	"github.com/cszatmary/shed/internal/util"
+	"github.com/cszatmary/shed/tool"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+var availableTools = map[string]map[string]string{
+	"github.com/cszatmary/go-fish": {
+		"v0.1.0": "v0.1.0",
+	},
+	"github.com/golangci/golangci-lint/cmd/golangci-lint": {
+		"v1.33.0": "v1.33.0",
+		"v1.28.3": "v1.28.3",
+	},
+	"github.com/Shopify/ejson/cmd/ejson": {
+		"v1.2.2": "v1.2.2",
+		"v1.1.0": "v1.1.0",
+	},
+	"golang.org/x/tools/cmd/stringer": {
+		"v0.1.0": "v0.1.0",
+		"v0.1.5": "v0.1.5",
+	},
+	"golang.org/x/tools/cmd/goimports": {
+		"v0.1.0": "v0.1.0",
+		"v0.1.5": "v0.1.5",
+	},
+}
+
+func newCache(t *testing.T, dir string, opts ...cache.Option) *cache.Cache {
+	mockGo, err := cache.NewMockGo(availableTools)
+	if err != nil {
+		t.Fatalf("failed to create mock go %v", err)
+	}
+	return cache.New(dir, append([]cache.Option{cache.WithGo(mockGo)}, opts...)...)
+}
+
+func TestCacheLayoutVersion(t *testing.T) {
+	tests := []struct {
+		name        string
+		existing    string
+		wantVersion int
+	}{
+		{
+			name:        "unversioned cache",
+			existing:    "",
+			wantVersion: 2,
+		},
+		{
+			name:        "version 1",
+			existing:    "1\n",
+			wantVersion: 2,
+		},
+		{
+			name:        "current version",
+			existing:    "2\n",
+			wantVersion: 2,
+		},
+		{
+			name:        "newer version is left alone",
+			existing:    "99\n",
+			wantVersion: 99,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			td := t.TempDir()
+			if tt.existing != "" {
+				if err := os.WriteFile(filepath.Join(td, "layout-version"), []byte(tt.existing), 0o644); err != nil {
+					t.Fatalf("failed to write layout version: %v", err)
+				}
+			}
+
+			c := newCache(t, td)
+			_, err := c.Install(context.Background(), tool.Tool{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"})
+			if err != nil {
+				t.Fatalf("want nil error, got %v", err)
+			}
+			v, err := c.LayoutVersion()
+			if err != nil {
+				t.Errorf("want nil error, got %v", err)
+			}
+			if v != tt.wantVersion {
+				t.Errorf("got layout version %d, want %d", v, tt.wantVersion)
+			}
+		})
+	}
+}
+
+func TestCacheLayoutMigrateAliases(t *testing.T) {
+	td := t.TempDir()
+	goFish := tool.Tool{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"}
+	c := newCache(t, td)
+	if _, err := c.Install(context.Background(), goFish, cache.WithBuildFlags("-tags=netgo")); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if _, err := c.Install(context.Background(), goFish); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	flagsBinPath, err := c.ToolPath(goFish, cache.ForBuildFlags("-tags=netgo"))
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	binPath, err := c.ToolPath(goFish)
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+
+	// Layout version 1 installed aliases next to the binary
+	legacyAliases := []string{
+		filepath.Join(filepath.Dir(binPath), "fish"),
+		filepath.Join(filepath.Dir(flagsBinPath), "fish"),
+	}
+	for _, p := range legacyAliases {
+		if err := os.WriteFile(p, []byte("alias"), 0o755); err != nil {
+			t.Fatalf("failed to write alias %v", err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(td, "layout-version"), []byte("1\n"), 0o644); err != nil {
+		t.Fatalf("failed to write layout version: %v", err)
+	}
+
+	c = newCache(t, td)
+	if _, err := c.Install(context.Background(), goFish, cache.WithAlias("fish")); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	for _, p := range legacyAliases {
+		if util.FileOrDirExists(p) {
+			t.Errorf("want legacy alias %s to be removed", p)
+		}
+	}
+	for _, opt := range []cache.PathOption{cache.ForBuildFlags(), cache.ForBuildFlags("-tags=netgo")} {
+		if installed, err := c.Installed(goFish, opt); err != nil || !installed {
+			t.Errorf("got installed %t, %v, want true, nil", installed, err)
+		}
+	}
+	if _, err := c.AliasToolPath(goFish, "fish"); err != nil {
+		t.Errorf("want nil error, got %v", err)
+	}
+}
+
+func TestCacheClean(t *testing.T) {
+	td := t.TempDir()
+	c := newCache(t, td)
+	goFish := tool.Tool{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"}
+	if _, err := c.Install(context.Background(), goFish); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+
+	// Cleaning while installing must not race, run with -race to check
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			// The install may fail if the directory is removed while installing
+			_, _ = c.Install(context.Background(), goFish)
+		}()
+		go func() {
+			defer wg.Done()
+			// Removing the directory may fail if files are written to it while it is removed
+			_ = c.Clean()
+		}()
+	}
+	wg.Wait()
+
+	if err := c.Clean(); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if util.FileOrDirExists(td) {
+		t.Errorf("want cache dir %s to be removed", td)
+	}
+	// The layout is checked again after cleaning
+	if _, err := c.Install(context.Background(), goFish); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if v, err := c.LayoutVersion(); err != nil || v != 2 {
+		t.Errorf("got layout version %d, %v, want 2, nil", v, err)
+	}
+}
+
+func TestCacheDirTag(t *testing.T) {
+	td := t.TempDir()
+	c := newCache(t, td)
+	_, err := c.Install(context.Background(), tool.Tool{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"})
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	b, err := os.ReadFile(filepath.Join(td, "CACHEDIR.TAG"))
+	if err != nil {
+		t.Fatalf("failed to read CACHEDIR.TAG %v", err)
+	}
+	// The spec requires the file to start with this exact signature
+	const signature = "Signature: 8a477f597d28d172789f06886806bc55"
+	if !strings.HasPrefix(string(b), signature) {
+		t.Errorf("got CACHEDIR.TAG contents %q, want prefix %q", b, signature)
+	}
+}
+
+func TestCacheLayoutVersionMissingDir(t *testing.T) {
+	c := newCache(t, filepath.Join(t.TempDir(), "does-not-exist"))
+	v, err := c.LayoutVersion()
+	if err != nil {
+		t.Errorf("want nil error, got %v", err)
+	}
+	if v != 0 {
+		t.Errorf("got layout version %d, want 0", v)
+	}
+}
+
+// installTools installs tools into a cache in dir and returns the size of each tool dir.
+func installTools(t *testing.T, dir string, tools []tool.Tool) map[tool.Tool]int64 {
+	c := newCache(t, dir)
+	sizes := make(map[tool.Tool]int64)
+	for _, tl := range tools {
+		if _, err := c.Install(context.Background(), tl); err != nil {
+			t.Fatalf("failed to install tool %v: %v", tl, err)
+		}
+		fp, err := tl.Filepath()
+		if err != nil {
+			t.Fatalf("failed to get filepath of tool %v: %v", tl, err)
+		}
+		var size int64
+		err = filepath.WalkDir(filepath.Join(dir, "tools", fp), func(p string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			fi, err := d.Info()
+			if err != nil {
+				return err
+			}
+			size += fi.Size()
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("failed to compute size of tool %v: %v", tl, err)
+		}
+		sizes[tl] = size
+	}
+	return sizes
+}
+
+func TestCacheInstallEvict(t *testing.T) {
+	goFish := tool.Tool{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"}
+	lint := tool.Tool{ImportPath: "github.com/golangci/golangci-lint/cmd/golangci-lint", Version: "v1.33.0"}
+	oldLint := tool.Tool{ImportPath: "github.com/golangci/golangci-lint/cmd/golangci-lint", Version: "v1.28.3"}
+	ejson := tool.Tool{ImportPath: "github.com/Shopify/ejson/cmd/ejson", Version: "v1.2.2"}
+
+	tests := []struct {
+		name        string
+		protected   []tool.Tool
+		wantEvicted []tool.Tool
+	}{
+		{
+			name:        "evicts least recently used",
+			wantEvicted: []tool.Tool{goFish},
+		},
+		{
+			name:        "does not evict protected tools",
+			protected:   []tool.Tool{goFish},
+			wantEvicted: []tool.Tool{lint},
+		},
+		{
+			name:        "evicts nothing if all are protected",
+			protected:   []tool.Tool{goFish, lint, oldLint},
+			wantEvicted: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			td := t.TempDir()
+			// Install ejson in a separate cache to figure out its size
+			ejsonSize := installTools(t, t.TempDir(), []tool.Tool{ejson})[ejson]
+			existing := []tool.Tool{goFish, lint, oldLint}
+			sizes := installTools(t, td, existing)
+
+			// Make the tools have different mod times, from oldest to newest
+			now := time.Now()
+			for i, tl := range existing {
+				bfp, err := tl.BinaryFilepath()
+				if err != nil {
+					t.Fatalf("failed to get binary filepath of tool %v: %v", tl, err)
+				}
+				modTime := now.Add(time.Duration(i-len(existing)) * time.Hour)
+				if err := os.Chtimes(filepath.Join(td, "tools", bfp), modTime, modTime); err != nil {
+					t.Fatalf("failed to change mod time of tool %v: %v", tl, err)
+				}
+			}
+
+			// Max size is set so that a single tool needs to be evicted
+			maxSize := ejsonSize + sizes[goFish] + sizes[lint] + sizes[oldLint] - 1
+			c := newCache(t, td, cache.WithMaxSize(maxSize))
+			c.Protect(tt.protected...)
+			if _, err := c.Install(context.Background(), ejson); err != nil {
+				t.Fatalf("want nil error, got %v", err)
+			}
+
+			evicted := make(map[tool.Tool]bool)
+			for _, tl := range tt.wantEvicted {
+				evicted[tl] = true
+			}
+			for _, tl := range append(existing, ejson) {
+				_, err := c.ToolPath(tl)
+				if evicted[tl] && err == nil {
+					t.Errorf("want tool %v to be evicted, but it exists", tl)
+				} else if !evicted[tl] && err != nil {
+					t.Errorf("want tool %v to exist, got %v", tl, err)
+				}
+			}
+		})
+	}
+}
+
+func TestCacheInstallEvictVariants(t *testing.T) {
+	goFish := tool.Tool{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"}
+	lint := tool.Tool{ImportPath: "github.com/golangci/golangci-lint/cmd/golangci-lint", Version: "v1.33.0"}
+	ejson := tool.Tool{ImportPath: "github.com/Shopify/ejson/cmd/ejson", Version: "v1.2.2"}
+	windows := tool.Target{GOOS: "windows", GOARCH: "amd64"}
+	td := t.TempDir()
+	c := newCache(t, td)
+	// Neither tool has a host binary built without build flags
+	if _, err := c.Install(context.Background(), goFish, cache.WithTarget(windows)); err != nil {
+		t.Fatalf("failed to install tool %v: %v", goFish, err)
+	}
+	if _, err := c.Install(context.Background(), lint, cache.WithBuildFlags("-tags=netgo")); err != nil {
+		t.Fatalf("failed to install tool %v: %v", lint, err)
+	}
+
+	// Every tool other than the one being installed needs to be evicted
+	c = newCache(t, td, cache.WithMaxSize(1))
+	if _, err := c.Install(context.Background(), ejson); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if _, err := c.TargetToolPath(goFish, windows); err == nil {
+		t.Errorf("want tool %v to be evicted, but it exists", goFish)
+	}
+	if _, err := c.ToolPath(lint, cache.ForBuildFlags("-tags=netgo")); err == nil {
+		t.Errorf("want tool %v to be evicted, but it exists", lint)
+	}
+	if _, err := c.ToolPath(ejson); err != nil {
+		t.Errorf("want tool %v to exist, got %v", ejson, err)
+	}
+}
+
+func TestCachePrune(t *testing.T) {
+	goFish := tool.Tool{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"}
+	lint := tool.Tool{ImportPath: "github.com/golangci/golangci-lint/cmd/golangci-lint", Version: "v1.33.0"}
+	oldLint := tool.Tool{ImportPath: "github.com/golangci/golangci-lint/cmd/golangci-lint", Version: "v1.28.3"}
+	ejson := tool.Tool{ImportPath: "github.com/Shopify/ejson/cmd/ejson", Version: "v1.2.2"}
+	td := t.TempDir()
+	installTools(t, td, []tool.Tool{goFish, lint, oldLint, ejson})
+
+	c := newCache(t, td)
+	c.Protect(ejson)
+	removed, err := c.Prune([]tool.Tool{lint})
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	wantRemoved := map[tool.Tool]bool{goFish: true, oldLint: true}
+	if len(removed) != len(wantRemoved) {
+		t.Errorf("got removed tools %v, want %v", removed, wantRemoved)
+	}
+	for _, tl := range removed {
+		if !wantRemoved[tl] {
+			t.Errorf("want tool %v to not be removed", tl)
+		}
+	}
+	for _, tl := range []tool.Tool{goFish, lint, oldLint, ejson} {
+		fp, err := tl.Filepath()
+		if err != nil {
+			t.Fatalf("failed to get filepath of tool %v: %v", tl, err)
+		}
+		exists := util.FileOrDirExists(filepath.Join(td, "tools", fp))
+		if exists == wantRemoved[tl] {
+			t.Errorf("got exists %t for tool %v, want %t", exists, tl, !wantRemoved[tl])
+		}
+	}
+
+	// Nothing left to prune
+	removed, err = c.Prune([]tool.Tool{lint})
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if len(removed) != 0 {
+		t.Errorf("got removed tools %v, want none", removed)
+	}
+}
+
+// blockingGetDGo is a cache.Go that blocks in GetD until release is closed.
+type blockingGetDGo struct {
+	cache.Go
+	started chan struct{}
+	release chan struct{}
+}
+
+func (g *blockingGetDGo) GetD(ctx context.Context, mod, dir string) error {
+	close(g.started)
+	<-g.release
+	return g.Go.GetD(ctx, mod, dir)
+}
+
+func TestCachePruneConcurrentInstall(t *testing.T) {
+	lint := tool.Tool{ImportPath: "github.com/golangci/golangci-lint/cmd/golangci-lint", Version: "v1.33.0"}
+	oldLint := tool.Tool{ImportPath: "github.com/golangci/golangci-lint/cmd/golangci-lint", Version: "v1.28.3"}
+	td := t.TempDir()
+	installTools(t, td, []tool.Tool{oldLint})
+
+	mockGo, err := cache.NewMockGo(availableTools)
+	if err != nil {
+		t.Fatalf("failed to create mock go %v", err)
+	}
+	bg := &blockingGetDGo{Go: mockGo, started: make(chan struct{}), release: make(chan struct{})}
+	c := cache.New(td, cache.WithGo(bg))
+
+	// Install holds the lock for all versions of the tool while it is downloading,
+	// so Prune has to wait for it to finish before removing the old version.
+	installErr := make(chan error, 1)
+	go func() {
+		_, err := c.Install(context.Background(), lint)
+		installErr <- err
+	}()
+	<-bg.started
+	type pruneResult struct {
+		removed []tool.Tool
+		err     error
+	}
+	pruneCh := make(chan pruneResult, 1)
+	go func() {
+		removed, err := c.Prune([]tool.Tool{lint})
+		pruneCh <- pruneResult{removed, err}
+	}()
+	// Give Prune time to start waiting for the tool lock
+	time.Sleep(50 * time.Millisecond)
+	close(bg.release)
+
+	timeout := time.After(5 * time.Second)
+	select {
+	case err := <-installErr:
+		if err != nil {
+			t.Errorf("want nil error from Install, got %v", err)
+		}
+	case <-timeout:
+		t.Fatal("timed out waiting for Install, Install and Prune are deadlocked")
+	}
+	select {
+	case res := <-pruneCh:
+		if res.err != nil {
+			t.Errorf("want nil error from Prune, got %v", res.err)
+		}
+		if want := []tool.Tool{oldLint}; !reflect.DeepEqual(res.removed, want) {
+			t.Errorf("got removed tools %v, want %v", res.removed, want)
+		}
+	case <-timeout:
+		t.Fatal("timed out waiting for Prune, Install and Prune are deadlocked")
+	}
+	if installed, err := c.Installed(lint); err != nil || !installed {
+		t.Errorf("got installed %t, %v for %v, want true, nil", installed, err, lint)
+	}
+}
+
+func TestCacheInstallLockCancelled(t *testing.T) {
+	lint := tool.Tool{ImportPath: "github.com/golangci/golangci-lint/cmd/golangci-lint", Version: "v1.33.0"}
+	oldLint := tool.Tool{ImportPath: "github.com/golangci/golangci-lint/cmd/golangci-lint", Version: "v1.28.3"}
+	td := t.TempDir()
+	mockGo, err := cache.NewMockGo(availableTools)
+	if err != nil {
+		t.Fatalf("failed to create mock go %v", err)
+	}
+	bg := &blockingGetDGo{Go: mockGo, started: make(chan struct{}), release: make(chan struct{})}
+	c := cache.New(td, cache.WithGo(bg))
+	installErr := make(chan error, 1)
+	go func() {
+		_, err := c.Install(context.Background(), lint)
+		installErr <- err
+	}()
+	<-bg.started
+
+	// Another process using the same cache must stop waiting for the lock once its context is done
+	other := cache.New(td, cache.WithGo(mockGo))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	otherErr := make(chan error, 1)
+	go func() {
+		_, err := other.Install(ctx, oldLint)
+		otherErr <- err
+	}()
+	select {
+	case err := <-otherErr:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("got err %v, want %v", err, context.DeadlineExceeded)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for Install, context was ignored while waiting for the lock")
+	}
+
+	close(bg.release)
+	if err := <-installErr; err != nil {
+		t.Errorf("want nil error, got %v", err)
+	}
+	// The lock is released once the first install is done
+	if _, err := other.Install(context.Background(), oldLint); err != nil {
+		t.Errorf("want nil error, got %v", err)
+	}
+}
+
+func TestCachePruneEmpty(t *testing.T) {
+	c := newCache(t, filepath.Join(t.TempDir(), "missing"))
+	removed, err := c.Prune(nil)
+	if err != nil {
+		t.Errorf("want nil error, got %v", err)
+	}
+	if len(removed) != 0 {
+		t.Errorf("got removed tools %v, want none", removed)
+	}
+}
+
+func TestCacheSize(t *testing.T) {
+	td := t.TempDir()
+	c := newCache(t, filepath.Join(td, "cache"))
+	size, err := c.Size()
+	if err != nil {
+		t.Fatalf("want nil error for missing cache, got %v", err)
+	}
+	if size != 0 {
+		t.Errorf("got size %d for missing cache, want 0", size)
+	}
+
+	goFish := tool.Tool{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"}
+	if _, err := c.Install(context.Background(), goFish); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	var want int64
+	err = filepath.WalkDir(c.Dir(), func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		want += fi.Size()
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to walk cache dir %v", err)
+	}
+	size, err = c.Size()
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if size != want || size == 0 {
+		t.Errorf("got size %d, want %d", size, want)
+	}
+}
+
+func TestCacheInstallCaseCollision(t *testing.T) {
+	td := t.TempDir()
+	c := newCache(t, td)
+	ejson := tool.Tool{ImportPath: "github.com/Shopify/ejson/cmd/ejson", Version: "v1.2.2"}
+	if _, err := c.Install(context.Background(), ejson); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+
+	// Simulate a module whose path only differs in case being stored in the same directory
+	fp, err := ejson.Filepath()
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	modfile := "module _\n\ngo 1.17\n\nrequire github.com/shopify/ejson v1.2.2\n"
+	if err := os.WriteFile(filepath.Join(td, "tools", fp, "go.mod"), []byte(modfile), 0o644); err != nil {
+		t.Fatalf("failed to write go.mod: %v", err)
+	}
+
+	_, err = c.Install(context.Background(), ejson)
+	if rootErr := errors.Root(err); rootErr == nil || rootErr.Kind != errors.Internal {
+		t.Errorf("want internal error, got %v", err)
+	}
+}
+
+func TestCacheInstallLatestRetracted(t *testing.T) {
+	mockGo, err := cache.NewMockGo(
+		availableTools,
+		cache.WithMockRetracted("github.com/golangci/golangci-lint/cmd/golangci-lint", "v1.33.0"),
+	)
+	if err != nil {
+		t.Fatalf("failed to create mock go %v", err)
+	}
+	td := t.TempDir()
+	c := cache.New(td, cache.WithGo(mockGo))
+
+	for _, version := range []string{"", "latest"} {
+		tl := tool.Tool{ImportPath: "github.com/golangci/golangci-lint/cmd/golangci-lint", Version: version}
+		installed, err := c.Install(context.Background(), tl)
+		if err != nil {
+			t.Fatalf("want nil error, got %v", err)
+		}
+		want := tool.Tool{ImportPath: "github.com/golangci/golangci-lint/cmd/golangci-lint", Version: "v1.28.3"}
+		if installed != want {
+			t.Errorf("got %+v, want %+v", installed, want)
+		}
+		if _, err := c.ToolPath(want); err != nil {
+			t.Errorf("want nil error, got %v", err)
+		}
+	}
+
+	// Explicitly requesting a retracted version is still allowed
+	tl := tool.Tool{ImportPath: "github.com/golangci/golangci-lint/cmd/golangci-lint", Version: "v1.33.0"}
+	installed, err := c.Install(context.Background(), tl)
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if installed != tl {
+		t.Errorf("got %+v, want %+v", installed, tl)
+	}
+}
+
+func TestCacheModuleGoVersion(t *testing.T) {
+	mockGo, err := cache.NewMockGo(
+		availableTools,
+		cache.WithMockGoVersion("github.com/Shopify/ejson/cmd/ejson", "v1.2.2", "1.16"),
+	)
+	if err != nil {
+		t.Fatalf("failed to create mock go %v", err)
+	}
+	td := t.TempDir()
+	c := cache.New(td, cache.WithGo(mockGo))
+
+	tests := []struct {
+		name string
+		tool tool.Tool
+		want string
+	}{
+		{
+			name: "go directive",
+			tool: tool.Tool{ImportPath: "github.com/Shopify/ejson/cmd/ejson", Version: "v1.2.2"},
+			want: "1.16",
+		},
+		{
+			name: "no go directive",
+			tool: tool.Tool{ImportPath: "github.com/Shopify/ejson/cmd/ejson", Version: "v1.1.0"},
+			want: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := c.Install(context.Background(), tt.tool); err != nil {
+				t.Fatalf("failed to install tool %v: %v", tt.tool, err)
+			}
+			got, err := c.ModuleGoVersion(context.Background(), tt.tool)
+			if err != nil {
+				t.Fatalf("want nil error, got %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got go version %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCacheModuleGoVersionNotInstalled(t *testing.T) {
+	c := newCache(t, t.TempDir())
+	tl := tool.Tool{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"}
+	_, err := c.ModuleGoVersion(context.Background(), tl)
+	if rootErr := errors.Root(err); rootErr == nil || rootErr.Kind != errors.NotInstalled {
+		t.Errorf("got error %v, want kind %v", err, errors.NotInstalled)
+	}
+}
+
+func TestCacheInstalled(t *testing.T) {
+	tl := tool.Tool{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"}
+	tests := []struct {
+		name       string
+		setup      func(t *testing.T, dir string)
+		want       bool
+		wantStatus cache.ToolStatus
+		// wantPath is whether ToolPath finds the binary, it only checks that the binary exists.
+		wantPath bool
+	}{
+		{
+			name: "built",
+			setup: func(t *testing.T, dir string) {
+				installTools(t, dir, []tool.Tool{tl})
+			},
+			want:       true,
+			wantStatus: cache.StatusInstalled,
+			wantPath:   true,
+		},
+		{
+			name: "not built",
+			setup: func(t *testing.T, dir string) {
+				installTools(t, dir, []tool.Tool{tl})
+				bfp, err := tl.BinaryFilepath()
+				if err != nil {
+					t.Fatalf("failed to get binary filepath of tool %v: %v", tl, err)
+				}
+				if err := os.Remove(filepath.Join(dir, "tools", bfp)); err != nil {
+					t.Fatalf("failed to remove binary %v", err)
+				}
+			},
+			want:       false,
+			wantStatus: cache.StatusNotBuilt,
+		},
+		{
+			name: "invalid modfile",
+			setup: func(t *testing.T, dir string) {
+				installTools(t, dir, []tool.Tool{tl})
+				fp, err := tl.Filepath()
+				if err != nil {
+					t.Fatalf("failed to get filepath of tool %v: %v", tl, err)
+				}
+				if err := os.WriteFile(filepath.Join(dir, "tools", fp, "go.mod"), []byte("not a modfile"), 0o644); err != nil {
+					t.Fatalf("failed to write modfile %v", err)
+				}
+			},
+			want:       false,
+			wantStatus: cache.StatusVersionMismatch,
+			wantPath:   true,
+		},
+		{
+			name:       "missing",
+			setup:      func(t *testing.T, dir string) {},
+			want:       false,
+			wantStatus: cache.StatusNotDownloaded,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			td := t.TempDir()
+			tt.setup(t, td)
+			c := newCache(t, td)
+			got, err := c.Installed(tl)
+			if err != nil {
+				t.Fatalf("want nil error, got %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+			status, err := c.Status(tl)
+			if err != nil {
+				t.Fatalf("want nil error, got %v", err)
+			}
+			if status != tt.wantStatus {
+				t.Errorf("got status %s, want %s", status, tt.wantStatus)
+			}
+			_, err = c.ToolPath(tl)
+			if tt.wantPath && err != nil {
+				t.Errorf("want nil error, got %v", err)
+			}
+			if rootErr := errors.Root(err); !tt.wantPath && (rootErr == nil || rootErr.Kind != errors.NotInstalled) {
+				t.Errorf("got error %v, want kind %v", err, errors.NotInstalled)
+			}
+		})
+	}
+}
+
+func TestCacheInstallWorkDir(t *testing.T) {
+	td := t.TempDir()
+	workDir := filepath.Join(td, "work")
+	c := newCache(t, filepath.Join(td, "cache"), cache.WithWorkDir(workDir))
+
+	for _, tl := range []tool.Tool{
+		{ImportPath: "github.com/Shopify/ejson/cmd/ejson"},
+		{ImportPath: "github.com/Shopify/ejson/cmd/ejson", Version: "v1.2.2"},
+		{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"},
+	} {
+		installed, err := c.Install(context.Background(), tl)
+		if err != nil {
+			t.Fatalf("want nil error, got %v", err)
+		}
+		ok, err := c.Installed(installed)
+		if err != nil {
+			t.Fatalf("want nil error, got %v", err)
+		}
+		if !ok {
+			t.Errorf("expected %v to be installed", installed)
+		}
+	}
+
+	// Staging directories must be cleaned up
+	entries, err := os.ReadDir(workDir)
+	if err != nil {
+		t.Fatalf("failed to read work dir %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("got %d entries in work dir, want 0", len(entries))
+	}
+}
+
+func TestCacheInstallProgress(t *testing.T) {
+	var buf bytes.Buffer
+	c := newCache(t, t.TempDir(), cache.WithProgressWriter(&buf))
+	tl := tool.Tool{ImportPath: "github.com/Shopify/ejson/cmd/ejson"}
+	installed, err := c.Install(context.Background(), tl)
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	want := "Downloading github.com/Shopify/ejson/cmd/ejson\n" +
+		"Building github.com/Shopify/ejson/cmd/ejson@v1.2.2\n" +
+		"Installed github.com/Shopify/ejson/cmd/ejson@v1.2.2\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got progress\n%s\nwant\n%s", got, want)
+	}
+
+	// Nothing is written if the tool is already installed
+	buf.Reset()
+	if _, err := c.Install(context.Background(), installed); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("got progress %q, want none", buf.String())
+	}
+}
+
+func TestCacheInstallLogsDuration(t *testing.T) {
+	logger, hook := test.NewNullLogger()
+	logger.SetLevel(logrus.DebugLevel)
+	c := newCache(t, t.TempDir(), cache.WithLogger(logger))
+	tl := tool.Tool{ImportPath: "github.com/Shopify/ejson/cmd/ejson"}
+	if _, err := c.Install(context.Background(), tl); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+
+	durations := make(map[string]bool)
+	for _, e := range hook.AllEntries() {
+		if _, ok := e.Data["duration"].(time.Duration); ok {
+			durations[e.Message] = true
+		}
+	}
+	for _, msg := range []string{"tool downloaded", "tool built"} {
+		if !durations[msg] {
+			t.Errorf("want %q to be logged with a duration", msg)
+		}
+	}
+}
+
+// diskFullGo is a cache.Go that fails to build because the disk is full.
+type diskFullGo struct {
+	cache.Go
+}
+
+func (diskFullGo) Build(ctx context.Context, pkg, outPath, dir string, flags []string) error {
+	return errors.New(errors.Go, "failed to build", errors.Op("diskFullGo.Build"), &fs.PathError{
+		Op:   "write",
+		Path: outPath,
+		Err:  syscall.ENOSPC,
+	})
+}
+
+func TestCacheInstallDiskFull(t *testing.T) {
+	mockGo, err := cache.NewMockGo(availableTools)
+	if err != nil {
+		t.Fatalf("failed to create mock go %v", err)
+	}
+	c := cache.New(t.TempDir(), cache.WithGo(diskFullGo{mockGo}))
+	_, err = c.Install(context.Background(), tool.Tool{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"})
+	if !errors.Is(err, syscall.ENOSPC) {
+		t.Errorf("got error %v, want %v", err, syscall.ENOSPC)
+	}
+	if rootErr := errors.Root(err); rootErr == nil || rootErr.Kind != errors.IO {
+		t.Errorf("got error %v, want kind %v", err, errors.IO)
+	}
+	if !strings.Contains(err.Error(), "shed cache prune") {
+		t.Errorf("got error %v, want it to suggest shed cache prune", err)
+	}
+}
+
+// badBuildGo is a cache.Go whose builds succeed but write data to the binary with the given permissions.
+// If data is nil, no binary is written.
+type badBuildGo struct {
+	cache.Go
+	data []byte
+	perm os.FileMode
+}
+
+func (g badBuildGo) Build(ctx context.Context, pkg, outPath, dir string, flags []string) error {
+	if g.data == nil {
+		return nil
+	}
+	return os.WriteFile(outPath, g.data, g.perm)
+}
+
+func TestCacheInstallInvalidBinary(t *testing.T) {
+	tests := []struct {
+		name string
+		g    badBuildGo
+		// unixOnly is set if the test relies on file permissions that don't exist on windows
+		unixOnly bool
+	}{
+		{name: "missing binary"},
+		{name: "empty binary", g: badBuildGo{data: []byte{}, perm: 0o755}},
+		{name: "not executable", g: badBuildGo{data: []byte("binary"), perm: 0o644}, unixOnly: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.unixOnly && runtime.GOOS == "windows" {
+				t.Skip("executable permission is not used on windows")
+			}
+			mockGo, err := cache.NewMockGo(availableTools)
+			if err != nil {
+				t.Fatalf("failed to create mock go %v", err)
+			}
+			tt.g.Go = mockGo
+			c := cache.New(t.TempDir(), cache.WithGo(tt.g))
+			goFish := tool.Tool{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"}
+			_, err = c.Install(context.Background(), goFish)
+			if rootErr := errors.Root(err); rootErr == nil || rootErr.Kind != errors.Internal {
+				t.Errorf("want internal error, got %v", err)
+			}
+			// The bad binary is removed so the next install builds it again
+			if installed, _ := c.Installed(goFish); installed {
+				t.Error("want tool to not be installed")
+			}
+		})
+	}
+}
+
+// envGo records the environment from GoEnv for each module downloaded by GetD,
+// for each build of a package, and for each module listed by ListU.
+type envGo struct {
+	cache.Go
+	env    map[string][]string
+	builds [][]string
+	lists  [][]string
+}
+
+func (g *envGo) GetD(ctx context.Context, mod, dir string) error {
+	g.env[mod] = cache.GoEnv(ctx)
+	return g.Go.GetD(ctx, mod, dir)
+}
+
+func (g *envGo) Build(ctx context.Context, pkg, outPath, dir string, flags []string) error {
+	g.builds = append(g.builds, cache.GoEnv(ctx))
+	return g.Go.Build(ctx, pkg, outPath, dir, flags)
+}
+
+func (g *envGo) ListU(ctx context.Context, mod, dir string) (cache.GoModule, error) {
+	g.lists = append(g.lists, cache.GoEnv(ctx))
+	return g.Go.ListU(ctx, mod, dir)
+}
+
+// flakyGo is a cache.Go that fails GetD with err the first failures times it is called.
+type flakyGo struct {
+	cache.Go
+	err      error
+	failures int
+	calls    int
+}
+
+func (g *flakyGo) GetD(ctx context.Context, mod, dir string) error {
+	g.calls++
+	if g.calls <= g.failures {
+		return g.err
+	}
+	return g.Go.GetD(ctx, mod, dir)
+}
+
+func TestCacheInstallRetry(t *testing.T) {
+	networkErr := errors.New(errors.Go, "failed to download", fmt.Errorf("%w: dial tcp: i/o timeout", cache.ErrNetwork))
+	tests := []struct {
+		name      string
+		err       error
+		failures  int
+		wantCalls int
+		wantErr   bool
+	}{
+		{name: "retries network errors", err: networkErr, failures: 2, wantCalls: 3},
+		{name: "gives up after max attempts", err: networkErr, failures: 5, wantCalls: 3, wantErr: true},
+		{name: "does not retry other errors", err: errors.New(errors.Go, "invalid module path"), failures: 1, wantCalls: 1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockGo, err := cache.NewMockGo(availableTools)
+			if err != nil {
+				t.Fatalf("failed to create mock go %v", err)
+			}
+			g := &flakyGo{Go: mockGo, err: tt.err, failures: tt.failures}
+			c := cache.New(t.TempDir(), cache.WithGo(g), cache.WithRetry(3, time.Millisecond))
+			_, err = c.Install(context.Background(), tool.Tool{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"})
+			if tt.wantErr && err == nil {
+				t.Error("want non-nil error, got nil")
+			} else if !tt.wantErr && err != nil {
+				t.Errorf("want nil error, got %v", err)
+			}
+			if g.calls != tt.wantCalls {
+				t.Errorf("got %d calls to GetD, want %d", g.calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestCacheInstallRetryCanceled(t *testing.T) {
+	mockGo, err := cache.NewMockGo(availableTools)
+	if err != nil {
+		t.Fatalf("failed to create mock go %v", err)
+	}
+	g := &flakyGo{Go: mockGo, err: fmt.Errorf("%w: connection refused", cache.ErrNetwork), failures: 5}
+	c := cache.New(t.TempDir(), cache.WithGo(g), cache.WithRetry(3, time.Hour))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = c.Install(ctx, tool.Tool{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got error %v, want %v", err, context.DeadlineExceeded)
+	}
+	if g.calls != 1 {
+		t.Errorf("got %d calls to GetD, want 1", g.calls)
+	}
+}
+
+func TestCacheInstallDirect(t *testing.T) {
+	mockGo, err := cache.NewMockGo(availableTools)
+	if err != nil {
+		t.Fatalf("failed to create mock go %v", err)
+	}
+	eg := &envGo{Go: mockGo, env: make(map[string][]string)}
+	c := cache.New(t.TempDir(), cache.WithGo(eg))
+	goFish := tool.Tool{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"}
+	ejson := tool.Tool{ImportPath: "github.com/Shopify/ejson/cmd/ejson", Version: "v1.1.0"}
+	if _, err := c.Install(context.Background(), goFish, cache.WithDirect()); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if _, err := c.Install(context.Background(), ejson); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+
+	want := map[string][]string{
+		goFish.Module(): {"GOPROXY=direct"},
+		ejson.Module():  nil,
+	}
+	if !reflect.DeepEqual(eg.env, want) {
+		t.Errorf("got env %v, want %v", eg.env, want)
+	}
+}
+
+func TestCacheInstallToolchain(t *testing.T) {
+	mockGo, err := cache.NewMockGo(availableTools)
+	if err != nil {
+		t.Fatalf("failed to create mock go %v", err)
+	}
+	eg := &envGo{Go: mockGo, env: make(map[string][]string)}
+	c := cache.New(t.TempDir(), cache.WithGo(eg))
+	goFish := tool.Tool{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"}
+	ejson := tool.Tool{ImportPath: "github.com/Shopify/ejson/cmd/ejson", Version: "v1.1.0"}
+	if _, err := c.Install(context.Background(), goFish, cache.WithToolchain("1.21.0"), cache.WithDirect()); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	// No toolchain uses the installed go
+	if _, err := c.Install(context.Background(), ejson, cache.WithToolchain("")); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+
+	wantDownloads := map[string][]string{
+		goFish.Module(): {"GOTOOLCHAIN=go1.21.0", "GOPROXY=direct"},
+		ejson.Module():  nil,
+	}
+	if !reflect.DeepEqual(eg.env, wantDownloads) {
+		t.Errorf("got download env %v, want %v", eg.env, wantDownloads)
+	}
+	wantBuilds := [][]string{{"GOTOOLCHAIN=go1.21.0"}, nil}
+	if !reflect.DeepEqual(eg.builds, wantBuilds) {
+		t.Errorf("got build env %v, want %v", eg.builds, wantBuilds)
+	}
+}
+
+func TestCacheInstallToolchainChanged(t *testing.T) {
+	mockGo, err := cache.NewMockGo(availableTools)
+	if err != nil {
+		t.Fatalf("failed to create mock go %v", err)
+	}
+	eg := &envGo{Go: mockGo, env: make(map[string][]string)}
+	c := cache.New(t.TempDir(), cache.WithGo(eg))
+	goFish := tool.Tool{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"}
+	for _, toolchain := range []string{"1.21.0", "1.21.0", "1.22.0", ""} {
+		if _, err := c.Install(context.Background(), goFish, cache.WithToolchain(toolchain)); err != nil {
+			t.Fatalf("want nil error, got %v", err)
+		}
+	}
+	// Only rebuilt when the toolchain changes, any toolchain is fine if none is requested
+	wantBuilds := [][]string{{"GOTOOLCHAIN=go1.21.0"}, {"GOTOOLCHAIN=go1.22.0"}}
+	if !reflect.DeepEqual(eg.builds, wantBuilds) {
+		t.Errorf("got build env %v, want %v", eg.builds, wantBuilds)
+	}
+
+	tests := []struct {
+		toolchain string
+		want      cache.ToolStatus
+	}{
+		{"", cache.StatusInstalled},
+		{"1.22.0", cache.StatusInstalled},
+		{"1.21.0", cache.StatusNotBuilt},
+	}
+	for _, tt := range tests {
+		if got, err := c.Status(goFish, cache.ForToolchain(tt.toolchain)); err != nil || got != tt.want {
+			t.Errorf("got status %v, %v for toolchain %q, want %v, nil", got, err, tt.toolchain, tt.want)
+		}
+	}
+	if _, err := c.ToolPath(goFish, cache.ForToolchain("1.21.0")); errors.Root(err) == nil || errors.Root(err).Kind != errors.NotInstalled {
+		t.Errorf("want not installed error, got %v", err)
+	}
+}
+
+func TestCacheReinstall(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []cache.Option
+	}{
+		{name: "cache dir"},
+		{name: "work dir", opts: []cache.Option{cache.WithWorkDir(t.TempDir())}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockGo, err := cache.NewMockGo(availableTools)
+			if err != nil {
+				t.Fatalf("failed to create mock go %v", err)
+			}
+			eg := &envGo{Go: mockGo, env: make(map[string][]string)}
+			c := cache.New(t.TempDir(), append([]cache.Option{cache.WithGo(eg)}, tt.opts...)...)
+			goFish := tool.Tool{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"}
+			if _, err := c.Install(context.Background(), goFish); err != nil {
+				t.Fatalf("want nil error, got %v", err)
+			}
+			// Simulate a corrupt binary
+			binPath, err := c.ToolPath(goFish)
+			if err != nil {
+				t.Fatalf("want nil error, got %v", err)
+			}
+			if err := os.WriteFile(binPath, []byte("corrupt"), 0o755); err != nil {
+				t.Fatalf("failed to write binary %v", err)
+			}
+
+			// Install skips the build since the binary exists
+			if _, err := c.Install(context.Background(), goFish); err != nil {
+				t.Fatalf("want nil error, got %v", err)
+			}
+			if len(eg.builds) != 1 {
+				t.Errorf("got %d builds, want 1", len(eg.builds))
+			}
+
+			installed, err := c.Reinstall(context.Background(), goFish)
+			if err != nil {
+				t.Fatalf("want nil error, got %v", err)
+			}
+			if installed != goFish {
+				t.Errorf("got tool %v, want %v", installed, goFish)
+			}
+			if len(eg.builds) != 2 {
+				t.Errorf("got %d builds, want 2", len(eg.builds))
+			}
+			data, err := os.ReadFile(binPath)
+			if err != nil {
+				t.Fatalf("failed to read binary %v", err)
+			}
+			if string(data) == "corrupt" {
+				t.Errorf("want binary to be rebuilt, got %q", data)
+			}
+
+			// Tools without an exact version are resolved and rebuilt
+			installed, err = c.Reinstall(context.Background(), tool.Tool{ImportPath: goFish.ImportPath})
+			if err != nil {
+				t.Fatalf("want nil error, got %v", err)
+			}
+			if installed != goFish {
+				t.Errorf("got tool %v, want %v", installed, goFish)
+			}
+			if len(eg.builds) != 3 {
+				t.Errorf("got %d builds, want 3", len(eg.builds))
+			}
+		})
+	}
+}
+
+func TestCacheWithEnv(t *testing.T) {
+	mockGo, err := cache.NewMockGo(availableTools)
+	if err != nil {
+		t.Fatalf("failed to create mock go %v", err)
+	}
+	eg := &envGo{Go: mockGo, env: make(map[string][]string)}
+	env := []string{"GOPROXY=https://proxy.example.com", "GONOSUMDB=example.com"}
+	c := cache.New(t.TempDir(), cache.WithGo(eg), cache.WithEnv(env))
+	goFish := tool.Tool{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"}
+	ejson := tool.Tool{ImportPath: "github.com/Shopify/ejson/cmd/ejson", Version: "v1.1.0"}
+	if _, err := c.Install(context.Background(), goFish); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	// Tool specific variables take precedence since they come last
+	if _, err := c.Install(context.Background(), ejson, cache.WithDirect()); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if _, err := c.FindUpdate(context.Background(), goFish); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+
+	wantDownloads := map[string][]string{
+		goFish.Module(): env,
+		ejson.Module():  append(env, "GOPROXY=direct"),
+	}
+	if !reflect.DeepEqual(eg.env, wantDownloads) {
+		t.Errorf("got download env %v, want %v", eg.env, wantDownloads)
+	}
+	wantBuilds := [][]string{env, env}
+	if !reflect.DeepEqual(eg.builds, wantBuilds) {
+		t.Errorf("got build env %v, want %v", eg.builds, wantBuilds)
+	}
+	wantLists := [][]string{env}
+	if !reflect.DeepEqual(eg.lists, wantLists) {
+		t.Errorf("got list env %v, want %v", eg.lists, wantLists)
+	}
+}
+
+// networkGo is a cache.Go that fails to download because of a network error.
+type networkGo struct {
+	cache.Go
+}
+
+func (networkGo) GetD(ctx context.Context, mod, dir string) error {
+	return errors.New(errors.Go, "failed to download", errors.Op("networkGo.GetD"), cache.ErrNetwork)
+}
+
+func TestCacheInstallOfflineFallback(t *testing.T) {
+	td := t.TempDir()
+	installTools(t, td, []tool.Tool{
+		{ImportPath: "golang.org/x/tools/cmd/stringer", Version: "v0.1.0"},
+		{ImportPath: "golang.org/x/tools/cmd/stringer", Version: "v0.1.5"},
+	})
+
+	mockGo, err := cache.NewMockGo(availableTools)
+	if err != nil {
+		t.Fatalf("failed to create mock go %v", err)
+	}
+	c := cache.New(td, cache.WithGo(networkGo{mockGo}))
+	stringer := tool.Tool{ImportPath: "golang.org/x/tools/cmd/stringer", Version: "latest"}
+	installed, err := c.Install(context.Background(), stringer, cache.WithOfflineFallback(""))
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	want := tool.Tool{ImportPath: "golang.org/x/tools/cmd/stringer", Version: "v0.1.5"}
+	if installed != want {
+		t.Errorf("got %v, want %v", installed, want)
+	}
+
+	// Without the option the error is returned
+	if _, err := c.Install(context.Background(), stringer); !errors.Is(err, cache.ErrNetwork) {
+		t.Errorf("got error %v, want %v", err, cache.ErrNetwork)
+	}
+	// Cached versions lower than the minimum version are not used
+	if _, err := c.Install(context.Background(), stringer, cache.WithOfflineFallback("v0.1.6")); !errors.Is(err, cache.ErrNetwork) {
+		t.Errorf("got error %v, want %v", err, cache.ErrNetwork)
+	}
+	installed, err = c.Install(context.Background(), stringer, cache.WithOfflineFallback("v0.1.5"))
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if installed != want {
+		t.Errorf("got %v, want %v", installed, want)
+	}
+	// No cached version to fall back to
+	goimports := tool.Tool{ImportPath: "golang.org/x/tools/cmd/goimports", Version: "latest"}
+	if _, err := c.Install(context.Background(), goimports, cache.WithOfflineFallback("")); !errors.Is(err, cache.ErrNetwork) {
+		t.Errorf("got error %v, want %v", err, cache.ErrNetwork)
+	}
+}
+
+func TestCacheInstallTarget(t *testing.T) {
+	for _, useWorkDir := range []bool{false, true} {
+		t.Run(fmt.Sprintf("work dir %t", useWorkDir), func(t *testing.T) {
+			mockGo, err := cache.NewMockGo(availableTools)
+			if err != nil {
+				t.Fatalf("failed to create mock go %v", err)
+			}
+			eg := &envGo{Go: mockGo, env: make(map[string][]string)}
+			opts := []cache.Option{cache.WithGo(eg)}
+			if useWorkDir {
+				opts = append(opts, cache.WithWorkDir(t.TempDir()))
+			}
+			dir := t.TempDir()
+			c := cache.New(dir, opts...)
+			goFish := tool.Tool{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"}
+			linux := tool.Target{GOOS: "linux", GOARCH: "arm64"}
+			darwin := tool.Target{GOOS: "darwin", GOARCH: "amd64"}
+			for _, target := range []tool.Target{{}, linux, darwin, linux} {
+				if _, err := c.Install(context.Background(), goFish, cache.WithTarget(target)); err != nil {
+					t.Fatalf("want nil error, got %v", err)
+				}
+			}
+			// linux was already built the second time
+			wantBuilds := [][]string{nil, {"GOOS=linux", "GOARCH=arm64"}, {"GOOS=darwin", "GOARCH=amd64"}}
+			if !reflect.DeepEqual(eg.builds, wantBuilds) {
+				t.Errorf("got builds %v, want %v", eg.builds, wantBuilds)
+			}
+
+			wantPaths := map[tool.Target]string{
+				{}:     filepath.Join(dir, "tools", "github.com/cszatmary/go-fish@v0.1.0/go-fish"),
+				linux:  filepath.Join(dir, "tools", "github.com/cszatmary/go-fish@v0.1.0/linux_arm64/go-fish"),
+				darwin: filepath.Join(dir, "tools", "github.com/cszatmary/go-fish@v0.1.0/darwin_amd64/go-fish"),
+			}
+			for target, want := range wantPaths {
+				got, err := c.TargetToolPath(goFish, target)
+				if err != nil {
+					t.Errorf("want nil error for target %v, got %v", target, err)
+				}
+				if got != filepath.FromSlash(want) {
+					t.Errorf("got path %s for target %v, want %s", got, target, want)
+				}
+				if !util.FileOrDirExists(got) {
+					t.Errorf("want binary to exist at %s", got)
+				}
+			}
+			_, err = c.TargetToolPath(goFish, tool.Target{GOOS: "windows", GOARCH: "amd64"})
+			if rootErr := errors.Root(err); rootErr == nil || rootErr.Kind != errors.NotInstalled {
+				t.Errorf("want not installed error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestCacheInstallInvalidTarget(t *testing.T) {
+	c := newCache(t, t.TempDir())
+	goFish := tool.Tool{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"}
+	_, err := c.Install(context.Background(), goFish, cache.WithTarget(tool.Target{GOOS: "linux"}))
+	if rootErr := errors.Root(err); rootErr == nil || rootErr.Kind != errors.Invalid {
+		t.Errorf("want invalid error, got %v", err)
+	}
+}
+
+func TestCacheInstallAlias(t *testing.T) {
+	dir := t.TempDir()
+	c := newCache(t, dir)
+	goFish := tool.Tool{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"}
+	_, err := c.AliasToolPath(goFish, "fish")
+	if rootErr := errors.Root(err); rootErr == nil || rootErr.Kind != errors.NotInstalled {
+		t.Errorf("want not installed error, got %v", err)
+	}
+	// Install twice to make sure an existing alias is replaced
+	for i := 0; i < 2; i++ {
+		if _, err := c.Install(context.Background(), goFish, cache.WithAlias("fish")); err != nil {
+			t.Fatalf("want nil error, got %v", err)
+		}
+	}
+
+	got, err := c.AliasToolPath(goFish, "fish")
+	if err != nil {
+		t.Errorf("want nil error, got %v", err)
+	}
+	want := filepath.Join(dir, "tools", filepath.FromSlash("github.com/cszatmary/go-fish@v0.1.0/.alias/fish"))
+	if runtime.GOOS == "windows" {
+		want += ".exe"
+	}
+	if got != want {
+		t.Errorf("got path %s, want %s", got, want)
+	}
+	if !util.FileOrDirExists(got) {
+		t.Errorf("want binary to exist at %s", got)
+	}
+	// The binary is still installed under its own name as well
+	binPath, err := c.ToolPath(goFish)
+	if err != nil {
+		t.Errorf("want nil error, got %v", err)
+	}
+	if got, err := c.AliasToolPath(goFish, ""); err != nil || got != binPath {
+		t.Errorf("got path %s, %v, want %s", got, err, binPath)
+	}
+
+	_, err = c.Install(context.Background(), goFish, cache.WithAlias("../fish"))
+	if rootErr := errors.Root(err); rootErr == nil || rootErr.Kind != errors.Invalid {
+		t.Errorf("want invalid error, got %v", err)
+	}
+
+	// Aliases can't replace the binary or other files of the tool
+	for _, alias := range []string{"go-fish", "go.mod"} {
+		if _, err := c.Install(context.Background(), goFish, cache.WithAlias(alias)); err != nil {
+			t.Fatalf("want nil error for alias %q, got %v", alias, err)
+		}
+		if _, err := c.AliasToolPath(goFish, alias); err != nil {
+			t.Errorf("want nil error for alias %q, got %v", alias, err)
+		}
+		if installed, err := c.Installed(goFish); err != nil || !installed {
+			t.Errorf("got installed %t, %v with alias %q, want true, nil", installed, err, alias)
+		}
+	}
+}
+
+// releaseServer serves binary release assets. Each asset is keyed by its path.
+func releaseServer(t *testing.T, assets map[string][]byte) (*httptest.Server, *int64) {
+	var requests int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&requests, 1)
+		data, ok := assets[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(data)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+func tarGz(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	for name, content := range files {
+		hdr := &tar.Header{Name: name, Mode: 0o755, Size: int64(len(content)), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatalf("failed to write tar header %v", err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatalf("failed to write tar content %v", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("failed to close tar writer %v", err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatalf("failed to close gzip writer %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestCacheInstallBinaryRelease(t *testing.T) {
+	srv, requests := releaseServer(t, map[string][]byte{
+		"/golangci/golangci-lint/releases/download/v1.33.0/golangci-lint-v1.33.0-linux-arm64.tar.gz": tarGz(t, map[string]string{
+			"golangci-lint-v1.33.0-linux-arm64/README.md":     "readme",
+			"golangci-lint-v1.33.0-linux-arm64/golangci-lint": "golangci-lint binary",
+		}),
+		"/Shopify/ejson/releases/download/v1.2.2/ejson": []byte("ejson binary"),
+	})
+	dir := t.TempDir()
+	c := newCache(t, dir, cache.WithReleaseURL(srv.URL+"/"))
+	lint := tool.Tool{ImportPath: "github.com/golangci/golangci-lint/cmd/golangci-lint", Version: "v1.33.0"}
+	ejson := tool.Tool{ImportPath: "github.com/Shopify/ejson/cmd/ejson", Version: "v1.2.2"}
+	linux := tool.Target{GOOS: "linux", GOARCH: "arm64"}
+
+	_, err := c.Install(context.Background(), lint, cache.WithTarget(linux), cache.WithBinaryRelease("golangci/golangci-lint", "golangci-lint-{version}-{os}-{arch}.tar.gz"))
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	_, err = c.Install(context.Background(), ejson, cache.WithBinaryRelease("Shopify/ejson", "ejson"))
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+
+	binPath, err := c.TargetToolPath(lint, linux)
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if data, _ := os.ReadFile(binPath); string(data) != "golangci-lint binary" {
+		t.Errorf("got binary %q, want %q", data, "golangci-lint binary")
+	}
+	binPath, err = c.ToolPath(ejson)
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if data, _ := os.ReadFile(binPath); string(data) != "ejson binary" {
+		t.Errorf("got binary %q, want %q", data, "ejson binary")
+	}
+	if _, err := c.Module(ejson); err == nil {
+		t.Error("want error for module of binary release, got nil")
+	}
+
+	// Already installed, nothing is downloaded
+	_, err = c.Install(context.Background(), ejson, cache.WithBinaryRelease("Shopify/ejson", "ejson"))
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if got := atomic.LoadInt64(requests); got != 2 {
+		t.Errorf("got %d requests, want 2", got)
+	}
+}
+
+func TestCacheInstallBinaryReleaseErrors(t *testing.T) {
+	srv, _ := releaseServer(t, map[string][]byte{
+		"/Shopify/ejson/releases/download/v1.2.2/ejson.tar.gz": tarGz(t, map[string]string{"other": "other binary"}),
+	})
+	c := newCache(t, t.TempDir(), cache.WithReleaseURL(srv.URL))
+	tests := []struct {
+		name  string
+		tool  tool.Tool
+		asset string
+	}{
+		{"no exact version", tool.Tool{ImportPath: "github.com/Shopify/ejson/cmd/ejson"}, "ejson"},
+		{"missing asset", tool.Tool{ImportPath: "github.com/Shopify/ejson/cmd/ejson", Version: "v1.1.0"}, "ejson"},
+		{"binary not in archive", tool.Tool{ImportPath: "github.com/Shopify/ejson/cmd/ejson", Version: "v1.2.2"}, "ejson.tar.gz"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := c.Install(context.Background(), tt.tool, cache.WithBinaryRelease("Shopify/ejson", tt.asset))
+			if err == nil {
+				t.Fatal("want error, got nil")
+			}
+			if tt.tool.Version == "" {
+				return
+			}
+			if installed, err := c.Installed(tt.tool); err != nil || installed {
+				t.Errorf("got installed %t, error %v, want tool to not be installed", installed, err)
+			}
+		})
+	}
+}
+
+func TestCacheInstallReleaseHash(t *testing.T) {
+	srv, requests := releaseServer(t, map[string][]byte{
+		"/Shopify/ejson/releases/download/v1.2.2/ejson": []byte("ejson binary"),
+	})
+	ejson := tool.Tool{ImportPath: "github.com/Shopify/ejson/cmd/ejson", Version: "v1.2.2"}
+	release := cache.WithBinaryRelease("Shopify/ejson", "ejson")
+	td := t.TempDir()
+	c := newCache(t, filepath.Join(td, "a"), cache.WithReleaseURL(srv.URL))
+	if _, err := c.Install(context.Background(), ejson, release); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	hash, err := c.ReleaseHash(ejson)
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	// sha256 of "ejson binary"
+	const wantHash = "sha256:644854eca2c1f991b1008bdad584b9e25ede0ecbec222073650556564ab014b7"
+	if hash != wantHash {
+		t.Errorf("got hash %q, want %q", hash, wantHash)
+	}
+
+	// Already installed with the same hash
+	if _, err := c.Install(context.Background(), ejson, release, cache.WithReleaseHash(hash)); err != nil {
+		t.Errorf("want nil error, got %v", err)
+	}
+	// Already installed with a different hash
+	_, err = c.Install(context.Background(), ejson, release, cache.WithReleaseHash("sha256:changed"))
+	if rootErr := errors.Root(err); rootErr == nil || rootErr.Kind != errors.BadState {
+		t.Errorf("want bad state error, got %v", err)
+	}
+	if got := atomic.LoadInt64(requests); got != 1 {
+		t.Errorf("got %d requests, want 1", got)
+	}
+
+	// The downloaded asset does not match the hash
+	c = newCache(t, filepath.Join(td, "b"), cache.WithReleaseURL(srv.URL))
+	_, err = c.Install(context.Background(), ejson, release, cache.WithReleaseHash("sha256:changed"))
+	if rootErr := errors.Root(err); rootErr == nil || rootErr.Kind != errors.BadState {
+		t.Errorf("want bad state error, got %v", err)
+	}
+	if installed, _ := c.Installed(ejson); installed {
+		t.Error("want tool to not be installed when the hash does not match")
+	}
+	if _, err := c.Install(context.Background(), ejson, release, cache.WithReleaseHash(hash)); err != nil {
+		t.Errorf("want nil error, got %v", err)
+	}
+
+	// Tools built from source have no release hash
+	c = newCache(t, filepath.Join(td, "c"))
+	goFish := tool.Tool{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"}
+	if _, err := c.ReleaseHash(goFish); errors.Root(err) == nil || errors.Root(err).Kind != errors.NotInstalled {
+		t.Errorf("want not installed error, got %v", err)
+	}
+	if _, err := c.Install(context.Background(), goFish); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if _, err := c.ReleaseHash(goFish); errors.Root(err) == nil || errors.Root(err).Kind != errors.Invalid {
+		t.Errorf("want invalid error, got %v", err)
+	}
+}
+
+func TestCacheInstallHash(t *testing.T) {
+	td := t.TempDir()
+	goFish := tool.Tool{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"}
+	c := newCache(t, filepath.Join(td, "a"))
+	if _, err := c.Install(context.Background(), goFish); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	hash, err := c.ModuleHash(goFish)
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if !strings.HasPrefix(hash, "h1:") {
+		t.Errorf("got hash %q, want h1 hash", hash)
+	}
+
+	// Same content in another cache matches the hash
+	c = newCache(t, filepath.Join(td, "b"))
+	if _, err := c.Install(context.Background(), goFish, cache.WithHash(hash)); err != nil {
+		t.Errorf("want nil error, got %v", err)
+	}
+
+	// Different content does not match
+	mockGo, err := cache.NewMockGo(availableTools, cache.WithMockHash(goFish.ImportPath, goFish.Version, "h1:changed="))
+	if err != nil {
+		t.Fatalf("failed to create mock go %v", err)
+	}
+	c = cache.New(filepath.Join(td, "c"), cache.WithGo(mockGo))
+	_, err = c.Install(context.Background(), goFish, cache.WithHash(hash))
+	if rootErr := errors.Root(err); rootErr == nil || rootErr.Kind != errors.BadState {
+		t.Errorf("want bad state error, got %v", err)
+	}
+	if installed, _ := c.Installed(goFish); installed {
+		t.Error("want tool to not be built when the hash does not match")
+	}
+}
+
+func TestCacheInstallReproducible(t *testing.T) {
+	t.Setenv("GOFLAGS", "-mod=mod")
+	mockGo, err := cache.NewMockGo(availableTools)
+	if err != nil {
+		t.Fatalf("failed to create mock go %v", err)
+	}
+	eg := &envGo{Go: mockGo, env: make(map[string][]string)}
+	c := cache.New(t.TempDir(), cache.WithGo(eg))
+	goFish := tool.Tool{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"}
+	if _, err := c.Install(context.Background(), goFish); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	// Not built reproducibly so it must be rebuilt
+	if _, err := c.Install(context.Background(), goFish, cache.WithReproducible()); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	// Already built reproducibly
+	if _, err := c.Install(context.Background(), goFish, cache.WithReproducible()); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	wantBuilds := [][]string{nil, {"GOFLAGS=-mod=mod -trimpath"}}
+	if !reflect.DeepEqual(eg.builds, wantBuilds) {
+		t.Errorf("got builds %v, want %v", eg.builds, wantBuilds)
+	}
+
+	hash, err := c.BinaryHash(goFish)
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	// mockGo builds binaries that contain a shell shebang
+	const wantHash = "sha256:a8076d3d28d21e02012b20eaf7dbf75409a6277134439025f282e368e3305abf"
+	if hash != wantHash {
+		t.Errorf("got hash %q, want %q", hash, wantHash)
+	}
+}
+
+func TestCacheBinaryHashNotInstalled(t *testing.T) {
+	c := newCache(t, t.TempDir())
+	_, err := c.BinaryHash(tool.Tool{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"})
+	if rootErr := errors.Root(err); rootErr == nil || rootErr.Kind != errors.NotInstalled {
+		t.Errorf("want not installed error, got %v", err)
+	}
+}
+
+func TestCacheModuleHashNotInstalled(t *testing.T) {
+	c := newCache(t, t.TempDir())
+	_, err := c.ModuleHash(tool.Tool{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"})
+	if rootErr := errors.Root(err); rootErr == nil || rootErr.Kind != errors.NotInstalled {
+		t.Errorf("want not installed error, got %v", err)
+	}
+}
+
+func TestIsPrereleaseToolchain(t *testing.T) {
+	tests := []struct {
+		toolchain string
+		want      bool
+	}{
+		{"go1.17", false},
+		{"go1.17.3", false},
+		{"go1.21.0", false},
+		{"go1.18rc1", true},
+		{"go1.18beta2", true},
+		{"go1.21rc2", true},
+		{"devel go1.18-2d1d548", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.toolchain, func(t *testing.T) {
+			if got := cache.IsPrereleaseToolchain(tt.toolchain); got != tt.want {
+				t.Errorf("got %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+// listCountingGo is a cache.Go that counts the number of calls to ListU.
+type listCountingGo struct {
+	cache.Go
+	listU int64
+}
+
+func (g *listCountingGo) ListU(ctx context.Context, mod, dir string) (cache.GoModule, error) {
+	atomic.AddInt64(&g.listU, 1)
+	return g.Go.ListU(ctx, mod, dir)
+}
+
+func TestUpdateChecker(t *testing.T) {
+	mockGo, err := cache.NewMockGo(availableTools)
+	if err != nil {
+		t.Fatalf("failed to create mock go %v", err)
+	}
+	g := &listCountingGo{Go: mockGo}
+	td := t.TempDir()
+	c := cache.New(td, cache.WithGo(g))
+	tools := []tool.Tool{
+		{ImportPath: "golang.org/x/tools/cmd/stringer", Version: "v0.1.0"},
+		{ImportPath: "golang.org/x/tools/cmd/goimports", Version: "v0.1.0"},
+		{ImportPath: "golang.org/x/tools/cmd/goimports", Version: "v0.1.5"},
+		{ImportPath: "github.com/Shopify/ejson/cmd/ejson", Version: "v1.1.0"},
+	}
+	for _, tl := range tools {
+		if _, err := c.Install(context.Background(), tl); err != nil {
+			t.Fatalf("failed to install tool %v: %v", tl, err)
+		}
+	}
+
+	uc := c.NewUpdateChecker()
+	want := []string{"v0.1.5", "v0.1.5", "", "v1.2.2"}
+	for i, tl := range tools {
+		got, err := uc.FindUpdate(context.Background(), tl)
+		if err != nil {
+			t.Fatalf("want nil error, got %v", err)
+		}
+		if got != want[i] {
+			t.Errorf("got update %q for %v, want %q", got, tl, want[i])
+		}
+	}
+	// stringer and goimports v0.1.0 share a module version so it should only be checked once
+	if g.listU != 3 {
+		t.Errorf("got %d ListU calls, want 3", g.listU)
+	}
+
+	// Checking again should not list any modules
+	got, err := uc.FindModuleUpdate(context.Background(), tools[1], "golang.org/x/tools")
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if got != "v0.1.5" {
+		t.Errorf("got update %q, want %q", got, "v0.1.5")
+	}
+	if g.listU != 3 {
+		t.Errorf("got %d ListU calls, want 3", g.listU)
+	}
+}
+
+func TestUpdateCheckerPseudoVersion(t *testing.T) {
+	pinned := tool.Tool{ImportPath: "golang.org/x/tools/cmd/stringer", Version: "v0.0.0-20201211185031-d93e913c1a58"}
+	mockGo, err := cache.NewMockGo(map[string]map[string]string{
+		"golang.org/x/tools/cmd/stringer": {
+			pinned.Version: pinned.Version,
+			"v0.1.5":       "v0.1.5",
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to create mock go %v", err)
+	}
+	c := cache.New(t.TempDir(), cache.WithGo(mockGo))
+	if _, err := c.Install(context.Background(), pinned); err != nil {
+		t.Fatalf("failed to install tool %v: %v", pinned, err)
+	}
+
+	// Tools pinned to a commit never have an update, even if there is a newer tagged release
+	got, err := c.FindUpdate(context.Background(), pinned)
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if got != "" {
+		t.Errorf("got update %q, want none", got)
+	}
+	got, err = c.FindModuleUpdate(context.Background(), pinned, "golang.org/x/tools")
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if got != "" {
+		t.Errorf("got update %q, want none", got)
+	}
+}
+
+func TestUpdateCheckerMajorLock(t *testing.T) {
+	mockGo, err := cache.NewMockGo(map[string]map[string]string{
+		"github.com/cszatmary/go-fish": {
+			"v0.1.0": "v0.1.0",
+			"v0.2.0": "v0.2.0",
+			"v1.0.0": "v1.0.0",
+		},
+		"github.com/golangci/golangci-lint/cmd/golangci-lint": {
+			"v1.28.3":      "v1.28.3",
+			"v1.33.0":      "v1.33.0",
+			"v1.34.0-rc.1": "v1.34.0-rc.1",
+			"v2.0.0":       "v2.0.0",
+		},
+		"github.com/Shopify/ejson/cmd/ejson": {
+			"v1.2.2": "v1.2.2",
+			"v2.0.0": "v2.0.0",
+		},
+		"golang.org/x/tools/cmd/stringer": {
+			"v0.1.0": "v0.1.0",
+			"v0.1.5": "v0.1.5",
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to create mock go %v", err)
+	}
+	c := cache.New(t.TempDir(), cache.WithGo(mockGo))
+	tests := []struct {
+		tool tool.Tool
+		want string
+	}{
+		{tool.Tool{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"}, "v0.2.0"},
+		{tool.Tool{ImportPath: "github.com/golangci/golangci-lint/cmd/golangci-lint", Version: "v1.28.3"}, "v1.33.0"},
+		{tool.Tool{ImportPath: "github.com/Shopify/ejson/cmd/ejson", Version: "v1.2.2"}, ""},
+		{tool.Tool{ImportPath: "golang.org/x/tools/cmd/stringer", Version: "v0.1.0"}, "v0.1.5"},
+	}
+	for _, tt := range tests {
+		if _, err := c.Install(context.Background(), tt.tool); err != nil {
+			t.Fatalf("failed to install tool %v: %v", tt.tool, err)
+		}
+	}
+
+	uc := c.NewUpdateChecker(cache.WithMajorLock())
+	for _, tt := range tests {
+		t.Run(tt.tool.String(), func(t *testing.T) {
+			got, err := uc.FindUpdate(context.Background(), tt.tool)
+			if err != nil {
+				t.Fatalf("want nil error, got %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got update %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// Without the lock the newest major version is found
+	got, err := c.FindUpdate(context.Background(), tests[1].tool)
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if got != "v2.0.0" {
+		t.Errorf("got update %q, want %q", got, "v2.0.0")
+	}
+}
+
+func BenchmarkFindUpdate(b *testing.B) {
+	mockGo, err := cache.NewMockGo(availableTools)
+	if err != nil {
+		b.Fatalf("failed to create mock go %v", err)
+	}
+	g := &listCountingGo{Go: mockGo}
+	c := cache.New(b.TempDir(), cache.WithGo(g))
+	tools := []tool.Tool{
+		{ImportPath: "golang.org/x/tools/cmd/stringer", Version: "v0.1.0"},
+		{ImportPath: "golang.org/x/tools/cmd/goimports", Version: "v0.1.0"},
+		{ImportPath: "github.com/golangci/golangci-lint/cmd/golangci-lint", Version: "v1.28.3"},
+		{ImportPath: "github.com/Shopify/ejson/cmd/ejson", Version: "v1.1.0"},
+	}
+	for _, tl := range tools {
+		if _, err := c.Install(context.Background(), tl); err != nil {
+			b.Fatalf("failed to install tool %v: %v", tl, err)
+		}
+	}
+
+	b.Run("Cache", func(b *testing.B) {
+		atomic.StoreInt64(&g.listU, 0)
+		for i := 0; i < b.N; i++ {
+			for _, tl := range tools {
+				if _, err := c.FindUpdate(context.Background(), tl); err != nil {
+					b.Fatalf("want nil error, got %v", err)
+				}
+			}
+		}
+		b.ReportMetric(float64(atomic.LoadInt64(&g.listU))/float64(b.N), "listU/op")
+	})
+	b.Run("UpdateChecker", func(b *testing.B) {
+		atomic.StoreInt64(&g.listU, 0)
+		for i := 0; i < b.N; i++ {
+			uc := c.NewUpdateChecker()
+			for _, tl := range tools {
+				if _, err := uc.FindUpdate(context.Background(), tl); err != nil {
+					b.Fatalf("want nil error, got %v", err)
+				}
+			}
+		}
+		b.ReportMetric(float64(atomic.LoadInt64(&g.listU))/float64(b.N), "listU/op")
+	})
+}
+
+// exclusiveGo is a cache.Go that detects if multiple downloads or builds of the same tool happen at once.
+type exclusiveGo struct {
+	cache.Go
+	mu      sync.Mutex
+	active  map[string]bool
+	overlap int64
+}
+
+func (g *exclusiveGo) run(importPath string, fn func() error) error {
+	g.mu.Lock()
+	if g.active[importPath] {
+		g.overlap++
+	}
+	g.active[importPath] = true
+	g.mu.Unlock()
+	// Slow down so overlapping calls are likely if there is no locking
+	time.Sleep(5 * time.Millisecond)
+	err := fn()
+	g.mu.Lock()
+	delete(g.active, importPath)
+	g.mu.Unlock()
+	return err
+}
+
+func (g *exclusiveGo) GetD(ctx context.Context, mod, dir string) error {
+	tl, err := tool.ParseLax(mod)
+	if err != nil {
+		return err
+	}
+	return g.run(tl.ImportPath, func() error {
+		return g.Go.GetD(ctx, mod, dir)
+	})
+}
+
+func (g *exclusiveGo) Build(ctx context.Context, pkg, outPath, dir string, flags []string) error {
+	return g.run(pkg, func() error {
+		return g.Go.Build(ctx, pkg, outPath, dir, flags)
+	})
+}
+
+func TestCacheInstallConcurrent(t *testing.T) {
+	mockGo, err := cache.NewMockGo(availableTools)
+	if err != nil {
+		t.Fatalf("failed to create mock go %v", err)
+	}
+	g := &exclusiveGo{Go: mockGo, active: make(map[string]bool)}
+	td := t.TempDir()
+	tl := tool.Tool{ImportPath: "github.com/golangci/golangci-lint/cmd/golangci-lint", Version: "v1.33.0"}
+	const n = 10
+	var wg sync.WaitGroup
+	results := make([]tool.Tool, n)
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// Use a separate cache for each install to simulate separate processes sharing the same cache.
+			// Alternate between an exact version and latest since they use different directories.
+			c := cache.New(td, cache.WithGo(g))
+			it := tl
+			if i%2 == 0 {
+				it.Version = ""
+			}
+			results[i], errs[i] = c.Install(context.Background(), it)
+		}(i)
+	}
+	wg.Wait()
+
+	if g.overlap != 0 {
+		t.Errorf("got %d overlapping downloads or builds, want 0", g.overlap)
+	}
+	for i := 0; i < n; i++ {
+		if errs[i] != nil {
+			t.Errorf("install %d: want nil error, got %v", i, errs[i])
+		}
+		if results[i] != tl {
+			t.Errorf("install %d: got %+v, want %+v", i, results[i], tl)
+		}
+	}
+	c := newCache(t, td)
+	installed, err := c.Installed(tl)
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if !installed {
+		t.Errorf("expected %v to be installed", tl)
+	}
+}
+
+func TestCacheInstalledVersions(t *testing.T) {
+	td := t.TempDir()
+	installTools(t, td, []tool.Tool{
+		{ImportPath: "golang.org/x/tools/cmd/stringer", Version: "v0.1.5"},
+		{ImportPath: "golang.org/x/tools/cmd/stringer", Version: "v0.1.0"},
+		{ImportPath: "golang.org/x/tools/cmd/goimports", Version: "v0.1.5"},
+	})
+	// Downloaded but not built, should be excluded
+	notBuilt := tool.Tool{ImportPath: "golang.org/x/tools/cmd/stringer", Version: "v0.2.0"}
+	fp, err := notBuilt.Filepath()
+	if err != nil {
+		t.Fatalf("failed to get filepath of tool %v: %v", notBuilt, err)
+	}
+	if err := os.MkdirAll(filepath.Join(td, "tools", fp), 0o755); err != nil {
+		t.Fatalf("failed to create dir %v", err)
+	}
+
+	c := newCache(t, td)
+	tests := []struct {
+		name       string
+		importPath string
+		want       []string
+	}{
+		{"multiple versions", "golang.org/x/tools/cmd/stringer", []string{"v0.1.0", "v0.1.5"}},
+		{"single version", "golang.org/x/tools/cmd/goimports", []string{"v0.1.5"}},
+		{"not installed", "github.com/cszatmary/go-fish", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := c.InstalledVersions(tt.importPath)
+			if err != nil {
+				t.Fatalf("want nil error, got %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCacheInstalledVersionsInvalid(t *testing.T) {
+	c := newCache(t, t.TempDir())
+	_, err := c.InstalledVersions("golang.org/x/tools/cmd/stringer@v0.1.5")
+	if rootErr := errors.Root(err); rootErr == nil || rootErr.Kind != errors.Invalid {
+		t.Errorf("got err %v, want Invalid kind", err)
+	}
+}
+
+func TestCacheInstallCalls(t *testing.T) {
+	td := t.TempDir()
+	var mc cache.MockCalls
+	mockGo, err := cache.NewMockGo(availableTools, cache.WithMockCalls(&mc))
+	if err != nil {
+		t.Fatalf("failed to create mock go %v", err)
+	}
+	c := cache.New(td, cache.WithGo(mockGo))
+	stringer := tool.Tool{ImportPath: "golang.org/x/tools/cmd/stringer", Version: "v0.1.5"}
+	fp, err := stringer.Filepath()
+	if err != nil {
+		t.Fatalf("failed to get filepath of tool %v: %v", stringer, err)
+	}
+	dir := filepath.Join(td, "tools", fp)
+
+	// The module must be downloaded before it is built
+	if _, err := c.Install(context.Background(), stringer); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	want := []cache.MockCall{
+		{Method: "GetD", Mod: "golang.org/x/tools/cmd/stringer@v0.1.5", Dir: dir},
+		{Method: "Build", Mod: "golang.org/x/tools/cmd/stringer", Dir: dir},
+	}
+	if got := mc.Calls(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got calls %+v, want %+v", got, want)
+	}
+
+	// Installed tools are neither downloaded nor built again
+	mc.Reset()
+	if _, err := c.Install(context.Background(), stringer); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if got := mc.Calls(); len(got) != 0 {
+		t.Errorf("got calls %+v, want none", got)
+	}
+
+	// Resolving the latest version requires a download, but it is not built again once resolved
+	mc.Reset()
+	if _, err := c.Install(context.Background(), stringer.WithoutVersion()); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	for _, call := range mc.Calls() {
+		if call.Method == "Build" {
+			t.Errorf("got call %+v, want no builds", call)
+		}
+	}
+}
+
+func TestCacheInstallBuildFlags(t *testing.T) {
+	for _, workDir := range []bool{false, true} {
+		t.Run(fmt.Sprintf("workDir=%t", workDir), func(t *testing.T) {
+			td := t.TempDir()
+			var mc cache.MockCalls
+			mockGo, err := cache.NewMockGo(availableTools, cache.WithMockCalls(&mc))
+			if err != nil {
+				t.Fatalf("failed to create mock go %v", err)
+			}
+			opts := []cache.Option{cache.WithGo(mockGo)}
+			if workDir {
+				opts = append(opts, cache.WithWorkDir(filepath.Join(td, "work")))
+			}
+			c := cache.New(td, opts...)
+			stringer := tool.Tool{ImportPath: "golang.org/x/tools/cmd/stringer", Version: "v0.1.5"}
+			ldflags := "-ldflags=-X main.version=v0.1.5"
+
+			steps := []struct {
+				flags     []string
+				wantBuild bool
+			}{
+				{[]string{ldflags, "-tags=netgo"}, true},
+				// Same flags, already built
+				{[]string{ldflags, "-tags=netgo"}, false},
+				// Different flags build a separate binary
+				{[]string{ldflags}, true},
+				{nil, true},
+				{nil, false},
+				// Binaries built with other flags are still there
+				{[]string{ldflags, "-tags=netgo"}, false},
+				{[]string{ldflags}, false},
+			}
+			seen := make(map[string]bool)
+			for i, step := range steps {
+				mc.Reset()
+				if _, err := c.Install(context.Background(), stringer, cache.WithBuildFlags(step.flags...)); err != nil {
+					t.Fatalf("step %d: want nil error, got %v", i, err)
+				}
+				var builds []cache.MockCall
+				for _, call := range mc.Calls() {
+					if call.Method == "Build" {
+						builds = append(builds, call)
+					}
+				}
+				if !step.wantBuild {
+					if len(builds) != 0 {
+						t.Errorf("step %d: got builds %+v, want none", i, builds)
+					}
+					continue
+				}
+				if len(builds) != 1 {
+					t.Fatalf("step %d: got builds %+v, want 1", i, builds)
+				}
+				if !reflect.DeepEqual(builds[0].Flags, step.flags) {
+					t.Errorf("step %d: got build flags %q, want %q", i, builds[0].Flags, step.flags)
+				}
+				binPath, err := c.ToolPath(stringer, cache.ForBuildFlags(step.flags...))
+				if err != nil {
+					t.Fatalf("step %d: want nil error, got %v", i, err)
+				}
+				if seen[binPath] {
+					t.Errorf("step %d: got path %s, want a different path for each set of build flags", i, binPath)
+				}
+				seen[binPath] = true
+			}
+			_, err = c.ToolPath(stringer, cache.ForBuildFlags("-tags=other"))
+			if rootErr := errors.Root(err); rootErr == nil || rootErr.Kind != errors.NotInstalled {
+				t.Errorf("got err %v for flags that were not built, want NotInstalled kind", err)
+			}
+		})
+	}
+}
+
+func TestCacheInstallBuildFlagsChanged(t *testing.T) {
+	var mc cache.MockCalls
+	mockGo, err := cache.NewMockGo(availableTools, cache.WithMockCalls(&mc))
+	if err != nil {
+		t.Fatalf("failed to create mock go %v", err)
+	}
+	c := cache.New(t.TempDir(), cache.WithGo(mockGo))
+	stringer := tool.Tool{ImportPath: "golang.org/x/tools/cmd/stringer", Version: "v0.1.5"}
+	flags := []string{"-tags=netgo"}
+	if _, err := c.Install(context.Background(), stringer, cache.WithBuildFlags(flags...)); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	binPath, err := c.ToolPath(stringer, cache.ForBuildFlags(flags...))
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	markerPath := filepath.Join(filepath.Dir(binPath), ".build-flags")
+
+	steps := []struct {
+		name      string
+		change    func() error
+		wantBuild bool
+	}{
+		{"same flags", func() error { return nil }, false},
+		{"recorded flags differ", func() error { return os.WriteFile(markerPath, []byte("-tags=other"), 0o644) }, true},
+		{"rebuilt with requested flags", func() error { return nil }, false},
+		{"flags not recorded", func() error { return os.Remove(markerPath) }, true},
+	}
+	for _, step := range steps {
+		if err := step.change(); err != nil {
+			t.Fatalf("%s: failed to change recorded flags %v", step.name, err)
+		}
+		mc.Reset()
+		if _, err := c.Install(context.Background(), stringer, cache.WithBuildFlags(flags...)); err != nil {
+			t.Fatalf("%s: want nil error, got %v", step.name, err)
+		}
+		var builds int
+		for _, call := range mc.Calls() {
+			if call.Method == "Build" {
+				builds++
+			}
+		}
+		if gotBuild := builds > 0; gotBuild != step.wantBuild {
+			t.Errorf("%s: got %d builds, want build %t", step.name, builds, step.wantBuild)
+		}
+	}
+}
+
+func TestCacheInstallInvalidBuildFlags(t *testing.T) {
+	c := newCache(t, t.TempDir())
+	stringer := tool.Tool{ImportPath: "golang.org/x/tools/cmd/stringer", Version: "v0.1.5"}
+	for _, flags := range [][]string{{"netgo"}, {"-o", "stringer"}, {"-o=stringer"}, {"-toolexec=/bin/sh"}, {"-exec=/bin/sh"}} {
+		_, err := c.Install(context.Background(), stringer, cache.WithBuildFlags(flags...))
+		if rootErr := errors.Root(err); rootErr == nil || rootErr.Kind != errors.Invalid {
+			t.Errorf("got err %v for flags %q, want Invalid kind", err, flags)
+		}
+	}
+}
+
+func TestCacheInstallGoInstall(t *testing.T) {
+	stringer := tool.Tool{ImportPath: "golang.org/x/tools/cmd/stringer", Version: "v0.1.5"}
+	tests := []struct {
+		name        string
+		opts        []cache.Option
+		t           tool.Tool
+		installOpts []cache.InstallOption
+		wantMethods []string
+	}{
+		{
+			name:        "go install",
+			opts:        []cache.Option{cache.WithGoInstall()},
+			t:           stringer,
+			wantMethods: []string{"Install"},
+		},
+		{
+			name:        "go install with work dir",
+			opts:        []cache.Option{cache.WithGoInstall(), cache.WithWorkDir(filepath.Join(t.TempDir(), "work"))},
+			t:           stringer,
+			wantMethods: []string{"Install"},
+		},
+		{
+			name:        "go get and go build by default",
+			t:           stringer,
+			wantMethods: []string{"GetD", "Build"},
+		},
+		{
+			name:        "fall back without exact version",
+			opts:        []cache.Option{cache.WithGoInstall()},
+			t:           stringer.WithoutVersion(),
+			wantMethods: []string{"GetD", "ListVersions", "Build"},
+		},
+		{
+			name:        "fall back for other target",
+			opts:        []cache.Option{cache.WithGoInstall()},
+			t:           stringer,
+			installOpts: []cache.InstallOption{cache.WithTarget(tool.Target{GOOS: "linux", GOARCH: "arm64"})},
+			wantMethods: []string{"GetD", "Build"},
+		},
+		{
+			name:        "fall back with build flags",
+			opts:        []cache.Option{cache.WithGoInstall()},
+			t:           stringer,
+			installOpts: []cache.InstallOption{cache.WithBuildFlags("-tags=netgo")},
+			wantMethods: []string{"GetD", "Build"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			td := t.TempDir()
+			var mc cache.MockCalls
+			mockGo, err := cache.NewMockGo(availableTools, cache.WithMockCalls(&mc))
+			if err != nil {
+				t.Fatalf("failed to create mock go %v", err)
+			}
+			c := cache.New(td, append([]cache.Option{cache.WithGo(mockGo)}, tt.opts...)...)
+			installed, err := c.Install(context.Background(), tt.t, tt.installOpts...)
+			if err != nil {
+				t.Fatalf("want nil error, got %v", err)
+			}
+			if installed != stringer {
+				t.Errorf("got tool %v, want %v", installed, stringer)
+			}
+			var gotMethods []string
+			for _, call := range mc.Calls() {
+				gotMethods = append(gotMethods, call.Method)
+			}
+			if !reflect.DeepEqual(gotMethods, tt.wantMethods) {
+				t.Errorf("got calls %v, want %v", gotMethods, tt.wantMethods)
+			}
+			if len(tt.installOpts) > 0 {
+				return
+			}
+
+			// The binary is placed at the same path regardless of how it was installed
+			bfp, err := stringer.BinaryFilepath()
+			if err != nil {
+				t.Fatalf("failed to get binary filepath of tool %v: %v", stringer, err)
+			}
+			binPath, err := c.ToolPath(stringer)
+			if err != nil {
+				t.Fatalf("want nil error, got %v", err)
+			}
+			if want := filepath.Join(td, "tools", bfp); binPath != want {
+				t.Errorf("got path %s, want %s", binPath, want)
+			}
+			mod, err := c.Module(stringer)
+			if err != nil {
+				t.Fatalf("want nil error, got %v", err)
+			}
+			if mod.Path != "golang.org/x/tools" || mod.Version != "v0.1.5" {
+				t.Errorf("got module %v, want golang.org/x/tools@v0.1.5", mod)
+			}
+			// The hash is the same regardless of how the tool was installed
+			// sha256 of "golang.org/x/tools@v0.1.5" which is used by mock go
+			const wantHash = "h1:QlHN6FrMXFX4LcOCuEML6sO1Xu/DLwhXSTCr0gGIWKQ="
+			hash, err := c.ModuleHash(stringer)
+			if err != nil {
+				t.Fatalf("want nil error, got %v", err)
+			}
+			if hash != wantHash {
+				t.Errorf("got hash %q, want %q", hash, wantHash)
+			}
+
+			// Installing again does nothing
+			mc.Reset()
+			if _, err := c.Install(context.Background(), stringer); err != nil {
+				t.Fatalf("want nil error, got %v", err)
+			}
+			if got := mc.Calls(); len(got) != 0 {
+				t.Errorf("got calls %+v, want none", got)
+			}
+		})
+	}
+}
+
+func TestCacheVerify(t *testing.T) {
+	td := t.TempDir()
+	stringer := tool.Tool{ImportPath: "golang.org/x/tools/cmd/stringer", Version: "v0.1.5"}
+	goimports := tool.Tool{ImportPath: "golang.org/x/tools/cmd/goimports", Version: "v0.1.5"}
+	ejson := tool.Tool{ImportPath: "github.com/Shopify/ejson/cmd/ejson", Version: "v1.2.2"}
+	installTools(t, td, []tool.Tool{stringer, goimports, ejson})
+	toolDir := func(tl tool.Tool) string {
+		fp, err := tl.Filepath()
+		if err != nil {
+			t.Fatalf("failed to get filepath of tool %v: %v", tl, err)
+		}
+		return filepath.Join(td, "tools", fp)
+	}
+	c := newCache(t, td)
+	// A tool that was only built with build flags is not in a bad state
+	lint := tool.Tool{ImportPath: "github.com/golangci/golangci-lint/cmd/golangci-lint", Version: "v1.33.0"}
+	if _, err := c.Install(context.Background(), lint, cache.WithBuildFlags("-tags=netgo")); err != nil {
+		t.Fatalf("failed to install tool %v: %v", lint, err)
+	}
+
+	bad, err := c.Verify(context.Background())
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if len(bad) != 0 {
+		t.Errorf("got bad tools %v, want none", bad)
+	}
+
+	// Tamper with the go.mod of one tool and remove the binary of another
+	modfilePath := filepath.Join(toolDir(stringer), "go.mod")
+	if err := os.WriteFile(modfilePath, []byte("module _\n\nrequire golang.org/x/tools v0.1.0\n"), 0o644); err != nil {
+		t.Fatalf("failed to write go.mod %v", err)
+	}
+	if err := os.Remove(filepath.Join(toolDir(ejson), "ejson")); err != nil {
+		t.Fatalf("failed to remove binary %v", err)
+	}
+
+	want := []tool.Tool{ejson, stringer}
+	bad, err = c.Verify(context.Background())
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if !reflect.DeepEqual(bad, want) {
+		t.Errorf("got bad tools %v, want %v", bad, want)
+	}
+	// Verify must not modify the cache without repair
+	if installed, err := c.Installed(stringer); err != nil || installed {
+		t.Errorf("got installed %t, %v, want false, nil", installed, err)
+	}
+
+	bad, err = c.Verify(context.Background(), cache.WithRepair())
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if !reflect.DeepEqual(bad, want) {
+		t.Errorf("got repaired tools %v, want %v", bad, want)
+	}
+	for _, tl := range []tool.Tool{stringer, goimports, ejson} {
+		if installed, err := c.Installed(tl); err != nil || !installed {
+			t.Errorf("got installed %t, %v for tool %v, want true, nil", installed, err, tl)
+		}
+	}
+	if bad, err := c.Verify(context.Background()); err != nil || len(bad) != 0 {
+		t.Errorf("got bad tools %v, %v after repair, want none", bad, err)
+	}
+}
+
+func TestCacheVerifyTarget(t *testing.T) {
+	mockGo, err := cache.NewMockGo(availableTools)
+	if err != nil {
+		t.Fatalf("failed to create mock go %v", err)
+	}
+	eg := &envGo{Go: mockGo, env: make(map[string][]string)}
+	c := cache.New(t.TempDir(), cache.WithGo(eg))
+	goFish := tool.Tool{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"}
+	windows := tool.Target{GOOS: "windows", GOARCH: "amd64"}
+	if _, err := c.Install(context.Background(), goFish, cache.WithTarget(windows)); err != nil {
+		t.Fatalf("failed to install tool %v: %v", goFish, err)
+	}
+
+	// A tool that was only built for another target is not in a bad state
+	bad, err := c.Verify(context.Background(), cache.WithRepair())
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if len(bad) != 0 {
+		t.Errorf("got bad tools %v, want none", bad)
+	}
+	if len(eg.builds) != 1 {
+		t.Errorf("got %d builds, want 1", len(eg.builds))
+	}
+
+	// Repairing the tool rebuilds the binary for the same target
+	binPath, err := c.TargetToolPath(goFish, windows)
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if err := os.WriteFile(binPath, nil, 0o755); err != nil {
+		t.Fatalf("failed to truncate binary %v", err)
+	}
+	want := []tool.Tool{goFish}
+	bad, err = c.Verify(context.Background(), cache.WithRepair())
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if !reflect.DeepEqual(bad, want) {
+		t.Errorf("got repaired tools %v, want %v", bad, want)
+	}
+	if _, err := c.TargetToolPath(goFish, windows); err != nil {
+		t.Errorf("want nil error for target %v, got %v", windows, err)
+	}
+	if installed, err := c.Installed(goFish); err != nil || installed {
+		t.Errorf("got installed %t, %v for host, want false, nil", installed, err)
+	}
+	wantBuilds := [][]string{{"GOOS=windows", "GOARCH=amd64"}, {"GOOS=windows", "GOARCH=amd64"}}
+	if !reflect.DeepEqual(eg.builds, wantBuilds) {
+		t.Errorf("got builds %v, want %v", eg.builds, wantBuilds)
+	}
+	if bad, err := c.Verify(context.Background()); err != nil || len(bad) != 0 {
+		t.Errorf("got bad tools %v, %v after repair, want none", bad, err)
+	}
+}
+
+func TestCacheVerifyEmpty(t *testing.T) {
+	c := newCache(t, t.TempDir())
+	bad, err := c.Verify(context.Background())
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if len(bad) != 0 {
+		t.Errorf("got bad tools %v, want none", bad)
+	}
+}
@@ -0,0 +1,321 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cszatmary/shed/errors"
+	"github.com/cszatmary/shed/tool"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/mod/module"
+)
+
+// Protect marks the given tools so that they are never evicted from the cache
+// when a max size is set using WithMaxSize.
+func (c *Cache) Protect(tools ...tool.Tool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.protected == nil {
+		c.protected = make(map[string]bool)
+	}
+	for _, t := range tools {
+		fp, err := t.Filepath()
+		if err != nil {
+			// Tool is invalid so it can't be in the cache anyway
+			continue
+		}
+		c.protected[fp] = true
+	}
+}
+
+// markInstalling marks the tool at filepath fp as being installed so that it
+// is not evicted. It returns a function that must be called once the install
+// is finished to remove the mark.
+func (c *Cache) markInstalling(fp string) func() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.installing == nil {
+		c.installing = make(map[string]int)
+	}
+	c.installing[fp]++
+	return func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.installing[fp]--
+		if c.installing[fp] == 0 {
+			delete(c.installing, fp)
+		}
+	}
+}
+
+// cacheEntry represents an installed tool in the cache.
+type cacheEntry struct {
+	tool tool.Tool
+	// Relative filepath of the tool directory from the tools directory.
+	fp string
+	// Size of the directory in bytes.
+	size int64
+	// Last time any of the tool binaries was modified.
+	modTime time.Time
+}
+
+// entries returns all installed tools in the cache. Only tools that have a binary are returned,
+// which can be for any target or built with build flags.
+func (c *Cache) entries(op errors.Op) ([]cacheEntry, error) {
+	baseDir := c.toolsDir()
+	var entries []cacheEntry
+	err := filepath.WalkDir(baseDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == baseDir && os.IsNotExist(err) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		// Tool directories have the format IMPORT_PATH@VERSION
+		i := strings.LastIndexByte(d.Name(), '@')
+		if i == -1 {
+			return nil
+		}
+
+		fp, err := filepath.Rel(baseDir, p)
+		if err != nil {
+			return err
+		}
+		t, err := toolFromFilepath(fp)
+		if err != nil {
+			// Not a tool dir, ignore it
+			c.logger.WithFields(logrus.Fields{
+				"path":  p,
+				"error": err,
+			}).Debug("skipping unknown directory in cache")
+			return filepath.SkipDir
+		}
+		variants, err := c.binaryVariants(t, fp)
+		if err != nil {
+			return err
+		}
+		if len(variants) == 0 {
+			// Tool is not built, skip it
+			return filepath.SkipDir
+		}
+		var modTime time.Time
+		for _, v := range variants {
+			fi, err := os.Stat(v.path)
+			if err != nil {
+				return err
+			}
+			if fi.ModTime().After(modTime) {
+				modTime = fi.ModTime()
+			}
+		}
+		size, err := dirSize(p)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, cacheEntry{tool: t, fp: fp, size: size, modTime: modTime})
+		return filepath.SkipDir
+	})
+	if err != nil {
+		return nil, errors.New(errors.IO, fmt.Sprintf("failed to read tools in %q", baseDir), op, err)
+	}
+	return entries, nil
+}
+
+// Prune removes all tools from the cache except the ones in keep, and returns the tools that were removed.
+// Every installed version of a tool is a separate IMPORT_PATH@VERSION directory in the cache, so this
+// removes versions that are no longer used, for example after a tool was updated. Tools that are
+// protected or are currently being installed are never removed. The tools are removed in the order
+// they are found, so if an error occurs, the tools removed so far are returned along with the error.
+func (c *Cache) Prune(keep []tool.Tool) ([]tool.Tool, error) {
+	const op = errors.Op("Cache.Prune")
+	keepFps := make(map[string]bool, len(keep))
+	for _, t := range keep {
+		fp, err := t.Filepath()
+		if err != nil {
+			// Tool is invalid so it can't be in the cache anyway
+			continue
+		}
+		keepFps[fp] = true
+	}
+
+	type candidate struct {
+		t  tool.Tool
+		fp string
+	}
+	var candidates []candidate
+	baseDir := c.toolsDir()
+	c.mu.Lock()
+	err := filepath.WalkDir(baseDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == baseDir && os.IsNotExist(err) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		// Tool directories have the format IMPORT_PATH@VERSION
+		if !d.IsDir() || strings.LastIndexByte(d.Name(), '@') == -1 {
+			return nil
+		}
+		fp, err := filepath.Rel(baseDir, p)
+		if err != nil {
+			return err
+		}
+		t, err := toolFromFilepath(fp)
+		if err != nil {
+			// Not a tool dir, leave it alone
+			c.logger.WithFields(logrus.Fields{
+				"path":  p,
+				"error": err,
+			}).Debug("skipping unknown directory in cache")
+			return filepath.SkipDir
+		}
+		if !keepFps[fp] && !c.protected[fp] && c.installing[fp] == 0 {
+			candidates = append(candidates, candidate{t, fp})
+		}
+		return filepath.SkipDir
+	})
+	c.mu.Unlock()
+	if err != nil {
+		return nil, errors.New(errors.IO, fmt.Sprintf("failed to prune tools in %q", baseDir), op, err)
+	}
+
+	// The tool lock must never be acquired while holding c.mu, since install acquires them
+	// in the opposite order. Each tool is checked again once it is locked, since it may have
+	// started being installed in the meantime.
+	var removed []tool.Tool
+	for _, cand := range candidates {
+		ok, err := c.pruneTool(op, cand.t, cand.fp)
+		if err != nil {
+			return removed, errors.New(errors.IO, fmt.Sprintf("failed to prune tools in %q", baseDir), op, err)
+		}
+		if ok {
+			removed = append(removed, cand.t)
+		}
+	}
+	return removed, nil
+}
+
+// pruneTool removes tool t in the tool directory fp, unless it is protected or being installed.
+// It reports whether t was removed.
+func (c *Cache) pruneTool(op errors.Op, t tool.Tool, fp string) (bool, error) {
+	// Another process might be installing the tool using the same cache.
+	// Prune can't be cancelled, so wait for as long as it takes.
+	unlock, err := c.lockTool(context.Background(), op, t)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.protected[fp] || c.installing[fp] > 0 {
+		return false, nil
+	}
+	if err := os.RemoveAll(filepath.Join(c.toolsDir(), fp)); err != nil {
+		return false, err
+	}
+	c.logger.WithFields(logrus.Fields{
+		"tool": t,
+	}).Debug("pruned tool from cache")
+	return true, nil
+}
+
+// toolFromFilepath is the inverse of Tool.Filepath. It parses the escaped relative
+// filepath fp and returns the tool it represents.
+func toolFromFilepath(fp string) (tool.Tool, error) {
+	escaped := filepath.ToSlash(fp)
+	i := strings.LastIndexByte(escaped, '@')
+	if i == -1 {
+		return tool.Tool{}, fmt.Errorf("missing version in %q", fp)
+	}
+	importPath, err := module.UnescapePath(escaped[:i])
+	if err != nil {
+		return tool.Tool{}, err
+	}
+	version, err := module.UnescapeVersion(escaped[i+1:])
+	if err != nil {
+		return tool.Tool{}, err
+	}
+	return tool.Parse(importPath + "@" + version)
+}
+
+// dirSize returns the total size in bytes of all files in the directory dir.
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		size += fi.Size()
+		return nil
+	})
+	return size, err
+}
+
+// evict removes the least recently used tools from the cache until the size of
+// the cache is less than or equal to the max size. Tools that are protected or are
+// currently being installed are never evicted.
+func (c *Cache) evict(op errors.Op) error {
+	if c.maxSize <= 0 {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entries, err := c.entries(op)
+	if err != nil {
+		return err
+	}
+	var total int64
+	for _, e := range entries {
+		total += e.size
+	}
+	if total <= c.maxSize {
+		return nil
+	}
+
+	// Oldest first
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].modTime.Before(entries[j].modTime)
+	})
+	for _, e := range entries {
+		if total <= c.maxSize {
+			break
+		}
+		if c.protected[e.fp] || c.installing[e.fp] > 0 {
+			continue
+		}
+		dir := filepath.Join(c.toolsDir(), e.fp)
+		if err := os.RemoveAll(dir); err != nil {
+			return errors.New(errors.IO, fmt.Sprintf("failed to remove directory %q", dir), op, err)
+		}
+		total -= e.size
+		c.logger.WithFields(logrus.Fields{
+			"tool": e.tool,
+			"size": e.size,
+		}).Debug("evicted tool from cache")
+		c.progressf("Removing %s from the cache", e.tool)
+	}
+	if total > c.maxSize {
+		c.logger.WithFields(logrus.Fields{
+			"size":    total,
+			"maxSize": c.maxSize,
+		}).Warn("cache exceeds max size but no more tools can be evicted")
+	}
+	return nil
+}
@@ -3,15 +3,22 @@ package cache
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
 	"regexp"
+	"runtime"
 	"sort"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/cszatmary/shed/errors"
 	"github.com/cszatmary/shed/tool"
@@ -20,28 +27,44 @@ import (
 	"golang.org/x/mod/semver"
 )
 
-// goVersion holds the version of Go that the user has installed.
-// This is lazily computed and cached. Do not use this variable directly,
-// instead use GoVersion().
-var goVersion string
+// goVersion holds the version of Go that the user has installed, and goToolchain
+// holds the full version of the toolchain. These are lazily computed and cached.
+// Do not use these variables directly, instead use GoVersion() and GoToolchain().
+// goVersionMu must be held when accessing them, since tools can be installed concurrently.
+var (
+	goVersion   string
+	goToolchain string
+	goVersionMu sync.Mutex
+)
 
 // modfileName is the name of the go mod file used.
 const modfileName = "go.mod"
 
+// gosumName is the name of the file containing the hashes of downloaded modules.
+const gosumName = "go.sum"
+
 // createGoModFile creates and writes an empty go.mod file at the path referenced by dir.
 // mod is used as the module name. This functions similar to 'go mod init'.
-func createGoModFile(ctx context.Context, op errors.Op, mod, dir string) error {
+// goVersion is used in the go directive, if it is empty the installed Go version is used.
+// Only the major and minor versions of goVersion are used.
+func createGoModFile(ctx context.Context, op errors.Op, mod, dir, goVersion string) error {
 	modFile := &modfile.File{}
 	modFile.AddComment("// Autogenerated by https://github.com/cszatmary/shed. DO NOT EDIT")
 	if err := modFile.AddModuleStmt(mod); err != nil {
 		return errors.New(errors.Go, "failed to add module statement to modfile", op, err)
 	}
 
-	version, err := GoVersion(ctx)
-	if err != nil {
-		return err
+	if goVersion == "" {
+		var err error
+		goVersion, err = GoVersion(ctx)
+		if err != nil {
+			return err
+		}
+	} else if mm := semver.MajorMinor("v" + goVersion); mm != "" {
+		// The go directive only supports major and minor versions, for example '1.21' instead of '1.21.0'.
+		goVersion = strings.TrimPrefix(mm, "v")
 	}
-	if err := modFile.AddGoStmt(version); err != nil {
+	if err := modFile.AddGoStmt(goVersion); err != nil {
 		return errors.New(errors.Go, "failed to add go statement to modfile", op, err)
 	}
 
@@ -90,6 +113,29 @@ func readGoModFile(op errors.Op, kind errors.Kind, modfilePath string) (*modfile
 // If no modfile exists at modfilePath, both return values will be nil. If the returned error
 // is non-nil, the returned modfile will be nil.
 
+// readModuleHash reads the hash of the content of module mod from the go.sum file in dir.
+// This is the 'h1:' hash that go records for each downloaded module.
+// If the hash cannot be found, an error with kind errors.BadState is returned.
+func readModuleHash(op errors.Op, dir string, mod module.Version) (string, error) {
+	gosumPath := filepath.Join(dir, gosumName)
+	data, err := os.ReadFile(gosumPath)
+	if os.IsNotExist(err) {
+		return "", errors.New(errors.BadState, fmt.Sprintf("no hash found for module %s, %s does not exist", mod, gosumPath), op)
+	}
+	if err != nil {
+		return "", errors.New(errors.IO, fmt.Sprintf("failed to read %s", gosumPath), op, err)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		// Each line has the form '<module> <version>[/go.mod] <hash>'.
+		// Lines for the go.mod file of the module are ignored since only the content is needed.
+		fields := strings.Fields(line)
+		if len(fields) == 3 && fields[0] == mod.Path && fields[1] == mod.Version {
+			return fields[2], nil
+		}
+	}
+	return "", errors.New(errors.BadState, fmt.Sprintf("no hash found for module %s in %s", mod, gosumPath), op)
+}
+
 // getModule finds the module that provides tool t from the modfile.
 func getModule(op errors.Op, kind errors.Kind, modFile *modfile.File, t tool.Tool) (module.Version, error) {
 	// Validation checks
@@ -113,39 +159,102 @@ func getModule(op errors.Op, kind errors.Kind, modFile *modfile.File, t tool.Too
 	return mod, nil
 }
 
+// checkCaseCollision checks if the modfile belongs to a module whose path only differs
+// in case from the module of tool t. This would mean two different tools map to the same
+// directory, which should be impossible because of the escape rules used by Tool.Filepath.
+func checkCaseCollision(op errors.Op, modFile *modfile.File, t tool.Tool) error {
+	for _, r := range modFile.Require {
+		if r.Indirect || strings.HasPrefix(t.ImportPath, r.Mod.Path) {
+			continue
+		}
+		if strings.HasPrefix(strings.ToLower(t.ImportPath), strings.ToLower(r.Mod.Path)) {
+			msg := fmt.Sprintf("tool %s collides with module %s which only differs in case", t, r.Mod.Path)
+			return errors.New(errors.Internal, msg, op)
+		}
+	}
+	return nil
+}
+
 // GoVersion finds the version of Go that is installed.
 func GoVersion(ctx context.Context) (string, error) {
 	const op = errors.Op("cache.GoVersion")
+	goVersionMu.Lock()
+	defer goVersionMu.Unlock()
+	if err := loadGoVersion(ctx, op); err != nil {
+		return "", err
+	}
+	return goVersion, nil
+}
+
+// GoToolchain finds the full version of the installed Go toolchain, as reported by 'go version'.
+// For example 'go1.17.3', 'go1.18rc1', or 'devel go1.18-2d1d548' for a toolchain built from source.
+// Use IsPrereleaseToolchain to check if it is an unstable toolchain.
+func GoToolchain(ctx context.Context) (string, error) {
+	const op = errors.Op("cache.GoToolchain")
+	goVersionMu.Lock()
+	defer goVersionMu.Unlock()
+	if err := loadGoVersion(ctx, op); err != nil {
+		return "", err
+	}
+	return goToolchain, nil
+}
+
+// loadGoVersion runs 'go version' and sets goVersion and goToolchain if they haven't been set yet.
+// goVersionMu must be held when calling it.
+func loadGoVersion(ctx context.Context, op errors.Op) error {
 	if goVersion != "" {
-		return goVersion, nil
+		return nil
 	}
+	// Ignore the environment of ctx since it can change the toolchain that is used, see WithToolchain.
+	// This must always find the installed Go version since the result is shared.
+	ctx = context.WithValue(ctx, goEnvKey{}, []string(nil))
 	var stdout bytes.Buffer
-	if err := execGo(ctx, op, &stdout, "", "version"); err != nil {
-		return "", err
+	if err := execGo(ctx, op, nil, &stdout, "", "version"); err != nil {
+		return err
 	}
 	re := regexp.MustCompile(`go?((?:[1-9][0-9]*)\.(?:0|[1-9][0-9]*))`)
 	matches := re.FindSubmatch(stdout.Bytes())
 	if len(matches) != 2 {
-		return "", errors.New(
+		return errors.New(
 			errors.Go,
 			fmt.Sprintf("unexpected go version format %s, unable to parse", stdout.String()),
 			op,
 		)
 	}
 	goVersion = string(matches[1])
-	return goVersion, nil
+
+	// The output looks like 'go version go1.17.3 linux/amd64'. Toolchains built from source
+	// look like 'go version devel go1.18-2d1d548 Tue Oct 19 19:56:49 2021 +0000 linux/amd64'.
+	fields := strings.Fields(strings.TrimPrefix(stdout.String(), "go version "))
+	switch {
+	case len(fields) >= 2 && fields[0] == "devel":
+		goToolchain = fields[0] + " " + fields[1]
+	case len(fields) >= 1:
+		goToolchain = fields[0]
+	}
+	return nil
+}
+
+// prereleaseToolchainRegex matches release candidate and beta toolchain versions, like 'go1.18rc1'.
+var prereleaseToolchainRegex = regexp.MustCompile(`^go[0-9]+(?:\.[0-9]+)*(?:rc|beta)[0-9]*`)
+
+// IsPrereleaseToolchain reports whether toolchain, as returned by GoToolchain, is an unstable
+// toolchain. That is a release candidate, a beta, or a development build.
+func IsPrereleaseToolchain(toolchain string) bool {
+	return strings.HasPrefix(toolchain, "devel") || prereleaseToolchainRegex.MatchString(toolchain)
 }
 
 // Go represents the core functionality provided by the go command.
 // It allows for downloading and building of modules.
 type Go interface {
 	// Build builds pkg and outputs the binary at outPath. dir is used as the working directory
-	// when building. pkg must be a valid import path.
+	// when building. pkg must be a valid import path. flags are passed to go build before pkg,
+	// for example '-ldflags=-s -w'. flags may be empty.
 	// Build functions like 'go build -o'.
 	//
 	// The provided context is used to terminate the build if the context becomes
 	// done before the build completes on its own.
-	Build(ctx context.Context, pkg, outPath, dir string) error
+	Build(ctx context.Context, pkg, outPath, dir string, flags []string) error
 	// GetD downloads the source code for the module mod. dir is used as the working directory
 	// and is expected to contain a go.mod file which will be updated with the installed module.
 	// mod must be a valid module name, that is an import path, optionally with a version.
@@ -162,36 +271,82 @@ type Go interface {
 	// The provided context is used to terminate listing if the context becomes done
 	// before listing completes on its own.
 	ListU(ctx context.Context, mod, dir string) (GoModule, error)
+	// ListVersions lists the details of mod and all of its known versions, excluding
+	// retracted versions. dir is used as the working directory and is expected to contain
+	// a go.mod file with mod.
+	// ListVersions functions like 'go list -m -versions -json'.
+	//
+	// The provided context is used to terminate listing if the context becomes done
+	// before listing completes on its own.
+	ListVersions(ctx context.Context, mod, dir string) (GoModule, error)
+	// List lists the details of mod, including the Go version declared in its go.mod file.
+	// dir is used as the working directory and is expected to contain a go.mod file with mod.
+	// List functions like 'go list -m -json'.
+	//
+	// The provided context is used to terminate listing if the context becomes done
+	// before listing completes on its own.
+	List(ctx context.Context, mod, dir string) (GoModule, error)
+	// Install builds the package mod and places the binary in the directory gobin. mod must include
+	// a version, that is it must have the form 'IMPORT_PATH@VERSION'. The module that provides the
+	// package is returned, including the hash of its content. Install functions like 'go install' with GOBIN set,
+	// which requires Go 1.16.
+	//
+	// The provided context is used to terminate the install if the context becomes
+	// done before the install completes on its own.
+	Install(ctx context.Context, mod, gobin string) (GoModule, error)
 }
 
 type GoModule struct {
-	Path    string    // module path
-	Version string    // module version
-	Update  *GoModule // available update, if any (with -u)
+	Path      string    // module path
+	Version   string    // module version
+	Versions  []string  // available module versions (with -versions)
+	Update    *GoModule // available update, if any (with -u)
+	GoVersion string    // go version used in module
+	Sum       string    // hash of the module content, like the hashes in go.sum (with Install)
 }
 
 // realGo is the main implementation of the Go interface.
 // It is a wrapper around the go command.
-type realGo struct{}
+type realGo struct {
+	// recorder is used to record each go command run, if set.
+	recorder Recorder
+}
 
 // NewGo returns a new Go instance which allows for downloading and building modules.
 func NewGo() Go {
 	return realGo{}
 }
 
-func (realGo) Build(ctx context.Context, pkg, outPath, dir string) error {
-	return execGo(ctx, errors.Op("Go.Build"), nil, dir, "build", "-o", outPath, pkg)
+func (g realGo) Build(ctx context.Context, pkg, outPath, dir string, flags []string) error {
+	args := []string{"build", "-o", outPath}
+	args = append(args, flags...)
+	args = append(args, pkg)
+	return execGo(ctx, errors.Op("Go.Build"), g.recorder, nil, dir, args...)
 }
 
-func (realGo) GetD(ctx context.Context, mod, dir string) error {
-	return execGo(ctx, errors.Op("Go.GetD"), nil, dir, "get", "-d", mod)
+func (g realGo) GetD(ctx context.Context, mod, dir string) error {
+	return execGo(ctx, errors.Op("Go.GetD"), g.recorder, nil, dir, "get", "-d", mod)
 }
 
-func (realGo) ListU(ctx context.Context, mod, dir string) (GoModule, error) {
+func (g realGo) ListU(ctx context.Context, mod, dir string) (GoModule, error) {
 	const op = errors.Op("Go.ListU")
 	var gm GoModule
 	var stdout bytes.Buffer
-	err := execGo(ctx, op, &stdout, dir, "list", "-u", "-m", "-json", mod)
+	err := execGo(ctx, op, g.recorder, &stdout, dir, "list", "-u", "-m", "-json", mod)
+	if err != nil {
+		return gm, err
+	}
+	if err := json.NewDecoder(&stdout).Decode(&gm); err != nil {
+		return gm, errors.New(errors.Internal, "failed to unmarshal go list output json", op, err)
+	}
+	return gm, nil
+}
+
+func (g realGo) ListVersions(ctx context.Context, mod, dir string) (GoModule, error) {
+	const op = errors.Op("Go.ListVersions")
+	var gm GoModule
+	var stdout bytes.Buffer
+	err := execGo(ctx, op, g.recorder, &stdout, dir, "list", "-m", "-versions", "-json", mod)
 	if err != nil {
 		return gm, err
 	}
@@ -201,13 +356,127 @@ func (realGo) ListU(ctx context.Context, mod, dir string) (GoModule, error) {
 	return gm, nil
 }
 
-func execGo(ctx context.Context, op errors.Op, stdout io.Writer, dir string, args ...string) error {
+func (g realGo) List(ctx context.Context, mod, dir string) (GoModule, error) {
+	const op = errors.Op("Go.List")
+	var gm GoModule
+	var stdout bytes.Buffer
+	err := execGo(ctx, op, g.recorder, &stdout, dir, "list", "-m", "-json", mod)
+	if err != nil {
+		return gm, err
+	}
+	if err := json.NewDecoder(&stdout).Decode(&gm); err != nil {
+		return gm, errors.New(errors.Internal, "failed to unmarshal go list output json", op, err)
+	}
+	return gm, nil
+}
+
+func (g realGo) Install(ctx context.Context, mod, gobin string) (GoModule, error) {
+	const op = errors.Op("Go.Install")
+	var gm GoModule
+	err := execGo(withGoEnv(ctx, "GOBIN="+gobin), op, g.recorder, nil, gobin, "install", mod)
+	if err != nil {
+		return gm, err
+	}
+	// The binary is named after the last element of the import path.
+	name := path.Base(strings.SplitN(mod, "@", 2)[0])
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	binPath := filepath.Join(gobin, name)
+	// Find the main module from the build info of the binary.
+	var stdout bytes.Buffer
+	if err := execGo(ctx, op, g.recorder, &stdout, gobin, "version", "-m", binPath); err != nil {
+		return gm, err
+	}
+	for _, line := range strings.Split(stdout.String(), "\n") {
+		// The main module has the form 'mod <path> <version> [<hash>]'
+		fields := strings.Fields(line)
+		if len(fields) < 3 || fields[0] != "mod" {
+			continue
+		}
+		gm.Path = fields[1]
+		gm.Version = fields[2]
+		if len(fields) > 3 {
+			gm.Sum = fields[3]
+		}
+		return gm, nil
+	}
+	return gm, errors.New(errors.Internal, fmt.Sprintf("failed to find module in build info of %q", binPath), op)
+}
+
+// goEnvKey is the context key used to store additional environment variables for the go command.
+type goEnvKey struct{}
+
+// withGoEnv returns a copy of ctx that causes env to be set when running the go command with it.
+func withGoEnv(ctx context.Context, env ...string) context.Context {
+	return context.WithValue(ctx, goEnvKey{}, append(append([]string(nil), GoEnv(ctx)...), env...))
+}
+
+// GoEnv returns the environment variables, in the form 'key=value', that must be set in addition
+// to the environment of the current process when running the go command with ctx.
+// The cache uses this to apply the variables from WithEnv and to change how specific tools
+// are downloaded, for example to bypass the module proxy, so custom implementations of Go
+// should apply them.
+func GoEnv(ctx context.Context) []string {
+	env, _ := ctx.Value(goEnvKey{}).([]string)
+	return env
+}
+
+// ErrNetwork is wrapped by errors returned by the go command when it fails because of a network error,
+// for example because the module proxy could not be reached.
+var ErrNetwork = errors.Str("cache: network error")
+
+// networkErrors contains substrings of the errors printed by the go command when the network is unavailable.
+var networkErrors = []string{
+	"dial tcp",
+	"no such host",
+	"connection refused",
+	"connection reset by peer",
+	"network is unreachable",
+	"i/o timeout",
+	"TLS handshake timeout",
+	"Temporary failure in name resolution",
+}
+
+// isNetworkError reports whether stderr from the go command contains a network error.
+func isNetworkError(stderr string) bool {
+	for _, s := range networkErrors {
+		if strings.Contains(stderr, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// execGo runs the go command with args in dir. If rec is not nil, the command will be recorded.
+func execGo(ctx context.Context, op errors.Op, rec Recorder, stdout io.Writer, dir string, args ...string) error {
 	cmd := exec.CommandContext(ctx, "go", args...)
 	cmd.Dir = dir
+	env := GoEnv(ctx)
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
 	cmd.Stdout = stdout
 	var stderr bytes.Buffer
 	cmd.Stderr = &stderr
-	if err := cmd.Run(); err != nil {
+	start := time.Now()
+	err := cmd.Run()
+	if rec != nil {
+		rec.Record(Command{
+			Args:     args,
+			Dir:      dir,
+			Env:      env,
+			Duration: time.Since(start),
+			ExitCode: exitCode(cmd),
+		})
+	}
+	if err != nil {
+		// Make it possible to detect if go failed because the disk is full.
+		if strings.Contains(stderr.String(), "no space left on device") {
+			err = fmt.Errorf("%w: %v", syscall.ENOSPC, err)
+		} else if isNetworkError(stderr.String()) {
+			err = fmt.Errorf("%w: %v", ErrNetwork, err)
+		}
 		msg := fmt.Sprintf("failed to run 'go %s', stderr: %s", strings.Join(args, " "), stderr.String())
 		return errors.New(errors.Go, msg, op, err)
 	}
@@ -218,6 +487,8 @@ func execGo(ctx context.Context, op errors.Op, stdout io.Writer, dir string, arg
 type mockGo struct {
 	// Tool import path to module
 	registry map[string]mockModule
+	// calls records each call if set
+	calls *MockCalls
 }
 
 type mockModule struct {
@@ -227,11 +498,146 @@ type mockModule struct {
 	versions []string
 	// Queries to versions
 	queries map[string]string
+	// Set of versions that have been retracted
+	retracted map[string]bool
+	// Versions to the go directive in the go.mod of that version
+	goVersions map[string]string
+	// Versions to the hash of the module content recorded in go.sum
+	hashes map[string]string
+}
+
+// hash returns the hash of the content of modver. If no hash was set with WithMockHash,
+// a hash is derived from modver.
+func (m mockModule) hash(modver module.Version) string {
+	if hash, ok := m.hashes[modver.Version]; ok {
+		return hash
+	}
+	sum := sha256.Sum256([]byte(modver.String()))
+	return "h1:" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// MockOption is a function that applies a configuration to the Go instance created by NewMockGo.
+type MockOption func(mg *mockGo) error
+
+// WithMockRetracted marks the given versions of the tool with import path importPath as retracted.
+// Retracted versions are excluded by ListVersions, but are still used when resolving the latest
+// version in GetD. This allows testing how retracted versions are handled.
+func WithMockRetracted(importPath string, versions ...string) MockOption {
+	return func(mg *mockGo) error {
+		m, ok := mg.registry[importPath]
+		if !ok {
+			return errors.New(errors.Invalid, fmt.Sprintf("unknown package %s", importPath), errors.Op("cache.WithMockRetracted"))
+		}
+		if m.retracted == nil {
+			m.retracted = make(map[string]bool)
+		}
+		for _, v := range versions {
+			m.retracted[v] = true
+		}
+		mg.registry[importPath] = m
+		return nil
+	}
+}
+
+// WithMockGoVersion sets the go directive of the given version of the tool with import path importPath.
+// This is the Go version returned by List. If it is not set, List returns an empty Go version,
+// as if the module had no go directive.
+func WithMockGoVersion(importPath, version, goVersion string) MockOption {
+	return func(mg *mockGo) error {
+		m, ok := mg.registry[importPath]
+		if !ok {
+			return errors.New(errors.Invalid, fmt.Sprintf("unknown package %s", importPath), errors.Op("cache.WithMockGoVersion"))
+		}
+		if m.goVersions == nil {
+			m.goVersions = make(map[string]string)
+		}
+		m.goVersions[version] = goVersion
+		mg.registry[importPath] = m
+		return nil
+	}
+}
+
+// WithMockHash sets the hash that is written to go.sum when the given version of the tool with
+// import path importPath is downloaded. This allows simulating a module whose content has changed.
+// If it is not set, a hash derived from the module path and version is used.
+func WithMockHash(importPath, version, hash string) MockOption {
+	return func(mg *mockGo) error {
+		m, ok := mg.registry[importPath]
+		if !ok {
+			return errors.New(errors.Invalid, fmt.Sprintf("unknown package %s", importPath), errors.Op("cache.WithMockHash"))
+		}
+		if m.hashes == nil {
+			m.hashes = make(map[string]string)
+		}
+		m.hashes[version] = hash
+		mg.registry[importPath] = m
+		return nil
+	}
+}
+
+// MockCall describes a single call to a method of the Go instance created by NewMockGo.
+type MockCall struct {
+	// Method is the name of the method that was called, for example 'GetD'.
+	Method string
+	// Mod is the module or package the method was called with.
+	// For Build this is the package being built.
+	Mod string
+	// Dir is the working directory the method was called with.
+	Dir string
+	// Flags are the build flags Build was called with. It is nil for other methods
+	// or if Build was called without flags.
+	Flags []string
+}
+
+// MockCalls records the calls made to the Go instance created by NewMockGo, see WithMockCalls.
+// This allows tests to assert which go commands the cache would have run, and in what order.
+// A MockCalls may be used concurrently from multiple goroutines.
+type MockCalls struct {
+	mu    sync.Mutex
+	calls []MockCall
+}
+
+// Calls returns the calls that have been recorded, in the order they were made.
+func (mc *MockCalls) Calls() []MockCall {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	calls := make([]MockCall, len(mc.calls))
+	copy(calls, mc.calls)
+	return calls
+}
+
+// Reset removes all recorded calls.
+func (mc *MockCalls) Reset() {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	mc.calls = nil
+}
+
+func (mc *MockCalls) record(method, mod, dir string, flags ...string) {
+	if mc == nil {
+		return
+	}
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	call := MockCall{Method: method, Mod: mod, Dir: dir}
+	if len(flags) > 0 {
+		call.Flags = append([]string(nil), flags...)
+	}
+	mc.calls = append(mc.calls, call)
+}
+
+// WithMockCalls records each call made to the Go instance in mc.
+// Calls are recorded even if they fail.
+func WithMockCalls(mc *MockCalls) MockOption {
+	return func(mg *mockGo) error {
+		mg.calls = mc
+		return nil
+	}
 }
 
 // NewMockGo returns a new Go instance that is suitable for testing.
 // Tools is a map of import paths to a map of queries to versions.
-func NewMockGo(tools map[string]map[string]string) (Go, error) {
+func NewMockGo(tools map[string]map[string]string, opts ...MockOption) (Go, error) {
 	registry := make(map[string]mockModule)
 	for tn, queries := range tools {
 		t, err := tool.ParseLax(tn)
@@ -259,16 +665,26 @@ func NewMockGo(tools map[string]map[string]string) (Go, error) {
 			return semver.Compare(m.versions[i], m.versions[j]) == -1
 		})
 	}
-	return &mockGo{registry: registry}, nil
+	mg := &mockGo{registry: registry}
+	for _, opt := range opts {
+		if err := opt(mg); err != nil {
+			return nil, err
+		}
+	}
+	return mg, nil
 }
 
-func (mg *mockGo) Build(ctx context.Context, pkg, outPath, dir string) error {
+// mockBinary is the content of the binaries built by mockGo.
+const mockBinary = "#!/bin/sh\n"
+
+func (mg *mockGo) Build(ctx context.Context, pkg, outPath, dir string, flags []string) error {
 	const op = "mockGo.Build"
+	mg.calls.record("Build", pkg, dir, flags...)
 	if _, ok := mg.registry[pkg]; !ok {
 		return errors.New(errors.Invalid, fmt.Sprintf("unknown package %s", pkg), op)
 	}
-	// Can just write an empty file to outPath so the binary "exists"
-	if err := os.WriteFile(outPath, nil, 0o644); err != nil {
+	// Can just write a small executable file to outPath so the binary "exists"
+	if err := os.WriteFile(outPath, []byte(mockBinary), 0o755); err != nil {
 		return errors.New(errors.IO, fmt.Sprintf("failed to write build to %s", outPath), op, err)
 	}
 	return nil
@@ -276,6 +692,7 @@ func (mg *mockGo) Build(ctx context.Context, pkg, outPath, dir string) error {
 
 func (mg *mockGo) GetD(ctx context.Context, mod, dir string) error {
 	const op = "mockGo.GetD"
+	mg.calls.record("GetD", mod, dir)
 	t, err := tool.ParseLax(mod)
 	if err != nil {
 		return err
@@ -331,11 +748,20 @@ func (mg *mockGo) GetD(ctx context.Context, mod, dir string) error {
 	if err := writeGoModFile(op, modFile, modfilePath); err != nil {
 		return err
 	}
+
+	// Record the module hash in go.sum like go get does
+	hash := m.hash(modver)
+	gosumPath := filepath.Join(dir, gosumName)
+	line := fmt.Sprintf("%s %s %s\n", modver.Path, modver.Version, hash)
+	if err := os.WriteFile(gosumPath, []byte(line), 0o644); err != nil {
+		return errors.New(errors.IO, fmt.Sprintf("failed to write %s", gosumPath), op, err)
+	}
 	return nil
 }
 
 func (mg mockGo) ListU(ctx context.Context, mod, dir string) (GoModule, error) {
 	const op = "mockGo.ListU"
+	mg.calls.record("ListU", mod, dir)
 	var gm GoModule
 	modfilePath := filepath.Join(dir, modfileName)
 	modFile, err := readGoModFile(op, errors.Internal, modfilePath)
@@ -380,3 +806,98 @@ func (mg mockGo) ListU(ctx context.Context, mod, dir string) (GoModule, error) {
 	}
 	return gm, nil
 }
+
+func (mg *mockGo) Install(ctx context.Context, mod, gobin string) (GoModule, error) {
+	const op = "mockGo.Install"
+	mg.calls.record("Install", mod, gobin)
+	var gm GoModule
+	t, err := tool.ParseLax(mod)
+	if err != nil {
+		return gm, err
+	}
+	m, ok := mg.registry[t.ImportPath]
+	if !ok {
+		return gm, errors.New(errors.Invalid, fmt.Sprintf("unknown package %s", mod), op)
+	}
+	if t.Version == "" {
+		return gm, errors.New(errors.Invalid, fmt.Sprintf("package %s has no version", mod), op)
+	}
+	version, ok := m.queries[t.Version]
+	if !ok {
+		return gm, errors.New(errors.Invalid, fmt.Sprintf("module %s has no version %s", t.ImportPath, t.Version), op)
+	}
+	binPath := filepath.Join(gobin, t.Name())
+	if err := os.WriteFile(binPath, []byte(mockBinary), 0o755); err != nil {
+		return gm, errors.New(errors.IO, fmt.Sprintf("failed to write build to %s", binPath), op, err)
+	}
+	gm.Path = m.name
+	gm.Version = version
+	gm.Sum = m.hash(module.Version{Path: m.name, Version: version})
+	return gm, nil
+}
+
+func (mg *mockGo) ListVersions(ctx context.Context, mod, dir string) (GoModule, error) {
+	const op = "mockGo.ListVersions"
+	mg.calls.record("ListVersions", mod, dir)
+	var gm GoModule
+	// Find the matching module, can't do fast lookup since we don't have the tool import path
+	for _, m := range mg.registry {
+		if m.name != mod {
+			continue
+		}
+		gm.Path = m.name
+		for _, v := range m.versions {
+			if !m.retracted[v] {
+				gm.Versions = append(gm.Versions, v)
+			}
+		}
+		return gm, nil
+	}
+	return gm, errors.New(errors.Invalid, fmt.Sprintf("unknown module %s", mod), op)
+}
+
+func (mg *mockGo) List(ctx context.Context, mod, dir string) (GoModule, error) {
+	const op = "mockGo.List"
+	mg.calls.record("List", mod, dir)
+	var gm GoModule
+	modfilePath := filepath.Join(dir, modfileName)
+	modFile, err := readGoModFile(op, errors.Internal, modfilePath)
+	if err != nil {
+		return gm, err
+	}
+	if modFile == nil {
+		// Treat no go.mod as an error because it is required for shed to work properly.
+		return gm, errors.New(errors.Internal, fmt.Sprintf("no go.mod file found at %s", dir), op)
+	}
+
+	var r *modfile.Require
+	for _, rr := range modFile.Require {
+		if rr.Mod.Path == mod {
+			r = rr
+			break
+		}
+	}
+	if r == nil {
+		return gm, errors.New(errors.Invalid, fmt.Sprintf("module %s is not a known dependency", mod), op)
+	}
+
+	// Find the matching module, can't do fast lookup since we don't have the tool import path.
+	// Multiple tools can be in the same module so check all of them for a go version.
+	found := false
+	for _, m := range mg.registry {
+		if m.name != r.Mod.Path {
+			continue
+		}
+		found = true
+		if v, ok := m.goVersions[r.Mod.Version]; ok {
+			gm.GoVersion = v
+			break
+		}
+	}
+	if !found {
+		return gm, errors.New(errors.Invalid, fmt.Sprintf("unknown module %s", r.Mod.Path), op)
+	}
+	gm.Path = r.Mod.Path
+	gm.Version = r.Mod.Version
+	return gm, nil
+}
@@ -0,0 +1,75 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cszatmary/shed/errors"
+	"github.com/cszatmary/shed/tool"
+	"golang.org/x/mod/module"
+)
+
+// locksDir returns the path to the directory containing the lock files used to
+// coordinate installs between processes.
+func (c *Cache) locksDir() string {
+	return filepath.Join(c.rootDir, "locks")
+}
+
+// Backoff used by lockTool while waiting for another process to release a lock.
+const (
+	lockMinBackoff = 10 * time.Millisecond
+	lockMaxBackoff = 500 * time.Millisecond
+)
+
+// lockTool acquires an exclusive lock for installing tool t. The lock is held across processes,
+// so multiple processes sharing the same cache, for example CI jobs, will wait for each other
+// instead of writing to the same files at the same time. All versions of a tool share the same lock,
+// since tools without a version are downloaded to a directory that is shared by all versions.
+// lockTool waits until the lock is acquired or ctx is done, in which case ctx.Err() is returned.
+// It returns a function that must be called to release the lock.
+func (c *Cache) lockTool(ctx context.Context, op errors.Op, t tool.Tool) (func(), error) {
+	escapedPath, err := module.EscapePath(t.ImportPath)
+	if err != nil {
+		return nil, errors.New(errors.Invalid, fmt.Sprintf("failed to escape import path %q", t.ImportPath), op, err)
+	}
+	lockPath := filepath.Join(c.locksDir(), filepath.FromSlash(escapedPath)+".lock")
+	if err := os.MkdirAll(filepath.Dir(lockPath), 0o755); err != nil {
+		return nil, errors.New(errors.IO, fmt.Sprintf("failed to create directory %q", filepath.Dir(lockPath)), op, err)
+	}
+	// The lock file is never removed, since another process could be waiting on it.
+	f, err := os.OpenFile(lockPath, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, errors.New(errors.IO, fmt.Sprintf("failed to open lock file %q", lockPath), op, err)
+	}
+	// Poll instead of blocking on the lock, so that waiting can be cancelled using ctx.
+	backoff := lockMinBackoff
+	for {
+		locked, err := tryLockFile(f)
+		if err != nil {
+			f.Close()
+			return nil, errors.New(errors.IO, fmt.Sprintf("failed to lock file %q", lockPath), op, err)
+		}
+		if locked {
+			break
+		}
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			f.Close()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+		if backoff *= 2; backoff > lockMaxBackoff {
+			backoff = lockMaxBackoff
+		}
+	}
+	return func() {
+		// Closing the file releases the lock, but unlock explicitly to be safe.
+		_ = unlockFile(f)
+		f.Close()
+	}, nil
+}
@@ -0,0 +1,46 @@
+package cache
+
+import (
+	"os/exec"
+	"time"
+)
+
+// Command contains the details of a go command that was run.
+type Command struct {
+	// Args are the arguments passed to the go command, not including 'go' itself.
+	Args []string
+	// Dir is the working directory the command was run in.
+	// An empty string means the current directory.
+	Dir string
+	// Env contains the environment variables that were set for the command
+	// in addition to the environment of the current process.
+	Env []string
+	// Duration is how long the command took to run.
+	Duration time.Duration
+	// ExitCode is the exit code of the command. It is -1 if the
+	// command could not be started or was terminated by a signal.
+	ExitCode int
+}
+
+// Recorder records the go commands that are run by the cache.
+// Record may be called concurrently from multiple goroutines.
+type Recorder interface {
+	Record(cmd Command)
+}
+
+// RecorderFunc is an adapter to allow the use of ordinary functions as a Recorder.
+type RecorderFunc func(cmd Command)
+
+// Record calls f(cmd).
+func (f RecorderFunc) Record(cmd Command) {
+	f(cmd)
+}
+
+// exitCode returns the exit code of cmd after it was run.
+func exitCode(cmd *exec.Cmd) int {
+	// ProcessState is nil if the command could not be started.
+	if cmd.ProcessState == nil {
+		return -1
+	}
+	return cmd.ProcessState.ExitCode()
+}
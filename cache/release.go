@@ -0,0 +1,309 @@
+package cache
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/cszatmary/shed/errors"
+	"github.com/cszatmary/shed/internal/util"
+	"github.com/cszatmary/shed/tool"
+	"github.com/sirupsen/logrus"
+)
+
+// defaultReleaseURL is the base URL that binary release assets are downloaded from.
+const defaultReleaseURL = "https://github.com"
+
+// releaseMarker is the name of the file written in the directory of a tool that was downloaded
+// from a binary release instead of being built. It contains the URL of the release asset.
+// Tools with a marker have no go.mod, so the marker is what identifies them as downloaded.
+const releaseMarker = ".release"
+
+// releaseHashMarker is the name of the file written next to a binary that was downloaded from
+// a binary release. It contains the hash of the release asset the binary was extracted from.
+const releaseHashMarker = ".release-hash"
+
+// WithReleaseURL sets the base URL that binary release assets are downloaded from when a tool
+// is installed using WithBinaryRelease. This is useful for GitHub Enterprise. It defaults to
+// https://github.com.
+func WithReleaseURL(u string) Option {
+	return func(c *Cache) {
+		c.releaseURL = strings.TrimSuffix(u, "/")
+	}
+}
+
+// binaryRelease identifies a GitHub release asset containing a prebuilt binary of a tool.
+type binaryRelease struct {
+	repo  string
+	asset string
+}
+
+// WithBinaryRelease causes the tool to be downloaded as a prebuilt binary from a GitHub release
+// of repo, which has the format 'OWNER/NAME', instead of being built from source with the go command.
+// The release tag must be the version of the tool, so the tool must have an exact version.
+//
+// asset is the name of the release asset. The placeholders '{os}', '{arch}' and '{version}' are
+// replaced by the GOOS and GOARCH of the target platform, see WithTarget, and the version of the tool.
+// If the asset is a .tar.gz, .tgz or .zip archive, the file with the same name as the tool is
+// extracted from it, otherwise the asset is the binary itself.
+//
+// Since no module is downloaded, WithDirect, WithHash and WithReproducible have no effect.
+// Use WithReleaseHash to verify the downloaded asset instead.
+func WithBinaryRelease(repo, asset string) InstallOption {
+	return func(o *installOptions) {
+		o.release = &binaryRelease{repo: repo, asset: asset}
+	}
+}
+
+// WithReleaseHash sets the expected hash of the release asset that the tool is downloaded from when using
+// WithBinaryRelease, see Cache.ReleaseHash. If the downloaded asset has a different hash, Install returns an
+// error with kind errors.BadState and the tool is not installed. If the tool is already installed from an asset
+// with a different hash, the same error is returned. hash only applies to the asset for the target being
+// installed, see WithTarget. If hash is empty, the asset is not verified.
+func WithReleaseHash(hash string) InstallOption {
+	return func(o *installOptions) {
+		o.releaseHash = hash
+	}
+}
+
+// installedFromRelease reports whether the tool directory fp in the cache was downloaded from a binary release.
+func (c *Cache) installedFromRelease(fp string) bool {
+	return util.FileOrDirExists(filepath.Join(c.toolsDir(), fp, releaseMarker))
+}
+
+// installRelease does the work of Install for a tool that is downloaded from a binary release.
+// It is kept separate from the download and build steps since no go command is involved.
+// The asset is always downloaded directly into the cache, the work dir is not used.
+func (c *Cache) installRelease(ctx context.Context, op errors.Op, t tool.Tool, opts installOptions) (tool.Tool, error) {
+	if !t.HasSemver() {
+		msg := fmt.Sprintf("tool %s must have an exact version to be installed from a binary release", t)
+		return t, errors.New(errors.Invalid, msg, op)
+	}
+	fp, err := t.Filepath()
+	if err != nil {
+		return t, err
+	}
+	bfp, err := binaryFilepath(t, opts.target, opts.buildFlags)
+	if err != nil {
+		return t, err
+	}
+	binPath := filepath.Join(c.toolsDir(), bfp)
+	binDir := filepath.Dir(binPath)
+	hashPath := filepath.Join(binDir, releaseHashMarker)
+
+	installed, err := c.installed(op, t, opts.target, opts.buildFlags)
+	if err != nil {
+		return t, errors.New(fmt.Sprintf("failed to check if tool %s is installed", t), op, err)
+	}
+	if installed {
+		data, err := os.ReadFile(hashPath)
+		switch {
+		case opts.releaseHash == "":
+		case err == nil && strings.TrimSpace(string(data)) != opts.releaseHash:
+			msg := fmt.Sprintf("hash of installed release asset for tool %s does not match, expected %s but got %s", t, opts.releaseHash, strings.TrimSpace(string(data)))
+			return t, errors.New(errors.BadState, msg, op)
+		case err != nil:
+			// Installed before hashes were recorded, download it again so it can be verified.
+			installed = false
+		}
+	}
+	if installed {
+		c.logger.WithFields(logrus.Fields{
+			"tool": t,
+		}).Debug("tool already installed, skipping download")
+		return t, nil
+	}
+
+	if err := os.MkdirAll(binDir, 0o755); err != nil {
+		return t, errors.New(errors.IO, fmt.Sprintf("failed to create directory %q", binDir), op, err)
+	}
+
+	goos, goarch := runtime.GOOS, runtime.GOARCH
+	if !opts.target.IsHost() {
+		goos, goarch = opts.target.GOOS, opts.target.GOARCH
+	}
+	asset := strings.NewReplacer("{os}", goos, "{arch}", goarch, "{version}", t.Version).Replace(opts.release.asset)
+	releaseURL := c.releaseURL
+	if releaseURL == "" {
+		releaseURL = defaultReleaseURL
+	}
+	assetURL := fmt.Sprintf("%s/%s/releases/download/%s/%s", releaseURL, opts.release.repo, url.PathEscape(t.Version), url.PathEscape(asset))
+
+	// Download to a temp file first, archives need to be read in full before the binary can be extracted.
+	f, err := os.CreateTemp(binDir, ".shed-release-")
+	if err != nil {
+		return t, errors.New(errors.IO, fmt.Sprintf("failed to create temp file in %q", binDir), op, err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	c.progressf("Downloading %s", t)
+	hash, err := c.downloadAsset(ctx, op, assetURL, f)
+	if err != nil {
+		return t, errors.New(fmt.Sprintf("failed to download tool %s", t), op, err)
+	}
+	if opts.releaseHash != "" && hash != opts.releaseHash {
+		msg := fmt.Sprintf("hash of release asset %s for tool %s does not match, expected %s but got %s", assetURL, t, opts.releaseHash, hash)
+		return t, errors.New(errors.BadState, msg, op)
+	}
+	if opts.downloaded != nil {
+		opts.downloaded(t)
+	}
+
+	tmpBin := binPath + ".tmp"
+	defer os.Remove(tmpBin)
+	if err := extractBinary(f, asset, t.Name(), tmpBin); err != nil {
+		return t, errors.New(errors.Invalid, fmt.Sprintf("failed to extract binary for tool %s from %s", t, assetURL), op, err)
+	}
+	// Write the marker before moving the binary in place, so the tool is only considered installed once both exist.
+	markerPath := filepath.Join(c.toolsDir(), fp, releaseMarker)
+	if err := os.WriteFile(markerPath, []byte(assetURL+"\n"), 0o644); err != nil {
+		return t, errors.New(errors.IO, fmt.Sprintf("failed to write file %q", markerPath), op, err)
+	}
+	if err := os.WriteFile(hashPath, []byte(hash+"\n"), 0o644); err != nil {
+		return t, errors.New(errors.IO, fmt.Sprintf("failed to write file %q", hashPath), op, err)
+	}
+	if err := os.Rename(tmpBin, binPath); err != nil {
+		return t, errors.New(errors.IO, fmt.Sprintf("failed to rename %q to %q", tmpBin, binPath), op, err)
+	}
+
+	c.logger.WithFields(logrus.Fields{
+		"tool": t,
+		"url":  assetURL,
+		"path": binPath,
+	}).Debug("downloaded tool from binary release")
+	c.progressf("Installed %s", t)
+
+	if err := c.evict(op); err != nil {
+		return t, errors.New("failed to evict tools from cache", op, err)
+	}
+	return t, nil
+}
+
+// downloadAsset downloads the release asset at assetURL and writes it to f. It returns the SHA-256 hash
+// of the asset in the form 'sha256:<hex digest>'.
+// If the asset cannot be fetched because of a network error, the returned error wraps ErrNetwork.
+func (c *Cache) downloadAsset(ctx context.Context, op errors.Op, assetURL string, f *os.File) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, assetURL, nil)
+	if err != nil {
+		return "", errors.New(errors.Invalid, fmt.Sprintf("invalid release asset URL %q", assetURL), op, err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", errors.New(errors.IO, fmt.Sprintf("failed to download %s", assetURL), op, fmt.Errorf("%w: %v", ErrNetwork, err))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.New(errors.IO, fmt.Sprintf("failed to download %s, got status %s", assetURL, resp.Status), op)
+	}
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(f, h), resp.Body); err != nil {
+		return "", errors.New(errors.IO, fmt.Sprintf("failed to download %s", assetURL), op, err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", errors.New(errors.IO, fmt.Sprintf("failed to seek %q", f.Name()), op, err)
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// extractBinary writes the binary named name from the release asset in f to dst.
+// Archives are detected using the file extension of asset.
+func extractBinary(f *os.File, asset, name, dst string) error {
+	var r io.Reader
+	switch {
+	case strings.HasSuffix(asset, ".tar.gz") || strings.HasSuffix(asset, ".tgz"):
+		gr, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer gr.Close()
+		tr := tar.NewReader(gr)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				return fmt.Errorf("no file named %s found in %s", name, asset)
+			}
+			if err != nil {
+				return err
+			}
+			if hdr.Typeflag == tar.TypeReg && isBinaryName(path.Base(hdr.Name), name) {
+				r = tr
+				break
+			}
+		}
+	case strings.HasSuffix(asset, ".zip"):
+		fi, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		zr, err := zip.NewReader(f, fi.Size())
+		if err != nil {
+			return err
+		}
+		for _, zf := range zr.File {
+			if zf.FileInfo().IsDir() || !isBinaryName(path.Base(zf.Name), name) {
+				continue
+			}
+			rc, err := zf.Open()
+			if err != nil {
+				return err
+			}
+			defer rc.Close()
+			r = rc
+			break
+		}
+		if r == nil {
+			return fmt.Errorf("no file named %s found in %s", name, asset)
+		}
+	default:
+		r = f
+	}
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o755)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, r); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// isBinaryName reports whether base is the name of the binary for a tool named name.
+// Windows binaries have a .exe extension.
+func isBinaryName(base, name string) bool {
+	return base == name || base == name+".exe"
+}
+
+// ReleaseHash returns the hash of the release asset that the installed tool t was downloaded from,
+// in the form 'sha256:<hex digest>'. It can be passed to WithReleaseHash to make sure future installs
+// of t download the exact same asset. The hash is for the asset of the host platform.
+// If t is not installed, an error with kind errors.NotInstalled is returned, and if it was not
+// downloaded from a binary release, an error with kind errors.Invalid is returned.
+func (c *Cache) ReleaseHash(t tool.Tool) (string, error) {
+	const op = errors.Op("Cache.ReleaseHash")
+	binPath, err := c.toolPath(op, t, tool.Target{}, pathOptions{})
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(filepath.Join(filepath.Dir(binPath), releaseHashMarker))
+	if os.IsNotExist(err) {
+		return "", errors.New(errors.Invalid, fmt.Sprintf("tool %s was not downloaded from a binary release", t), op)
+	}
+	if err != nil {
+		return "", errors.New(errors.IO, fmt.Sprintf("failed to read release hash of tool %s", t), op, err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
@@ -0,0 +1,151 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+
+	"github.com/cszatmary/shed/errors"
+	"github.com/cszatmary/shed/internal/util"
+	"github.com/cszatmary/shed/tool"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+)
+
+// UpdateChecker checks multiple tools for updates. It remembers parsed go.mod files and the
+// update found for each module, so tools that belong to the same module version only need to
+// be checked once. Results are never invalidated, so an UpdateChecker should only be used for
+// a single batch of checks, and a new one should be created for each batch.
+//
+// An UpdateChecker is safe for concurrent use by multiple goroutines.
+type UpdateChecker struct {
+	c         *Cache
+	majorLock bool
+	mu        sync.Mutex
+	modfiles  map[string]*modfile.File
+	updates   map[module.Version]*moduleUpdate
+}
+
+// UpdateCheckerOption is a function that applies a configuration to an UpdateChecker.
+type UpdateCheckerOption func(*UpdateChecker)
+
+// WithMajorLock only finds updates that have the same major version as the installed version of a tool,
+// as determined by semver.Major. This avoids updating to a new major version which may contain breaking changes.
+// If the newest version has a different major version, the newest version with the same major version is used instead.
+func WithMajorLock() UpdateCheckerOption {
+	return func(uc *UpdateChecker) {
+		uc.majorLock = true
+	}
+}
+
+// moduleUpdate is the result of checking a single module version for an update.
+type moduleUpdate struct {
+	once    sync.Once
+	version string
+	err     error
+}
+
+// NewUpdateChecker returns a new UpdateChecker that checks for updates to tools in c.
+// opts can be used to customize how updates are found.
+func (c *Cache) NewUpdateChecker(opts ...UpdateCheckerOption) *UpdateChecker {
+	uc := &UpdateChecker{
+		c:        c,
+		modfiles: make(map[string]*modfile.File),
+		updates:  make(map[module.Version]*moduleUpdate),
+	}
+	for _, opt := range opts {
+		opt(uc)
+	}
+	return uc
+}
+
+// FindUpdate checks if there is a newer version available for tool t.
+// If no newer version is found, an empty string is returned.
+// Tools with a pseudo-version are pinned to a commit, so no update is ever found for them.
+func (uc *UpdateChecker) FindUpdate(ctx context.Context, t tool.Tool) (string, error) {
+	const op = errors.Op("UpdateChecker.FindUpdate")
+	fp, err := t.Filepath()
+	if err != nil {
+		return "", err
+	}
+	uc.c.logger.WithField("tool", t).Debug("finding module that tool belongs to")
+	dir := filepath.Join(uc.c.toolsDir(), fp)
+	modFile, err := uc.readGoModFile(op, filepath.Join(dir, modfileName))
+	if err != nil {
+		return "", err
+	}
+	if modFile == nil {
+		return "", errors.New(errors.NotInstalled, fmt.Sprintf("tool %s does not exist", t), op)
+	}
+	mod, err := getModule(op, errors.BadState, modFile, t)
+	if err != nil {
+		return "", err
+	}
+	return uc.findUpdate(ctx, op, t, mod, dir)
+}
+
+// FindModuleUpdate is like FindUpdate but uses modulePath as the module that provides tool t
+// instead of resolving it from the installed go.mod file. This is useful if the module is
+// already known, for example because it is recorded in the lockfile.
+func (uc *UpdateChecker) FindModuleUpdate(ctx context.Context, t tool.Tool, modulePath string) (string, error) {
+	const op = errors.Op("UpdateChecker.FindModuleUpdate")
+	fp, err := t.Filepath()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(uc.c.toolsDir(), fp)
+	if !util.FileOrDirExists(filepath.Join(dir, modfileName)) {
+		return "", errors.New(errors.NotInstalled, fmt.Sprintf("tool %s does not exist", t), op)
+	}
+	// The version of a tool is the version of its module
+	return uc.findUpdate(ctx, op, t, module.Version{Path: modulePath, Version: t.Version}, dir)
+}
+
+// readGoModFile is like the readGoModFile function but only reads and parses
+// each go.mod file once.
+func (uc *UpdateChecker) readGoModFile(op errors.Op, modfilePath string) (*modfile.File, error) {
+	uc.mu.Lock()
+	modFile, ok := uc.modfiles[modfilePath]
+	uc.mu.Unlock()
+	if ok {
+		return modFile, nil
+	}
+	modFile, err := readGoModFile(op, errors.BadState, modfilePath)
+	if err != nil {
+		return nil, err
+	}
+	// Don't remember missing files since the tool could still be installed.
+	if modFile != nil {
+		uc.mu.Lock()
+		uc.modfiles[modfilePath] = modFile
+		uc.mu.Unlock()
+	}
+	return modFile, nil
+}
+
+// findUpdate checks if mod has a newer version using the go.mod file in dir.
+// Each module version is only checked once, concurrent checks of the same
+// module version wait for the first one to finish.
+func (uc *UpdateChecker) findUpdate(ctx context.Context, op errors.Op, t tool.Tool, mod module.Version, dir string) (string, error) {
+	if t.IsPseudoVersion() {
+		// Tools pinned to a commit must not be replaced by a tagged release, same as 'shed get -u'.
+		uc.c.logger.Debugf("Not checking tool %s for updates since it is pinned to a commit", t)
+		return "", nil
+	}
+	uc.mu.Lock()
+	mu, ok := uc.updates[mod]
+	if !ok {
+		mu = &moduleUpdate{}
+		uc.updates[mod] = mu
+	}
+	uc.mu.Unlock()
+	mu.once.Do(func() {
+		mu.version, mu.err = uc.c.findUpdate(ctx, op, t, mod.Path, dir)
+		if mu.err == nil && mu.version != "" && uc.majorLock && semver.Major(mu.version) != semver.Major(mod.Version) {
+			mu.version, mu.err = uc.c.findMajorUpdate(ctx, op, mod, dir)
+		}
+	})
+	return mu.version, mu.err
+}
@@ -0,0 +1,282 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/cszatmary/shed/errors"
+	"github.com/cszatmary/shed/internal/util"
+	"github.com/cszatmary/shed/tool"
+	"github.com/sirupsen/logrus"
+)
+
+// VerifyOption is a function that configures a single call to Cache.Verify.
+type VerifyOption func(*verifyOptions)
+
+type verifyOptions struct {
+	repair bool
+}
+
+// WithRepair causes Verify to repair each tool that is in a bad state by downloading and building it again
+// for the same targets. Tools that were downloaded from a binary release are removed from the cache instead,
+// since the release they came from is not known. They will be downloaded again the next time they are installed.
+// The same applies to binaries built with build flags.
+func WithRepair() VerifyOption {
+	return func(o *verifyOptions) {
+		o.repair = true
+	}
+}
+
+// Verify checks every tool in the cache and returns the tools that are in a bad state, sorted by import path.
+// A tool is in a bad state if its go.mod is missing, invalid, or does not require the version of the tool,
+// or if its binary is missing or is not a valid executable. This can happen if the cache was modified
+// or an install was interrupted. Tools that are currently being installed are not checked.
+//
+// By default Verify never modifies the cache, use WithRepair to fix the tools that are found.
+// If any tools fail to be repaired, an errors.List is returned along with the tools.
+func (c *Cache) Verify(ctx context.Context, opts ...VerifyOption) ([]tool.Tool, error) {
+	const op = errors.Op("Cache.Verify")
+	var verifyOpts verifyOptions
+	for _, opt := range opts {
+		opt(&verifyOpts)
+	}
+
+	type badTool struct {
+		t  tool.Tool
+		fp string
+	}
+	var bad []badTool
+	baseDir := c.toolsDir()
+	c.mu.Lock()
+	err := filepath.WalkDir(baseDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == baseDir && os.IsNotExist(err) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		// Tool directories have the format IMPORT_PATH@VERSION
+		if !d.IsDir() || strings.LastIndexByte(d.Name(), '@') == -1 {
+			return nil
+		}
+		fp, err := filepath.Rel(baseDir, p)
+		if err != nil {
+			return err
+		}
+		t, err := toolFromFilepath(fp)
+		if err != nil {
+			// Not a tool dir, leave it alone
+			c.logger.WithFields(logrus.Fields{
+				"path":  p,
+				"error": err,
+			}).Debug("skipping unknown directory in cache")
+			return filepath.SkipDir
+		}
+		if c.installing[fp] > 0 {
+			return filepath.SkipDir
+		}
+		if err := c.verifyTool(op, t, fp); err != nil {
+			c.logger.WithFields(logrus.Fields{
+				"tool":  t,
+				"error": err,
+			}).Debug("tool is in a bad state")
+			bad = append(bad, badTool{t, fp})
+		}
+		return filepath.SkipDir
+	})
+	c.mu.Unlock()
+	if err != nil {
+		return nil, errors.New(errors.IO, fmt.Sprintf("failed to verify tools in %q", baseDir), op, err)
+	}
+
+	sort.SliceStable(bad, func(i, j int) bool {
+		return bad[i].t.ImportPath < bad[j].t.ImportPath
+	})
+	tools := make([]tool.Tool, len(bad))
+	for i, b := range bad {
+		tools[i] = b.t
+	}
+	if !verifyOpts.repair {
+		return tools, nil
+	}
+
+	var errs errors.List
+	for _, b := range bad {
+		if err := c.repairTool(ctx, op, b.t, b.fp); err != nil {
+			errs = append(errs, errors.New(fmt.Sprintf("failed to repair tool %s", b.t), op, err))
+		}
+	}
+	if len(errs) > 0 {
+		return tools, errs
+	}
+	return tools, nil
+}
+
+// verifyTool checks the go.mod and binary of tool t in the tool directory fp.
+// It returns an error describing the problem if t is in a bad state.
+func (c *Cache) verifyTool(op errors.Op, t tool.Tool, fp string) error {
+	if c.installedFromRelease(fp) {
+		// Tools downloaded from a binary release have no go.mod, only the binary needs to be checked.
+		return c.verifyBinary(op, t, fp)
+	}
+	modfilePath := filepath.Join(c.toolsDir(), fp, modfileName)
+	modFile, err := readGoModFile(op, errors.BadState, modfilePath)
+	if err != nil {
+		return err
+	}
+	if modFile == nil {
+		return errors.New(errors.BadState, fmt.Sprintf("go.mod for tool %s does not exist", t), op)
+	}
+	mod, err := getModule(op, errors.BadState, modFile, t)
+	if err != nil {
+		return err
+	}
+	if mod.Version != t.Version {
+		msg := fmt.Sprintf("go.mod for tool %s requires version %s", t, mod.Version)
+		return errors.New(errors.BadState, msg, op)
+	}
+	return c.verifyBinary(op, t, fp)
+}
+
+// binaryVariant is a binary of a tool in its tool directory.
+type binaryVariant struct {
+	path   string
+	target tool.Target
+	// buildFlags is true if the binary was built with build flags.
+	buildFlags bool
+}
+
+// binaryVariants returns every binary of tool t that exists in the tool directory fp. This includes the
+// host binary, binaries built for other targets in GOOS_GOARCH directories, and binaries built with
+// build flags in build-* directories.
+func (c *Cache) binaryVariants(t tool.Tool, fp string) ([]binaryVariant, error) {
+	var variants []binaryVariant
+	// addVariants adds the binaries for target in dir, including the ones built with build flags.
+	addVariants := func(dir string, target tool.Target) error {
+		if p := filepath.Join(dir, t.Name()); util.FileOrDirExists(p) {
+			variants = append(variants, binaryVariant{path: p, target: target})
+		}
+		paths, err := filepath.Glob(filepath.Join(dir, buildFlagsDirPrefix+"*", t.Name()))
+		if err != nil {
+			return err
+		}
+		for _, p := range paths {
+			variants = append(variants, binaryVariant{path: p, target: target, buildFlags: true})
+		}
+		return nil
+	}
+
+	dir := filepath.Join(c.toolsDir(), fp)
+	if err := addVariants(dir, tool.Target{}); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, e := range entries {
+		// Target directories have the format GOOS_GOARCH
+		i := strings.IndexByte(e.Name(), '_')
+		if !e.IsDir() || i == -1 {
+			continue
+		}
+		target := tool.Target{GOOS: e.Name()[:i], GOARCH: e.Name()[i+1:]}
+		if target.Validate() != nil {
+			continue
+		}
+		if err := addVariants(filepath.Join(dir, e.Name()), target); err != nil {
+			return nil, err
+		}
+	}
+	return variants, nil
+}
+
+// verifyBinary checks that the binaries of tool t in the tool directory fp exist and are usable.
+// Every binary that exists is checked, since a tool might only have been built for another target
+// or with build flags. If there are no binaries, t is in a bad state.
+func (c *Cache) verifyBinary(op errors.Op, t tool.Tool, fp string) error {
+	variants, err := c.binaryVariants(t, fp)
+	if err != nil {
+		return errors.New(errors.IO, fmt.Sprintf("failed to find binaries for tool %s", t), op, err)
+	}
+	if len(variants) == 0 {
+		return errors.New(errors.BadState, fmt.Sprintf("binary for tool %s does not exist", t), op)
+	}
+	for _, v := range variants {
+		if err := validateBinary(op, t, v.path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// repairTool repairs tool t in the tool directory fp. It is reinstalled from scratch and the binaries
+// for the same targets are built again. Binaries built with build flags are removed, since the flags
+// are not known, and are rebuilt the next time they are installed. If t only has binaries built with
+// build flags or was downloaded from a binary release, it is removed instead.
+func (c *Cache) repairTool(ctx context.Context, op errors.Op, t tool.Tool, fp string) error {
+	if c.installedFromRelease(fp) {
+		return c.removeTool(ctx, op, t, fp)
+	}
+	variants, err := c.binaryVariants(t, fp)
+	if err != nil {
+		return errors.New(errors.IO, fmt.Sprintf("failed to find binaries for tool %s", t), op, err)
+	}
+	var targets []tool.Target
+	for _, v := range variants {
+		if !v.buildFlags {
+			targets = append(targets, v.target)
+		}
+	}
+	if len(targets) == 0 {
+		if len(variants) > 0 {
+			return c.removeTool(ctx, op, t, fp)
+		}
+		// No binaries are left, so the targets it was built for are not known
+		targets = append(targets, tool.Target{})
+	}
+	// Keep the binaries reproducible so that their hashes still match.
+	// This must be checked before the tool is removed by Reinstall.
+	reproducible := make([]bool, len(targets))
+	for i, target := range targets {
+		reproducible[i] = c.builtReproducibly(c.toolsDir(), t, target, nil)
+	}
+	for i, target := range targets {
+		opts := []InstallOption{WithTarget(target)}
+		if reproducible[i] {
+			opts = append(opts, WithReproducible())
+		}
+		if i == 0 {
+			_, err = c.Reinstall(ctx, t, opts...)
+		} else {
+			_, err = c.Install(ctx, t, opts...)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeTool removes tool t in the tool directory fp from the cache.
+func (c *Cache) removeTool(ctx context.Context, op errors.Op, t tool.Tool, fp string) error {
+	// Another process might be installing the tool using the same cache.
+	unlock, err := c.lockTool(ctx, op, t)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	dir := filepath.Join(c.toolsDir(), fp)
+	if err := os.RemoveAll(dir); err != nil {
+		return errors.New(errors.IO, fmt.Sprintf("failed to remove directory %q", dir), op, err)
+	}
+	c.logger.WithFields(logrus.Fields{
+		"tool": t,
+	}).Debug("removed tool from cache")
+	return nil
+}
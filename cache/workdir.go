@@ -0,0 +1,108 @@
+package cache
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/cszatmary/shed/errors"
+	"github.com/cszatmary/shed/tool"
+	"github.com/sirupsen/logrus"
+)
+
+// moveToCache moves the go.mod, go.sum and binary for target built with buildFlags of tool t from stageDir to the cache.
+// The binary is moved last so that the tool is only considered installed once all files are in place.
+func (c *Cache) moveToCache(op errors.Op, t tool.Tool, target tool.Target, buildFlags []string, stageDir string) error {
+	fp, err := t.Filepath()
+	if err != nil {
+		return err
+	}
+	bfp, err := binaryFilepath(t, target, buildFlags)
+	if err != nil {
+		return err
+	}
+	srcDir := filepath.Join(stageDir, fp)
+	dstDir := filepath.Join(c.toolsDir(), fp)
+	// The binary may be in a subdirectory if it was built for a different target or with build flags
+	binDir, err := filepath.Rel(fp, filepath.Dir(bfp))
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Join(dstDir, binDir), 0o755); err != nil {
+		return errors.New(errors.IO, fmt.Sprintf("failed to create directory %q", filepath.Join(dstDir, binDir)), op, err)
+	}
+
+	markerNames := map[string]bool{
+		filepath.Join(binDir, reproducibleMarker): true,
+		filepath.Join(binDir, toolchainMarker):    true,
+		filepath.Join(binDir, buildFlagsMarker):   true,
+	}
+	names := []string{modfileName, gosumName}
+	for name := range markerNames {
+		names = append(names, name)
+	}
+	names = append(names, filepath.Join(binDir, t.Name()))
+	for _, name := range names {
+		src := filepath.Join(srcDir, name)
+		if _, err := os.Stat(src); os.IsNotExist(err) {
+			// go.sum may not exist if there are no dependencies, and the markers only exist
+			// for reproducible builds or builds with a specific toolchain or build flags
+			if markerNames[name] {
+				// Make sure a stale marker doesn't apply to the new binary
+				if err := os.RemoveAll(filepath.Join(dstDir, name)); err != nil {
+					return errors.New(errors.IO, fmt.Sprintf("failed to remove %q", filepath.Join(dstDir, name)), op, err)
+				}
+			}
+			continue
+		}
+		dst := filepath.Join(dstDir, name)
+		if err := moveFile(src, dst); err != nil {
+			return errors.New(errors.IO, fmt.Sprintf("failed to move %q to %q", src, dst), op, err)
+		}
+	}
+	c.logger.WithFields(logrus.Fields{
+		"tool": t,
+		"path": dstDir,
+	}).Debug("moved tool to cache")
+	return nil
+}
+
+// moveFile moves the file at src to dst. If src and dst are on different devices,
+// the file is copied and then src is removed.
+func moveFile(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+
+	// Rename fails across devices, fallback to copying. Copy to a temp file
+	// first and rename it so that dst is never partially written.
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	fi, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	tmp := dst + ".tmp"
+	out, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Remove(src)
+}
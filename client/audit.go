@@ -0,0 +1,182 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/cszatmary/shed/cache"
+	"github.com/cszatmary/shed/errors"
+	"github.com/cszatmary/shed/tool"
+	"github.com/sirupsen/logrus"
+)
+
+// govulncheckImportPath is the import path of the govulncheck tool used by Shed.Audit.
+const govulncheckImportPath = "golang.org/x/vuln/cmd/govulncheck"
+
+// Vulnerability contains information about a known vulnerability affecting a tool.
+type Vulnerability struct {
+	// Tool is the tool affected by the vulnerability.
+	Tool tool.Tool
+	// ID is the ID of the vulnerability in the Go vulnerability database.
+	// For example 'GO-2022-0969'.
+	ID string
+	// Summary is a short description of the vulnerability.
+	Summary string
+	// Module is the module that contains the vulnerability. This is either
+	// the module of the tool or one of its dependencies.
+	Module string
+	// Version is the version of Module used by the tool.
+	Version string
+	// FixedVersion is the earliest version of Module that fixes the vulnerability.
+	// It is empty if no fix is available.
+	FixedVersion string
+}
+
+// Audit checks each tool in the lockfile for known vulnerabilities using govulncheck.
+// The installed binary of each tool is scanned, so all tools must be installed.
+//
+// If govulncheck is managed by shed, that is it is in the lockfile, the installed version is used.
+// Otherwise govulncheck is looked up in PATH. If it cannot be found, an error with kind
+// errors.NotInstalled is returned.
+//
+// The returned vulnerabilities are sorted by import path of the affected tool.
+func (s *Shed) Audit(ctx context.Context) ([]Vulnerability, error) {
+	const op = errors.Op("Shed.Audit")
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	govulncheckPath, err := s.findGovulncheck(op)
+	if err != nil {
+		return nil, err
+	}
+	s.logger.Debugf("Using govulncheck at %s", govulncheckPath)
+
+	// Make sure all tools are installed before starting, since checking can be slow
+	type installedTool struct {
+		t       tool.Tool
+		binPath string
+	}
+	var tools []installedTool
+	var errs errors.List
+	it := s.lf.Iter()
+	for it.Next() {
+		t := it.Value()
+		binPath, err := s.cache.ToolPath(t, cache.ForBuildFlags(s.lf.BuildFlags(t.ImportPath)...))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		tools = append(tools, installedTool{t, binPath})
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	sort.Slice(tools, func(i, j int) bool {
+		return tools[i].t.ImportPath < tools[j].t.ImportPath
+	})
+
+	var vulns []Vulnerability
+	for _, tl := range tools {
+		s.logger.WithFields(logrus.Fields{
+			"tool": tl.t,
+			"path": tl.binPath,
+		}).Debugf("Checking tool for vulnerabilities")
+		toolVulns, err := govulncheck(ctx, op, govulncheckPath, tl.binPath)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range toolVulns {
+			v.Tool = tl.t
+			vulns = append(vulns, v)
+		}
+	}
+	return vulns, nil
+}
+
+// findGovulncheck returns the path to the govulncheck binary.
+func (s *Shed) findGovulncheck(op errors.Op) (string, error) {
+	t, err := s.lf.GetTool(govulncheckImportPath)
+	if err == nil {
+		return s.cache.ToolPath(t, cache.ForBuildFlags(s.lf.BuildFlags(t.ImportPath)...))
+	}
+	p, err := exec.LookPath("govulncheck")
+	if err != nil {
+		msg := fmt.Sprintf("govulncheck is not installed, it can be installed by running 'shed get %s'", govulncheckImportPath)
+		return "", errors.New(errors.NotInstalled, msg, op, err)
+	}
+	return p, nil
+}
+
+// govulncheckMessage is a single message in the JSON output of govulncheck.
+// Only the fields used by shed are included.
+type govulncheckMessage struct {
+	OSV *struct {
+		ID      string `json:"id"`
+		Summary string `json:"summary"`
+	} `json:"osv"`
+	Finding *struct {
+		OSV          string `json:"osv"`
+		FixedVersion string `json:"fixed_version"`
+		Trace        []struct {
+			Module  string `json:"module"`
+			Version string `json:"version"`
+		} `json:"trace"`
+	} `json:"finding"`
+}
+
+// govulncheck runs govulncheck on the binary at binPath and returns the vulnerabilities found.
+// The Tool field of each returned vulnerability is not set.
+func govulncheck(ctx context.Context, op errors.Op, govulncheckPath, binPath string) ([]Vulnerability, error) {
+	args := []string{"-mode", "binary", "-json", binPath}
+	cmd := exec.CommandContext(ctx, govulncheckPath, args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		msg := fmt.Sprintf("failed to run 'govulncheck %s', stderr: %s", strings.Join(args, " "), stderr.String())
+		return nil, errors.New(errors.Internal, msg, op, err)
+	}
+
+	// The output is a stream of JSON objects. The OSV entries are reported before
+	// any findings that reference them. A vulnerability can have multiple findings,
+	// one for each affected symbol, so only keep the first one per module.
+	summaries := make(map[string]string)
+	seen := make(map[string]bool)
+	var vulns []Vulnerability
+	dec := json.NewDecoder(&stdout)
+	for {
+		var m govulncheckMessage
+		err := dec.Decode(&m)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.New(errors.Internal, "failed to unmarshal govulncheck output json", op, err)
+		}
+		if m.OSV != nil {
+			summaries[m.OSV.ID] = m.OSV.Summary
+		}
+		if m.Finding == nil || len(m.Finding.Trace) == 0 {
+			continue
+		}
+		f := m.Finding
+		key := f.OSV + " " + f.Trace[0].Module
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		vulns = append(vulns, Vulnerability{
+			ID:           f.OSV,
+			Summary:      summaries[f.OSV],
+			Module:       f.Trace[0].Module,
+			Version:      f.Trace[0].Version,
+			FixedVersion: f.FixedVersion,
+		})
+	}
+	return vulns, nil
+}
@@ -2,13 +2,20 @@
 package client
 
 import (
+	"bufio"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
+	"path"
 	"path/filepath"
 	"runtime"
 	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/cszatmary/shed/cache"
 	"github.com/cszatmary/shed/errors"
@@ -29,10 +36,40 @@ const (
 	latestVersion = "latest"
 )
 
+// DefaultResolveBoundary is the marker used by ResolveLockfilePath to detect
+// the root of a repository. See WithResolveBoundary.
+const DefaultResolveBoundary = ".git"
+
+// ResolveOption is a function that configures how ResolveLockfilePath searches for a lockfile.
+type ResolveOption func(*resolveOptions)
+
+type resolveOptions struct {
+	boundary string
+}
+
+// WithResolveBoundary sets the name of a file or directory that marks a repository boundary.
+// ResolveLockfilePath will not search past a directory that contains marker. This prevents
+// finding a lockfile that belongs to a different project, for example a repo nested inside another repo.
+// If marker is empty, no boundary is used and the search continues until the root directory.
+// The default is DefaultResolveBoundary.
+func WithResolveBoundary(marker string) ResolveOption {
+	return func(o *resolveOptions) {
+		o.boundary = marker
+	}
+}
+
 // ResolveLockfilePath resolves the path to the nearest shed lockfile starting at dir.
-// It will keep searching parent directories until either a lockfile is found,
-// or the root directory is reached. If no lockfile is found, an empty string will be returned.
-func ResolveLockfilePath(dir string) string {
+// It will keep searching parent directories until either a lockfile is found, a
+// repository boundary is reached, or the root directory is reached. The directory containing
+// the boundary marker is still searched. If no lockfile is found, an empty string will be returned.
+//
+// By default, a directory containing a '.git' file or directory is the boundary.
+// Use WithResolveBoundary to change this.
+func ResolveLockfilePath(dir string, opts ...ResolveOption) string {
+	o := resolveOptions{boundary: DefaultResolveBoundary}
+	for _, opt := range opts {
+		opt(&o)
+	}
 	// "" is synonymous with "."
 	// This makes sure we do at least one check in the current directory
 	if dir == "" {
@@ -44,23 +81,75 @@ func ResolveLockfilePath(dir string) string {
 		if util.FileOrDirExists(p) {
 			return p
 		}
+		if o.boundary != "" && util.FileOrDirExists(filepath.Join(dir, o.boundary)) {
+			break
+		}
 		prev = dir
 		dir = filepath.Dir(dir)
 	}
 	return ""
 }
 
+// GlobalLockfilePath returns the path to the global lockfile, which is used to manage
+// tools that are not tied to a project. It is 'os.UserConfigDir()/shed/shed.lock'.
+// An error is returned if the user config directory cannot be determined.
+func GlobalLockfilePath() (string, error) {
+	const op = errors.Op("client.GlobalLockfilePath")
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", errors.New(errors.IO, "unable to find user config directory", op, err)
+	}
+	return filepath.Join(dir, "shed", LockfileName), nil
+}
+
 // Shed provides the API for managing tool dependencies with shed.
+// A Shed is safe for concurrent use by multiple goroutines. For example, List can be called
+// while an InstallSet is being applied, and will see the lockfile either before or after
+// Apply updates it, never part way through.
 type Shed struct {
-	cache        *cache.Cache
-	lf           *lockfile.Lockfile
+	cache *cache.Cache
+	// mu guards lf, baseLf and overlayLf, since they can be read and modified by different goroutines.
+	// Exported methods acquire it, unexported helpers expect the caller to hold it.
+	mu sync.RWMutex
+	// lf is the lockfile used for all reads. If an overlay is used,
+	// this is the result of merging the overlay into the base lockfile.
+	lf *lockfile.Lockfile
+	// baseLf is the lockfile that is written to lockfilePath.
+	// If no overlay is used, it is the same as lf.
+	baseLf       *lockfile.Lockfile
 	lockfilePath string
-	logger       logrus.FieldLogger
+	// overlayLf contains the tools from the overlay lockfile, if one was loaded.
+	// The overlay is read-only and is never written.
+	overlayLf   *lockfile.Lockfile
+	overlayPath string
+	// noLockfile is set if no lockfile should be read or written.
+	noLockfile bool
+	// globalLockfile is set if the global lockfile should be used, see GlobalLockfilePath.
+	globalLockfile bool
+	// strictLockfile is set if unknown fields in the lockfile should be errors.
+	strictLockfile bool
+	// versionFormat controls how versions are written to the lockfile.
+	versionFormat lockfile.VersionFormat
+	// compactLockfile is set if the lockfile should be written in the compact format.
+	compactLockfile bool
+	// importPathPolicy is used to check the import paths provided to Get if set.
+	importPathPolicy *ImportPathPolicy
+	// versionResolver is used to find the versions of tools provided to Get without a version if set.
+	versionResolver VersionResolver
+	// cacheOpts are used when creating the default cache.
+	cacheOpts []cache.Option
+	logger    logrus.FieldLogger
 }
 
 // NewShed creates a new Shed instance. Options can be provided to customize the created Shed instance.
 //
-// By default, the lockfile path used is './shed.lock' and the cache directory is 'os.UserCacheDir()/shed'.
+// By default, the lockfile path used is './shed.lock'. The default cache directory is resolved
+// in the following order:
+//
+//  1. The value of the SHED_CACHE_DIR environment variable, if set.
+//  2. 'os.UserCacheDir()/shed'.
+//  3. '$XDG_CACHE_HOME/shed', if XDG_CACHE_HOME is set.
+//  4. 'os.TempDir()/shed-cache'. A warning is logged in this case since the cache may not persist.
 func NewShed(opts ...Option) (*Shed, error) {
 	const op = errors.Op("client.NewShed")
 	s := &Shed{}
@@ -68,6 +157,14 @@ func NewShed(opts ...Option) (*Shed, error) {
 		opt(s)
 	}
 
+	if s.globalLockfile {
+		lfp, err := GlobalLockfilePath()
+		if err != nil {
+			return nil, errors.New("failed to resolve global lockfile path", op, err)
+		}
+		s.lockfilePath = lfp
+	}
+
 	// Set defaults
 	if s.lockfilePath == "" {
 		s.lockfilePath = LockfileName
@@ -80,29 +177,110 @@ func NewShed(opts ...Option) (*Shed, error) {
 		s.logger = logger
 	}
 	if s.cache == nil {
-		userCacheDir, err := os.UserCacheDir()
-		if err != nil {
-			return nil, errors.New(errors.Invalid, "unable to find user cache directory", op, err)
-		}
-		s.cache = cache.New(filepath.Join(userCacheDir, "shed"), cache.WithLogger(s.logger))
+		cacheOpts := append([]cache.Option{cache.WithLogger(s.logger)}, s.cacheOpts...)
+		s.cache = cache.New(defaultCacheDir(s.logger), cacheOpts...)
 	}
 
-	f, err := os.Open(s.lockfilePath)
-	if os.IsNotExist(err) {
+	if err := s.loadLockfile(op); err != nil {
+		return nil, err
+	}
+	s.lf.SetVersionFormat(s.versionFormat)
+	s.baseLf.SetVersionFormat(s.versionFormat)
+	if s.compactLockfile {
+		s.baseLf.SetCompact(true)
+	}
+	// Tools in the lockfile must never be evicted from the cache.
+	var tools []tool.Tool
+	it := s.lf.Iter()
+	for it.Next() {
+		tools = append(tools, it.Value())
+	}
+	s.cache.Protect(tools...)
+	return s, nil
+}
+
+// defaultCacheDir returns the cache directory to use if one was not provided.
+// See NewShed for details on how it is resolved.
+func defaultCacheDir(logger logrus.FieldLogger) string {
+	if dir := os.Getenv("SHED_CACHE_DIR"); dir != "" {
+		return dir
+	}
+	userCacheDir, err := os.UserCacheDir()
+	if err == nil {
+		return filepath.Join(userCacheDir, "shed")
+	}
+	logger.Debugf("Unable to find user cache directory: %v", err)
+	if dir := os.Getenv("XDG_CACHE_HOME"); dir != "" {
+		return filepath.Join(dir, "shed")
+	}
+	dir := filepath.Join(os.TempDir(), "shed-cache")
+	logger.Warnf("Unable to find user cache directory, using %s instead. Set SHED_CACHE_DIR to use a different directory.", dir)
+	return dir
+}
+
+// loadLockfile reads the lockfile, and overlay if one is used, and sets up s.lf and s.baseLf.
+func (s *Shed) loadLockfile(op errors.Op) error {
+	if s.noLockfile {
+		s.baseLf = &lockfile.Lockfile{}
+		s.lf = s.baseLf
+		return nil
+	}
+
+	var err error
+	s.baseLf, err = readLockfile(op, s.lockfilePath, s.strictLockfile)
+	if err != nil {
+		return err
+	}
+	if s.baseLf == nil {
 		// No lockfile, create an empty one
-		s.lf = &lockfile.Lockfile{}
-		return s, nil
+		s.baseLf = &lockfile.Lockfile{}
+	}
+	s.lf = s.baseLf
+	if s.overlayPath == "" {
+		return nil
+	}
+
+	s.overlayLf, err = readLockfile(op, s.overlayPath, s.strictLockfile)
+	if err != nil {
+		return err
+	}
+	if s.overlayLf == nil {
+		s.logger.Debugf("No overlay lockfile found at %s, skipping", s.overlayPath)
+		return nil
+	}
+	// Compute the merged view of the lockfile, tools in the overlay take precedence.
+	s.lf = &lockfile.Lockfile{}
+	if err := s.lf.Merge(s.baseLf, lockfile.PreferOther); err != nil {
+		return errors.New(errors.Internal, "failed to merge base lockfile", op, err)
+	}
+	if err := s.lf.Merge(s.overlayLf, lockfile.PreferOther); err != nil {
+		return errors.New(errors.Internal, fmt.Sprintf("failed to merge overlay lockfile %q", s.overlayPath), op, err)
+	}
+	s.logger.Debugf("Using overlay lockfile %s", s.overlayPath)
+	return nil
+}
+
+// readLockfile reads and parses the lockfile at path. If strict is true, unknown fields are errors.
+// If no file exists at path, both return values will be nil.
+func readLockfile(op errors.Op, path string, strict bool) (*lockfile.Lockfile, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
 	}
 	if err != nil {
-		return nil, errors.New(errors.IO, fmt.Sprintf("failed to open file %q", s.lockfilePath), op, err)
+		return nil, errors.New(errors.IO, fmt.Sprintf("failed to open file %q", path), op, err)
 	}
 	defer f.Close()
 
-	s.lf, err = lockfile.Parse(f)
+	parse := lockfile.Parse
+	if strict {
+		parse = lockfile.ParseStrict
+	}
+	lf, err := parse(f)
 	if err != nil {
-		return nil, errors.New(errors.Internal, fmt.Sprintf("failed to parse lockfile %q", s.lockfilePath), op, err)
+		return nil, errors.New(errors.Internal, fmt.Sprintf("failed to parse lockfile %q", path), op, err)
 	}
-	return s, nil
+	return lf, nil
 }
 
 // Option is a function that takes a Shed instance and applies a configuration to it.
@@ -115,6 +293,61 @@ func WithLockfilePath(lfp string) Option {
 	}
 }
 
+// WithGlobalLockfile makes Shed use the global lockfile returned by GlobalLockfilePath instead of
+// a project lockfile. This allows managing tools that are used across projects. The lockfile and
+// its parent directory are created when the lockfile is first written.
+// WithGlobalLockfile takes precedence over WithLockfilePath.
+func WithGlobalLockfile() Option {
+	return func(s *Shed) {
+		s.globalLockfile = true
+	}
+}
+
+// WithOverlay sets the path to an overlay lockfile. Tools in the overlay replace
+// the tools with the same import path in the lockfile. The overlay is read-only,
+// all changes are only written to the lockfile. If no file exists at path,
+// no overlay is used.
+func WithOverlay(path string) Option {
+	return func(s *Shed) {
+		s.overlayPath = path
+	}
+}
+
+// WithoutLockfile makes Shed not use a lockfile. No lockfile will be read and
+// an empty lockfile is used instead. Operations that would write the lockfile
+// will return an error.
+func WithoutLockfile() Option {
+	return func(s *Shed) {
+		s.noLockfile = true
+	}
+}
+
+// WithStrictLockfile makes Shed return an error when reading a lockfile that contains unknown fields,
+// for example a misspelled field name. This applies to both the lockfile and the overlay.
+// By default unknown fields are ignored.
+func WithStrictLockfile() Option {
+	return func(s *Shed) {
+		s.strictLockfile = true
+	}
+}
+
+// WithVersionFormat sets how tool versions are normalized before they are written to the lockfile.
+// By default, lockfile.VersionFormatExact is used.
+func WithVersionFormat(f lockfile.VersionFormat) Option {
+	return func(s *Shed) {
+		s.versionFormat = f
+	}
+}
+
+// WithCompactLockfile makes Shed write the lockfile in the compact format, where each tool is on a single line.
+// This reduces the size of lockfiles with many tools and the noise in their diffs, at the cost of readability.
+// Lockfiles that are already compact are always kept compact, see lockfile.Lockfile.SetCompact.
+func WithCompactLockfile() Option {
+	return func(s *Shed) {
+		s.compactLockfile = true
+	}
+}
+
 // WithLogger sets a logger that should be used for writing debug messages.
 // By default no logging is done.
 func WithLogger(logger logrus.FieldLogger) Option {
@@ -130,37 +363,354 @@ func WithCache(c *cache.Cache) Option {
 	}
 }
 
+// WithCacheOptions sets options that are used to create the default Cache instance.
+// It has no effect if WithCache is used.
+func WithCacheOptions(opts ...cache.Option) Option {
+	return func(s *Shed) {
+		s.cacheOpts = append(s.cacheOpts, opts...)
+	}
+}
+
+// LockfilePath returns the path to the lockfile used. If no lockfile is used, an empty string is returned.
+func (s *Shed) LockfilePath() string {
+	if s.noLockfile {
+		return ""
+	}
+	return s.lockfilePath
+}
+
+// ToolsByName returns all tools in the lockfile whose binary name is name, sorted by import path.
+// This can be used to show the possible tools when a lookup fails with lockfile.ErrMultipleTools.
+func (s *Shed) ToolsByName(name string) []tool.Tool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.lf.ToolsByName(name)
+}
+
+// StatsByHost returns the number of tools in the lockfile for each host, for example 'github.com'.
+func (s *Shed) StatsByHost() map[string]int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.lf.StatsByHost()
+}
+
 // CacheDir returns the OS filesystem directory where the shed cache is located.
 func (s *Shed) CacheDir() string {
 	return s.cache.Dir()
 }
 
+// CacheSize returns the total size in bytes of the cache directory.
+// If the cache directory does not exist, 0 is returned.
+func (s *Shed) CacheSize() (int64, error) {
+	return s.cache.Size()
+}
+
 // CleanCache removes the cache directory and all contents from the filesystem.
 func (s *Shed) CleanCache() error {
 	return s.cache.Clean()
 }
 
+// Prune removes all tools from the cache that are not in the lockfile, and returns the tools that were removed.
+// This frees up the space used by old versions of tools that are no longer needed.
+// Since the cache is shared between projects, tools used only by other projects are also removed.
+func (s *Shed) Prune() ([]tool.Tool, error) {
+	var keep []tool.Tool
+	s.mu.RLock()
+	for _, lf := range []*lockfile.Lockfile{s.lf, s.baseLf} {
+		keep = append(keep, lf.Tools()...)
+	}
+	s.mu.RUnlock()
+	return s.cache.Prune(keep)
+}
+
+// VerifyCache checks every tool in the cache and returns the tools that are in a bad state,
+// for example because their go.mod or binary was corrupted. Unlike Verify, this checks all the tools
+// in the cache, not only the ones in the lockfile. Pass cache.WithRepair to reinstall the tools that are found.
+func (s *Shed) VerifyCache(ctx context.Context, opts ...cache.VerifyOption) ([]tool.Tool, error) {
+	return s.cache.Verify(ctx, opts...)
+}
+
 func (s *Shed) writeLockfile(op errors.Op) error {
-	f, err := os.OpenFile(s.lockfilePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
-	if err != nil {
-		return errors.New(errors.IO, fmt.Sprintf("failed to create/open file %q", s.lockfilePath), op, err)
+	if s.noLockfile {
+		return errors.New(errors.Invalid, "cannot write lockfile since no lockfile is being used", op)
 	}
-	defer f.Close()
-	if _, err = s.lf.WriteTo(f); err != nil {
-		return errors.New(errors.Internal, fmt.Sprintf("failed to write lockfile to %q", s.lockfilePath), op, err)
+	if s.globalLockfile {
+		// The config directory might not exist yet if this is the first global tool.
+		dir := filepath.Dir(s.lockfilePath)
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return errors.New(errors.IO, fmt.Sprintf("failed to create directory %q", dir), op, err)
+		}
+	}
+	// Write atomically so the lockfile is never left partially written,
+	// for example if shed is killed while writing.
+	err := util.WriteFileAtomic(s.lockfilePath, 0o644, func(w io.Writer) error {
+		_, err := s.baseLf.WriteTo(w)
+		return err
+	})
+	if err != nil {
+		return errors.New(errors.IO, fmt.Sprintf("failed to write lockfile to %q", s.lockfilePath), op, err)
 	}
 	return nil
 }
 
+// putTool adds t to the lockfile. If an overlay is used, t is only added to
+// the base lockfile if it differs from the tool pinned by the overlay.
+func (s *Shed) putTool(t tool.Tool) error {
+	if err := s.lf.PutTool(t); err != nil {
+		return err
+	}
+	if s.baseLf == s.lf {
+		return nil
+	}
+	if ot, err := s.overlayLf.GetTool(t.ImportPath); err == nil && ot == t {
+		return nil
+	}
+	return s.baseLf.PutTool(t)
+}
+
+// setModule records that t is provided by the module with path modPath.
+// It is only recorded for lockfiles that contain the same version of t.
+func (s *Shed) setModule(t tool.Tool, modPath string) {
+	for _, lf := range []*lockfile.Lockfile{s.lf, s.baseLf} {
+		if lt, err := lf.GetTool(t.ImportPath); err != nil || lt != t {
+			continue
+		}
+		if err := lf.SetModule(t.ImportPath, modPath); err != nil {
+			s.logger.WithError(err).Debugf("Failed to record module of tool %s", t)
+		}
+	}
+}
+
+// installOptions returns the options to use when installing t based on what is recorded in the lockfile.
+func (s *Shed) installOptions(t tool.Tool) []cache.InstallOption {
+	var opts []cache.InstallOption
+	if s.lf.Direct(t.ImportPath) {
+		opts = append(opts, cache.WithDirect())
+	}
+	if s.lf.HasBinHashes(t.ImportPath) {
+		opts = append(opts, cache.WithReproducible())
+	}
+	if br := s.lf.BinaryRelease(t.ImportPath); !br.IsZero() {
+		opts = append(opts, cache.WithBinaryRelease(br.Repo, br.Asset))
+	}
+	if toolchain := s.lf.Toolchain(); toolchain != "" {
+		opts = append(opts, cache.WithToolchain(toolchain))
+	}
+	if alias := s.lf.Alias(t.ImportPath); alias != "" {
+		opts = append(opts, cache.WithAlias(alias))
+	}
+	if flags := s.lf.BuildFlags(t.ImportPath); len(flags) > 0 {
+		opts = append(opts, cache.WithBuildFlags(flags...))
+	}
+	// The hash only applies to the version in the lockfile
+	if lt, err := s.lf.GetTool(t.ImportPath); err == nil && lt.Version == t.Version {
+		if hash := s.lf.Hash(t.ImportPath); hash != "" {
+			opts = append(opts, cache.WithHash(hash))
+		}
+		if hash := s.lf.ReleaseHash(t.ImportPath, releasePlatform()); hash != "" {
+			opts = append(opts, cache.WithReleaseHash(hash))
+		}
+	}
+	return opts
+}
+
+// expandEnv replaces references to environment variables in toolName, like $VAR or ${VAR},
+// with their values. Unlike os.ExpandEnv, an error is returned if a variable is not set.
+func expandEnv(op errors.Op, toolName string) (string, error) {
+	var unset []string
+	expanded := os.Expand(toolName, func(key string) string {
+		v, ok := os.LookupEnv(key)
+		if !ok {
+			unset = append(unset, key)
+		}
+		return v
+	})
+	if len(unset) > 0 {
+		return "", errors.Errorf(errors.Invalid, op, "environment variable %s used in tool %s is not set", strings.Join(unset, ", "), toolName)
+	}
+	return expanded, nil
+}
+
+// setHash records the module hash of t. It is only recorded for lockfiles that contain the same version of t.
+func (s *Shed) setHash(t tool.Tool, hash string) {
+	for _, lf := range []*lockfile.Lockfile{s.lf, s.baseLf} {
+		if lt, err := lf.GetTool(t.ImportPath); err != nil || lt != t {
+			continue
+		}
+		if err := lf.SetHash(t.ImportPath, hash); err != nil {
+			s.logger.WithError(err).Debugf("Failed to record module hash of tool %s", t)
+		}
+	}
+}
+
+// setGoVersion records the Go version required by t. It is only recorded for lockfiles that contain the same version of t.
+func (s *Shed) setGoVersion(t tool.Tool, goVersion string) {
+	for _, lf := range []*lockfile.Lockfile{s.lf, s.baseLf} {
+		if lt, err := lf.GetTool(t.ImportPath); err != nil || lt != t {
+			continue
+		}
+		if err := lf.SetGoVersion(t.ImportPath, goVersion); err != nil {
+			s.logger.WithError(err).Debugf("Failed to record go version of tool %s", t)
+		}
+	}
+}
+
+// setBinHash records the hash of the binary of t for the current platform.
+// It is only recorded for lockfiles that contain the same version of t.
+func (s *Shed) setBinHash(ctx context.Context, t tool.Tool) {
+	platform, err := s.binHashPlatform(ctx)
+	if err != nil {
+		s.logger.WithError(err).Debugf("Failed to determine platform for binary hash of tool %s", t)
+		return
+	}
+	hash, err := s.cache.BinaryHash(t, cache.ForBuildFlags(s.lf.BuildFlags(t.ImportPath)...))
+	if err != nil {
+		s.logger.WithError(err).Debugf("Failed to compute binary hash of tool %s", t)
+		return
+	}
+	for _, lf := range []*lockfile.Lockfile{s.lf, s.baseLf} {
+		if lt, err := lf.GetTool(t.ImportPath); err != nil || lt != t {
+			continue
+		}
+		if err := lf.SetBinHash(t.ImportPath, platform, hash); err != nil {
+			s.logger.WithError(err).Debugf("Failed to record binary hash of tool %s", t)
+		}
+	}
+}
+
+// binHashPlatform returns the key that binary hashes are recorded under for the current platform.
+// Binaries are only reproducible using the same OS, architecture and Go toolchain, so all of them
+// are part of the key, for example 'linux/amd64/go1.17.3'. If the lockfile sets a toolchain, it is
+// used instead of the installed Go toolchain since tools are built with it.
+func (s *Shed) binHashPlatform(ctx context.Context) (string, error) {
+	toolchain := "go" + s.lf.Toolchain()
+	if s.lf.Toolchain() == "" {
+		var err error
+		toolchain, err = cache.GoToolchain(ctx)
+		if err != nil {
+			return "", err
+		}
+	}
+	return runtime.GOOS + "/" + runtime.GOARCH + "/" + toolchain, nil
+}
+
+// setDirect records that t must be downloaded directly from version control.
+func (s *Shed) setDirect(t tool.Tool) {
+	for _, lf := range []*lockfile.Lockfile{s.lf, s.baseLf} {
+		if err := lf.SetDirect(t.ImportPath, true); err != nil {
+			s.logger.WithError(err).Debugf("Failed to record tool %s as direct", t)
+		}
+	}
+}
+
+// setBuildFlags records that t must be built with the given build flags.
+func (s *Shed) setBuildFlags(t tool.Tool, flags []string) {
+	for _, lf := range []*lockfile.Lockfile{s.lf, s.baseLf} {
+		if err := lf.SetBuildFlags(t.ImportPath, flags); err != nil {
+			s.logger.WithError(err).Debugf("Failed to record build flags of tool %s", t)
+		}
+	}
+}
+
+// releasePlatform returns the key that release hashes are recorded under for the current platform.
+// Each platform downloads its own release asset, for example 'linux/amd64'.
+func releasePlatform() string {
+	return runtime.GOOS + "/" + runtime.GOARCH
+}
+
+// setReleaseHash records the hash of the release asset t was downloaded from for the current platform.
+// It is only recorded for lockfiles that contain the same version of t.
+func (s *Shed) setReleaseHash(t tool.Tool) {
+	hash, err := s.cache.ReleaseHash(t)
+	if err != nil {
+		s.logger.WithError(err).Debugf("Failed to find release hash of tool %s", t)
+		return
+	}
+	for _, lf := range []*lockfile.Lockfile{s.lf, s.baseLf} {
+		if lt, err := lf.GetTool(t.ImportPath); err != nil || lt != t {
+			continue
+		}
+		if err := lf.SetReleaseHash(t.ImportPath, releasePlatform(), hash); err != nil {
+			s.logger.WithError(err).Debugf("Failed to record release hash of tool %s", t)
+		}
+	}
+}
+
+// setBinaryRelease records that t must be downloaded from the binary release br.
+func (s *Shed) setBinaryRelease(t tool.Tool, br lockfile.BinaryRelease) {
+	for _, lf := range []*lockfile.Lockfile{s.lf, s.baseLf} {
+		if err := lf.SetBinaryRelease(t.ImportPath, br); err != nil {
+			s.logger.WithError(err).Debugf("Failed to record binary release of tool %s", t)
+		}
+	}
+}
+
+// deleteTool removes t from the lockfile.
+func (s *Shed) deleteTool(t tool.Tool) {
+	s.lf.DeleteTool(t)
+	if s.baseLf != s.lf {
+		s.baseLf.DeleteTool(t)
+	}
+}
+
 // GetOptions is used to configure Shed.Get.
 type GetOptions struct {
 	// ToolNames is a list of tools that should be installed.
 	// These will be unioned with the tools specified in the lockfile.
+	// References to environment variables, like $VAR or ${VAR}, are expanded
+	// before the tool names are parsed. It is an error to reference a variable that is not set.
 	ToolNames []string
 	// Update sets whether or not tools should be updated to the latest available
 	// minor or patch version. If ToolNames is not empty, only those tools will be
-	// updated. Otherwise, all tools in the lockfile will be updated.
+	// updated. Otherwise, all tools in the lockfile will be updated, except tools with a
+	// prerelease version or a pseudo-version, which pins the tool to a commit. Those tools
+	// are only updated if they are in ToolNames.
 	Update bool
+	// From is another lockfile whose tools should also be installed.
+	// If a tool in From is also in the lockfile with a different version,
+	// Get will return an error unless the tool is also in ToolNames.
+	From *lockfile.Lockfile
+	// MergeFrom sets whether or not the tools from From should be added to the lockfile.
+	// If false, the tools are only installed and the lockfile is not modified for them.
+	MergeFrom bool
+	// KeepGoing makes Get skip invalid tool names in ToolNames instead of returning an error.
+	// A warning is logged for each skipped tool name.
+	KeepGoing bool
+	// UnifyModuleVersions sets how tools that belong to the same module but have different
+	// versions are handled when at least one of them is in ToolNames. By default Apply returns an
+	// error. If true, all the tools are installed using the highest version instead.
+	// If Update is set, the tools that are updated are always unified with the other tools in their module,
+	// since the update is what caused the versions to differ.
+	// Since the module of a tool is only known once it has been downloaded,
+	// conflicts are detected by Apply not Get.
+	UnifyModuleVersions bool
+	// MinVersions is a list of tools with the minimum version that should be installed,
+	// for example 'golang.org/x/tools/cmd/stringer@v0.1.5'. If the version of the tool in the
+	// lockfile is lower, the tool is upgraded to the minimum version. Otherwise the tool is
+	// left as is. Tools that are not in the lockfile are installed using the minimum version.
+	// Each version must be a valid SemVer and the tool must not also be in ToolNames.
+	MinVersions []string
+	// Direct sets whether the tools in ToolNames must be downloaded directly from version control,
+	// bypassing the module proxy. This is recorded in the lockfile, so the tools will always be
+	// downloaded directly when installed from the lockfile. Checksums are still verified using GOSUMDB,
+	// see cache.WithDirect.
+	Direct bool
+	// BinaryRelease, if set, causes the tools in ToolNames to be downloaded as prebuilt binaries from
+	// the given GitHub release instead of being built from source. This is meant for tools that can't
+	// be installed with go install. It is recorded in the lockfile, so the tools will always be downloaded
+	// from the release. Each tool must have an exact version, which is used as the release tag.
+	// Tools downloaded from a binary release are not updated when updating all tools.
+	BinaryRelease lockfile.BinaryRelease
+	// Reproducible sets whether the tools in ToolNames should be built reproducibly. The hash of
+	// each binary is recorded in the lockfile for the current platform, which allows Shed.Verify to
+	// check that the installed binaries have not been modified. Once a tool has a binary hash it
+	// is always built reproducibly and its hash is kept up to date.
+	Reproducible bool
+	// BuildFlags are extra flags passed to go build when building the tools in ToolNames, for example
+	// '-ldflags=-X main.version=v1.0.0' or '-tags=netgo'. Each flag must include its value. The flags are
+	// recorded in the lockfile, replacing any existing flags, so the tools will always be built with them.
+	// Changing the flags of a tool causes it to be rebuilt.
+	BuildFlags []string
 }
 
 // Get computes a set of tools that should be installed. Zero or more tools can be
@@ -172,18 +722,43 @@ type GetOptions struct {
 // discard the returned InstallSet.
 //
 // All tool names provided must be full import paths, not binary names.
-// If a tool name is invalid, Get will return an error.
+// If a tool name is invalid, Get will return an error, unless opts.KeepGoing is set
+// in which case the tool name is skipped.
 //
 // If opts.Update is set, tool names must not include version suffixes.
 func (s *Shed) Get(opts GetOptions) (*InstallSet, error) {
 	const op = errors.Op("Shed.Get")
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	// Collect all the tools that need to be installed.
 	// Merge the given tools with what exists in the lockfile.
 	seenTools := make(map[string]bool)
 	var tools []tool.Tool
+	var direct map[string]bool
+	var reproducible map[string]bool
+	var buildFlags map[string][]string
+	var releases map[string]lockfile.BinaryRelease
+	var updated map[string]bool
+
+	if !opts.BinaryRelease.IsZero() {
+		if err := opts.BinaryRelease.Validate(); err != nil {
+			return nil, errors.New(errors.Invalid, op, err)
+		}
+	}
 
 	var errs errors.List
 	for _, toolName := range opts.ToolNames {
+		// Expand variables so that versions can be set from the environment, for example in CI.
+		toolName, err := expandEnv(op, toolName)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		// Check before parsing, since some suspicious import paths are not valid and the reason is clearer.
+		if err := s.checkImportPath(op, toolName); err != nil {
+			errs = append(errs, err)
+			continue
+		}
 		// This also serves to validate the the given tool name is a valid module name
 		// Use ParseLax since the version might be a query that should be passed to go get.
 		t, err := tool.ParseLax(toolName)
@@ -198,7 +773,80 @@ func (s *Shed) Get(opts GetOptions) (*InstallSet, error) {
 				errs = append(errs, errors.New(errors.Invalid, msg, op))
 				continue
 			}
-			t.Version = latestVersion
+			t = t.WithVersion(latestVersion)
+			if updated == nil {
+				updated = make(map[string]bool)
+			}
+			updated[t.ImportPath] = true
+		} else if t, err = s.resolveVersion(op, t); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if !opts.BinaryRelease.IsZero() {
+			if !t.HasSemver() {
+				msg := fmt.Sprintf("tool %s must have an exact version to be downloaded from a binary release", t)
+				errs = append(errs, errors.New(errors.Invalid, msg, op))
+				continue
+			}
+			if releases == nil {
+				releases = make(map[string]lockfile.BinaryRelease)
+			}
+			releases[t.ImportPath] = opts.BinaryRelease
+		}
+		seenTools[t.ImportPath] = true
+		tools = append(tools, t)
+		if opts.Direct {
+			if direct == nil {
+				direct = make(map[string]bool)
+			}
+			direct[t.ImportPath] = true
+		}
+		if opts.Reproducible {
+			if reproducible == nil {
+				reproducible = make(map[string]bool)
+			}
+			reproducible[t.ImportPath] = true
+		}
+		if len(opts.BuildFlags) > 0 {
+			if buildFlags == nil {
+				buildFlags = make(map[string][]string)
+			}
+			buildFlags[t.ImportPath] = opts.BuildFlags
+		}
+	}
+	if len(errs) > 0 {
+		if !opts.KeepGoing {
+			return nil, errs
+		}
+		for _, err := range errs {
+			s.logger.Warnf("Skipping tool: %s", err)
+		}
+		errs = nil
+	}
+	for _, minName := range opts.MinVersions {
+		if err := s.checkImportPath(op, minName); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		t, err := tool.Parse(minName)
+		if err != nil {
+			errs = append(errs, errors.New(fmt.Sprintf("invalid minimum version %s", minName), op, err))
+			continue
+		}
+		if !t.HasSemver() {
+			msg := fmt.Sprintf("minimum version of tool %s must be a valid SemVer", t)
+			errs = append(errs, errors.New(errors.Invalid, msg, op))
+			continue
+		}
+		if seenTools[t.ImportPath] {
+			msg := fmt.Sprintf("tool %s cannot have a minimum version since it was also provided explicitly", t.ImportPath)
+			errs = append(errs, errors.New(errors.Invalid, msg, op))
+			continue
+		}
+		if lt, err := s.lf.GetTool(t.ImportPath); err == nil && semver.Compare(lt.Version, t.Version) >= 0 {
+			// Existing version is new enough, it will be added from the lockfile below.
+			s.logger.Debugf("Tool %s satisfies minimum version %s", lt, t.Version)
+			continue
 		}
 		seenTools[t.ImportPath] = true
 		tools = append(tools, t)
@@ -206,6 +854,52 @@ func (s *Shed) Get(opts GetOptions) (*InstallSet, error) {
 	if len(errs) > 0 {
 		return nil, errs
 	}
+	// Keep track of the tools that were explicitly requested before
+	// the tools from the lockfile are added.
+	requested := make(map[string]bool, len(seenTools))
+	for importPath := range seenTools {
+		requested[importPath] = true
+	}
+
+	// Add the tools from the other lockfile
+	var ephemeral map[string]bool
+	if opts.From != nil {
+		it := opts.From.Iter()
+		for it.Next() {
+			t := it.Value()
+			if seenTools[t.ImportPath] {
+				// Explicitly requested version takes precedence
+				continue
+			}
+			if err := t.Validate(); err != nil {
+				errs = append(errs, errors.New(fmt.Sprintf("invalid tool %s", t), op, err))
+				continue
+			}
+			lt, err := s.lf.GetTool(t.ImportPath)
+			if err == nil {
+				if lt.Version != t.Version {
+					msg := fmt.Sprintf(
+						"tool %s conflicts with version %s in lockfile %q, specify the tool with the desired version to resolve",
+						t, lt.Version, s.lockfilePath,
+					)
+					errs = append(errs, errors.New(errors.Invalid, msg, op))
+				}
+				// Same version, will be added from lockfile below
+				continue
+			}
+			if !opts.MergeFrom {
+				if ephemeral == nil {
+					ephemeral = make(map[string]bool)
+				}
+				ephemeral[t.ImportPath] = true
+			}
+			seenTools[t.ImportPath] = true
+			tools = append(tools, t)
+		}
+		if len(errs) > 0 {
+			return nil, errs
+		}
+	}
 
 	// If update and no tools provided update all in the lockfile.
 	updateAll := opts.Update && len(opts.ToolNames) == 0
@@ -216,14 +910,79 @@ func (s *Shed) Get(opts GetOptions) (*InstallSet, error) {
 		if ok := seenTools[t.ImportPath]; ok {
 			continue
 		}
-		// Skip tools with a prelease version installed since the latest version might
-		// actually be older than the current version which was explicitly installed.
-		if updateAll && semver.Prerelease(t.Version) == "" {
-			t.Version = latestVersion
+		if updateAll {
+			switch {
+			case t.IsPseudoVersion():
+				// Tools pinned to a commit must not be silently replaced by a tagged release.
+				// They are only updated if they are provided explicitly. Every pseudo-version is also
+				// a prerelease, this is checked first so the reason the tool is skipped is logged.
+				s.logger.Debugf("Not updating tool %s since it is pinned to a commit", t)
+			case semver.Prerelease(t.Version) != "":
+				// Skip tools with a prelease version installed since the latest version might
+				// actually be older than the current version which was explicitly installed.
+			case !s.lf.BinaryRelease(t.ImportPath).IsZero():
+				// Binary releases can't be resolved to the latest version, since there is no module to query.
+			default:
+				t = t.WithVersion(latestVersion)
+			}
 		}
 		tools = append(tools, t)
 	}
-	return &InstallSet{s: s, tools: tools}, nil
+	return &InstallSet{
+		s:            s,
+		tools:        tools,
+		requested:    requested,
+		updated:      updated,
+		ephemeral:    ephemeral,
+		direct:       direct,
+		releases:     releases,
+		reproducible: reproducible,
+		buildFlags:   buildFlags,
+		unifyModules: opts.UnifyModuleVersions,
+	}, nil
+}
+
+// GetFromReader is like Get but also installs the tools listed in r, similar to a pip requirements file.
+// Each line of r is a tool import path with an optional version suffix, in the same format as
+// opts.ToolNames. Blank lines are ignored, as is everything after a '#', so comments can be used.
+//
+// The tools are added to opts.ToolNames, so they are unioned with the lockfile exactly like Get does.
+// If any lines are invalid, an errors.List is returned containing an error for each invalid line,
+// unless opts.KeepGoing is set in which case the invalid lines are skipped.
+func (s *Shed) GetFromReader(r io.Reader, opts GetOptions) (*InstallSet, error) {
+	const op = errors.Op("Shed.GetFromReader")
+	var toolNames []string
+	var errs errors.List
+	sc := bufio.NewScanner(r)
+	for lineNum := 1; sc.Scan(); lineNum++ {
+		line := sc.Text()
+		if i := strings.IndexByte(line, '#'); i != -1 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		// Only validate here so the error can include the line number, Get parses the tools again.
+		if _, err := tool.ParseLax(line); err != nil {
+			errs = append(errs, errors.New(fmt.Sprintf("line %d: invalid tool name %s", lineNum, line), op, err))
+			continue
+		}
+		toolNames = append(toolNames, line)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, errors.New(errors.IO, "failed to read tools", op, err)
+	}
+	if len(errs) > 0 {
+		if !opts.KeepGoing {
+			return nil, errs
+		}
+		for _, err := range errs {
+			s.logger.Warnf("Skipping tool: %s", err)
+		}
+	}
+	opts.ToolNames = append(toolNames, opts.ToolNames...)
+	return s.Get(opts)
 }
 
 // InstallSet represents a set of tools that are to be installed.
@@ -231,12 +990,86 @@ func (s *Shed) Get(opts GetOptions) (*InstallSet, error) {
 // To abort the install, simply discard the InstallSet object.
 type InstallSet struct {
 	// Concurrency sets the amount of installs that will run concurrently.
-	// It defaults to the number of CPUs available.
+	// It defaults to the value of the SHED_CONCURRENCY environment variable if set,
+	// otherwise the number of CPUs available. If it is 1, tools are
+	// installed one at a time sorted by import path, which makes the order
+	// of notifications and errors deterministic.
 	Concurrency uint
+	// StatePath is the path to a file where the progress of Apply is recorded.
+	// If Apply does not complete, the install can be continued using Shed.Resume.
+	// The file is removed once Apply completes successfully.
+	// If empty, no progress is recorded.
+	StatePath string
+	// OfflineFallback sets whether a tool that is being resolved to a new version, for example
+	// when updating, should use the highest version already in the cache if it cannot be
+	// downloaded because of a network error. A warning is logged when this happens.
+	// A cached version lower than the one in the lockfile is never used.
+	OfflineFallback bool
+	// Force sets whether every tool should be downloaded and built again, even if it is
+	// already installed, see cache.Cache.Reinstall. This is useful if a binary is corrupt
+	// or was built with a different Go toolchain. Force is recorded in the file at StatePath.
+	Force bool
+	// Timeout is the maximum amount of time installing a single tool can take.
+	// If a tool takes longer, its install is cancelled and it is reported as a failure,
+	// but the other tools continue to be installed. If zero, there is no timeout.
+	Timeout time.Duration
+
+	s     *Shed
+	tools []tool.Tool
+	// requested contains the import paths of the tools that were explicitly requested.
+	requested map[string]bool
+	// ephemeral contains the import paths of the tools that should be installed
+	// but not added to the lockfile.
+	ephemeral map[string]bool
+	// direct contains the import paths of the tools that were requested to be
+	// downloaded directly from version control.
+	direct map[string]bool
+	// releases contains the binary releases of the tools that were requested to be
+	// downloaded from a binary release, keyed by import path.
+	releases map[string]lockfile.BinaryRelease
+	// reproducible contains the import paths of the tools that were requested to be built reproducibly.
+	reproducible map[string]bool
+	// buildFlags contains the build flags of the tools that were requested to be built with
+	// build flags, keyed by import path.
+	buildFlags map[string][]string
+	// resumed contains the import paths of the tools that were already
+	// installed by a previous Apply that is being resumed.
+	resumed map[string]bool
+	// updated contains the import paths of the requested tools that are being updated to the latest version.
+	updated map[string]bool
+	// unifyModules sets whether tools from the same module should be installed
+	// using the highest version instead of returning an error.
+	unifyModules bool
+	notifyCh     chan<- tool.Tool
+	eventCh      chan<- InstallEvent
+	sem          *Semaphore
+	results      []InstallResult
+	failures     []InstallFailure
+}
 
-	s        *Shed
-	tools    []tool.Tool
-	notifyCh chan<- tool.Tool
+// InstallResult contains the result of installing a tool.
+type InstallResult struct {
+	// Tool is the tool that was installed. If the tool was uninstalled,
+	// Version will be set to 'none'.
+	Tool tool.Tool
+	// AlreadySatisfied is true if the tool was explicitly requested with an exact version
+	// that was already in the lockfile and installed. In this case no work was performed.
+	AlreadySatisfied bool
+	// CacheHit is true if the tool was already installed in the cache before Apply,
+	// so it did not need to be downloaded or built. It is only known for tools with an exact version.
+	CacheHit bool
+	// Duration is how long it took to install the tool.
+	Duration time.Duration
+}
+
+// InstallFailure contains the reason a tool failed to install.
+type InstallFailure struct {
+	// Tool is the tool that failed to install.
+	Tool tool.Tool
+	// Err is the reason the install failed.
+	Err error
+	// Duration is how long the install ran before it failed.
+	Duration time.Duration
 }
 
 // Len returns the number of tools in the InstallSet.
@@ -248,101 +1081,608 @@ func (is *InstallSet) Len() int {
 // This is useful to keep track of the progress of installation.
 // You should receive from ch on a separate goroutine than the one that
 // Apply is called on, since Apply will block until all tools are installed.
+//
+// A tool is sent once it reaches PhaseBuilt, PhaseSkipped or PhaseRemoved, use
+// NotifyEvents to also be notified of the other phases and of failures.
 func (is *InstallSet) Notify(ch chan<- tool.Tool) {
 	is.notifyCh = ch
 }
 
+// WithSharedSemaphore causes Apply to also acquire sem before installing each tool. This bounds the total
+// number of concurrent installs across all InstallSets that share sem, in addition to the Concurrency of
+// each InstallSet.
+func (is *InstallSet) WithSharedSemaphore(sem *Semaphore) {
+	is.sem = sem
+}
+
 // Apply will install each tool in the InstallSet and add them to the lockfile.
 //
+// The lockfile is only written once all tools have been installed, and it is written atomically,
+// so it will either contain all the tools in the InstallSet or none of them. If StatePath is set,
+// the completed tools are persisted to it after each tool finishes, so that an install which
+// fails or is interrupted can be continued using Shed.Resume.
+//
 // The provided context is used to terminate the install if the context becomes
 // done before the install completes on its own.
 func (is *InstallSet) Apply(ctx context.Context) error {
 	const op = errors.Op("InstallSet.Apply")
+	completed := make(map[string]tool.Tool)
+	if err := is.writeState(op, completed); err != nil {
+		return err
+	}
 
-	type result struct {
-		t   tool.Tool
-		err error
+	var completedTools []tool.Tool
+	var errs errors.List
+	handleResult := func(r applyResult) error {
+		if r.err != nil {
+			// Continue even if a tool failed because they are cached so it will
+			// save work on subsequent runs.
+			errs = append(errs, r.err)
+			is.failures = append(is.failures, InstallFailure{Tool: r.t, Err: r.err, Duration: r.duration})
+			return nil
+		}
+		completedTools = append(completedTools, r.t)
+		is.results = append(is.results, InstallResult{
+			Tool:             r.t,
+			AlreadySatisfied: r.satisfied,
+			CacheHit:         r.cacheHit,
+			Duration:         r.duration,
+		})
+		completed[r.t.ImportPath] = r.t
+		return is.writeState(op, completed)
 	}
-	resultCh := make(chan result, len(is.tools))
+
 	concurrency := getConcurrency(is.Concurrency)
 	is.s.logger.Debugf("Using concurrency %d", concurrency)
-	semCh := make(chan struct{}, concurrency)
-	for _, tl := range is.tools {
-		semCh <- struct{}{}
-		go func(t tool.Tool) {
-			defer func() {
-				<-semCh
-			}()
-
-			// go get supports the special version suffix '@none' which means remove the module.
-			// See https://golang.org/ref/mod#go-get for more details.
-			// Support this for consistency since we want to shed to just work with all module queries.
-			if t.Version == noneVersion {
-				is.s.logger.Debugf("Uninstalling tool: %s", t.ImportPath)
-				resultCh <- result{t: t}
-				return
+	if concurrency == 1 {
+		// Install tools one at a time in a deterministic order so that
+		// the output is reproducible, which makes debugging easier.
+		tools := make([]tool.Tool, len(is.tools))
+		copy(tools, is.tools)
+		sort.Slice(tools, func(i, j int) bool {
+			return tools[i].ImportPath < tools[j].ImportPath
+		})
+		for _, t := range tools {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			default:
 			}
-
-			is.s.logger.Debugf("Installing tool: %v", t)
-			installed, err := is.s.cache.Install(ctx, t)
-			if err != nil {
-				resultCh <- result{err: errors.New(fmt.Sprintf("failed to install tool %s", t), op, err)}
-				return
+			if err := handleResult(is.installShared(ctx, op, t)); err != nil {
+				return err
 			}
-			resultCh <- result{t: installed}
-		}(tl)
-	}
+		}
+	} else {
+		resultCh := make(chan applyResult, len(is.tools))
+		semCh := make(chan struct{}, concurrency)
+		// Wait for all installs to stop before returning, even if the context is done,
+		// so that no events are sent after Apply returns.
+		var wg sync.WaitGroup
+		defer wg.Wait()
+		for _, tl := range is.tools {
+			semCh <- struct{}{}
+			wg.Add(1)
+			go func(t tool.Tool) {
+				defer func() {
+					<-semCh
+					wg.Done()
+				}()
+				resultCh <- is.installShared(ctx, op, t)
+			}(tl)
+		}
 
-	var completedTools []tool.Tool
-	var errs errors.List
-	for i := 0; i < len(is.tools); i++ {
-		select {
-		case r := <-resultCh:
-			if r.err != nil {
-				// Continue even if a tool failed because they are cached so it will
-				// save work on subsequent runs.
-				errs = append(errs, r.err)
-				continue
-			}
-			completedTools = append(completedTools, r.t)
-			if is.notifyCh != nil {
-				is.notifyCh <- r.t
+		for i := 0; i < len(is.tools); i++ {
+			select {
+			case r := <-resultCh:
+				if err := handleResult(r); err != nil {
+					return err
+				}
+			case <-ctx.Done():
+				return ctx.Err()
 			}
-		case <-ctx.Done():
-			return ctx.Err()
 		}
 	}
 	if len(errs) > 0 {
 		return errs
 	}
+	completedTools, err := is.resolveModuleConflicts(ctx, op, completedTools)
+	if err != nil {
+		return err
+	}
 
+	is.s.mu.Lock()
+	defer is.s.mu.Unlock()
 	for _, t := range completedTools {
+		if is.ephemeral[t.ImportPath] {
+			continue
+		}
 		if t.Version == noneVersion {
 			// Uninstall the tool by removing it from the lockfile.
 			// This will not error if the tool is not in the lockfile,
 			// instead it will be silently ignored.
-			t.Version = ""
-			is.s.lf.DeleteTool(t)
+			is.s.deleteTool(t.WithoutVersion())
 			continue
 		}
-		if err := is.s.lf.PutTool(t); err != nil {
-			return errors.New(errors.Internal, fmt.Sprintf("failed to add tool %s to lockfile", t), op, err)
+		// Check before the tool is updated, since changing the version removes the existing hashes.
+		reproducible := is.reproducible[t.ImportPath] || is.s.lf.HasBinHashes(t.ImportPath)
+		if err := is.s.putTool(t); err != nil {
+			return errors.New(errors.Internal, fmt.Sprintf("failed to add tool %s to lockfile %q", t, is.s.lockfilePath), op, err)
+		}
+		if is.direct[t.ImportPath] {
+			is.s.setDirect(t)
 		}
+		if br, ok := is.releases[t.ImportPath]; ok {
+			is.s.setBinaryRelease(t, br)
+		}
+		if flags, ok := is.buildFlags[t.ImportPath]; ok {
+			is.s.setBuildFlags(t, flags)
+		}
+		// Record the hash of the release asset so future installs can verify they get the same binary.
+		if !is.s.lf.BinaryRelease(t.ImportPath).IsZero() {
+			is.s.setReleaseHash(t)
+		}
+		// Record the hash so future installs can verify they get the same module content.
+		if hash, err := is.s.cache.ModuleHash(t); err != nil {
+			is.s.logger.WithError(err).Debugf("Failed to find module hash of tool %s", t)
+		} else {
+			is.s.setHash(t, hash)
+		}
+		if reproducible {
+			is.s.setBinHash(ctx, t)
+		}
+		// Record the Go version the tool requires so it can be checked before running the tool.
+		// Binary releases have no module and so no Go version.
+		if is.s.lf.GoVersion(t.ImportPath) == "" && is.s.lf.BinaryRelease(t.ImportPath).IsZero() {
+			if goVersion, err := is.s.cache.ModuleGoVersion(ctx, t); err != nil {
+				is.s.logger.WithError(err).Debugf("Failed to find go version of tool %s", t)
+			} else {
+				is.s.setGoVersion(t, goVersion)
+			}
+		}
+		// Record the module so it doesn't need to be resolved again later.
+		// This is optional so don't fail if it can't be found.
+		mod, err := is.s.cache.Module(t)
+		if err != nil {
+			is.s.logger.WithError(err).Debugf("Failed to find module of tool %s", t)
+			continue
+		}
+		is.s.setModule(t, mod.Path)
 	}
 	if err := is.s.writeLockfile(op); err != nil {
 		return err
 	}
-	return nil
+	return is.removeState(op)
+}
+
+// Results returns the result of each tool that was successfully installed or uninstalled
+// by Apply. The results are in the order that the tools finished installing.
+func (is *InstallSet) Results() []InstallResult {
+	return is.results
+}
+
+// Failures returns the tools that failed to install during Apply, in the order that they failed.
+// Apply still returns an error for each failure, Failures makes it possible to report them alongside the results.
+func (is *InstallSet) Failures() []InstallFailure {
+	return is.failures
+}
+
+// resolveModuleConflicts checks that installed tools which belong to the same module have the
+// same version. Only modules with at least one requested tool are checked. If a conflict is found,
+// an error is returned, unless is.unifyModules is set or every requested tool in the module is being
+// updated. In that case the tools are re-installed using the highest version and the updated list
+// of tools is returned.
+func (is *InstallSet) resolveModuleConflicts(ctx context.Context, op errors.Op, tools []tool.Tool) ([]tool.Tool, error) {
+	type moduleTools struct {
+		// indices of the tools in tools
+		indices   []int
+		requested bool
+		// pinned is whether a requested tool has an explicit version, i.e. it is not being updated.
+		pinned   bool
+		conflict bool
+		highest  string
+	}
+	modules := make(map[string]*moduleTools)
+	var modPaths []string
+	for i, t := range tools {
+		if t.Version == noneVersion || is.ephemeral[t.ImportPath] {
+			continue
+		}
+		// Tools downloaded from a binary release don't belong to a module.
+		is.s.mu.RLock()
+		br := is.s.lf.BinaryRelease(t.ImportPath)
+		is.s.mu.RUnlock()
+		if _, ok := is.releases[t.ImportPath]; ok || !br.IsZero() {
+			continue
+		}
+		mod, err := is.s.cache.Module(t)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("failed to find module of tool %s", t), op, err)
+		}
+		mt, ok := modules[mod.Path]
+		if !ok {
+			mt = &moduleTools{highest: mod.Version}
+			modules[mod.Path] = mt
+			modPaths = append(modPaths, mod.Path)
+		}
+		mt.indices = append(mt.indices, i)
+		mt.requested = mt.requested || is.requested[t.ImportPath]
+		mt.pinned = mt.pinned || (is.requested[t.ImportPath] && !is.updated[t.ImportPath])
+		if c := semver.Compare(mod.Version, mt.highest); c != 0 {
+			mt.conflict = true
+			if c > 0 {
+				mt.highest = mod.Version
+			}
+		}
+	}
+
+	sort.Strings(modPaths)
+	var errs errors.List
+	for _, modPath := range modPaths {
+		mt := modules[modPath]
+		if !mt.conflict || !mt.requested {
+			continue
+		}
+		if !is.unifyModules && mt.pinned {
+			toolStrs := make([]string, len(mt.indices))
+			for i, ti := range mt.indices {
+				toolStrs[i] = tools[ti].String()
+			}
+			sort.Strings(toolStrs)
+			msg := fmt.Sprintf(
+				"tools %s belong to module %s but have different versions, use the same version for all of them or unify them to the highest version",
+				strings.Join(toolStrs, ", "), modPath,
+			)
+			errs = append(errs, errors.New(errors.Invalid, msg, op))
+			continue
+		}
+
+		for _, ti := range mt.indices {
+			t := tools[ti]
+			if t.Version == mt.highest {
+				continue
+			}
+			is.s.logger.Debugf("Installing tool %v using version %s of module %s", t, mt.highest, modPath)
+			t = t.WithVersion(mt.highest)
+			installed, err := is.s.cache.Install(ctx, t)
+			if err != nil {
+				return nil, errors.New(fmt.Sprintf("failed to install tool %s", t), op, err)
+			}
+			is.s.cache.Protect(installed)
+			tools[ti] = installed
+			for i, r := range is.results {
+				if r.Tool.ImportPath == installed.ImportPath {
+					is.results[i] = InstallResult{Tool: installed}
+				}
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return tools, nil
+}
+
+// applyResult is the result of installing a single tool in InstallSet.Apply.
+type applyResult struct {
+	t         tool.Tool
+	satisfied bool
+	cacheHit  bool
+	duration  time.Duration
+	err       error
+}
+
+// installShared calls install once the shared semaphore, if one is set, allows it.
+func (is *InstallSet) installShared(ctx context.Context, op errors.Op, t tool.Tool) applyResult {
+	if is.sem == nil {
+		return is.install(ctx, op, t)
+	}
+	if err := is.sem.acquire(ctx); err != nil {
+		is.emit(t, PhaseFailed, time.Time{}, err)
+		return applyResult{t: t, err: err}
+	}
+	defer is.sem.release()
+	return is.install(ctx, op, t)
+}
+
+// install installs a single tool as part of Apply.
+func (is *InstallSet) install(ctx context.Context, op errors.Op, t tool.Tool) (r applyResult) {
+	start := time.Now()
+	defer func() {
+		r.duration = time.Since(start)
+	}()
+
+	// go get supports the special version suffix '@none' which means remove the module.
+	// See https://golang.org/ref/mod#go-get for more details.
+	// Support this for consistency since we want to shed to just work with all module queries.
+	if t.Version == noneVersion {
+		is.s.logger.Debugf("Uninstalling tool: %s", t.ImportPath)
+		is.emit(t, PhaseRemoved, start, nil)
+		return applyResult{t: t}
+	}
+	if is.resumed[t.ImportPath] {
+		is.s.logger.Debugf("Tool already installed by previous run: %v", t)
+		is.emit(t, PhaseSkipped, start, nil)
+		return applyResult{t: t, cacheHit: true}
+	}
+
+	is.s.mu.RLock()
+	// Fast path: if the exact version is already in the lockfile and installed there's nothing to do.
+	satisfied := is.requested[t.ImportPath] && !is.Force && is.satisfied(t)
+	baseOpts := is.s.installOptions(t)
+	pathOpts := is.pathOptions(t)
+	// The recorded release hash is for the asset of the binary release in the lockfile.
+	br, releaseRequested := is.releases[t.ImportPath]
+	releaseChanged := releaseRequested && br != is.s.lf.BinaryRelease(t.ImportPath)
+	// An offline fallback must never downgrade a tool below the version in the lockfile.
+	var lockedVersion string
+	if lt, err := is.s.lf.GetTool(t.ImportPath); err == nil {
+		lockedVersion = lt.Version
+	}
+	is.s.mu.RUnlock()
+	if satisfied {
+		is.s.logger.Debugf("Tool already installed: %v", t)
+		is.emit(t, PhaseSkipped, start, nil)
+		return applyResult{t: t, satisfied: true, cacheHit: true}
+	}
+
+	is.s.logger.Debugf("Installing tool: %v", t)
+	is.emit(t, PhaseStarted, start, nil)
+	installOpts := append(baseOpts, cache.WithDownloaded(func(dt tool.Tool) {
+		is.emit(dt, PhaseDownloaded, start, nil)
+	}))
+	if is.direct[t.ImportPath] {
+		installOpts = append(installOpts, cache.WithDirect())
+	}
+	if releaseRequested {
+		installOpts = append(installOpts, cache.WithBinaryRelease(br.Repo, br.Asset))
+	}
+	if releaseChanged {
+		installOpts = append(installOpts, cache.WithReleaseHash(""))
+	}
+	if is.reproducible[t.ImportPath] {
+		installOpts = append(installOpts, cache.WithReproducible())
+	}
+	if flags, ok := is.buildFlags[t.ImportPath]; ok {
+		installOpts = append(installOpts, cache.WithBuildFlags(flags...))
+	}
+	if is.OfflineFallback {
+		installOpts = append(installOpts, cache.WithOfflineFallback(lockedVersion))
+	}
+	// The resolved version isn't known up front, so only tools with an exact version can be cache hits.
+	var cacheHit bool
+	if t.HasSemver() && !is.Force {
+		cacheHit, _ = is.s.cache.Installed(t, pathOpts...)
+	}
+	install := is.s.cache.Install
+	if is.Force {
+		install = is.s.cache.Reinstall
+	}
+	installCtx := ctx
+	if is.Timeout > 0 {
+		var cancel context.CancelFunc
+		installCtx, cancel = context.WithTimeout(ctx, is.Timeout)
+		defer cancel()
+	}
+	installed, err := install(installCtx, t, installOpts...)
+	if err != nil {
+		msg := fmt.Sprintf("failed to install tool %s", t)
+		if ctx.Err() == nil && installCtx.Err() == context.DeadlineExceeded {
+			msg = fmt.Sprintf("timed out installing tool %s after %s", t, is.Timeout)
+		}
+		err = errors.New(msg, op, err)
+		is.emit(t, PhaseFailed, start, err)
+		return applyResult{t: t, err: err}
+	}
+	// Tool will be added to the lockfile so make sure it doesn't get evicted.
+	is.s.cache.Protect(installed)
+	is.emit(installed, PhaseBuilt, start, nil)
+	return applyResult{t: installed, cacheHit: cacheHit}
+}
+
+// satisfied reports whether t has an exact version that is already in the lockfile and installed.
+func (is *InstallSet) satisfied(t tool.Tool) bool {
+	if !t.HasSemver() {
+		return false
+	}
+	lt, err := is.s.lf.GetTool(t.ImportPath)
+	if err != nil || lt != t {
+		return false
+	}
+	// The alias may have been added after the tool was installed.
+	_, err = is.s.cache.AliasToolPath(t, is.s.lf.Alias(t.ImportPath), is.pathOptions(t)...)
+	return err == nil
+}
+
+// pathOptions returns the options that select the binary of t that will be installed. The binary is only
+// installed if it was built with the same build flags, and with the toolchain from the lockfile if one is set.
+func (is *InstallSet) pathOptions(t tool.Tool) []cache.PathOption {
+	opts := []cache.PathOption{cache.ForBuildFlags(is.toolBuildFlags(t)...)}
+	// Binary releases are not built, so the toolchain doesn't apply to them.
+	_, release := is.releases[t.ImportPath]
+	if !release && is.s.lf.BinaryRelease(t.ImportPath).IsZero() {
+		opts = append(opts, cache.ForToolchain(is.s.lf.Toolchain()))
+	}
+	return opts
+}
+
+// toolBuildFlags returns the build flags t will be built with. These are the flags that were requested,
+// or the flags from the lockfile if none were requested.
+func (is *InstallSet) toolBuildFlags(t tool.Tool) []string {
+	if flags, ok := is.buildFlags[t.ImportPath]; ok {
+		return flags
+	}
+	return is.s.lf.BuildFlags(t.ImportPath)
+}
+
+// LookupTool returns the tool with the given name from the lockfile.
+// toolName can either be the name of the binary or the full import path,
+// optionally with a version. See lockfile.Lockfile.GetTool for details.
+//
+// The returned error wraps the error from GetTool, so errors like lockfile.ErrNotFound
+// can be checked for using errors.Is.
+func (s *Shed) LookupTool(toolName string) (tool.Tool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.lookupTool(toolName)
+}
+
+// lookupTool does the actual work of LookupTool.
+func (s *Shed) lookupTool(toolName string) (tool.Tool, error) {
+	const op = errors.Op("Shed.LookupTool")
+	t, err := s.lf.GetTool(toolName)
+	if err != nil && !s.noLockfile {
+		return t, errors.New(fmt.Sprintf("failed to find tool %s in lockfile %q", toolName, s.lockfilePath), op, err)
+	}
+	return t, err
+}
+
+// Uninstall removes the given tools from the lockfile and writes the lockfile, and returns the tools that were removed.
+// Each tool name can either be the name of the binary or the full import path.
+// A tool that is provided multiple times, for example by both names, is only removed and returned once.
+//
+// If a tool is not in the lockfile, an error wrapping lockfile.ErrNotFound is returned.
+// If any tool cannot be found, the lockfile is not modified and an errors.List
+// containing an error for each tool that could not be found is returned.
+func (s *Shed) Uninstall(toolNames ...string) ([]tool.Tool, error) {
+	const op = errors.Op("Shed.Uninstall")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var tools []tool.Tool
+	seen := make(map[string]bool)
+	var errs errors.List
+	for _, toolName := range toolNames {
+		t, err := s.lookupTool(toolName)
+		if err != nil {
+			errs = append(errs, errors.New(fmt.Sprintf("failed to uninstall tool %s", toolName), op, err))
+			continue
+		}
+		if seen[t.ImportPath] {
+			continue
+		}
+		seen[t.ImportPath] = true
+		tools = append(tools, t)
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	if len(tools) == 0 {
+		return nil, nil
+	}
+
+	for _, t := range tools {
+		s.deleteTool(t)
+		s.logger.Debugf("Removed tool %s from lockfile", t)
+	}
+	if err := s.writeLockfile(op); err != nil {
+		return nil, err
+	}
+	return tools, nil
+}
+
+// FormatOptions is used to configure Shed.FormatLockfile.
+type FormatOptions struct {
+	// Compact sets whether the lockfile is written in the compact format, where each tool is on a single line.
+	// If false, the lockfile is written as indented JSON.
+	Compact bool
+}
+
+// FormatLockfile rewrites the lockfile with tools sorted by import path, using the format set by opts.
+// Later writes of the lockfile keep the format.
+func (s *Shed) FormatLockfile(opts FormatOptions) error {
+	const op = errors.Op("Shed.FormatLockfile")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.baseLf.SetCompact(opts.Compact)
+	return s.writeLockfile(op)
 }
 
 // ToolPath returns the absolute path to the binary of the tool if it is installed.
+// If the tool has an alias in the lockfile, the path to the binary installed under the alias is returned.
 // If the tool cannot be found, or toolName is invalid, an error will be returned.
 func (s *Shed) ToolPath(toolName string) (string, error) {
-	t, err := s.lf.GetTool(toolName)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	t, err := s.lookupTool(toolName)
 	if err != nil {
 		return "", err
 	}
-	return s.cache.ToolPath(t)
+	return s.cache.AliasToolPath(t, s.lf.Alias(t.ImportPath), cache.ForBuildFlags(s.lf.BuildFlags(t.ImportPath)...))
+}
+
+// CheckGoVersion checks that the installed Go toolchain satisfies the Go version required by the tool
+// with the given name, as recorded in the lockfile. This matters for tools that run the go command themselves,
+// like code generators. Only the major and minor versions are compared. If the lockfile has no Go version for
+// the tool, nil is returned. If the Go toolchain is too old, an error with kind errors.Invalid is returned.
+func (s *Shed) CheckGoVersion(ctx context.Context, toolName string) error {
+	const op = errors.Op("Shed.CheckGoVersion")
+	s.mu.RLock()
+	t, err := s.lookupTool(toolName)
+	required := s.lf.GoVersion(t.ImportPath)
+	s.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+	if required == "" {
+		return nil
+	}
+	current, err := cache.GoVersion(ctx)
+	if err != nil {
+		return errors.New("failed to find go version", op, err)
+	}
+	// The semver package requires strings to be prefixed with 'v' to be considered valid
+	if semver.Compare("v"+current, semver.MajorMinor("v"+required)) < 0 {
+		msg := fmt.Sprintf("tool %s requires go %s, but the installed go version is %s", t, required, current)
+		return errors.New(errors.Invalid, msg, op)
+	}
+	return nil
+}
+
+// InstallEphemeral installs the tool with the given name and returns the absolute path to
+// the binary of the tool. The lockfile is neither read nor modified, therefore, toolName must be
+// a full import path. It may contain a version or module query, if no version is provided
+// the latest version is installed. If the resolved version of the tool has already been
+// installed, the cached binary is reused.
+//
+// The provided context is used to terminate the install if the context becomes
+// done before the install completes on its own.
+func (s *Shed) InstallEphemeral(ctx context.Context, toolName string) (string, error) {
+	const op = errors.Op("Shed.InstallEphemeral")
+	t, err := tool.ParseLax(toolName)
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("invalid tool name %s", toolName), op, err)
+	}
+	if t.Version == noneVersion {
+		return "", errors.New(errors.Invalid, fmt.Sprintf("cannot use version %s with tool %s", noneVersion, t.ImportPath), op)
+	}
+
+	s.logger.Debugf("Installing ephemeral tool: %v", t)
+	installed, err := s.cache.Install(ctx, t)
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("failed to install tool %s", t), op, err)
+	}
+	return s.cache.ToolPath(installed)
+}
+
+// SortOrder specifies the order tools are sorted in.
+type SortOrder int
+
+const (
+	// SortByPath sorts tools by import path.
+	SortByPath SortOrder = iota
+	// SortByName sorts tools by name, that is the name of the binary.
+	// Tools with the same name are sorted by import path.
+	SortByName
+)
+
+// sortTools sorts tools in place using the given order.
+func sortTools(tools []ToolInfo, order SortOrder) {
+	sort.Slice(tools, func(i, j int) bool {
+		ti, tj := tools[i].Tool, tools[j].Tool
+		if order == SortByName && ti.Name() != tj.Name() {
+			return ti.Name() < tj.Name()
+		}
+		return ti.ImportPath < tj.ImportPath
+	})
 }
 
 // ListOptions is used to configure Shed.List.
@@ -351,8 +1691,21 @@ type ListOptions struct {
 	ShowUpdates bool
 	// Concurrency sets the amount of update checks that will happen
 	// concurrently when ShowUpdates is true.
-	// It defaults to the number of CPUs available.
+	// It defaults to the value of the SHED_CONCURRENCY environment variable if set,
+	// otherwise the number of CPUs available.
 	Concurrency uint
+	// Sort sets the order of the returned tools. By default tools are sorted by import path.
+	Sort SortOrder
+	// MajorLock makes List only report updates that have the same major version
+	// as the installed version of each tool, to avoid updates with breaking changes.
+	// It has no effect unless ShowUpdates is true.
+	MajorLock bool
+	// Filter restricts the returned tools to the ones whose import path matches it.
+	// If Filter ends with '/...', it matches import paths with that prefix, like a Go package pattern.
+	// If Filter contains a glob character ('*', '?', or '['), it is matched against the whole
+	// import path using path.Match. Otherwise it matches import paths that contain it.
+	// If empty, all tools are returned.
+	Filter string
 }
 
 // ToolInfo contains information about a tool returned by Shed.List.
@@ -365,19 +1718,59 @@ type ToolInfo struct {
 	LatestVersion string
 }
 
+// toolInfoJSON is the JSON representation of ToolInfo.
+type toolInfoJSON struct {
+	ImportPath    string `json:"importPath"`
+	Version       string `json:"version"`
+	LatestVersion string `json:"latestVersion,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler. A ToolInfo is represented as an object with
+// the fields importPath, version, and latestVersion. latestVersion is omitted if it is empty.
+func (ti ToolInfo) MarshalJSON() ([]byte, error) {
+	return json.Marshal(toolInfoJSON{
+		ImportPath:    ti.Tool.ImportPath,
+		Version:       ti.Tool.Version,
+		LatestVersion: ti.LatestVersion,
+	})
+}
+
+// UnmarshalJSON implements json.Unmarshaler. It accepts the format produced by MarshalJSON.
+func (ti *ToolInfo) UnmarshalJSON(data []byte) error {
+	var v toolInfoJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*ti = ToolInfo{
+		Tool:          tool.Tool{ImportPath: v.ImportPath, Version: v.Version},
+		LatestVersion: v.LatestVersion,
+	}
+	return nil
+}
+
 // List returns a list of all the tools specified in the lockfile.
 // opts can be used to customize how List behaves.
 func (s *Shed) List(ctx context.Context, opts ListOptions) ([]ToolInfo, error) {
+	const op = errors.Op("Shed.List")
+	if _, err := path.Match(opts.Filter, ""); err != nil {
+		return nil, errors.Wrap(err, errors.Invalid, op, fmt.Sprintf("invalid filter %q", opts.Filter))
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var matched []tool.Tool
+	for _, t := range s.lf.Tools() {
+		if matchFilter(opts.Filter, t.ImportPath) {
+			matched = append(matched, t)
+		}
+	}
+
 	// If not checking updates, then skip any concurrency
 	if !opts.ShowUpdates {
 		var tools []ToolInfo
-		it := s.lf.Iter()
-		for it.Next() {
-			tools = append(tools, ToolInfo{Tool: it.Value()})
+		for _, t := range matched {
+			tools = append(tools, ToolInfo{Tool: t})
 		}
-		sort.Slice(tools, func(i, j int) bool {
-			return tools[i].Tool.ImportPath < tools[j].Tool.ImportPath
-		})
+		sortTools(tools, opts.Sort)
 		return tools, nil
 	}
 
@@ -390,29 +1783,50 @@ func (s *Shed) List(ctx context.Context, opts ListOptions) ([]ToolInfo, error) {
 		info ToolInfo
 		err  error
 	}
-	resultCh := make(chan result, s.lf.LenTools())
+	resultCh := make(chan result, len(matched))
 	concurrency := getConcurrency(opts.Concurrency)
 	s.logger.Debugf("Using concurrency %d", concurrency)
 	semCh := make(chan struct{}, concurrency)
-	it := s.lf.Iter()
-	for it.Next() {
+	// Share an UpdateChecker so tools from the same module are only checked once
+	var ucOpts []cache.UpdateCheckerOption
+	if opts.MajorLock {
+		ucOpts = append(ucOpts, cache.WithMajorLock())
+	}
+	uc := s.cache.NewUpdateChecker(ucOpts...)
+	for _, tl := range matched {
+		// Read from the lockfile before starting the goroutine, since List can return and release
+		// the lock while update checks are still running, for example if one of them fails.
+		isRelease := !s.lf.BinaryRelease(tl.ImportPath).IsZero()
+		mod := s.lf.Module(tl.ImportPath)
 		semCh <- struct{}{}
 		go func(t tool.Tool) {
 			defer func() {
 				<-semCh
 			}()
 
-			latest, err := s.cache.FindUpdate(ctx, t)
+			// Tools downloaded from a binary release have no module to check for updates.
+			if isRelease {
+				resultCh <- result{info: ToolInfo{Tool: t}}
+				return
+			}
+			// Use the module from the lockfile if it's known to avoid resolving it again
+			var latest string
+			var err error
+			if mod != "" {
+				latest, err = uc.FindModuleUpdate(ctx, t, mod)
+			} else {
+				latest, err = uc.FindUpdate(ctx, t)
+			}
 			if err != nil {
 				resultCh <- result{err: err}
 				return
 			}
 			resultCh <- result{info: ToolInfo{Tool: t, LatestVersion: latest}}
-		}(it.Value())
+		}(tl)
 	}
 
 	var tools []ToolInfo
-	for i := 0; i < s.lf.LenTools(); i++ {
+	for i := 0; i < len(matched); i++ {
 		select {
 		case r := <-resultCh:
 			if r.err != nil {
@@ -425,19 +1839,45 @@ func (s *Shed) List(ctx context.Context, opts ListOptions) ([]ToolInfo, error) {
 			return nil, ctx.Err()
 		}
 	}
-	sort.Slice(tools, func(i, j int) bool {
-		return tools[i].Tool.ImportPath < tools[j].Tool.ImportPath
-	})
+	sortTools(tools, opts.Sort)
 	return tools, nil
 }
 
-// getConcurrency returns either concurrency or the number of CPUs if
-// concurrency is 0. If the number of CPUs cannot be determined,
-// 1 will be returned.
+// matchFilter reports whether importPath matches filter, see ListOptions.Filter.
+// filter must be a valid pattern for path.Match.
+func matchFilter(filter, importPath string) bool {
+	if filter == "" {
+		return true
+	}
+	if prefix := strings.TrimSuffix(filter, "/..."); prefix != filter {
+		return importPath == prefix || strings.HasPrefix(importPath, prefix+"/")
+	}
+	if strings.ContainsAny(filter, "*?[") {
+		ok, _ := path.Match(filter, importPath)
+		return ok
+	}
+	return strings.Contains(importPath, filter)
+}
+
+// getConcurrency returns the concurrency to use. The precedence is:
+//
+//  1. concurrency, if it is not 0.
+//  2. The value of the SHED_CONCURRENCY environment variable, if it is set to an integer.
+//     Values less than 1 are treated as 1.
+//  3. The number of CPUs.
+//
+// If the number of CPUs cannot be determined, 1 will be returned.
 func getConcurrency(concurrency uint) uint {
 	if concurrency != 0 {
 		return concurrency
 	}
+	// runtime.NumCPU can over-report in containers, for example in CI, so allow overriding it.
+	if v, err := strconv.Atoi(os.Getenv("SHED_CONCURRENCY")); err == nil {
+		if v < 1 {
+			return 1
+		}
+		return uint(v)
+	}
 	numCPUs := runtime.NumCPU()
 	// Check for negative number just to be safe since the type is int.
 	// Better safe than sorry and having an overflow.
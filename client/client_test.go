@@ -2,10 +2,18 @@ package client_test
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"reflect"
+	"runtime"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/cszatmary/shed/cache"
 	"github.com/cszatmary/shed/client"
@@ -83,6 +91,94 @@ func TestResolveLockfilePath(t *testing.T) {
 	}
 }
 
+func TestResolveLockfilePathBoundary(t *testing.T) {
+	tests := []struct {
+		name     string
+		cwd      string
+		location string
+		markers  []string
+		opts     []client.ResolveOption
+		want     string
+	}{
+		{
+			name:     "lockfile in repo root",
+			cwd:      "repo/a/b",
+			location: "repo/shed.lock",
+			markers:  []string{"repo/.git"},
+			want:     "repo/shed.lock",
+		},
+		{
+			name:     "does not look outside repo",
+			cwd:      "repo/a",
+			location: "shed.lock",
+			markers:  []string{"repo/.git"},
+			want:     "",
+		},
+		{
+			name:     "nested repo does not use outer repo lockfile",
+			cwd:      "outer/inner/a",
+			location: "outer/shed.lock",
+			markers:  []string{"outer/.git", "outer/inner/.git"},
+			want:     "",
+		},
+		{
+			name:     "nested repo uses own lockfile",
+			cwd:      "outer/inner/a",
+			location: "outer/inner/shed.lock",
+			markers:  []string{"outer/.git", "outer/inner/.git"},
+			want:     "outer/inner/shed.lock",
+		},
+		{
+			name:     "custom boundary",
+			cwd:      "repo/a",
+			location: "shed.lock",
+			markers:  []string{"repo/.hg"},
+			opts:     []client.ResolveOption{client.WithResolveBoundary(".hg")},
+			want:     "",
+		},
+		{
+			name:     "custom boundary ignores default",
+			cwd:      "repo/a",
+			location: "shed.lock",
+			markers:  []string{"repo/.git"},
+			opts:     []client.ResolveOption{client.WithResolveBoundary(".hg")},
+			want:     "shed.lock",
+		},
+		{
+			name:     "no boundary",
+			cwd:      "outer/inner/a",
+			location: "shed.lock",
+			markers:  []string{"outer/.git", "outer/inner/.git"},
+			opts:     []client.ResolveOption{client.WithResolveBoundary("")},
+			want:     "shed.lock",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			td := t.TempDir()
+			if err := os.MkdirAll(filepath.Join(td, filepath.FromSlash(tt.cwd)), 0o755); err != nil {
+				t.Fatalf("failed to create directory %s: %v", tt.cwd, err)
+			}
+			for _, m := range tt.markers {
+				if err := os.MkdirAll(filepath.Join(td, filepath.FromSlash(m)), 0o755); err != nil {
+					t.Fatalf("failed to create directory %s: %v", m, err)
+				}
+			}
+			createLockfile(t, filepath.Join(td, filepath.FromSlash(tt.location)), nil)
+
+			cwd := filepath.Join(td, filepath.FromSlash(tt.cwd))
+			got := client.ResolveLockfilePath(cwd, tt.opts...)
+			if tt.want != "" {
+				tt.want = filepath.Join(td, filepath.FromSlash(tt.want))
+			}
+			if got != tt.want {
+				t.Errorf("got lockfile path %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestClientCache(t *testing.T) {
 	td := t.TempDir()
 	s, err := client.NewShed(client.WithCache(cache.New(td)))
@@ -126,6 +222,163 @@ var availableTools = map[string]map[string]string{
 	"example.org/z/random/stringer/v2/cmd/stringer": {
 		"v2.1.0": "v2.1.0",
 	},
+	"example.org/x/tools/cmd/stringer": {
+		"v1.0.0": "v1.0.0",
+	},
+	"golang.org/x/tools/cmd/goimports": {
+		"v0.1.0": "v0.1.0",
+		"v0.1.5": "v0.1.5",
+	},
+	"golang.org/x/tools/cmd/godoc": {
+		"v0.1.0": "v0.1.0",
+		"v0.1.5": "v0.1.5",
+	},
+}
+
+func TestNewShedCacheDir(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("user cache directory does not depend on HOME on windows")
+	}
+	td := t.TempDir()
+	tests := []struct {
+		name string
+		env  map[string]string
+		want string
+	}{
+		{
+			name: "SHED_CACHE_DIR",
+			env:  map[string]string{"SHED_CACHE_DIR": filepath.Join(td, "custom"), "XDG_CACHE_HOME": filepath.Join(td, "xdg")},
+			want: filepath.Join(td, "custom"),
+		},
+		{
+			name: "XDG_CACHE_HOME",
+			env:  map[string]string{"HOME": "", "XDG_CACHE_HOME": filepath.Join(td, "xdg")},
+			want: filepath.Join(td, "xdg", "shed"),
+		},
+		{
+			name: "temp dir fallback",
+			env:  map[string]string{"HOME": "", "TMPDIR": td},
+			want: filepath.Join(td, "shed-cache"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, k := range []string{"SHED_CACHE_DIR", "XDG_CACHE_HOME"} {
+				t.Setenv(k, "")
+			}
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			s, err := client.NewShed(client.WithLockfilePath(filepath.Join(td, "shed.lock")))
+			if err != nil {
+				t.Fatalf("want nil error, got %v", err)
+			}
+			if s.CacheDir() != tt.want {
+				t.Errorf("got %s, want %s", s.CacheDir(), tt.want)
+			}
+		})
+	}
+}
+
+func TestGlobalLockfilePath(t *testing.T) {
+	if runtime.GOOS == "windows" || runtime.GOOS == "darwin" {
+		t.Skip("user config directory does not depend on XDG_CONFIG_HOME on " + runtime.GOOS)
+	}
+	td := t.TempDir()
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "XDG_CONFIG_HOME",
+			env:  map[string]string{"HOME": filepath.Join(td, "home"), "XDG_CONFIG_HOME": filepath.Join(td, "xdg")},
+			want: filepath.Join(td, "xdg", "shed", "shed.lock"),
+		},
+		{
+			name: "HOME",
+			env:  map[string]string{"HOME": filepath.Join(td, "home"), "XDG_CONFIG_HOME": ""},
+			want: filepath.Join(td, "home", ".config", "shed", "shed.lock"),
+		},
+		{
+			name:    "no config dir",
+			env:     map[string]string{"HOME": "", "XDG_CONFIG_HOME": ""},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			got, err := client.GlobalLockfilePath()
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("want error, got path %s", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("want nil error, got %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewShedGlobalLockfile(t *testing.T) {
+	if runtime.GOOS == "windows" || runtime.GOOS == "darwin" {
+		t.Skip("user config directory does not depend on XDG_CONFIG_HOME on " + runtime.GOOS)
+	}
+	td := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(td, "config"))
+	globalPath := filepath.Join(td, "config", "shed", "shed.lock")
+	projectPath := filepath.Join(td, "shed.lock")
+	goFish := tool.Tool{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"}
+	createLockfile(t, projectPath, []tool.Tool{goFish})
+
+	// The global lockfile takes precedence over the project lockfile
+	s, err := client.NewShed(
+		client.WithLockfilePath(projectPath),
+		client.WithGlobalLockfile(),
+		client.WithCache(cache.New(filepath.Join(td, "cache"))),
+	)
+	if err != nil {
+		t.Fatalf("failed to create shed client %v", err)
+	}
+	if got := s.LockfilePath(); got != globalPath {
+		t.Errorf("got lockfile path %s, want %s", got, globalPath)
+	}
+	if _, err := s.LookupTool("go-fish"); !errors.Is(err, lockfile.ErrNotFound) {
+		t.Errorf("want not found error, got %v", err)
+	}
+
+	// The config directory doesn't exist yet so it must be created when writing the lockfile
+	if err := s.FormatLockfile(client.FormatOptions{}); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if !util.FileOrDirExists(globalPath) {
+		t.Errorf("want global lockfile to exist at %s", globalPath)
+	}
+
+	// Tools are read from the global lockfile
+	createLockfile(t, globalPath, []tool.Tool{goFish})
+	s, err = client.NewShed(client.WithGlobalLockfile(), client.WithCache(cache.New(filepath.Join(td, "cache"))))
+	if err != nil {
+		t.Fatalf("failed to create shed client %v", err)
+	}
+	got, err := s.LookupTool("go-fish")
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if got != goFish {
+		t.Errorf("got tool %v, want %v", got, goFish)
+	}
 }
 
 func createLockfile(t *testing.T, path string, tools []tool.Tool) {
@@ -298,6 +551,35 @@ func TestGet(t *testing.T) {
 				{ImportPath: "github.com/Shopify/ejson/cmd/ejson", Version: "v1.2.2"},
 			},
 		},
+		{
+			name: "does not update pseudo-versions when updating all",
+			lockfileTools: []tool.Tool{
+				{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.0.0-20201203230243-22d10c9b658d"},
+				{ImportPath: "github.com/Shopify/ejson/cmd/ejson", Version: "v1.1.0"},
+			},
+			update:  true,
+			wantLen: 2,
+			wantTools: []tool.Tool{
+				{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.0.0-20201203230243-22d10c9b658d"},
+				{ImportPath: "github.com/Shopify/ejson/cmd/ejson", Version: "v1.2.2"},
+			},
+		},
+		{
+			name: "updates pseudo-version if provided explicitly",
+			lockfileTools: []tool.Tool{
+				{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.0.0-20201203230243-22d10c9b658d"},
+				{ImportPath: "github.com/Shopify/ejson/cmd/ejson", Version: "v1.1.0"},
+			},
+			installTools: []string{
+				"github.com/cszatmary/go-fish",
+			},
+			update:  true,
+			wantLen: 2,
+			wantTools: []tool.Tool{
+				{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"},
+				{ImportPath: "github.com/Shopify/ejson/cmd/ejson", Version: "v1.1.0"},
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -403,6 +685,61 @@ func TestGetError(t *testing.T) {
 	}
 }
 
+func TestGetExpandEnv(t *testing.T) {
+	td := t.TempDir()
+	lockfilePath := filepath.Join(td, "shed.lock")
+	mockGo, err := cache.NewMockGo(availableTools)
+	if err != nil {
+		t.Fatalf("failed to create mock go %v", err)
+	}
+	s, err := client.NewShed(
+		client.WithLockfilePath(lockfilePath),
+		client.WithCache(cache.New(td, cache.WithGo(mockGo))),
+	)
+	if err != nil {
+		t.Fatalf("failed to create shed client %v", err)
+	}
+
+	t.Setenv("SHED_TEST_GO_FISH_VERSION", "v0.1.0")
+	t.Setenv("SHED_TEST_EJSON_VERSION", "v1.1.0")
+	installSet, err := s.Get(client.GetOptions{
+		ToolNames: []string{
+			"github.com/cszatmary/go-fish@${SHED_TEST_GO_FISH_VERSION}",
+			"github.com/Shopify/ejson/cmd/ejson@$SHED_TEST_EJSON_VERSION",
+		},
+	})
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if err := installSet.Apply(context.Background()); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	lf := readLockfile(t, lockfilePath)
+	for _, want := range []tool.Tool{
+		{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"},
+		{ImportPath: "github.com/Shopify/ejson/cmd/ejson", Version: "v1.1.0"},
+	} {
+		if got, err := lf.GetTool(want.ImportPath); err != nil || got != want {
+			t.Errorf("got %+v, %v, want %+v", got, err, want)
+		}
+	}
+
+	os.Unsetenv("SHED_TEST_GO_FISH_VERSION")
+	_, err = s.Get(client.GetOptions{
+		ToolNames: []string{"github.com/cszatmary/go-fish@${SHED_TEST_GO_FISH_VERSION}"},
+	})
+	errList, ok := err.(errors.List)
+	if !ok || len(errList) != 1 {
+		t.Fatalf("want errors.List with 1 error, got %v: %T", err, err)
+	}
+	if rootErr := errors.Root(errList[0]); rootErr == nil || rootErr.Kind != errors.Invalid {
+		t.Errorf("got error %v, want kind %v", errList[0], errors.Invalid)
+	}
+	if !strings.Contains(errList[0].Error(), "SHED_TEST_GO_FISH_VERSION") {
+		t.Errorf("got error %v, want it to contain the variable name", errList[0])
+	}
+}
+
 func TestList(t *testing.T) {
 	tests := []struct {
 		name          string
@@ -451,6 +788,101 @@ func TestList(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "list tools sorted by name",
+			lockfileTools: []tool.Tool{
+				{ImportPath: "github.com/golangci/golangci-lint/cmd/golangci-lint", Version: "v1.33.0"},
+				{ImportPath: "golang.org/x/tools/cmd/stringer", Version: "v0.0.0-20201211185031-d93e913c1a58"},
+				{ImportPath: "example.org/x/tools/cmd/stringer", Version: "v1.0.0"},
+				{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"},
+			},
+			opts: client.ListOptions{Sort: client.SortByName},
+			wantTools: []client.ToolInfo{
+				{
+					Tool: tool.Tool{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"},
+				},
+				{
+					Tool: tool.Tool{ImportPath: "github.com/golangci/golangci-lint/cmd/golangci-lint", Version: "v1.33.0"},
+				},
+				{
+					Tool: tool.Tool{ImportPath: "example.org/x/tools/cmd/stringer", Version: "v1.0.0"},
+				},
+				{
+					Tool: tool.Tool{ImportPath: "golang.org/x/tools/cmd/stringer", Version: "v0.0.0-20201211185031-d93e913c1a58"},
+				},
+			},
+		},
+		{
+			name: "filter exact import path",
+			lockfileTools: []tool.Tool{
+				{ImportPath: "golang.org/x/tools/cmd/goimports", Version: "v0.1.0"},
+				{ImportPath: "golang.org/x/tools/cmd/godoc", Version: "v0.1.0"},
+				{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"},
+			},
+			opts: client.ListOptions{Filter: "golang.org/x/tools/cmd/goimports"},
+			wantTools: []client.ToolInfo{
+				{
+					Tool: tool.Tool{ImportPath: "golang.org/x/tools/cmd/goimports", Version: "v0.1.0"},
+				},
+			},
+		},
+		{
+			name: "filter substring",
+			lockfileTools: []tool.Tool{
+				{ImportPath: "golang.org/x/tools/cmd/goimports", Version: "v0.1.0"},
+				{ImportPath: "golang.org/x/tools/cmd/godoc", Version: "v0.1.0"},
+				{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"},
+			},
+			opts: client.ListOptions{Filter: "godoc"},
+			wantTools: []client.ToolInfo{
+				{
+					Tool: tool.Tool{ImportPath: "golang.org/x/tools/cmd/godoc", Version: "v0.1.0"},
+				},
+			},
+		},
+		{
+			name: "filter prefix",
+			lockfileTools: []tool.Tool{
+				{ImportPath: "golang.org/x/tools/cmd/goimports", Version: "v0.1.0"},
+				{ImportPath: "golang.org/x/tools/cmd/godoc", Version: "v0.1.0"},
+				{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"},
+			},
+			opts: client.ListOptions{Filter: "golang.org/x/..."},
+			wantTools: []client.ToolInfo{
+				{
+					Tool: tool.Tool{ImportPath: "golang.org/x/tools/cmd/godoc", Version: "v0.1.0"},
+				},
+				{
+					Tool: tool.Tool{ImportPath: "golang.org/x/tools/cmd/goimports", Version: "v0.1.0"},
+				},
+			},
+		},
+		{
+			name: "filter wildcard with updates",
+			lockfileTools: []tool.Tool{
+				{ImportPath: "github.com/golangci/golangci-lint/cmd/golangci-lint", Version: "v1.28.3"},
+				{ImportPath: "github.com/Shopify/ejson/cmd/ejson", Version: "v1.2.2"},
+				{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"},
+			},
+			opts: client.ListOptions{ShowUpdates: true, Filter: "*/*/*/cmd/*"},
+			wantTools: []client.ToolInfo{
+				{
+					Tool: tool.Tool{ImportPath: "github.com/Shopify/ejson/cmd/ejson", Version: "v1.2.2"},
+				},
+				{
+					Tool:          tool.Tool{ImportPath: "github.com/golangci/golangci-lint/cmd/golangci-lint", Version: "v1.28.3"},
+					LatestVersion: "v1.33.0",
+				},
+			},
+		},
+		{
+			name: "filter wildcard no matches",
+			lockfileTools: []tool.Tool{
+				{ImportPath: "golang.org/x/tools/cmd/godoc", Version: "v0.1.0"},
+			},
+			opts:      client.ListOptions{ShowUpdates: true, Filter: "github.com/*"},
+			wantTools: nil,
+		},
 	}
 
 	for _, tt := range tests {
@@ -491,3 +923,3011 @@ func TestList(t *testing.T) {
 		})
 	}
 }
+
+func TestListInvalidFilter(t *testing.T) {
+	td := t.TempDir()
+	lockfilePath := filepath.Join(td, "shed.lock")
+	createLockfile(t, lockfilePath, []tool.Tool{{ImportPath: "golang.org/x/tools/cmd/stringer", Version: "v0.1.0"}})
+	s, err := client.NewShed(client.WithLockfilePath(lockfilePath), client.WithCache(cache.New(td)))
+	if err != nil {
+		t.Fatalf("failed to create shed client %v", err)
+	}
+	_, err = s.List(context.Background(), client.ListOptions{Filter: "golang.org/["})
+	if rootErr := errors.Root(err); rootErr == nil || rootErr.Kind != errors.Invalid {
+		t.Errorf("got err %v, want Invalid kind", err)
+	}
+}
+
+func TestListMajorLock(t *testing.T) {
+	td := t.TempDir()
+	lockfilePath := filepath.Join(td, "shed.lock")
+	mockGo, err := cache.NewMockGo(map[string]map[string]string{
+		"github.com/Shopify/ejson/cmd/ejson": {
+			"v1.1.0": "v1.1.0",
+			"v1.2.2": "v1.2.2",
+			"v2.0.0": "v2.0.0",
+		},
+		"github.com/cszatmary/go-fish": {
+			"v0.1.0": "v0.1.0",
+			"v1.0.0": "v1.0.0",
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to create mock go %v", err)
+	}
+
+	createLockfile(t, lockfilePath, []tool.Tool{
+		{ImportPath: "github.com/Shopify/ejson/cmd/ejson", Version: "v1.1.0"},
+		{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"},
+	})
+	s, err := client.NewShed(
+		client.WithLockfilePath(lockfilePath),
+		client.WithCache(cache.New(td, cache.WithGo(mockGo))),
+	)
+	if err != nil {
+		t.Fatalf("failed to create shed client %v", err)
+	}
+	ctx := context.Background()
+	installSet, err := s.Get(client.GetOptions{})
+	if err != nil {
+		t.Fatalf("failed to install tools %v", err)
+	}
+	if err := installSet.Apply(ctx); err != nil {
+		t.Fatalf("failed to install tools %v", err)
+	}
+
+	got, err := s.List(ctx, client.ListOptions{ShowUpdates: true, MajorLock: true})
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	want := []client.ToolInfo{
+		{
+			Tool:          tool.Tool{ImportPath: "github.com/Shopify/ejson/cmd/ejson", Version: "v1.1.0"},
+			LatestVersion: "v1.2.2",
+		},
+		{
+			Tool: tool.Tool{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got tools %+v, want %+v", got, want)
+	}
+}
+
+func TestGetWithOverlay(t *testing.T) {
+	td := t.TempDir()
+	lockfilePath := filepath.Join(td, "shed.lock")
+	overlayPath := filepath.Join(td, "shed.override.lock")
+	mockGo, err := cache.NewMockGo(availableTools)
+	if err != nil {
+		t.Fatalf("failed to create mock go %v", err)
+	}
+
+	createLockfile(t, lockfilePath, []tool.Tool{
+		{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"},
+		{ImportPath: "github.com/Shopify/ejson/cmd/ejson", Version: "v1.1.0"},
+	})
+	createLockfile(t, overlayPath, []tool.Tool{
+		{ImportPath: "github.com/Shopify/ejson/cmd/ejson", Version: "v1.2.2"},
+	})
+	s, err := client.NewShed(
+		client.WithLockfilePath(lockfilePath),
+		client.WithOverlay(overlayPath),
+		client.WithCache(cache.New(td, cache.WithGo(mockGo))),
+	)
+	if err != nil {
+		t.Fatalf("failed to create shed client %v", err)
+	}
+
+	installSet, err := s.Get(client.GetOptions{
+		ToolNames: []string{"github.com/golangci/golangci-lint/cmd/golangci-lint@v1.33.0"},
+	})
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if err := installSet.Apply(context.Background()); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+
+	// The overlay version should be used
+	binPath, err := s.ToolPath("ejson")
+	if err != nil {
+		t.Errorf("want nil error, got %v", err)
+	}
+	wantPath := filepath.Join(td, "tools", filepath.FromSlash("github.com/!shopify/ejson/cmd/ejson@v1.2.2/ejson"))
+	if binPath != wantPath {
+		t.Errorf("got path %s, want %s", binPath, wantPath)
+	}
+
+	// The base lockfile should have the new tool, but not the overlay version
+	lf := readLockfile(t, lockfilePath)
+	wantTools := []tool.Tool{
+		{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"},
+		{ImportPath: "github.com/golangci/golangci-lint/cmd/golangci-lint", Version: "v1.33.0"},
+		{ImportPath: "github.com/Shopify/ejson/cmd/ejson", Version: "v1.1.0"},
+	}
+	if lf.LenTools() != len(wantTools) {
+		t.Errorf("got %d tools in lockfile, want %d", lf.LenTools(), len(wantTools))
+	}
+	for _, wantTool := range wantTools {
+		tl, err := lf.GetTool(wantTool.ImportPath)
+		if err != nil {
+			t.Errorf("want nil error, got %v", err)
+		}
+		if tl != wantTool {
+			t.Errorf("got %+v, want %+v", tl, wantTool)
+		}
+	}
+
+	// The overlay must not be modified
+	overlay := readLockfile(t, overlayPath)
+	if overlay.LenTools() != 1 {
+		t.Errorf("got %d tools in overlay, want 1", overlay.LenTools())
+	}
+}
+
+func TestInstallEphemeral(t *testing.T) {
+	td := t.TempDir()
+	lockfilePath := filepath.Join(td, "shed.lock")
+	mockGo, err := cache.NewMockGo(availableTools)
+	if err != nil {
+		t.Fatalf("failed to create mock go %v", err)
+	}
+
+	s, err := client.NewShed(
+		client.WithLockfilePath(lockfilePath),
+		client.WithoutLockfile(),
+		client.WithCache(cache.New(td, cache.WithGo(mockGo))),
+	)
+	if err != nil {
+		t.Fatalf("failed to create shed client %v", err)
+	}
+
+	for _, toolName := range []string{
+		"github.com/Shopify/ejson/cmd/ejson@v1.1.0",
+		// Should reuse the cached version
+		"github.com/Shopify/ejson/cmd/ejson@v1.1.0",
+		"github.com/Shopify/ejson/cmd/ejson@latest",
+	} {
+		binPath, err := s.InstallEphemeral(context.Background(), toolName)
+		if err != nil {
+			t.Errorf("want nil error, got %v", err)
+		}
+		if !util.FileOrDirExists(binPath) {
+			t.Errorf("expected %s to exist, but it doesn't", binPath)
+		}
+	}
+	if util.FileOrDirExists(lockfilePath) {
+		t.Errorf("expected %s to not exist, but it exists", lockfilePath)
+	}
+
+	// Writing the lockfile is not allowed
+	installSet, err := s.Get(client.GetOptions{ToolNames: []string{"github.com/cszatmary/go-fish"}})
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	err = installSet.Apply(context.Background())
+	if rootErr := errors.Root(err); rootErr == nil || rootErr.Kind != errors.Invalid {
+		t.Errorf("want invalid error, got %v", err)
+	}
+}
+
+// countingGo wraps a cache.Go and counts the number of calls made to it.
+type countingGo struct {
+	cache.Go
+	mu    sync.Mutex
+	getD  int
+	build int
+}
+
+func (cg *countingGo) GetD(ctx context.Context, mod, dir string) error {
+	cg.mu.Lock()
+	cg.getD++
+	cg.mu.Unlock()
+	return cg.Go.GetD(ctx, mod, dir)
+}
+
+func (cg *countingGo) Build(ctx context.Context, pkg, outPath, dir string, flags []string) error {
+	cg.mu.Lock()
+	cg.build++
+	cg.mu.Unlock()
+	return cg.Go.Build(ctx, pkg, outPath, dir, flags)
+}
+
+func TestGetAlreadySatisfied(t *testing.T) {
+	td := t.TempDir()
+	lockfilePath := filepath.Join(td, "shed.lock")
+	mockGo, err := cache.NewMockGo(availableTools)
+	if err != nil {
+		t.Fatalf("failed to create mock go %v", err)
+	}
+	cg := &countingGo{Go: mockGo}
+	c := cache.New(td, cache.WithGo(cg))
+
+	ejson := tool.Tool{ImportPath: "github.com/Shopify/ejson/cmd/ejson", Version: "v1.1.0"}
+	createLockfile(t, lockfilePath, []tool.Tool{ejson})
+	if _, err := c.Install(context.Background(), ejson); err != nil {
+		t.Fatalf("failed to install tool %v", err)
+	}
+	cg.getD, cg.build = 0, 0
+
+	s, err := client.NewShed(client.WithLockfilePath(lockfilePath), client.WithCache(c))
+	if err != nil {
+		t.Fatalf("failed to create shed client %v", err)
+	}
+	installSet, err := s.Get(client.GetOptions{ToolNames: []string{ejson.Module()}})
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if err := installSet.Apply(context.Background()); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+
+	if cg.getD != 0 || cg.build != 0 {
+		t.Errorf("got %d GetD calls and %d Build calls, want none", cg.getD, cg.build)
+	}
+	want := []client.InstallResult{{Tool: ejson, AlreadySatisfied: true, CacheHit: true}}
+	got := installSet.Results()
+	for i := range got {
+		// Duration varies so don't compare it
+		got[i].Duration = 0
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got results %+v, want %+v", got, want)
+	}
+}
+
+func TestApplyForce(t *testing.T) {
+	td := t.TempDir()
+	lockfilePath := filepath.Join(td, "shed.lock")
+	mockGo, err := cache.NewMockGo(availableTools)
+	if err != nil {
+		t.Fatalf("failed to create mock go %v", err)
+	}
+	cg := &countingGo{Go: mockGo}
+	c := cache.New(td, cache.WithGo(cg))
+
+	ejson := tool.Tool{ImportPath: "github.com/Shopify/ejson/cmd/ejson", Version: "v1.1.0"}
+	createLockfile(t, lockfilePath, []tool.Tool{ejson})
+	if _, err := c.Install(context.Background(), ejson); err != nil {
+		t.Fatalf("failed to install tool %v", err)
+	}
+	cg.getD, cg.build = 0, 0
+
+	s, err := client.NewShed(client.WithLockfilePath(lockfilePath), client.WithCache(c))
+	if err != nil {
+		t.Fatalf("failed to create shed client %v", err)
+	}
+	installSet, err := s.Get(client.GetOptions{ToolNames: []string{ejson.Module()}})
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	installSet.Force = true
+	if err := installSet.Apply(context.Background()); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+
+	// The tool is downloaded and built again even though it was already installed
+	if cg.getD != 1 || cg.build != 1 {
+		t.Errorf("got %d GetD calls and %d Build calls, want 1 of each", cg.getD, cg.build)
+	}
+	want := []client.InstallResult{{Tool: ejson}}
+	got := installSet.Results()
+	for i := range got {
+		// Duration varies so don't compare it
+		got[i].Duration = 0
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got results %+v, want %+v", got, want)
+	}
+}
+
+// networkGo is a cache.Go that fails to download because of a network error.
+type networkGo struct {
+	cache.Go
+}
+
+func (networkGo) GetD(ctx context.Context, mod, dir string) error {
+	return errors.New(errors.Go, "failed to download "+mod, errors.Op("networkGo.GetD"), cache.ErrNetwork)
+}
+
+func TestApplyOfflineFallback(t *testing.T) {
+	tests := []struct {
+		name       string
+		locked     tool.Tool
+		wantErr    bool
+		wantLocked tool.Tool
+	}{
+		{
+			name:       "cached version",
+			locked:     tool.Tool{ImportPath: "github.com/Shopify/ejson/cmd/ejson", Version: "v1.1.0"},
+			wantLocked: tool.Tool{ImportPath: "github.com/Shopify/ejson/cmd/ejson", Version: "v1.1.0"},
+		},
+		{
+			name:       "cached version lower than lockfile",
+			locked:     tool.Tool{ImportPath: "github.com/Shopify/ejson/cmd/ejson", Version: "v1.2.2"},
+			wantErr:    true,
+			wantLocked: tool.Tool{ImportPath: "github.com/Shopify/ejson/cmd/ejson", Version: "v1.2.2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			td := t.TempDir()
+			lockfilePath := filepath.Join(td, "shed.lock")
+			mockGo, err := cache.NewMockGo(availableTools)
+			if err != nil {
+				t.Fatalf("failed to create mock go %v", err)
+			}
+			// Only the older version is in the cache
+			cached := tool.Tool{ImportPath: "github.com/Shopify/ejson/cmd/ejson", Version: "v1.1.0"}
+			if _, err := cache.New(td, cache.WithGo(mockGo)).Install(context.Background(), cached); err != nil {
+				t.Fatalf("failed to install tool %v", err)
+			}
+			createLockfile(t, lockfilePath, []tool.Tool{tt.locked})
+
+			s, err := client.NewShed(
+				client.WithLockfilePath(lockfilePath),
+				client.WithCache(cache.New(td, cache.WithGo(networkGo{mockGo}))),
+			)
+			if err != nil {
+				t.Fatalf("failed to create shed client %v", err)
+			}
+			installSet, err := s.Get(client.GetOptions{ToolNames: []string{tt.locked.ImportPath}, Update: true})
+			if err != nil {
+				t.Fatalf("want nil error, got %v", err)
+			}
+			installSet.OfflineFallback = true
+			err = installSet.Apply(context.Background())
+			if tt.wantErr {
+				errs, ok := err.(errors.List)
+				if !ok || len(errs) != 1 {
+					t.Fatalf("got error %v, want errors.List with 1 error", err)
+				}
+				if !errors.Is(errs[0], cache.ErrNetwork) {
+					t.Errorf("got error %v, want %v", errs[0], cache.ErrNetwork)
+				}
+			} else if err != nil {
+				t.Fatalf("want nil error, got %v", err)
+			}
+
+			lf := readLockfile(t, lockfilePath)
+			got, err := lf.GetTool(tt.locked.ImportPath)
+			if err != nil {
+				t.Fatalf("want nil error, got %v", err)
+			}
+			if got != tt.wantLocked {
+				t.Errorf("got %v, want %v", got, tt.wantLocked)
+			}
+		})
+	}
+}
+
+func TestApplyResultsCacheHit(t *testing.T) {
+	td := t.TempDir()
+	lockfilePath := filepath.Join(td, "shed.lock")
+	mockGo, err := cache.NewMockGo(availableTools)
+	if err != nil {
+		t.Fatalf("failed to create mock go %v", err)
+	}
+	fg := &failingGo{countingGo: &countingGo{Go: mockGo}, fail: map[string]bool{"github.com/cszatmary/go-fish@v0.1.0": true}}
+	c := cache.New(td, cache.WithGo(fg))
+
+	ejson := tool.Tool{ImportPath: "github.com/Shopify/ejson/cmd/ejson", Version: "v1.1.0"}
+	lint := tool.Tool{ImportPath: "github.com/golangci/golangci-lint/cmd/golangci-lint", Version: "v1.33.0"}
+	goFish := tool.Tool{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"}
+	createLockfile(t, lockfilePath, []tool.Tool{ejson, lint, goFish})
+	if _, err := c.Install(context.Background(), ejson); err != nil {
+		t.Fatalf("failed to install tool %v", err)
+	}
+
+	s, err := client.NewShed(client.WithLockfilePath(lockfilePath), client.WithCache(c))
+	if err != nil {
+		t.Fatalf("failed to create shed client %v", err)
+	}
+	installSet, err := s.Get(client.GetOptions{})
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	installSet.Concurrency = 1
+	if err := installSet.Apply(context.Background()); err == nil {
+		t.Fatal("want error, got nil")
+	}
+
+	cacheHits := make(map[tool.Tool]bool)
+	for _, r := range installSet.Results() {
+		cacheHits[r.Tool] = r.CacheHit
+	}
+	wantHits := map[tool.Tool]bool{ejson: true, lint: false}
+	if !reflect.DeepEqual(cacheHits, wantHits) {
+		t.Errorf("got cache hits %v, want %v", cacheHits, wantHits)
+	}
+	failures := installSet.Failures()
+	if len(failures) != 1 || failures[0].Tool != goFish || failures[0].Err == nil {
+		t.Errorf("got failures %+v, want a failure for %v", failures, goFish)
+	}
+}
+
+func TestApplyPartialFailureLockfileUnchanged(t *testing.T) {
+	td := t.TempDir()
+	lockfilePath := filepath.Join(td, "shed.lock")
+	mockGo, err := cache.NewMockGo(availableTools)
+	if err != nil {
+		t.Fatalf("failed to create mock go %v", err)
+	}
+	fg := &failingGo{countingGo: &countingGo{Go: mockGo}, fail: map[string]bool{"github.com/Shopify/ejson/cmd/ejson@v1.1.0": true}}
+	goFish := tool.Tool{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"}
+	createLockfile(t, lockfilePath, []tool.Tool{goFish})
+	before, err := os.ReadFile(lockfilePath)
+	if err != nil {
+		t.Fatalf("failed to read lockfile %v", err)
+	}
+
+	s, err := client.NewShed(client.WithLockfilePath(lockfilePath), client.WithCache(cache.New(td, cache.WithGo(fg))))
+	if err != nil {
+		t.Fatalf("failed to create shed client %v", err)
+	}
+	installSet, err := s.Get(client.GetOptions{
+		ToolNames: []string{
+			"github.com/golangci/golangci-lint/cmd/golangci-lint@v1.33.0",
+			"github.com/Shopify/ejson/cmd/ejson@v1.1.0",
+		},
+	})
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if err := installSet.Apply(context.Background()); err == nil {
+		t.Fatal("want error, got nil")
+	}
+	if len(installSet.Results()) == 0 {
+		t.Fatal("want golangci-lint to be installed, got no results")
+	}
+
+	// The lockfile is only written if every tool succeeds, so golangci-lint must not have been added
+	after, err := os.ReadFile(lockfilePath)
+	if err != nil {
+		t.Fatalf("failed to read lockfile %v", err)
+	}
+	if string(after) != string(before) {
+		t.Errorf("got lockfile\n%s\nwant it unchanged\n%s", after, before)
+	}
+	if _, err := s.ToolPath("golangci-lint"); err == nil {
+		t.Error("want error getting path of golangci-lint, got nil")
+	}
+}
+
+func TestPlan(t *testing.T) {
+	td := t.TempDir()
+	lockfilePath := filepath.Join(td, "shed.lock")
+	mockGo, err := cache.NewMockGo(availableTools)
+	if err != nil {
+		t.Fatalf("failed to create mock go %v", err)
+	}
+	newShed := func() *client.Shed {
+		s, err := client.NewShed(
+			client.WithLockfilePath(lockfilePath),
+			client.WithCache(cache.New(td, cache.WithGo(mockGo))),
+		)
+		if err != nil {
+			t.Fatalf("failed to create shed client %v", err)
+		}
+		return s
+	}
+
+	createLockfile(t, lockfilePath, []tool.Tool{
+		{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"},
+		{ImportPath: "github.com/golangci/golangci-lint/cmd/golangci-lint", Version: "v1.28.3"},
+		{ImportPath: "github.com/Shopify/ejson/cmd/ejson", Version: "v1.1.0"},
+	})
+	installSet, err := newShed().Get(client.GetOptions{
+		ToolNames: []string{
+			"github.com/golangci/golangci-lint/cmd/golangci-lint@v1.33.0",
+			"github.com/Shopify/ejson/cmd/ejson@none",
+			"golang.org/x/tools/cmd/stringer",
+			"github.com/cszatmary/go-fish@v0.1.0",
+		},
+	})
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+
+	plan := installSet.Plan()
+	wantPlan := &client.Plan{
+		Lockfile: map[string]string{
+			"github.com/cszatmary/go-fish":                        "v0.1.0",
+			"github.com/golangci/golangci-lint/cmd/golangci-lint": "v1.28.3",
+			"github.com/Shopify/ejson/cmd/ejson":                  "v1.1.0",
+		},
+		Changes: []client.PlanChange{
+			{
+				Action:         client.PlanRemove,
+				ImportPath:     "github.com/Shopify/ejson/cmd/ejson",
+				CurrentVersion: "v1.1.0",
+			},
+			{
+				Action:         client.PlanUpdate,
+				ImportPath:     "github.com/golangci/golangci-lint/cmd/golangci-lint",
+				CurrentVersion: "v1.28.3",
+				Version:        "v1.33.0",
+			},
+			{
+				Action:     client.PlanAdd,
+				ImportPath: "golang.org/x/tools/cmd/stringer",
+				Version:    "latest",
+			},
+		},
+	}
+	if !reflect.DeepEqual(plan, wantPlan) {
+		t.Errorf("got plan %+v, want %+v", plan, wantPlan)
+	}
+
+	installSet, err = newShed().GetPlan(plan)
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if err := installSet.Apply(context.Background()); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	lf := readLockfile(t, lockfilePath)
+	wantTools := []tool.Tool{
+		{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"},
+		{ImportPath: "github.com/golangci/golangci-lint/cmd/golangci-lint", Version: "v1.33.0"},
+		{ImportPath: "golang.org/x/tools/cmd/stringer", Version: "v0.0.0-20201211185031-d93e913c1a58"},
+	}
+	if lf.LenTools() != len(wantTools) {
+		t.Errorf("got %d tools in lockfile, want %d", lf.LenTools(), len(wantTools))
+	}
+	for _, wantTool := range wantTools {
+		tl, err := lf.GetTool(wantTool.ImportPath)
+		if err != nil {
+			t.Errorf("want nil error, got %v", err)
+		}
+		if tl != wantTool {
+			t.Errorf("got %+v, want %+v", tl, wantTool)
+		}
+	}
+
+	// The lockfile has now changed so the plan can't be applied again
+	_, err = newShed().GetPlan(plan)
+	errList, ok := err.(errors.List)
+	if !ok {
+		t.Fatalf("want error to be errors.List, got %s: %T", err, err)
+	}
+	// golangci-lint changed, ejson was removed, stringer was added
+	if len(errList) != 3 {
+		t.Errorf("got %d errors, want 3", len(errList))
+	}
+}
+
+func TestGetFrom(t *testing.T) {
+	lockfileTools := []tool.Tool{
+		{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"},
+		{ImportPath: "github.com/Shopify/ejson/cmd/ejson", Version: "v1.1.0"},
+	}
+	tests := []struct {
+		name         string
+		fromTools    []tool.Tool
+		installTools []string
+		merge        bool
+		wantTools    []tool.Tool
+		wantErr      bool
+	}{
+		{
+			name: "install without merge",
+			fromTools: []tool.Tool{
+				{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"},
+				{ImportPath: "github.com/golangci/golangci-lint/cmd/golangci-lint", Version: "v1.28.3"},
+			},
+			wantTools: lockfileTools,
+		},
+		{
+			name: "install with merge",
+			fromTools: []tool.Tool{
+				{ImportPath: "github.com/golangci/golangci-lint/cmd/golangci-lint", Version: "v1.28.3"},
+			},
+			merge: true,
+			wantTools: []tool.Tool{
+				{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"},
+				{ImportPath: "github.com/golangci/golangci-lint/cmd/golangci-lint", Version: "v1.28.3"},
+				{ImportPath: "github.com/Shopify/ejson/cmd/ejson", Version: "v1.1.0"},
+			},
+		},
+		{
+			name: "conflict",
+			fromTools: []tool.Tool{
+				{ImportPath: "github.com/Shopify/ejson/cmd/ejson", Version: "v1.2.2"},
+			},
+			merge:   true,
+			wantErr: true,
+		},
+		{
+			name: "conflict resolved explicitly",
+			fromTools: []tool.Tool{
+				{ImportPath: "github.com/Shopify/ejson/cmd/ejson", Version: "v1.2.2"},
+			},
+			installTools: []string{"github.com/Shopify/ejson/cmd/ejson@v1.2.2"},
+			merge:        true,
+			wantTools: []tool.Tool{
+				{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"},
+				{ImportPath: "github.com/Shopify/ejson/cmd/ejson", Version: "v1.2.2"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			td := t.TempDir()
+			lockfilePath := filepath.Join(td, "shed.lock")
+			mockGo, err := cache.NewMockGo(availableTools)
+			if err != nil {
+				t.Fatalf("failed to create mock go %v", err)
+			}
+			createLockfile(t, lockfilePath, lockfileTools)
+			from := &lockfile.Lockfile{}
+			for _, tl := range tt.fromTools {
+				if err := from.PutTool(tl); err != nil {
+					t.Fatalf("failed to add tool %v to lockfile: %v", tl, err)
+				}
+			}
+			s, err := client.NewShed(
+				client.WithLockfilePath(lockfilePath),
+				client.WithCache(cache.New(td, cache.WithGo(mockGo))),
+			)
+			if err != nil {
+				t.Fatalf("failed to create shed client %v", err)
+			}
+
+			installSet, err := s.Get(client.GetOptions{
+				ToolNames: tt.installTools,
+				From:      from,
+				MergeFrom: tt.merge,
+			})
+			if tt.wantErr {
+				if _, ok := err.(errors.List); !ok {
+					t.Errorf("want error to be errors.List, got %s: %T", err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("want nil error, got %v", err)
+			}
+			if err := installSet.Apply(context.Background()); err != nil {
+				t.Fatalf("want nil error, got %v", err)
+			}
+
+			// All tools from the other lockfile must be installed
+			c := cache.New(td)
+			for _, tl := range tt.fromTools {
+				if _, err := c.ToolPath(tl); err != nil {
+					t.Errorf("want nil error, got %v", err)
+				}
+			}
+			lf := readLockfile(t, lockfilePath)
+			if lf.LenTools() != len(tt.wantTools) {
+				t.Errorf("got %d tools in lockfile, want %d", lf.LenTools(), len(tt.wantTools))
+			}
+			for _, wantTool := range tt.wantTools {
+				tl, err := lf.GetTool(wantTool.ImportPath)
+				if err != nil {
+					t.Errorf("want nil error, got %v", err)
+				}
+				if tl != wantTool {
+					t.Errorf("got %+v, want %+v", tl, wantTool)
+				}
+			}
+		})
+	}
+}
+
+// failingGo wraps a cache.Go and fails to download the modules in fail.
+type failingGo struct {
+	*countingGo
+	fail map[string]bool
+}
+
+func (fg *failingGo) GetD(ctx context.Context, mod, dir string) error {
+	if fg.fail[mod] {
+		return errors.New(errors.Go, "failed to download "+mod)
+	}
+	return fg.countingGo.GetD(ctx, mod, dir)
+}
+
+// blockingGo wraps a cache.Go and blocks downloading the modules in block until the context is done.
+type blockingGo struct {
+	cache.Go
+	block map[string]bool
+}
+
+func (bg *blockingGo) GetD(ctx context.Context, mod, dir string) error {
+	if bg.block[mod] {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	return bg.Go.GetD(ctx, mod, dir)
+}
+
+// slowListGo is a cache.Go that fails to check modules in fail for updates and is slow to check others.
+type slowListGo struct {
+	cache.Go
+	fail map[string]bool
+}
+
+func (g slowListGo) ListU(ctx context.Context, mod, dir string) (cache.GoModule, error) {
+	if g.fail[mod] {
+		return cache.GoModule{}, errors.New(errors.Go, "failed to list "+mod)
+	}
+	time.Sleep(5 * time.Millisecond)
+	return g.Go.ListU(ctx, mod, dir)
+}
+
+func TestConcurrentListApply(t *testing.T) {
+	td := t.TempDir()
+	lockfilePath := filepath.Join(td, "shed.lock")
+	mockGo, err := cache.NewMockGo(availableTools)
+	if err != nil {
+		t.Fatalf("failed to create mock go %v", err)
+	}
+	lg := slowListGo{Go: mockGo, fail: map[string]bool{"github.com/cszatmary/go-fish": true}}
+	createLockfile(t, lockfilePath, []tool.Tool{
+		{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"},
+		{ImportPath: "example.org/x/tools/cmd/stringer", Version: "v1.0.0"},
+		{ImportPath: "golang.org/x/tools/cmd/godoc", Version: "v0.1.5"},
+	})
+	s, err := client.NewShed(
+		client.WithLockfilePath(lockfilePath),
+		client.WithCache(cache.New(td, cache.WithGo(lg))),
+	)
+	if err != nil {
+		t.Fatalf("failed to create shed client %v", err)
+	}
+
+	ctx := context.Background()
+	toolNames := []string{
+		"github.com/golangci/golangci-lint/cmd/golangci-lint@v1.33.0",
+		"github.com/Shopify/ejson/cmd/ejson@v1.2.2",
+		"golang.org/x/tools/cmd/goimports@v0.1.5",
+	}
+	var wg sync.WaitGroup
+	errCh := make(chan error, len(toolNames)+2)
+	for _, toolName := range toolNames {
+		wg.Add(1)
+		go func(toolName string) {
+			defer wg.Done()
+			installSet, err := s.Get(client.GetOptions{ToolNames: []string{toolName}})
+			if err != nil {
+				errCh <- err
+				return
+			}
+			errCh <- installSet.Apply(ctx)
+		}(toolName)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			tools, err := s.List(ctx, client.ListOptions{})
+			if err != nil {
+				errCh <- err
+				return
+			}
+			if len(tools) == 0 {
+				errCh <- fmt.Errorf("got no tools from List")
+				return
+			}
+			s.ToolsByName("go-fish")
+		}
+		errCh <- nil
+	}()
+	// List returns as soon as the update check for go-fish fails,
+	// while the checks for other tools are still running.
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			if _, err := s.List(ctx, client.ListOptions{ShowUpdates: true, Concurrency: 4}); err == nil {
+				errCh <- fmt.Errorf("want error from List with updates, got nil")
+				return
+			}
+		}
+		errCh <- nil
+	}()
+	wg.Wait()
+	close(errCh)
+	for err := range errCh {
+		if err != nil {
+			t.Errorf("want nil error, got %v", err)
+		}
+	}
+
+	lf := readLockfile(t, lockfilePath)
+	if lf.LenTools() != len(toolNames)+3 {
+		t.Errorf("got %d tools in lockfile, want %d", lf.LenTools(), len(toolNames)+3)
+	}
+}
+
+func TestApplyTimeout(t *testing.T) {
+	td := t.TempDir()
+	lockfilePath := filepath.Join(td, "shed.lock")
+	mockGo, err := cache.NewMockGo(availableTools)
+	if err != nil {
+		t.Fatalf("failed to create mock go %v", err)
+	}
+	bg := &blockingGo{Go: mockGo, block: map[string]bool{"github.com/cszatmary/go-fish@v0.1.0": true}}
+	s, err := client.NewShed(
+		client.WithLockfilePath(lockfilePath),
+		client.WithCache(cache.New(td, cache.WithGo(bg))),
+	)
+	if err != nil {
+		t.Fatalf("failed to create shed client %v", err)
+	}
+
+	ejson := tool.Tool{ImportPath: "github.com/Shopify/ejson/cmd/ejson", Version: "v1.1.0"}
+	goFish := tool.Tool{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"}
+	installSet, err := s.Get(client.GetOptions{ToolNames: []string{ejson.String(), goFish.String()}})
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	installSet.Timeout = 50 * time.Millisecond
+	err = installSet.Apply(context.Background())
+	errs, ok := err.(errors.List)
+	if !ok {
+		t.Fatalf("want error to be errors.List, got %v: %T", err, err)
+	}
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "timed out installing tool "+goFish.String()) {
+		t.Errorf("got errors %v, want a timeout error for %v", errs, goFish)
+	}
+
+	// The tool that didn't time out is still installed
+	var gotTools []tool.Tool
+	for _, r := range installSet.Results() {
+		gotTools = append(gotTools, r.Tool)
+	}
+	if want := []tool.Tool{ejson}; !reflect.DeepEqual(gotTools, want) {
+		t.Errorf("got installed tools %v, want %v", gotTools, want)
+	}
+	failures := installSet.Failures()
+	if len(failures) != 1 || failures[0].Tool != goFish {
+		t.Errorf("got failures %+v, want a failure for %v", failures, goFish)
+	}
+}
+
+// activeGo is a cache.Go that records the max number of downloads that happen at once.
+type activeGo struct {
+	cache.Go
+	mu        sync.Mutex
+	active    int
+	maxActive int
+}
+
+func (g *activeGo) GetD(ctx context.Context, mod, dir string) error {
+	g.mu.Lock()
+	g.active++
+	if g.active > g.maxActive {
+		g.maxActive = g.active
+	}
+	g.mu.Unlock()
+	// Slow down so overlapping calls are likely if the limit is not respected
+	time.Sleep(5 * time.Millisecond)
+	err := g.Go.GetD(ctx, mod, dir)
+	g.mu.Lock()
+	g.active--
+	g.mu.Unlock()
+	return err
+}
+
+func TestApplySharedSemaphore(t *testing.T) {
+	td := t.TempDir()
+	mockGo, err := cache.NewMockGo(availableTools)
+	if err != nil {
+		t.Fatalf("failed to create mock go %v", err)
+	}
+	ag := &activeGo{Go: mockGo}
+	c := cache.New(filepath.Join(td, "cache"), cache.WithGo(ag))
+	sem := client.NewSemaphore(2)
+	if sem.Size() != 2 {
+		t.Errorf("got size %d, want 2", sem.Size())
+	}
+
+	lockfileTools := [][]tool.Tool{
+		{
+			{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"},
+			{ImportPath: "github.com/golangci/golangci-lint/cmd/golangci-lint", Version: "v1.33.0"},
+			{ImportPath: "github.com/Shopify/ejson/cmd/ejson", Version: "v1.2.2"},
+		},
+		{
+			{ImportPath: "golang.org/x/tools/cmd/goimports", Version: "v0.1.5"},
+			{ImportPath: "github.com/golangci/golangci-lint/cmd/golangci-lint", Version: "v1.28.3"},
+			{ImportPath: "github.com/Shopify/ejson/cmd/ejson", Version: "v1.1.0"},
+		},
+	}
+	var installSets []*client.InstallSet
+	for i, tools := range lockfileTools {
+		lockfilePath := filepath.Join(td, fmt.Sprintf("shed%d.lock", i))
+		createLockfile(t, lockfilePath, tools)
+		s, err := client.NewShed(client.WithLockfilePath(lockfilePath), client.WithCache(c))
+		if err != nil {
+			t.Fatalf("failed to create shed client %v", err)
+		}
+		installSet, err := s.Get(client.GetOptions{})
+		if err != nil {
+			t.Fatalf("want nil error, got %v", err)
+		}
+		installSet.Concurrency = 3
+		installSet.WithSharedSemaphore(sem)
+		installSets = append(installSets, installSet)
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(installSets))
+	for i, installSet := range installSets {
+		wg.Add(1)
+		go func(i int, installSet *client.InstallSet) {
+			defer wg.Done()
+			errs[i] = installSet.Apply(context.Background())
+		}(i, installSet)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Errorf("want nil error, got %v", err)
+		}
+	}
+	if ag.maxActive > 2 {
+		t.Errorf("got %d concurrent downloads, want at most 2", ag.maxActive)
+	}
+}
+
+func TestSemaphoreConcurrencyEnv(t *testing.T) {
+	numCPUs := uint(runtime.NumCPU())
+	tests := []struct {
+		name string
+		env  string
+		n    uint
+		want uint
+	}{
+		{"unset", "", 0, numCPUs},
+		{"env set", "3", 0, 3},
+		{"explicit value takes precedence", "3", 5, 5},
+		{"zero is clamped", "0", 0, 1},
+		{"negative is clamped", "-2", 0, 1},
+		{"invalid is ignored", "many", 0, numCPUs},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("SHED_CONCURRENCY", tt.env)
+			if got := client.NewSemaphore(tt.n).Size(); got != tt.want {
+				t.Errorf("got size %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResume(t *testing.T) {
+	td := t.TempDir()
+	lockfilePath := filepath.Join(td, "shed.lock")
+	statePath := filepath.Join(td, "state.json")
+	mockGo, err := cache.NewMockGo(availableTools)
+	if err != nil {
+		t.Fatalf("failed to create mock go %v", err)
+	}
+	fg := &failingGo{
+		countingGo: &countingGo{Go: mockGo},
+		fail:       map[string]bool{"github.com/Shopify/ejson/cmd/ejson@v1.1.0": true},
+	}
+	s, err := client.NewShed(
+		client.WithLockfilePath(lockfilePath),
+		client.WithCache(cache.New(td, cache.WithGo(fg))),
+	)
+	if err != nil {
+		t.Fatalf("failed to create shed client %v", err)
+	}
+
+	installSet, err := s.Get(client.GetOptions{
+		ToolNames: []string{
+			"github.com/cszatmary/go-fish",
+			"github.com/Shopify/ejson/cmd/ejson@v1.1.0",
+		},
+	})
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	installSet.StatePath = statePath
+	if err := installSet.Apply(context.Background()); err == nil {
+		t.Fatal("want error, got nil")
+	}
+	if !util.FileOrDirExists(statePath) {
+		t.Fatalf("expected %s to exist, but it doesn't", statePath)
+	}
+
+	// Resume, only ejson should be installed
+	fg.fail = nil
+	fg.getD, fg.build = 0, 0
+	installSet, err = s.Resume(statePath)
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if err := installSet.Apply(context.Background()); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if fg.getD != 1 || fg.build != 1 {
+		t.Errorf("got %d GetD calls and %d Build calls, want 1 each", fg.getD, fg.build)
+	}
+	if util.FileOrDirExists(statePath) {
+		t.Errorf("expected %s to not exist, but it exists", statePath)
+	}
+
+	lf := readLockfile(t, lockfilePath)
+	wantTools := []tool.Tool{
+		{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"},
+		{ImportPath: "github.com/Shopify/ejson/cmd/ejson", Version: "v1.1.0"},
+	}
+	if lf.LenTools() != len(wantTools) {
+		t.Errorf("got %d tools in lockfile, want %d", lf.LenTools(), len(wantTools))
+	}
+	for _, wantTool := range wantTools {
+		tl, err := lf.GetTool(wantTool.ImportPath)
+		if err != nil {
+			t.Errorf("want nil error, got %v", err)
+		}
+		if tl != wantTool {
+			t.Errorf("got %+v, want %+v", tl, wantTool)
+		}
+	}
+}
+
+func TestResumeForce(t *testing.T) {
+	td := t.TempDir()
+	lockfilePath := filepath.Join(td, "shed.lock")
+	statePath := filepath.Join(td, "state.json")
+	mockGo, err := cache.NewMockGo(availableTools)
+	if err != nil {
+		t.Fatalf("failed to create mock go %v", err)
+	}
+	fg := &failingGo{
+		countingGo: &countingGo{Go: mockGo},
+		fail:       map[string]bool{"github.com/Shopify/ejson/cmd/ejson@v1.1.0": true},
+	}
+	c := cache.New(td, cache.WithGo(fg))
+	// ejson is already installed, so it is only installed again if the install is forced
+	ejson := tool.Tool{ImportPath: "github.com/Shopify/ejson/cmd/ejson", Version: "v1.1.0"}
+	if _, err := cache.New(td, cache.WithGo(mockGo)).Install(context.Background(), ejson); err != nil {
+		t.Fatalf("failed to install tool %v", err)
+	}
+	s, err := client.NewShed(client.WithLockfilePath(lockfilePath), client.WithCache(c))
+	if err != nil {
+		t.Fatalf("failed to create shed client %v", err)
+	}
+
+	installSet, err := s.Get(client.GetOptions{
+		ToolNames: []string{"github.com/cszatmary/go-fish", ejson.Module()},
+	})
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	installSet.StatePath = statePath
+	installSet.Force = true
+	if err := installSet.Apply(context.Background()); err == nil {
+		t.Fatal("want error, got nil")
+	}
+
+	// Resume, ejson must be forced to install again even though it is installed
+	fg.fail = nil
+	fg.getD, fg.build = 0, 0
+	installSet, err = s.Resume(statePath)
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if !installSet.Force {
+		t.Error("want Force to be set on resumed install")
+	}
+	if err := installSet.Apply(context.Background()); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if fg.getD != 1 || fg.build != 1 {
+		t.Errorf("got %d GetD calls and %d Build calls, want 1 each", fg.getD, fg.build)
+	}
+}
+
+// govulncheckOutput is the output of the fake govulncheck used in TestAudit.
+const govulncheckOutput = `{"config":{"protocol_version":"v1.0.0","scanner_name":"govulncheck"}}
+{"osv":{"id":"GO-2022-0969","summary":"HTTP/2 server connections can hang forever waiting for a clean shutdown"}}
+{"finding":{"osv":"GO-2022-0969","fixed_version":"v0.0.0-20220906165146-f3363e06e74c","trace":[{"module":"golang.org/x/net","version":"v0.0.0-20220722155237-a158d28d115b"}]}}
+{"finding":{"osv":"GO-2022-0969","fixed_version":"v0.0.0-20220906165146-f3363e06e74c","trace":[{"module":"golang.org/x/net","version":"v0.0.0-20220722155237-a158d28d115b","package":"golang.org/x/net/http2"}]}}
+`
+
+func TestAudit(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake govulncheck requires a unix shell")
+	}
+	td := t.TempDir()
+	binDir := filepath.Join(td, "bin")
+	if err := os.Mkdir(binDir, 0o755); err != nil {
+		t.Fatalf("failed to create bin dir %v", err)
+	}
+	script := "#!/bin/sh\nprintf '%s' '" + govulncheckOutput + "'\n"
+	if err := os.WriteFile(filepath.Join(binDir, "govulncheck"), []byte(script), 0o755); err != nil {
+		t.Fatalf("failed to write fake govulncheck %v", err)
+	}
+	t.Setenv("PATH", binDir)
+
+	lockfilePath := filepath.Join(td, "shed.lock")
+	mockGo, err := cache.NewMockGo(availableTools)
+	if err != nil {
+		t.Fatalf("failed to create mock go %v", err)
+	}
+	s, err := client.NewShed(
+		client.WithLockfilePath(lockfilePath),
+		client.WithCache(cache.New(td, cache.WithGo(mockGo))),
+	)
+	if err != nil {
+		t.Fatalf("failed to create shed client %v", err)
+	}
+	installSet, err := s.Get(client.GetOptions{ToolNames: []string{"github.com/cszatmary/go-fish@v0.1.0"}})
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if err := installSet.Apply(context.Background()); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+
+	vulns, err := s.Audit(context.Background())
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	want := []client.Vulnerability{
+		{
+			Tool:         tool.Tool{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"},
+			ID:           "GO-2022-0969",
+			Summary:      "HTTP/2 server connections can hang forever waiting for a clean shutdown",
+			Module:       "golang.org/x/net",
+			Version:      "v0.0.0-20220722155237-a158d28d115b",
+			FixedVersion: "v0.0.0-20220906165146-f3363e06e74c",
+		},
+	}
+	if !reflect.DeepEqual(vulns, want) {
+		t.Errorf("got %+v, want %+v", vulns, want)
+	}
+}
+
+func TestAuditGovulncheckNotInstalled(t *testing.T) {
+	td := t.TempDir()
+	t.Setenv("PATH", td)
+	s, err := client.NewShed(
+		client.WithLockfilePath(filepath.Join(td, "shed.lock")),
+		client.WithCache(cache.New(td)),
+	)
+	if err != nil {
+		t.Fatalf("failed to create shed client %v", err)
+	}
+	_, err = s.Audit(context.Background())
+	if rootErr := errors.Root(err); rootErr == nil || rootErr.Kind != errors.NotInstalled {
+		t.Errorf("got error %v, want kind %v", err, errors.NotInstalled)
+	}
+}
+
+func TestGetKeepGoing(t *testing.T) {
+	td := t.TempDir()
+	lockfilePath := filepath.Join(td, "shed.lock")
+	mockGo, err := cache.NewMockGo(availableTools)
+	if err != nil {
+		t.Fatalf("failed to create mock go %v", err)
+	}
+	s, err := client.NewShed(
+		client.WithLockfilePath(lockfilePath),
+		client.WithCache(cache.New(td, cache.WithGo(mockGo))),
+	)
+	if err != nil {
+		t.Fatalf("failed to create shed client %v", err)
+	}
+
+	toolNames := []string{"github.com/cszatmary/go-fish@v0.1.0", "golang/x/tools/cmd/stringer"}
+	_, err = s.Get(client.GetOptions{ToolNames: toolNames})
+	if err == nil {
+		t.Fatal("want non-nil error, got nil")
+	}
+
+	installSet, err := s.Get(client.GetOptions{ToolNames: toolNames, KeepGoing: true})
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if installSet.Len() != 1 {
+		t.Errorf("got %d tools, want 1", installSet.Len())
+	}
+	if err := installSet.Apply(context.Background()); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	lf := readLockfile(t, lockfilePath)
+	if lf.LenTools() != 1 {
+		t.Errorf("got %d tools in lockfile, want 1", lf.LenTools())
+	}
+}
+
+func TestGetFromReader(t *testing.T) {
+	td := t.TempDir()
+	lockfilePath := filepath.Join(td, "shed.lock")
+	createLockfile(t, lockfilePath, []tool.Tool{
+		{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"},
+	})
+	mockGo, err := cache.NewMockGo(availableTools)
+	if err != nil {
+		t.Fatalf("failed to create mock go %v", err)
+	}
+	s, err := client.NewShed(
+		client.WithLockfilePath(lockfilePath),
+		client.WithCache(cache.New(td, cache.WithGo(mockGo))),
+	)
+	if err != nil {
+		t.Fatalf("failed to create shed client %v", err)
+	}
+
+	_, err = s.GetFromReader(strings.NewReader("golang.org/x/tools/cmd/stringer\n\nnot a tool\nfoo@\n"), client.GetOptions{})
+	errs, ok := err.(errors.List)
+	if !ok {
+		t.Fatalf("got error %v, want errors.List", err)
+	}
+	if len(errs) != 2 {
+		t.Fatalf("got %d errors, want 2", len(errs))
+	}
+	for i, prefix := range []string{"line 3:", "line 4:"} {
+		if !strings.HasPrefix(errs[i].Error(), prefix) {
+			t.Errorf("got error %q, want prefix %q", errs[i], prefix)
+		}
+	}
+
+	r := strings.NewReader(`# Code generation
+golang.org/x/tools/cmd/goimports@v0.1.5 # pinned
+
+  github.com/golangci/golangci-lint/cmd/golangci-lint@v1.33.0
+`)
+	installSet, err := s.GetFromReader(r, client.GetOptions{})
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if installSet.Len() != 3 {
+		t.Errorf("got %d tools, want 3", installSet.Len())
+	}
+	if err := installSet.Apply(context.Background()); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	lf := readLockfile(t, lockfilePath)
+	if lf.LenTools() != 3 {
+		t.Errorf("got %d tools in lockfile, want 3", lf.LenTools())
+	}
+	if _, err := lf.GetTool("golang.org/x/tools/cmd/goimports"); err != nil {
+		t.Errorf("want goimports in lockfile, got %v", err)
+	}
+}
+
+func TestGetFromToolsFile(t *testing.T) {
+	td := t.TempDir()
+	lockfilePath := filepath.Join(td, "shed.lock")
+	goMod := `module example.org/project
+
+go 1.17
+
+require (
+	github.com/golangci/golangci-lint v1.33.0
+	golang.org/x/tools v0.1.5
+)
+`
+	toolsGo := `//go:build tools
+
+package tools
+
+import (
+	_ "github.com/golangci/golangci-lint/cmd/golangci-lint"
+	_ "golang.org/x/tools/cmd/goimports"
+)
+`
+	if err := os.WriteFile(filepath.Join(td, "go.mod"), []byte(goMod), 0o644); err != nil {
+		t.Fatalf("failed to write go.mod %v", err)
+	}
+	toolsDir := filepath.Join(td, "tools")
+	if err := os.Mkdir(toolsDir, 0o755); err != nil {
+		t.Fatalf("failed to create dir %v", err)
+	}
+	toolsPath := filepath.Join(toolsDir, "tools.go")
+	if err := os.WriteFile(toolsPath, []byte(toolsGo), 0o644); err != nil {
+		t.Fatalf("failed to write tools.go %v", err)
+	}
+
+	mockGo, err := cache.NewMockGo(availableTools)
+	if err != nil {
+		t.Fatalf("failed to create mock go %v", err)
+	}
+	s, err := client.NewShed(
+		client.WithLockfilePath(lockfilePath),
+		client.WithCache(cache.New(filepath.Join(td, "cache"), cache.WithGo(mockGo))),
+	)
+	if err != nil {
+		t.Fatalf("failed to create shed client %v", err)
+	}
+	installSet, err := s.GetFromToolsFile(toolsPath, client.GetOptions{})
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if err := installSet.Apply(context.Background()); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	lf := readLockfile(t, lockfilePath)
+	for _, want := range []tool.Tool{
+		{ImportPath: "github.com/golangci/golangci-lint/cmd/golangci-lint", Version: "v1.33.0"},
+		{ImportPath: "golang.org/x/tools/cmd/goimports", Version: "v0.1.5"},
+	} {
+		got, err := lf.GetTool(want.ImportPath)
+		if err != nil {
+			t.Errorf("want nil error, got %v", err)
+		}
+		if got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	}
+
+	// Tools must be required by go.mod
+	missing := "package tools\n\nimport _ \"github.com/cszatmary/go-fish\"\n"
+	if err := os.WriteFile(toolsPath, []byte(missing), 0o644); err != nil {
+		t.Fatalf("failed to write tools.go %v", err)
+	}
+	if _, err := s.GetFromToolsFile(toolsPath, client.GetOptions{}); err == nil {
+		t.Error("want error for tool without require directive, got nil")
+	}
+}
+
+// fakeResolver is a client.VersionResolver that resolves versions from a map.
+type fakeResolver map[string]string
+
+func (r fakeResolver) Resolve(importPath string) (string, bool) {
+	v, ok := r[importPath]
+	return v, ok
+}
+
+func TestGetVersionResolver(t *testing.T) {
+	td := t.TempDir()
+	lockfilePath := filepath.Join(td, "shed.lock")
+	mockGo, err := cache.NewMockGo(availableTools)
+	if err != nil {
+		t.Fatalf("failed to create mock go %v", err)
+	}
+	s, err := client.NewShed(
+		client.WithLockfilePath(lockfilePath),
+		client.WithCache(cache.New(td, cache.WithGo(mockGo))),
+		client.WithVersionResolver(fakeResolver{
+			"github.com/golangci/golangci-lint/cmd/golangci-lint": "v1.28.3",
+			"github.com/Shopify/ejson/cmd/ejson":                  "v1.1.0",
+			"golang.org/x/tools/cmd/goimports":                    "master",
+		}),
+	)
+	if err != nil {
+		t.Fatalf("failed to create shed client %v", err)
+	}
+
+	installSet, err := s.Get(client.GetOptions{
+		ToolNames: []string{
+			"github.com/golangci/golangci-lint/cmd/golangci-lint",
+			// An explicit version takes precedence
+			"github.com/Shopify/ejson/cmd/ejson@v1.2.2",
+			// Not known by the resolver so the latest version is used
+			"github.com/cszatmary/go-fish",
+		},
+	})
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if err := installSet.Apply(context.Background()); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	lf := readLockfile(t, lockfilePath)
+	wantTools := []tool.Tool{
+		{ImportPath: "github.com/Shopify/ejson/cmd/ejson", Version: "v1.2.2"},
+		{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"},
+		{ImportPath: "github.com/golangci/golangci-lint/cmd/golangci-lint", Version: "v1.28.3"},
+	}
+	if got := lf.Tools(); !reflect.DeepEqual(got, wantTools) {
+		t.Errorf("got tools %+v, want %+v", got, wantTools)
+	}
+
+	// The resolver is not used when updating
+	installSet, err = s.Get(client.GetOptions{
+		ToolNames: []string{"github.com/golangci/golangci-lint/cmd/golangci-lint"},
+		Update:    true,
+	})
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if err := installSet.Apply(context.Background()); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	lt, err := readLockfile(t, lockfilePath).GetTool("github.com/golangci/golangci-lint/cmd/golangci-lint")
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if lt.Version != "v1.33.0" {
+		t.Errorf("got version %s, want v1.33.0", lt.Version)
+	}
+
+	// Resolved versions must be valid
+	_, err = s.Get(client.GetOptions{ToolNames: []string{"golang.org/x/tools/cmd/goimports"}})
+	errs, ok := err.(errors.List)
+	if !ok || len(errs) != 1 {
+		t.Fatalf("got error %v, want errors.List with 1 error", err)
+	}
+	if rootErr := errors.Root(errs[0]); rootErr == nil || rootErr.Kind != errors.Invalid {
+		t.Errorf("got error %v, want invalid error", errs[0])
+	}
+}
+
+func TestReadVersionsFile(t *testing.T) {
+	td := t.TempDir()
+	versionsPath := filepath.Join(td, "tool-versions.yaml")
+	data := `# Shared tool versions
+---
+golang.org/x/tools/cmd/stringer: v0.1.5
+"github.com/golangci/golangci-lint/cmd/golangci-lint": 'v1.33.0' # linter
+
+github.com/cszatmary/go-fish: v0.1
+`
+	if err := os.WriteFile(versionsPath, []byte(data), 0o644); err != nil {
+		t.Fatalf("failed to write versions file %v", err)
+	}
+	vf, err := client.ReadVersionsFile(versionsPath)
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	want := client.VersionsFile{
+		"golang.org/x/tools/cmd/stringer":                     "v0.1.5",
+		"github.com/golangci/golangci-lint/cmd/golangci-lint": "v1.33.0",
+		"github.com/cszatmary/go-fish":                        "v0.1.0",
+	}
+	if !reflect.DeepEqual(vf, want) {
+		t.Errorf("got %+v, want %+v", vf, want)
+	}
+	if v, ok := vf.Resolve("golang.org/x/tools/cmd/goimports"); ok {
+		t.Errorf("got version %s for unknown tool, want none", v)
+	}
+
+	invalid := `golang.org/x/tools/cmd/stringer: v0.1.5
+golang.org/x/tools/cmd/goimports
+golang.org/x/tools/cmd/godoc: master
+golang.org/x/tools/cmd/stringer: v0.1.6
+`
+	if err := os.WriteFile(versionsPath, []byte(invalid), 0o644); err != nil {
+		t.Fatalf("failed to write versions file %v", err)
+	}
+	_, err = client.ReadVersionsFile(versionsPath)
+	var errs errors.List
+	if !errors.As(err, &errs) {
+		t.Fatalf("got error %v, want errors.List", err)
+	}
+	for i, prefix := range []string{"line 2:", "line 3:", "line 4:"} {
+		if i >= len(errs) {
+			t.Errorf("missing error with prefix %q", prefix)
+			continue
+		}
+		if !strings.Contains(errs[i].Error(), prefix) {
+			t.Errorf("got error %q, want it to contain %q", errs[i], prefix)
+		}
+	}
+
+	if _, err := client.ReadVersionsFile(filepath.Join(td, "missing.yaml")); err == nil {
+		t.Error("want error for missing file, got nil")
+	}
+}
+
+func TestApplySerial(t *testing.T) {
+	td := t.TempDir()
+	lockfilePath := filepath.Join(td, "shed.lock")
+	mockGo, err := cache.NewMockGo(availableTools)
+	if err != nil {
+		t.Fatalf("failed to create mock go %v", err)
+	}
+	createLockfile(t, lockfilePath, []tool.Tool{
+		{ImportPath: "golang.org/x/tools/cmd/stringer", Version: "v0.0.0-20201211185031-d93e913c1a58"},
+		{ImportPath: "github.com/golangci/golangci-lint/cmd/golangci-lint", Version: "v1.33.0"},
+	})
+	s, err := client.NewShed(
+		client.WithLockfilePath(lockfilePath),
+		client.WithCache(cache.New(td, cache.WithGo(mockGo))),
+	)
+	if err != nil {
+		t.Fatalf("failed to create shed client %v", err)
+	}
+
+	installSet, err := s.Get(client.GetOptions{
+		ToolNames: []string{"github.com/Shopify/ejson/cmd/ejson", "github.com/cszatmary/go-fish"},
+	})
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	installSet.Concurrency = 1
+	ch := make(chan tool.Tool, installSet.Len())
+	installSet.Notify(ch)
+	if err := installSet.Apply(context.Background()); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	close(ch)
+
+	var got []string
+	for tl := range ch {
+		got = append(got, tl.ImportPath)
+	}
+	want := []string{
+		"github.com/Shopify/ejson/cmd/ejson",
+		"github.com/cszatmary/go-fish",
+		"github.com/golangci/golangci-lint/cmd/golangci-lint",
+		"golang.org/x/tools/cmd/stringer",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestGetModuleVersionConflict(t *testing.T) {
+	toolNames := []string{"golang.org/x/tools/cmd/goimports@v0.1.0", "golang.org/x/tools/cmd/godoc@v0.1.5"}
+	tests := []struct {
+		name      string
+		unify     bool
+		wantErr   bool
+		wantTools []tool.Tool
+	}{
+		{
+			name:    "conflict",
+			wantErr: true,
+		},
+		{
+			name:  "unify versions",
+			unify: true,
+			wantTools: []tool.Tool{
+				{ImportPath: "golang.org/x/tools/cmd/goimports", Version: "v0.1.5"},
+				{ImportPath: "golang.org/x/tools/cmd/godoc", Version: "v0.1.5"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			td := t.TempDir()
+			lockfilePath := filepath.Join(td, "shed.lock")
+			mockGo, err := cache.NewMockGo(availableTools)
+			if err != nil {
+				t.Fatalf("failed to create mock go %v", err)
+			}
+			s, err := client.NewShed(
+				client.WithLockfilePath(lockfilePath),
+				client.WithCache(cache.New(td, cache.WithGo(mockGo))),
+			)
+			if err != nil {
+				t.Fatalf("failed to create shed client %v", err)
+			}
+
+			installSet, err := s.Get(client.GetOptions{ToolNames: toolNames, UnifyModuleVersions: tt.unify})
+			if err != nil {
+				t.Fatalf("want nil error, got %v", err)
+			}
+			err = installSet.Apply(context.Background())
+			if tt.wantErr {
+				errs, ok := err.(errors.List)
+				if !ok || len(errs) != 1 {
+					t.Fatalf("got error %v, want list with 1 error", err)
+				}
+				if rootErr := errors.Root(errs[0]); rootErr == nil || rootErr.Kind != errors.Invalid {
+					t.Errorf("got error %v, want kind %v", errs[0], errors.Invalid)
+				}
+				if util.FileOrDirExists(lockfilePath) {
+					t.Errorf("expected %s to not exist, but it exists", lockfilePath)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("want nil error, got %v", err)
+			}
+
+			lf := readLockfile(t, lockfilePath)
+			if lf.LenTools() != len(tt.wantTools) {
+				t.Errorf("got %d tools in lockfile, want %d", lf.LenTools(), len(tt.wantTools))
+			}
+			for _, wantTool := range tt.wantTools {
+				tl, err := lf.GetTool(wantTool.ImportPath)
+				if err != nil {
+					t.Errorf("want nil error, got %v", err)
+				}
+				if tl != wantTool {
+					t.Errorf("got %+v, want %+v", tl, wantTool)
+				}
+			}
+		})
+	}
+}
+
+func TestGetUpdateUnifiesModuleVersions(t *testing.T) {
+	td := t.TempDir()
+	lockfilePath := filepath.Join(td, "shed.lock")
+	// Only use tools from golang.org/x/tools that have the same versions, since
+	// the mock resolves the latest version of a module using any of its tools.
+	mockGo, err := cache.NewMockGo(map[string]map[string]string{
+		"golang.org/x/tools/cmd/goimports": availableTools["golang.org/x/tools/cmd/goimports"],
+		"golang.org/x/tools/cmd/godoc":     availableTools["golang.org/x/tools/cmd/godoc"],
+	})
+	if err != nil {
+		t.Fatalf("failed to create mock go %v", err)
+	}
+	createLockfile(t, lockfilePath, []tool.Tool{
+		{ImportPath: "golang.org/x/tools/cmd/goimports", Version: "v0.1.0"},
+		{ImportPath: "golang.org/x/tools/cmd/godoc", Version: "v0.1.0"},
+	})
+	s, err := client.NewShed(
+		client.WithLockfilePath(lockfilePath),
+		client.WithCache(cache.New(td, cache.WithGo(mockGo))),
+	)
+	if err != nil {
+		t.Fatalf("failed to create shed client %v", err)
+	}
+
+	// Updating only one tool from the module must not fail because of the other one
+	installSet, err := s.Get(client.GetOptions{ToolNames: []string{"golang.org/x/tools/cmd/godoc"}, Update: true})
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if err := installSet.Apply(context.Background()); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+
+	lf := readLockfile(t, lockfilePath)
+	wantTools := []tool.Tool{
+		{ImportPath: "golang.org/x/tools/cmd/goimports", Version: "v0.1.5"},
+		{ImportPath: "golang.org/x/tools/cmd/godoc", Version: "v0.1.5"},
+	}
+	for _, wantTool := range wantTools {
+		tl, err := lf.GetTool(wantTool.ImportPath)
+		if err != nil {
+			t.Errorf("want nil error, got %v", err)
+		}
+		if tl != wantTool {
+			t.Errorf("got %+v, want %+v", tl, wantTool)
+		}
+	}
+}
+
+func TestLookupToolErrorIncludesLockfilePath(t *testing.T) {
+	td := t.TempDir()
+	lockfilePath := filepath.Join(td, "shed.lock")
+	s, err := client.NewShed(
+		client.WithLockfilePath(lockfilePath),
+		client.WithCache(cache.New(td)),
+	)
+	if err != nil {
+		t.Fatalf("failed to create shed client %v", err)
+	}
+	if got := s.LockfilePath(); got != lockfilePath {
+		t.Errorf("got lockfile path %s, want %s", got, lockfilePath)
+	}
+	_, err = s.LookupTool("stringer")
+	if !errors.Is(err, lockfile.ErrNotFound) {
+		t.Errorf("got error %v, want %v", err, lockfile.ErrNotFound)
+	}
+	if err == nil || !strings.Contains(err.Error(), lockfilePath) {
+		t.Errorf("want error to contain %q, got %v", lockfilePath, err)
+	}
+}
+
+func TestGetRecordsModule(t *testing.T) {
+	td := t.TempDir()
+	lockfilePath := filepath.Join(td, "shed.lock")
+	mockGo, err := cache.NewMockGo(availableTools)
+	if err != nil {
+		t.Fatalf("failed to create mock go %v", err)
+	}
+	s, err := client.NewShed(
+		client.WithLockfilePath(lockfilePath),
+		client.WithCache(cache.New(td, cache.WithGo(mockGo))),
+	)
+	if err != nil {
+		t.Fatalf("failed to create shed client %v", err)
+	}
+	installSet, err := s.Get(client.GetOptions{ToolNames: []string{"github.com/Shopify/ejson/cmd/ejson@v1.1.0"}})
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if err := installSet.Apply(context.Background()); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+
+	lf := readLockfile(t, lockfilePath)
+	if got := lf.Module("github.com/Shopify/ejson/cmd/ejson"); got != "github.com/Shopify/ejson" {
+		t.Errorf("got module %q, want %q", got, "github.com/Shopify/ejson")
+	}
+
+	// List should use the recorded module to find the update
+	tools, err := s.List(context.Background(), client.ListOptions{ShowUpdates: true})
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	want := []client.ToolInfo{{
+		Tool:          tool.Tool{ImportPath: "github.com/Shopify/ejson/cmd/ejson", Version: "v1.1.0"},
+		LatestVersion: "v1.2.2",
+	}}
+	if !reflect.DeepEqual(tools, want) {
+		t.Errorf("got %+v, want %+v", tools, want)
+	}
+}
+
+func TestApplyEvents(t *testing.T) {
+	td := t.TempDir()
+	lockfilePath := filepath.Join(td, "shed.lock")
+	mockGo, err := cache.NewMockGo(availableTools)
+	if err != nil {
+		t.Fatalf("failed to create mock go %v", err)
+	}
+	ejson := tool.Tool{ImportPath: "github.com/Shopify/ejson/cmd/ejson", Version: "v1.1.0"}
+	createLockfile(t, lockfilePath, []tool.Tool{ejson})
+	c := cache.New(td, cache.WithGo(&failingGo{
+		countingGo: &countingGo{Go: mockGo},
+		fail:       map[string]bool{"github.com/golangci/golangci-lint/cmd/golangci-lint@v1.33.0": true},
+	}))
+	if _, err := c.Install(context.Background(), ejson); err != nil {
+		t.Fatalf("failed to install tool %v", err)
+	}
+	s, err := client.NewShed(client.WithLockfilePath(lockfilePath), client.WithCache(c))
+	if err != nil {
+		t.Fatalf("failed to create shed client %v", err)
+	}
+
+	installSet, err := s.Get(client.GetOptions{
+		ToolNames: []string{
+			ejson.Module(),
+			"github.com/cszatmary/go-fish",
+			"github.com/golangci/golangci-lint/cmd/golangci-lint@v1.33.0",
+		},
+	})
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	installSet.Concurrency = 1
+	ch := make(chan client.InstallEvent, 10)
+	installSet.NotifyEvents(ch)
+	// Notify must still work alongside events
+	doneCh := make(chan tool.Tool, installSet.Len())
+	installSet.Notify(doneCh)
+	if err := installSet.Apply(context.Background()); err == nil {
+		t.Fatal("want error, got nil")
+	}
+	close(ch)
+	close(doneCh)
+
+	type event struct {
+		tool   string
+		phase  client.Phase
+		failed bool
+	}
+	var got []event
+	var downloaded, built time.Duration
+	for e := range ch {
+		got = append(got, event{e.Tool.Module(), e.Phase, e.Err != nil})
+		if e.Tool.ImportPath == "github.com/cszatmary/go-fish" {
+			switch e.Phase {
+			case client.PhaseDownloaded:
+				downloaded = e.Duration
+			case client.PhaseBuilt:
+				built = e.Duration
+			}
+		}
+	}
+	want := []event{
+		{"github.com/Shopify/ejson/cmd/ejson@v1.1.0", client.PhaseSkipped, false},
+		{"github.com/cszatmary/go-fish", client.PhaseStarted, false},
+		{"github.com/cszatmary/go-fish@v0.1.0", client.PhaseDownloaded, false},
+		{"github.com/cszatmary/go-fish@v0.1.0", client.PhaseBuilt, false},
+		{"github.com/golangci/golangci-lint/cmd/golangci-lint@v1.33.0", client.PhaseStarted, false},
+		{"github.com/golangci/golangci-lint/cmd/golangci-lint@v1.33.0", client.PhaseFailed, true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got events %+v, want %+v", got, want)
+	}
+	if downloaded <= 0 || built < downloaded {
+		t.Errorf("got downloaded duration %s and built duration %s, want built >= downloaded > 0", downloaded, built)
+	}
+
+	var gotDone []string
+	for tl := range doneCh {
+		gotDone = append(gotDone, tl.Module())
+	}
+	wantDone := []string{"github.com/Shopify/ejson/cmd/ejson@v1.1.0", "github.com/cszatmary/go-fish@v0.1.0"}
+	if !reflect.DeepEqual(gotDone, wantDone) {
+		t.Errorf("got completed tools %v, want %v", gotDone, wantDone)
+	}
+}
+
+func TestStrictLockfile(t *testing.T) {
+	td := t.TempDir()
+	lockfilePath := filepath.Join(td, "shed.lock")
+	data := `{"tools": {"github.com/cszatmary/go-fish": {"version": "v0.1.0", "verison": "v0.1.0"}}}`
+	if err := os.WriteFile(lockfilePath, []byte(data), 0o644); err != nil {
+		t.Fatalf("failed to write lockfile %v", err)
+	}
+
+	// Unknown fields are ignored by default
+	s, err := client.NewShed(client.WithLockfilePath(lockfilePath), client.WithCache(cache.New(td)))
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if _, err := s.LookupTool("go-fish"); err != nil {
+		t.Errorf("want nil error, got %v", err)
+	}
+
+	_, err = client.NewShed(
+		client.WithLockfilePath(lockfilePath),
+		client.WithCache(cache.New(td)),
+		client.WithStrictLockfile(),
+	)
+	if err == nil || !strings.Contains(err.Error(), `unknown field "verison"`) {
+		t.Errorf("want unknown field error, got %v", err)
+	}
+}
+
+func TestGetMinVersions(t *testing.T) {
+	tests := []struct {
+		name       string
+		minVersion string
+		want       tool.Tool
+	}{
+		{
+			name:       "current version above minimum",
+			minVersion: "github.com/golangci/golangci-lint/cmd/golangci-lint@v1.28.3",
+			want:       tool.Tool{ImportPath: "github.com/golangci/golangci-lint/cmd/golangci-lint", Version: "v1.33.0"},
+		},
+		{
+			name:       "current version equal to minimum",
+			minVersion: "github.com/golangci/golangci-lint/cmd/golangci-lint@v1.33.0",
+			want:       tool.Tool{ImportPath: "github.com/golangci/golangci-lint/cmd/golangci-lint", Version: "v1.33.0"},
+		},
+		{
+			name:       "current version below minimum",
+			minVersion: "github.com/Shopify/ejson/cmd/ejson@v1.2.2",
+			want:       tool.Tool{ImportPath: "github.com/Shopify/ejson/cmd/ejson", Version: "v1.2.2"},
+		},
+		{
+			name:       "tool not in lockfile",
+			minVersion: "github.com/cszatmary/go-fish@v0.1.0",
+			want:       tool.Tool{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			td := t.TempDir()
+			lockfilePath := filepath.Join(td, "shed.lock")
+			mockGo, err := cache.NewMockGo(availableTools)
+			if err != nil {
+				t.Fatalf("failed to create mock go %v", err)
+			}
+			createLockfile(t, lockfilePath, []tool.Tool{
+				{ImportPath: "github.com/golangci/golangci-lint/cmd/golangci-lint", Version: "v1.33.0"},
+				{ImportPath: "github.com/Shopify/ejson/cmd/ejson", Version: "v1.1.0"},
+			})
+			s, err := client.NewShed(
+				client.WithLockfilePath(lockfilePath),
+				client.WithCache(cache.New(td, cache.WithGo(mockGo))),
+			)
+			if err != nil {
+				t.Fatalf("failed to create shed client %v", err)
+			}
+			installSet, err := s.Get(client.GetOptions{MinVersions: []string{tt.minVersion}})
+			if err != nil {
+				t.Fatalf("want nil error, got %v", err)
+			}
+			if err := installSet.Apply(context.Background()); err != nil {
+				t.Fatalf("want nil error, got %v", err)
+			}
+
+			lf := readLockfile(t, lockfilePath)
+			got, err := lf.GetTool(tt.want.ImportPath)
+			if err != nil {
+				t.Fatalf("want nil error, got %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetMinVersionsError(t *testing.T) {
+	tests := []struct {
+		name string
+		opts client.GetOptions
+	}{
+		{
+			name: "no version",
+			opts: client.GetOptions{MinVersions: []string{"github.com/cszatmary/go-fish"}},
+		},
+		{
+			name: "query instead of version",
+			opts: client.GetOptions{MinVersions: []string{"github.com/cszatmary/go-fish@latest"}},
+		},
+		{
+			name: "also in tool names",
+			opts: client.GetOptions{
+				ToolNames:   []string{"github.com/cszatmary/go-fish"},
+				MinVersions: []string{"github.com/cszatmary/go-fish@v0.1.0"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			td := t.TempDir()
+			s, err := client.NewShed(
+				client.WithLockfilePath(filepath.Join(td, "shed.lock")),
+				client.WithCache(cache.New(td)),
+			)
+			if err != nil {
+				t.Fatalf("failed to create shed client %v", err)
+			}
+			if _, err := s.Get(tt.opts); err == nil {
+				t.Error("want error, got nil")
+			}
+		})
+	}
+}
+
+func TestUninstall(t *testing.T) {
+	td := t.TempDir()
+	lockfilePath := filepath.Join(td, "shed.lock")
+	createLockfile(t, lockfilePath, []tool.Tool{
+		{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"},
+		{ImportPath: "github.com/golangci/golangci-lint/cmd/golangci-lint", Version: "v1.33.0"},
+		{ImportPath: "golang.org/x/tools/cmd/stringer", Version: "v0.1.0"},
+	})
+	s, err := client.NewShed(
+		client.WithLockfilePath(lockfilePath),
+		client.WithCache(cache.New(td)),
+	)
+	if err != nil {
+		t.Fatalf("failed to create shed client %v", err)
+	}
+	// stringer is provided twice but must only be removed once
+	removed, err := s.Uninstall("go-fish", "golang.org/x/tools/cmd/stringer", "stringer")
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	wantRemoved := []tool.Tool{
+		{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"},
+		{ImportPath: "golang.org/x/tools/cmd/stringer", Version: "v0.1.0"},
+	}
+	if !reflect.DeepEqual(removed, wantRemoved) {
+		t.Errorf("got removed tools %v, want %v", removed, wantRemoved)
+	}
+
+	lf := readLockfile(t, lockfilePath)
+	if lf.LenTools() != 1 {
+		t.Errorf("got %d tools, want 1", lf.LenTools())
+	}
+	if _, err := lf.GetTool("golangci-lint"); err != nil {
+		t.Errorf("want nil error, got %v", err)
+	}
+	for _, name := range []string{"go-fish", "stringer"} {
+		if _, err := lf.GetTool(name); !errors.Is(err, lockfile.ErrNotFound) {
+			t.Errorf("got error %v, want %v", err, lockfile.ErrNotFound)
+		}
+	}
+}
+
+func TestPrune(t *testing.T) {
+	td := t.TempDir()
+	lockfilePath := filepath.Join(td, "shed.lock")
+	mockGo, err := cache.NewMockGo(availableTools)
+	if err != nil {
+		t.Fatalf("failed to create mock go %v", err)
+	}
+	s, err := client.NewShed(
+		client.WithLockfilePath(lockfilePath),
+		client.WithCache(cache.New(filepath.Join(td, "cache"), cache.WithGo(mockGo))),
+	)
+	if err != nil {
+		t.Fatalf("failed to create shed client %v", err)
+	}
+	for _, toolName := range []string{
+		"github.com/golangci/golangci-lint/cmd/golangci-lint@v1.28.3",
+		"github.com/golangci/golangci-lint/cmd/golangci-lint@v1.33.0",
+		"github.com/cszatmary/go-fish@v0.1.0",
+	} {
+		installSet, err := s.Get(client.GetOptions{ToolNames: []string{toolName}})
+		if err != nil {
+			t.Fatalf("want nil error, got %v", err)
+		}
+		if err := installSet.Apply(context.Background()); err != nil {
+			t.Fatalf("want nil error, got %v", err)
+		}
+	}
+
+	// Use a new client since installed tools are protected from being removed for the lifetime of the cache.
+	s, err = client.NewShed(
+		client.WithLockfilePath(lockfilePath),
+		client.WithCache(cache.New(filepath.Join(td, "cache"), cache.WithGo(mockGo))),
+	)
+	if err != nil {
+		t.Fatalf("failed to create shed client %v", err)
+	}
+	removed, err := s.Prune()
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	want := []tool.Tool{{ImportPath: "github.com/golangci/golangci-lint/cmd/golangci-lint", Version: "v1.28.3"}}
+	if !reflect.DeepEqual(removed, want) {
+		t.Errorf("got removed tools %v, want %v", removed, want)
+	}
+	for _, name := range []string{"golangci-lint", "go-fish"} {
+		if _, err := s.ToolPath(name); err != nil {
+			t.Errorf("want tool %s to still be installed, got %v", name, err)
+		}
+	}
+}
+
+func TestUninstallNotFound(t *testing.T) {
+	td := t.TempDir()
+	lockfilePath := filepath.Join(td, "shed.lock")
+	createLockfile(t, lockfilePath, []tool.Tool{
+		{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"},
+	})
+	s, err := client.NewShed(
+		client.WithLockfilePath(lockfilePath),
+		client.WithCache(cache.New(td)),
+	)
+	if err != nil {
+		t.Fatalf("failed to create shed client %v", err)
+	}
+	_, err = s.Uninstall("go-fish", "stringer", "golangci-lint")
+	errs, ok := err.(errors.List)
+	if !ok {
+		t.Fatalf("got error %v, want errors.List", err)
+	}
+	if len(errs) != 2 {
+		t.Fatalf("got %d errors, want 2", len(errs))
+	}
+	for _, err := range errs {
+		if !errors.Is(err, lockfile.ErrNotFound) {
+			t.Errorf("got error %v, want %v", err, lockfile.ErrNotFound)
+		}
+	}
+
+	// The lockfile must not be modified if any tool is not found
+	lf := readLockfile(t, lockfilePath)
+	if _, err := lf.GetTool("go-fish"); err != nil {
+		t.Errorf("want nil error, got %v", err)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	td := t.TempDir()
+	lockfilePath := filepath.Join(td, "shed.lock")
+	mockGo, err := cache.NewMockGo(availableTools)
+	if err != nil {
+		t.Fatalf("failed to create mock go %v", err)
+	}
+	goFish := tool.Tool{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"}
+	ejson := tool.Tool{ImportPath: "github.com/Shopify/ejson/cmd/ejson", Version: "v1.1.0"}
+	createLockfile(t, lockfilePath, []tool.Tool{goFish, ejson})
+	cg := &countingGo{Go: mockGo}
+	c := cache.New(td, cache.WithGo(cg))
+	if _, err := c.Install(context.Background(), ejson); err != nil {
+		t.Fatalf("failed to install tool %v", err)
+	}
+	s, err := client.NewShed(client.WithLockfilePath(lockfilePath), client.WithCache(c))
+	if err != nil {
+		t.Fatalf("failed to create shed client %v", err)
+	}
+
+	want := []client.VerifyResult{
+		{Tool: ejson, Status: cache.StatusInstalled},
+		{Tool: goFish, Status: cache.StatusNotDownloaded},
+	}
+	cg.getD, cg.build = 0, 0
+	results, err := s.Verify(context.Background(), client.VerifyOptions{})
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if !reflect.DeepEqual(results, want) {
+		t.Errorf("got results %+v, want %+v", results, want)
+	}
+	if cg.getD != 0 || cg.build != 0 {
+		t.Errorf("got %d downloads and %d builds, want none", cg.getD, cg.build)
+	}
+
+	want[1].Fixed = true
+	results, err = s.Verify(context.Background(), client.VerifyOptions{Fix: true})
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if !reflect.DeepEqual(results, want) {
+		t.Errorf("got results %+v, want %+v", results, want)
+	}
+	if installed, err := c.Installed(goFish); err != nil || !installed {
+		t.Errorf("want %v to be installed, got %t, %v", goFish, installed, err)
+	}
+}
+
+func TestVerifyFixError(t *testing.T) {
+	td := t.TempDir()
+	lockfilePath := filepath.Join(td, "shed.lock")
+	mockGo, err := cache.NewMockGo(availableTools)
+	if err != nil {
+		t.Fatalf("failed to create mock go %v", err)
+	}
+	goFish := tool.Tool{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"}
+	createLockfile(t, lockfilePath, []tool.Tool{goFish})
+	c := cache.New(td, cache.WithGo(&failingGo{
+		countingGo: &countingGo{Go: mockGo},
+		fail:       map[string]bool{"github.com/cszatmary/go-fish@v0.1.0": true},
+	}))
+	s, err := client.NewShed(client.WithLockfilePath(lockfilePath), client.WithCache(c))
+	if err != nil {
+		t.Fatalf("failed to create shed client %v", err)
+	}
+
+	results, err := s.Verify(context.Background(), client.VerifyOptions{Fix: true})
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("got %d results, want 1", len(results))
+	}
+	r := results[0]
+	if r.Fixed || r.OK() || r.Err == nil {
+		t.Errorf("want tool to not be fixed, got %+v", r)
+	}
+}
+
+// envGo records the environment from cache.GoEnv for each module downloaded by GetD.
+type envGo struct {
+	cache.Go
+	mu     sync.Mutex
+	env    map[string][]string
+	builds map[string][]string
+}
+
+func (g *envGo) GetD(ctx context.Context, mod, dir string) error {
+	g.mu.Lock()
+	g.env[mod] = cache.GoEnv(ctx)
+	g.mu.Unlock()
+	return g.Go.GetD(ctx, mod, dir)
+}
+
+func (g *envGo) Build(ctx context.Context, pkg, outPath, dir string, flags []string) error {
+	g.mu.Lock()
+	if g.builds == nil {
+		g.builds = make(map[string][]string)
+	}
+	g.builds[pkg] = cache.GoEnv(ctx)
+	g.mu.Unlock()
+	return g.Go.Build(ctx, pkg, outPath, dir, flags)
+}
+
+func TestGetToolchain(t *testing.T) {
+	td := t.TempDir()
+	lockfilePath := filepath.Join(td, "shed.lock")
+	mockGo, err := cache.NewMockGo(availableTools)
+	if err != nil {
+		t.Fatalf("failed to create mock go %v", err)
+	}
+	goFish := tool.Tool{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"}
+	createLockfile(t, lockfilePath, []tool.Tool{goFish})
+	lf := readLockfile(t, lockfilePath)
+	if err := lf.SetToolchain("1.21.0"); err != nil {
+		t.Fatalf("failed to set toolchain %v", err)
+	}
+	f, err := os.Create(lockfilePath)
+	if err != nil {
+		t.Fatalf("failed to create %s, %v", lockfilePath, err)
+	}
+	if _, err := lf.WriteTo(f); err != nil {
+		t.Fatalf("failed to write lockfile, %v", err)
+	}
+	f.Close()
+
+	eg := &envGo{Go: mockGo, env: make(map[string][]string)}
+	s, err := client.NewShed(
+		client.WithLockfilePath(lockfilePath),
+		client.WithCache(cache.New(td, cache.WithGo(eg))),
+	)
+	if err != nil {
+		t.Fatalf("failed to create shed client %v", err)
+	}
+	installSet, err := s.Get(client.GetOptions{ToolNames: []string{"github.com/Shopify/ejson/cmd/ejson@v1.1.0"}})
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if err := installSet.Apply(context.Background()); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+
+	// All tools are built with the toolchain from the lockfile
+	want := map[string][]string{
+		goFish.Module(): {"GOTOOLCHAIN=go1.21.0"},
+		"github.com/Shopify/ejson/cmd/ejson@v1.1.0": {"GOTOOLCHAIN=go1.21.0"},
+	}
+	if !reflect.DeepEqual(eg.env, want) {
+		t.Errorf("got env %v, want %v", eg.env, want)
+	}
+	if got := readLockfile(t, lockfilePath).Toolchain(); got != "1.21.0" {
+		t.Errorf("got toolchain %q, want %q", got, "1.21.0")
+	}
+
+	// Changing the toolchain rebuilds the installed tools
+	lf = readLockfile(t, lockfilePath)
+	if err := lf.SetToolchain("1.22.0"); err != nil {
+		t.Fatalf("failed to set toolchain %v", err)
+	}
+	f, err = os.Create(lockfilePath)
+	if err != nil {
+		t.Fatalf("failed to create %s, %v", lockfilePath, err)
+	}
+	if _, err := lf.WriteTo(f); err != nil {
+		t.Fatalf("failed to write lockfile, %v", err)
+	}
+	f.Close()
+	s, err = client.NewShed(
+		client.WithLockfilePath(lockfilePath),
+		client.WithCache(cache.New(td, cache.WithGo(eg))),
+	)
+	if err != nil {
+		t.Fatalf("failed to create shed client %v", err)
+	}
+	installSet, err = s.Get(client.GetOptions{})
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if err := installSet.Apply(context.Background()); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	wantBuilds := map[string][]string{
+		goFish.ImportPath:                    {"GOTOOLCHAIN=go1.22.0"},
+		"github.com/Shopify/ejson/cmd/ejson": {"GOTOOLCHAIN=go1.22.0"},
+	}
+	if !reflect.DeepEqual(eg.builds, wantBuilds) {
+		t.Errorf("got builds %v, want %v", eg.builds, wantBuilds)
+	}
+}
+
+func TestToolPathAlias(t *testing.T) {
+	td := t.TempDir()
+	lockfilePath := filepath.Join(td, "shed.lock")
+	mockGo, err := cache.NewMockGo(availableTools)
+	if err != nil {
+		t.Fatalf("failed to create mock go %v", err)
+	}
+	goFish := tool.Tool{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"}
+	createLockfile(t, lockfilePath, []tool.Tool{goFish})
+	lf := readLockfile(t, lockfilePath)
+	if err := lf.SetAlias(goFish.ImportPath, "fish"); err != nil {
+		t.Fatalf("failed to set alias %v", err)
+	}
+	f, err := os.Create(lockfilePath)
+	if err != nil {
+		t.Fatalf("failed to create %s, %v", lockfilePath, err)
+	}
+	if _, err := lf.WriteTo(f); err != nil {
+		t.Fatalf("failed to write lockfile, %v", err)
+	}
+	f.Close()
+
+	// Install the tool before the alias is used, the alias must still be created
+	c := cache.New(td, cache.WithGo(mockGo))
+	if _, err := c.Install(context.Background(), goFish); err != nil {
+		t.Fatalf("failed to install tool %v", err)
+	}
+	s, err := client.NewShed(client.WithLockfilePath(lockfilePath), client.WithCache(c))
+	if err != nil {
+		t.Fatalf("failed to create shed client %v", err)
+	}
+	if _, err := s.ToolPath("fish"); err == nil {
+		t.Error("want error for alias that is not installed, got nil")
+	}
+	installSet, err := s.Get(client.GetOptions{ToolNames: []string{goFish.String()}})
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if err := installSet.Apply(context.Background()); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+
+	want := filepath.Join(td, "tools", filepath.FromSlash("github.com/cszatmary/go-fish@v0.1.0/.alias/fish"))
+	if runtime.GOOS == "windows" {
+		want += ".exe"
+	}
+	for _, name := range []string{"fish", "go-fish", goFish.ImportPath} {
+		binPath, err := s.ToolPath(name)
+		if err != nil {
+			t.Errorf("want nil error for %s, got %v", name, err)
+		}
+		if binPath != want {
+			t.Errorf("got path %s for %s, want %s", binPath, name, want)
+		}
+	}
+	if got := readLockfile(t, lockfilePath).Alias(goFish.ImportPath); got != "fish" {
+		t.Errorf("got alias %q, want %q", got, "fish")
+	}
+}
+
+func TestToolPathLockfile(t *testing.T) {
+	td := t.TempDir()
+	mockGo, err := cache.NewMockGo(availableTools)
+	if err != nil {
+		t.Fatalf("failed to create mock go %v", err)
+	}
+	c := cache.New(filepath.Join(td, "cache"), cache.WithGo(mockGo))
+
+	// Projects share the cache but use different versions of the same tool.
+	versions := map[string]string{"project-a": "v1.1.0", "project-b": "v1.2.2"}
+	for project, version := range versions {
+		dir := filepath.Join(td, project)
+		if err := os.Mkdir(dir, 0o755); err != nil {
+			t.Fatalf("failed to create dir %v", err)
+		}
+		ejson := tool.Tool{ImportPath: "github.com/Shopify/ejson/cmd/ejson", Version: version}
+		createLockfile(t, filepath.Join(dir, "shed.lock"), []tool.Tool{ejson})
+		if _, err := c.Install(context.Background(), ejson); err != nil {
+			t.Fatalf("failed to install tool %v", err)
+		}
+	}
+
+	for project, version := range versions {
+		lockfilePath := filepath.Join(td, project, "shed.lock")
+		s, err := client.NewShed(client.WithLockfilePath(lockfilePath), client.WithCache(c))
+		if err != nil {
+			t.Fatalf("failed to create shed client %v", err)
+		}
+		if got := s.LockfilePath(); got != lockfilePath {
+			t.Errorf("got lockfile path %s, want %s", got, lockfilePath)
+		}
+		binPath, err := s.ToolPath("ejson")
+		if err != nil {
+			t.Fatalf("want nil error for %s, got %v", project, err)
+		}
+		want := filepath.Join(td, "cache", "tools", filepath.FromSlash("github.com/!shopify/ejson/cmd/ejson@"+version+"/ejson"))
+		if binPath != want {
+			t.Errorf("got path %s for %s, want %s", binPath, project, want)
+		}
+	}
+}
+
+func TestGetDirect(t *testing.T) {
+	td := t.TempDir()
+	lockfilePath := filepath.Join(td, "shed.lock")
+	mockGo, err := cache.NewMockGo(availableTools)
+	if err != nil {
+		t.Fatalf("failed to create mock go %v", err)
+	}
+	eg := &envGo{Go: mockGo, env: make(map[string][]string)}
+	c := cache.New(td, cache.WithGo(eg))
+	s, err := client.NewShed(client.WithLockfilePath(lockfilePath), client.WithCache(c))
+	if err != nil {
+		t.Fatalf("failed to create shed client %v", err)
+	}
+	installSet, err := s.Get(client.GetOptions{
+		ToolNames: []string{"github.com/cszatmary/go-fish@v0.1.0"},
+		Direct:    true,
+	})
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if err := installSet.Apply(context.Background()); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	installSet, err = s.Get(client.GetOptions{
+		ToolNames: []string{"github.com/Shopify/ejson/cmd/ejson@v1.1.0"},
+	})
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if err := installSet.Apply(context.Background()); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+
+	lf := readLockfile(t, lockfilePath)
+	if !lf.Direct("github.com/cszatmary/go-fish") {
+		t.Error("want go-fish to be recorded as direct")
+	}
+	if lf.Direct("github.com/Shopify/ejson/cmd/ejson") {
+		t.Error("want ejson to not be recorded as direct")
+	}
+	want := map[string][]string{
+		"github.com/cszatmary/go-fish@v0.1.0":       {"GOPROXY=direct"},
+		"github.com/Shopify/ejson/cmd/ejson@v1.1.0": nil,
+	}
+	if !reflect.DeepEqual(eg.env, want) {
+		t.Errorf("got env %v, want %v", eg.env, want)
+	}
+
+	// Tools recorded as direct are still downloaded directly when installed from the lockfile
+	eg.env = make(map[string][]string)
+	c = cache.New(t.TempDir(), cache.WithGo(eg))
+	s, err = client.NewShed(client.WithLockfilePath(lockfilePath), client.WithCache(c))
+	if err != nil {
+		t.Fatalf("failed to create shed client %v", err)
+	}
+	installSet, err = s.Get(client.GetOptions{})
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if err := installSet.Apply(context.Background()); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if !reflect.DeepEqual(eg.env, want) {
+		t.Errorf("got env %v, want %v", eg.env, want)
+	}
+}
+
+func TestGetBuildFlags(t *testing.T) {
+	td := t.TempDir()
+	lockfilePath := filepath.Join(td, "shed.lock")
+	var mc cache.MockCalls
+	mockGo, err := cache.NewMockGo(availableTools, cache.WithMockCalls(&mc))
+	if err != nil {
+		t.Fatalf("failed to create mock go %v", err)
+	}
+	c := cache.New(td, cache.WithGo(mockGo))
+	s, err := client.NewShed(client.WithLockfilePath(lockfilePath), client.WithCache(c))
+	if err != nil {
+		t.Fatalf("failed to create shed client %v", err)
+	}
+	buildFlags := func() map[string][]string {
+		flags := make(map[string][]string)
+		for _, call := range mc.Calls() {
+			if call.Method == "Build" {
+				flags[call.Mod] = call.Flags
+			}
+		}
+		return flags
+	}
+	get := func(opts client.GetOptions) {
+		t.Helper()
+		mc.Reset()
+		installSet, err := s.Get(opts)
+		if err != nil {
+			t.Fatalf("want nil error, got %v", err)
+		}
+		if err := installSet.Apply(context.Background()); err != nil {
+			t.Fatalf("want nil error, got %v", err)
+		}
+	}
+
+	get(client.GetOptions{
+		ToolNames:  []string{"github.com/cszatmary/go-fish@v0.1.0", "github.com/Shopify/ejson/cmd/ejson@v1.1.0"},
+		BuildFlags: []string{"-tags=netgo"},
+	})
+	want := map[string][]string{
+		"github.com/cszatmary/go-fish":       {"-tags=netgo"},
+		"github.com/Shopify/ejson/cmd/ejson": {"-tags=netgo"},
+	}
+	if got := buildFlags(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got build flags %v, want %v", got, want)
+	}
+
+	// Changing the flags of an installed tool rebuilds it
+	get(client.GetOptions{
+		ToolNames:  []string{"github.com/cszatmary/go-fish@v0.1.0"},
+		BuildFlags: []string{"-ldflags=-s -w"},
+	})
+	want = map[string][]string{
+		"github.com/cszatmary/go-fish": {"-ldflags=-s -w"},
+	}
+	if got := buildFlags(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got build flags %v, want %v", got, want)
+	}
+
+	lf := readLockfile(t, lockfilePath)
+	if got, want := lf.BuildFlags("github.com/cszatmary/go-fish"), []string{"-ldflags=-s -w"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got build flags %q for go-fish, want %q", got, want)
+	}
+	if got, want := lf.BuildFlags("github.com/Shopify/ejson/cmd/ejson"), []string{"-tags=netgo"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got build flags %q for ejson, want %q", got, want)
+	}
+
+	// Tools are built with the flags from the lockfile when installed from it, including when they are updated
+	c = cache.New(t.TempDir(), cache.WithGo(mockGo))
+	s, err = client.NewShed(client.WithLockfilePath(lockfilePath), client.WithCache(c))
+	if err != nil {
+		t.Fatalf("failed to create shed client %v", err)
+	}
+	get(client.GetOptions{ToolNames: []string{"github.com/Shopify/ejson/cmd/ejson@v1.2.2"}})
+	want = map[string][]string{
+		"github.com/cszatmary/go-fish":       {"-ldflags=-s -w"},
+		"github.com/Shopify/ejson/cmd/ejson": {"-tags=netgo"},
+	}
+	if got := buildFlags(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got build flags %v, want %v", got, want)
+	}
+	// Another lockfile using the same cache with different flags doesn't replace the binary
+	otherLockfilePath := filepath.Join(t.TempDir(), "shed.lock")
+	other, err := client.NewShed(client.WithLockfilePath(otherLockfilePath), client.WithCache(c))
+	if err != nil {
+		t.Fatalf("failed to create shed client %v", err)
+	}
+	mc.Reset()
+	installSet, err := other.Get(client.GetOptions{ToolNames: []string{"github.com/cszatmary/go-fish@v0.1.0"}})
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if err := installSet.Apply(context.Background()); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	want = map[string][]string{"github.com/cszatmary/go-fish": nil}
+	if got := buildFlags(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got build flags %v, want %v", got, want)
+	}
+	binPath, err := s.ToolPath("go-fish")
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	otherBinPath, err := other.ToolPath("go-fish")
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if binPath == otherBinPath {
+		t.Errorf("got the same path %s for tools built with different flags", binPath)
+	}
+	get(client.GetOptions{ToolNames: []string{"github.com/cszatmary/go-fish@v0.1.0"}})
+	if got := buildFlags(); len(got) != 0 {
+		t.Errorf("got build flags %v, want no builds", got)
+	}
+}
+
+func TestGetBinaryRelease(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/Shopify/ejson/releases/download/v1.2.2/ejson-"+runtime.GOOS {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("ejson binary"))
+	}))
+	defer srv.Close()
+
+	td := t.TempDir()
+	lockfilePath := filepath.Join(td, "shed.lock")
+	createLockfile(t, lockfilePath, []tool.Tool{
+		{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"},
+	})
+	mockGo, err := cache.NewMockGo(availableTools)
+	if err != nil {
+		t.Fatalf("failed to create mock go %v", err)
+	}
+	cg := &countingGo{Go: mockGo}
+	c := cache.New(filepath.Join(td, "cache"), cache.WithGo(cg), cache.WithReleaseURL(srv.URL))
+	s, err := client.NewShed(client.WithLockfilePath(lockfilePath), client.WithCache(c))
+	if err != nil {
+		t.Fatalf("failed to create shed client %v", err)
+	}
+	release := lockfile.BinaryRelease{Repo: "Shopify/ejson", Asset: "ejson-{os}"}
+	_, err = s.Get(client.GetOptions{
+		ToolNames:     []string{"github.com/Shopify/ejson/cmd/ejson"},
+		BinaryRelease: release,
+	})
+	if err == nil {
+		t.Error("want error for tool without version, got nil")
+	}
+	installSet, err := s.Get(client.GetOptions{
+		ToolNames:     []string{"github.com/Shopify/ejson/cmd/ejson@v1.2.2"},
+		BinaryRelease: release,
+	})
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if err := installSet.Apply(context.Background()); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+
+	// Only go-fish was built from source
+	if cg.getD != 1 || cg.build != 1 {
+		t.Errorf("got %d downloads and %d builds, want 1 of each", cg.getD, cg.build)
+	}
+	lf := readLockfile(t, lockfilePath)
+	if got := lf.BinaryRelease("github.com/Shopify/ejson/cmd/ejson"); got != release {
+		t.Errorf("got binary release %+v, want %+v", got, release)
+	}
+	// sha256 of "ejson binary"
+	const wantHash = "sha256:644854eca2c1f991b1008bdad584b9e25ede0ecbec222073650556564ab014b7"
+	if got := lf.ReleaseHash("github.com/Shopify/ejson/cmd/ejson", runtime.GOOS+"/"+runtime.GOARCH); got != wantHash {
+		t.Errorf("got release hash %q, want %q", got, wantHash)
+	}
+	binPath, err := s.ToolPath("ejson")
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if data, _ := os.ReadFile(binPath); string(data) != "ejson binary" {
+		t.Errorf("got binary %q, want %q", data, "ejson binary")
+	}
+
+	// Updating all tools leaves the binary release as is
+	installSet, err = s.Get(client.GetOptions{Update: true})
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if err := installSet.Apply(context.Background()); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	lf = readLockfile(t, lockfilePath)
+	if got, err := lf.GetTool("ejson"); err != nil || got.Version != "v1.2.2" {
+		t.Errorf("got tool %v, error %v, want ejson@v1.2.2", got, err)
+	}
+
+	// Installing in a new cache fails if the asset does not match the recorded hash
+	err = lf.SetReleaseHash("github.com/Shopify/ejson/cmd/ejson", runtime.GOOS+"/"+runtime.GOARCH, "sha256:changed")
+	if err != nil {
+		t.Fatalf("failed to set release hash %v", err)
+	}
+	f, err := os.Create(lockfilePath)
+	if err != nil {
+		t.Fatalf("failed to create %s, %v", lockfilePath, err)
+	}
+	if _, err := lf.WriteTo(f); err != nil {
+		t.Fatalf("failed to write lockfile, %v", err)
+	}
+	f.Close()
+	c = cache.New(filepath.Join(td, "cache2"), cache.WithGo(cg), cache.WithReleaseURL(srv.URL))
+	s, err = client.NewShed(client.WithLockfilePath(lockfilePath), client.WithCache(c))
+	if err != nil {
+		t.Fatalf("failed to create shed client %v", err)
+	}
+	installSet, err = s.Get(client.GetOptions{})
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	err = installSet.Apply(context.Background())
+	errs, ok := err.(errors.List)
+	if !ok || len(errs) != 1 {
+		t.Fatalf("got error %v, want errors.List with 1 error", err)
+	}
+	if rootErr := errors.Root(errs[0]); rootErr == nil || rootErr.Kind != errors.BadState {
+		t.Errorf("want bad state error, got %v", errs[0])
+	}
+}
+
+func TestCheckGoVersion(t *testing.T) {
+	td := t.TempDir()
+	lockfilePath := filepath.Join(td, "shed.lock")
+	mockGo, err := cache.NewMockGo(
+		availableTools,
+		cache.WithMockGoVersion("github.com/Shopify/ejson/cmd/ejson", "v1.2.2", "1.11"),
+		cache.WithMockGoVersion("github.com/golangci/golangci-lint/cmd/golangci-lint", "v1.33.0", "99.0"),
+	)
+	if err != nil {
+		t.Fatalf("failed to create mock go %v", err)
+	}
+	s, err := client.NewShed(
+		client.WithLockfilePath(lockfilePath),
+		client.WithCache(cache.New(td, cache.WithGo(mockGo))),
+	)
+	if err != nil {
+		t.Fatalf("failed to create shed client %v", err)
+	}
+	installSet, err := s.Get(client.GetOptions{ToolNames: []string{
+		"github.com/Shopify/ejson/cmd/ejson@v1.2.2",
+		"github.com/golangci/golangci-lint/cmd/golangci-lint@v1.33.0",
+		"github.com/cszatmary/go-fish@v0.1.0",
+	}})
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if err := installSet.Apply(context.Background()); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	lf := readLockfile(t, lockfilePath)
+	if got := lf.GoVersion("github.com/Shopify/ejson/cmd/ejson"); got != "1.11" {
+		t.Errorf("got go version %q, want %q", got, "1.11")
+	}
+
+	ctx := context.Background()
+	if err := s.CheckGoVersion(ctx, "ejson"); err != nil {
+		t.Errorf("want nil error, got %v", err)
+	}
+	// No go version is recorded so there is nothing to check
+	if err := s.CheckGoVersion(ctx, "go-fish"); err != nil {
+		t.Errorf("want nil error, got %v", err)
+	}
+	err = s.CheckGoVersion(ctx, "golangci-lint")
+	if e := errors.Root(err); e == nil || e.Kind != errors.Invalid {
+		t.Errorf("got error %v, want kind %v", err, errors.Invalid)
+	}
+}
+
+func TestGetRecordsHash(t *testing.T) {
+	td := t.TempDir()
+	lockfilePath := filepath.Join(td, "shed.lock")
+	goFish := tool.Tool{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"}
+	mockGo, err := cache.NewMockGo(availableTools)
+	if err != nil {
+		t.Fatalf("failed to create mock go %v", err)
+	}
+	c := cache.New(filepath.Join(td, "a"), cache.WithGo(mockGo))
+	s, err := client.NewShed(client.WithLockfilePath(lockfilePath), client.WithCache(c))
+	if err != nil {
+		t.Fatalf("failed to create shed client %v", err)
+	}
+	installSet, err := s.Get(client.GetOptions{ToolNames: []string{goFish.String()}})
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if err := installSet.Apply(context.Background()); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	wantHash, err := c.ModuleHash(goFish)
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	lf := readLockfile(t, lockfilePath)
+	if got := lf.Hash(goFish.ImportPath); got != wantHash {
+		t.Errorf("got hash %q, want %q", got, wantHash)
+	}
+
+	// Installing from the lockfile with different module content must fail
+	mockGo, err = cache.NewMockGo(availableTools, cache.WithMockHash(goFish.ImportPath, goFish.Version, "h1:changed="))
+	if err != nil {
+		t.Fatalf("failed to create mock go %v", err)
+	}
+	c = cache.New(filepath.Join(td, "b"), cache.WithGo(mockGo))
+	s, err = client.NewShed(client.WithLockfilePath(lockfilePath), client.WithCache(c))
+	if err != nil {
+		t.Fatalf("failed to create shed client %v", err)
+	}
+	installSet, err = s.Get(client.GetOptions{})
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	err = installSet.Apply(context.Background())
+	errs, ok := err.(errors.List)
+	if !ok || len(errs) != 1 {
+		t.Fatalf("got error %v, want errors.List with 1 error", err)
+	}
+	if rootErr := errors.Root(errs[0]); rootErr == nil || rootErr.Kind != errors.BadState {
+		t.Errorf("want bad state error, got %v", errs[0])
+	}
+}
+
+func TestGetReproducible(t *testing.T) {
+	td := t.TempDir()
+	lockfilePath := filepath.Join(td, "shed.lock")
+	goFish := tool.Tool{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"}
+	ejson := tool.Tool{ImportPath: "github.com/Shopify/ejson/cmd/ejson", Version: "v1.1.0"}
+	mockGo, err := cache.NewMockGo(availableTools)
+	if err != nil {
+		t.Fatalf("failed to create mock go %v", err)
+	}
+	c := cache.New(td, cache.WithGo(mockGo))
+	s, err := client.NewShed(client.WithLockfilePath(lockfilePath), client.WithCache(c))
+	if err != nil {
+		t.Fatalf("failed to create shed client %v", err)
+	}
+	installSet, err := s.Get(client.GetOptions{ToolNames: []string{goFish.String()}, Reproducible: true})
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if err := installSet.Apply(context.Background()); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	installSet, err = s.Get(client.GetOptions{ToolNames: []string{ejson.String()}})
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if err := installSet.Apply(context.Background()); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	lf := readLockfile(t, lockfilePath)
+	if !lf.HasBinHashes(goFish.ImportPath) {
+		t.Errorf("want binary hash to be recorded for %v", goFish)
+	}
+	if lf.HasBinHashes(ejson.ImportPath) {
+		t.Errorf("want no binary hash to be recorded for %v", ejson)
+	}
+
+	// Match
+	want := []client.VerifyResult{
+		{Tool: ejson, Status: cache.StatusInstalled},
+		{Tool: goFish, Status: cache.StatusInstalled},
+	}
+	results, err := s.Verify(context.Background(), client.VerifyOptions{})
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if !reflect.DeepEqual(results, want) {
+		t.Errorf("got results %+v, want %+v", results, want)
+	}
+
+	// Mismatch
+	binPath, err := s.ToolPath(goFish.ImportPath)
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if err := os.WriteFile(binPath, []byte("modified"), 0o755); err != nil {
+		t.Fatalf("failed to modify binary %v", err)
+	}
+	want[1].BinHashMismatch = true
+	results, err = s.Verify(context.Background(), client.VerifyOptions{Fix: true})
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if !reflect.DeepEqual(results, want) {
+		t.Errorf("got results %+v, want %+v", results, want)
+	}
+	if results[1].OK() {
+		t.Errorf("want %v to not be OK", goFish)
+	}
+}
+
+func TestDefaultImportPathRules(t *testing.T) {
+	tests := []struct {
+		importPath string
+		wantOK     bool
+	}{
+		{"github.com/cszatmary/go-fish", true},
+		{"gitlab.com/example/tool", true},
+		{"golang.org/x/tools/cmd/stringer", true},
+		{"go.uber.org/mock/mockgen", true},
+		{"honnef.co/go/tools/cmd/staticcheck", true},
+		{"example.de/tool", true},
+		{"gith8b.com/cszatmary/go-fish", false},
+		{"github.cm/cszatmary/go-fish", false},
+		{"golang.og/x/tools/cmd/stringer", false},
+		{"example.zip/tool", false},
+		{"localhost/tool", false},
+		{"xn--gthub-n4a.com/cszatmary/go-fish", false},
+		{"gіthub.com/cszatmary/go-fish", false},
+	}
+	rules := client.DefaultImportPathRules()
+	for _, tt := range tests {
+		var reasons []string
+		for _, rule := range rules {
+			if reason := rule(tt.importPath); reason != "" {
+				reasons = append(reasons, reason)
+			}
+		}
+		if tt.wantOK && len(reasons) > 0 {
+			t.Errorf("%s: want no problems, got %v", tt.importPath, reasons)
+		} else if !tt.wantOK && len(reasons) == 0 {
+			t.Errorf("%s: want problems, got none", tt.importPath)
+		}
+	}
+}
+
+func TestGetImportPathGuard(t *testing.T) {
+	td := t.TempDir()
+	lockfilePath := filepath.Join(td, "shed.lock")
+	c := cache.New(td)
+	newShed := func(policy client.ImportPathPolicy) *client.Shed {
+		s, err := client.NewShed(client.WithLockfilePath(lockfilePath), client.WithCache(c), client.WithImportPathGuard(policy))
+		if err != nil {
+			t.Fatalf("failed to create shed client %v", err)
+		}
+		return s
+	}
+
+	// Warnings don't stop the install
+	s := newShed(client.ImportPathPolicy{})
+	if _, err := s.Get(client.GetOptions{ToolNames: []string{"gith8b.com/cszatmary/go-fish@v0.1.0"}}); err != nil {
+		t.Errorf("want nil error, got %v", err)
+	}
+
+	s = newShed(client.ImportPathPolicy{Reject: true})
+	_, err := s.Get(client.GetOptions{ToolNames: []string{"github.com/cszatmary/go-fish@v0.1.0", "gith8b.com/cszatmary/go-fish@v0.1.0"}})
+	errs, ok := err.(errors.List)
+	if !ok || len(errs) != 1 {
+		t.Fatalf("got error %v, want errors.List with 1 error", err)
+	}
+	if rootErr := errors.Root(errs[0]); rootErr == nil || rootErr.Kind != errors.Invalid {
+		t.Errorf("want invalid error, got %v", errs[0])
+	}
+	_, err = s.Get(client.GetOptions{MinVersions: []string{"gith8b.com/cszatmary/go-fish@v0.1.0"}})
+	if err == nil {
+		t.Error("want error for suspicious minimum version, got nil")
+	}
+
+	// Allowed hosts and custom rules
+	s = newShed(client.ImportPathPolicy{
+		Reject:       true,
+		AllowedHosts: []string{"gith8b.com"},
+		Rules: append(client.DefaultImportPathRules(), func(importPath string) string {
+			if strings.HasPrefix(importPath, "github.com/evil/") {
+				return "evil organization"
+			}
+			return ""
+		}),
+	})
+	if _, err := s.Get(client.GetOptions{ToolNames: []string{"gith8b.com/cszatmary/go-fish@v0.1.0"}}); err != nil {
+		t.Errorf("want nil error, got %v", err)
+	}
+	if _, err := s.Get(client.GetOptions{ToolNames: []string{"github.com/evil/tool@v0.1.0"}}); err == nil {
+		t.Error("want error for custom rule, got nil")
+	}
+}
+
+func TestToolInfoJSON(t *testing.T) {
+	tools := []client.ToolInfo{
+		{
+			Tool:          tool.Tool{ImportPath: "golang.org/x/tools/cmd/stringer", Version: "v0.1.0"},
+			LatestVersion: "v0.1.5",
+		},
+		{
+			Tool: tool.Tool{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"},
+		},
+	}
+	data, err := json.Marshal(tools)
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	const want = `[{"importPath":"golang.org/x/tools/cmd/stringer","version":"v0.1.0","latestVersion":"v0.1.5"},` +
+		`{"importPath":"github.com/cszatmary/go-fish","version":"v0.1.0"}]`
+	if string(data) != want {
+		t.Errorf("got %s, want %s", data, want)
+	}
+
+	var got []client.ToolInfo
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if !reflect.DeepEqual(got, tools) {
+		t.Errorf("got %+v, want %+v", got, tools)
+	}
+}
+
+func TestFormatLockfile(t *testing.T) {
+	td := t.TempDir()
+	lockfilePath := filepath.Join(td, "shed.lock")
+	goFish := tool.Tool{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"}
+	ejson := tool.Tool{ImportPath: "github.com/Shopify/ejson/cmd/ejson", Version: "v1.1.0"}
+	createLockfile(t, lockfilePath, []tool.Tool{goFish})
+	mockGo, err := cache.NewMockGo(availableTools)
+	if err != nil {
+		t.Fatalf("failed to create mock go %v", err)
+	}
+	c := cache.New(td, cache.WithGo(mockGo))
+	newShed := func(opts ...client.Option) *client.Shed {
+		opts = append(opts, client.WithLockfilePath(lockfilePath), client.WithCache(c))
+		s, err := client.NewShed(opts...)
+		if err != nil {
+			t.Fatalf("failed to create shed client %v", err)
+		}
+		return s
+	}
+
+	s := newShed()
+	if err := s.FormatLockfile(client.FormatOptions{Compact: true}); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if lf := readLockfile(t, lockfilePath); !lf.Compact() {
+		t.Error("want lockfile to be compact")
+	}
+
+	// Compact format is kept on later writes
+	s = newShed()
+	installSet, err := s.Get(client.GetOptions{ToolNames: []string{ejson.String()}})
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if err := installSet.Apply(context.Background()); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	data, err := os.ReadFile(lockfilePath)
+	if err != nil {
+		t.Fatalf("failed to read lockfile %v", err)
+	}
+	if lines := strings.Count(string(data), "\n") + 1; lines != 4 {
+		t.Errorf("got %d lines, want 4 lines for 2 tools\n%s", lines, data)
+	}
+
+	s = newShed()
+	if err := s.FormatLockfile(client.FormatOptions{}); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if lf := readLockfile(t, lockfilePath); lf.Compact() {
+		t.Error("want lockfile to not be compact")
+	}
+
+	s = newShed(client.WithCompactLockfile())
+	if _, err := s.Uninstall(ejson.ImportPath); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	lf := readLockfile(t, lockfilePath)
+	if !lf.Compact() {
+		t.Error("want lockfile to be compact")
+	}
+	if lf.LenTools() != 1 {
+		t.Errorf("got %d tools, want 1", lf.LenTools())
+	}
+}
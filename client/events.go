@@ -0,0 +1,93 @@
+package client
+
+import (
+	"time"
+
+	"github.com/cszatmary/shed/tool"
+)
+
+// Phase represents a step in the installation of a tool.
+type Phase int
+
+const (
+	// PhaseStarted means the tool has started installing.
+	PhaseStarted Phase = iota
+	// PhaseDownloaded means the tool has been downloaded and is about to be built.
+	PhaseDownloaded
+	// PhaseBuilt means the tool has been installed. This is also used if the
+	// tool was already built and only needed to be resolved from the cache.
+	PhaseBuilt
+	// PhaseSkipped means the tool was already installed so no work was done.
+	PhaseSkipped
+	// PhaseRemoved means the tool was uninstalled.
+	PhaseRemoved
+	// PhaseFailed means the tool failed to install.
+	PhaseFailed
+)
+
+// String returns the name of the phase.
+func (p Phase) String() string {
+	switch p {
+	case PhaseStarted:
+		return "started"
+	case PhaseDownloaded:
+		return "downloaded"
+	case PhaseBuilt:
+		return "built"
+	case PhaseSkipped:
+		return "skipped"
+	case PhaseRemoved:
+		return "removed"
+	case PhaseFailed:
+		return "failed"
+	default:
+		return "unknown"
+	}
+}
+
+// InstallEvent describes the progress of installing a single tool.
+type InstallEvent struct {
+	// Tool is the tool the event is for. Once the tool has been downloaded,
+	// Version is set to the resolved version.
+	Tool tool.Tool
+	// Phase is the step of the install that was reached.
+	Phase Phase
+	// Err is the reason the install failed. It is only set if Phase is PhaseFailed.
+	Err error
+	// Duration is how long the tool had been installing when the event was sent. For example, the
+	// Duration of the PhaseDownloaded event is how long the download took, and the difference between
+	// the Duration of the PhaseBuilt and PhaseDownloaded events is how long the build took.
+	Duration time.Duration
+}
+
+// NotifyEvents causes the InstallSet to relay the progress of each tool to ch.
+// Unlike Notify, an event is sent for each phase of the install, including failures.
+//
+// Events are sent from the goroutines installing the tools, so you should receive
+// from ch on a separate goroutine than the one that Apply is called on, and ch should
+// be buffered or drained promptly to avoid slowing down the install.
+// No events are sent after Apply returns, so ch can be closed once it does.
+func (is *InstallSet) NotifyEvents(ch chan<- InstallEvent) {
+	is.eventCh = ch
+}
+
+// completed reports whether p is the last phase of a tool that was installed or uninstalled successfully.
+func (p Phase) completed() bool {
+	return p == PhaseBuilt || p == PhaseSkipped || p == PhaseRemoved
+}
+
+// emit sends an event to the events channel if one is set. start is when the tool started installing,
+// if it is the zero time the event has no duration. Completed tools are also sent to the channel set by Notify,
+// so that it stays in sync with the events.
+func (is *InstallSet) emit(t tool.Tool, phase Phase, start time.Time, err error) {
+	if is.eventCh != nil {
+		var d time.Duration
+		if !start.IsZero() {
+			d = time.Since(start)
+		}
+		is.eventCh <- InstallEvent{Tool: t, Phase: phase, Err: err, Duration: d}
+	}
+	if is.notifyCh != nil && phase.completed() {
+		is.notifyCh <- t
+	}
+}
@@ -0,0 +1,225 @@
+package client
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/cszatmary/shed/errors"
+)
+
+// ImportPathRule checks an import path for signs that it is typosquatting a well known module,
+// for example 'gith8b.com' instead of 'github.com'. It returns a description of why importPath is
+// suspicious, or an empty string if it looks fine.
+type ImportPathRule func(importPath string) string
+
+// ImportPathPolicy configures how Shed guards against suspicious import paths. See WithImportPathGuard.
+type ImportPathPolicy struct {
+	// Rules are the checks that are performed on each import path.
+	// If nil, the rules returned by DefaultImportPathRules are used.
+	// To extend the defaults, append custom rules to DefaultImportPathRules.
+	Rules []ImportPathRule
+	// AllowedHosts contains hosts that are never checked, for example the host of a private
+	// module proxy or version control server.
+	AllowedHosts []string
+	// Reject sets whether a suspicious import path is an error. If false, a warning is logged instead.
+	Reject bool
+}
+
+// knownTLDs contains top-level domains that are commonly used by Go modules.
+var knownTLDs = []string{
+	"app", "cloud", "com", "dev", "edu", "gov", "info", "io", "net", "org", "page", "tech",
+}
+
+// knownHosts contains hosts that are commonly used by Go modules and are likely targets of typosquatting.
+var knownHosts = []string{
+	"bitbucket.org",
+	"cloud.google.com",
+	"github.com",
+	"gitlab.com",
+	"go.etcd.io",
+	"go.uber.org",
+	"golang.org",
+	"google.golang.org",
+	"gopkg.in",
+	"honnef.co",
+	"k8s.io",
+	"mvdan.cc",
+	"sigs.k8s.io",
+}
+
+// DefaultImportPathRules returns the rules used by an ImportPathPolicy that does not set Rules.
+// They are conservative so that they rarely flag legitimate import paths:
+//
+//   - The top-level domain must be commonly used by Go modules, or be a two letter country code.
+//   - The host must not be a slight misspelling of a well known host like 'github.com'.
+//   - The host must not contain non-ASCII characters or punycode labels, which can contain
+//     characters that look identical to ASCII characters.
+func DefaultImportPathRules() []ImportPathRule {
+	return []ImportPathRule{
+		KnownTLDRule(knownTLDs...),
+		HostTypoRule(knownHosts...),
+		HomoglyphRule(),
+	}
+}
+
+// KnownTLDRule returns a rule that flags import paths whose host has a top-level domain that is
+// not one of tlds. Two letter country code top-level domains are always allowed.
+func KnownTLDRule(tlds ...string) ImportPathRule {
+	allowed := make(map[string]bool, len(tlds))
+	for _, tld := range tlds {
+		allowed[strings.ToLower(tld)] = true
+	}
+	return func(importPath string) string {
+		host := importPathHost(importPath)
+		i := strings.LastIndexByte(host, '.')
+		if i == -1 {
+			return fmt.Sprintf("host %q does not have a top-level domain", host)
+		}
+		tld := host[i+1:]
+		if allowed[tld] || (len(tld) == 2 && isASCIILetters(tld)) {
+			return ""
+		}
+		return fmt.Sprintf("host %q has an uncommon top-level domain %q", host, tld)
+	}
+}
+
+// HostTypoRule returns a rule that flags import paths whose host is a slight misspelling of one of hosts.
+// A host is considered a misspelling if it is within one edit of a known host, or two edits for
+// known hosts that are at least 10 characters long.
+func HostTypoRule(hosts ...string) ImportPathRule {
+	known := make([]string, len(hosts))
+	for i, h := range hosts {
+		known[i] = strings.ToLower(h)
+	}
+	return func(importPath string) string {
+		host := importPathHost(importPath)
+		for _, k := range known {
+			if host == k {
+				return ""
+			}
+		}
+		for _, k := range known {
+			maxDist := 1
+			if len(k) >= 10 {
+				maxDist = 2
+			}
+			if editDistance(host, k) <= maxDist {
+				return fmt.Sprintf("host %q looks like a misspelling of %q", host, k)
+			}
+		}
+		return ""
+	}
+}
+
+// HomoglyphRule returns a rule that flags import paths whose host contains non-ASCII characters
+// or punycode labels, since they can be used to create hosts that look identical to well known ones.
+func HomoglyphRule() ImportPathRule {
+	return func(importPath string) string {
+		host := importPathHost(importPath)
+		for _, r := range host {
+			if r >= utf8.RuneSelf {
+				return fmt.Sprintf("host %q contains non-ASCII character %q", host, r)
+			}
+		}
+		for _, label := range strings.Split(host, ".") {
+			if strings.HasPrefix(label, "xn--") {
+				return fmt.Sprintf("host %q contains punycode label %q", host, label)
+			}
+		}
+		return ""
+	}
+}
+
+// WithImportPathGuard makes Shed check the import paths of the tools provided to Get against
+// the rules in policy, which helps catch typosquatted import paths, for example when installing
+// tools specified by users. Depending on policy, a suspicious import path is either logged as a
+// warning or causes Get to fail. Tools from lockfiles are not checked. By default no checks are done.
+func WithImportPathGuard(policy ImportPathPolicy) Option {
+	return func(s *Shed) {
+		s.importPathPolicy = &policy
+	}
+}
+
+// checkImportPath checks importPath against the import path policy, if one is set.
+// A non-nil error is only returned if the import path is suspicious and the policy rejects it.
+func (s *Shed) checkImportPath(op errors.Op, importPath string) error {
+	p := s.importPathPolicy
+	if p == nil {
+		return nil
+	}
+	host := importPathHost(importPath)
+	for _, allowed := range p.AllowedHosts {
+		if host == strings.ToLower(allowed) {
+			return nil
+		}
+	}
+	rules := p.Rules
+	if rules == nil {
+		rules = DefaultImportPathRules()
+	}
+	for _, rule := range rules {
+		reason := rule(importPath)
+		if reason == "" {
+			continue
+		}
+		if p.Reject {
+			return errors.New(errors.Invalid, fmt.Sprintf("suspicious import path %q: %s", importPath, reason), op)
+		}
+		s.logger.Warnf("Suspicious import path %q: %s", importPath, reason)
+		return nil
+	}
+	return nil
+}
+
+// importPathHost returns the lower case host of importPath, which is the first path element.
+// Any version suffix is ignored.
+func importPathHost(importPath string) string {
+	if i := strings.IndexByte(importPath, '@'); i != -1 {
+		importPath = importPath[:i]
+	}
+	if i := strings.IndexByte(importPath, '/'); i != -1 {
+		importPath = importPath[:i]
+	}
+	return strings.ToLower(importPath)
+}
+
+func isASCIILetters(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < 'a' || s[i] > 'z' {
+			return false
+		}
+	}
+	return true
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
@@ -0,0 +1,148 @@
+package client
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/cszatmary/shed/errors"
+	"github.com/cszatmary/shed/tool"
+)
+
+// PlanAction is the type of change that will be made to a tool in the lockfile.
+type PlanAction string
+
+const (
+	// PlanAdd signifies that the tool will be added to the lockfile.
+	PlanAdd PlanAction = "add"
+	// PlanUpdate signifies that the version of the tool in the lockfile will change.
+	PlanUpdate PlanAction = "update"
+	// PlanRemove signifies that the tool will be removed from the lockfile.
+	PlanRemove PlanAction = "remove"
+)
+
+// PlanChange describes a change that will be made to a tool in the lockfile.
+type PlanChange struct {
+	Action     PlanAction `json:"action"`
+	ImportPath string     `json:"importPath"`
+	// CurrentVersion is the version of the tool in the lockfile.
+	// It is empty if the tool is being added.
+	CurrentVersion string `json:"currentVersion,omitempty"`
+	// Version is the version of the tool that will be installed. It is an exact
+	// version if it is known, otherwise it is the module query that will be resolved
+	// during install (ex: 'latest'). It is empty if the tool is being removed.
+	Version string `json:"version,omitempty"`
+}
+
+// Plan describes the changes that an InstallSet will make to the lockfile.
+// A Plan can be serialized as JSON so that it can be reviewed and applied later
+// using Shed.GetPlan.
+type Plan struct {
+	// Lockfile contains the version of each tool in the lockfile at the time
+	// the plan was created, keyed by import path. It is used to detect if the
+	// lockfile has changed before the plan is applied.
+	Lockfile map[string]string `json:"lockfile"`
+	// Changes are the changes that will be made to the lockfile, sorted by import path.
+	Changes []PlanChange `json:"changes"`
+}
+
+// Plan computes the changes that Apply will make to the lockfile. It does not modify any state.
+func (is *InstallSet) Plan() *Plan {
+	plan := &Plan{Lockfile: lockfileSnapshot(is.s), Changes: []PlanChange{}}
+	for _, t := range is.tools {
+		if is.ephemeral[t.ImportPath] {
+			// Lockfile won't be modified
+			continue
+		}
+		current, inLockfile := plan.Lockfile[t.ImportPath]
+		switch {
+		case t.Version == noneVersion:
+			if inLockfile {
+				plan.Changes = append(plan.Changes, PlanChange{
+					Action:         PlanRemove,
+					ImportPath:     t.ImportPath,
+					CurrentVersion: current,
+				})
+			}
+		case !inLockfile:
+			plan.Changes = append(plan.Changes, PlanChange{
+				Action:     PlanAdd,
+				ImportPath: t.ImportPath,
+				Version:    planVersion(t),
+			})
+		case current != t.Version:
+			plan.Changes = append(plan.Changes, PlanChange{
+				Action:         PlanUpdate,
+				ImportPath:     t.ImportPath,
+				CurrentVersion: current,
+				Version:        planVersion(t),
+			})
+		}
+	}
+	sort.Slice(plan.Changes, func(i, j int) bool {
+		return plan.Changes[i].ImportPath < plan.Changes[j].ImportPath
+	})
+	return plan
+}
+
+// planVersion returns the version to record in a plan. An empty version means the latest version.
+func planVersion(t tool.Tool) string {
+	if t.Version == "" {
+		return latestVersion
+	}
+	return t.Version
+}
+
+// lockfileSnapshot returns the version of each tool in the lockfile keyed by import path.
+func lockfileSnapshot(s *Shed) map[string]string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	snapshot := make(map[string]string)
+	it := s.lf.Iter()
+	for it.Next() {
+		t := it.Value()
+		snapshot[t.ImportPath] = t.Version
+	}
+	return snapshot
+}
+
+// GetPlan creates an InstallSet that will perform the changes in plan.
+// The lockfile must be in the same state as when the plan was created,
+// otherwise an error is returned.
+func (s *Shed) GetPlan(plan *Plan) (*InstallSet, error) {
+	const op = errors.Op("Shed.GetPlan")
+	current := lockfileSnapshot(s)
+	var drift []string
+	for importPath, v := range plan.Lockfile {
+		if cv, ok := current[importPath]; !ok {
+			drift = append(drift, fmt.Sprintf("%s@%s was removed", importPath, v))
+		} else if cv != v {
+			drift = append(drift, fmt.Sprintf("%s changed from %s to %s", importPath, v, cv))
+		}
+	}
+	for importPath, cv := range current {
+		if _, ok := plan.Lockfile[importPath]; !ok {
+			drift = append(drift, fmt.Sprintf("%s@%s was added", importPath, cv))
+		}
+	}
+	if len(drift) > 0 {
+		sort.Strings(drift)
+		var errs errors.List
+		for _, d := range drift {
+			errs = append(errs, errors.New(errors.Invalid, fmt.Sprintf("lockfile %q has changed since the plan was created: %s", s.lockfilePath, d), op))
+		}
+		return nil, errs
+	}
+
+	toolNames := make([]string, len(plan.Changes))
+	for i, c := range plan.Changes {
+		v := c.Version
+		if c.Action == PlanRemove {
+			v = noneVersion
+		}
+		if v == "" {
+			return nil, errors.New(errors.Invalid, fmt.Sprintf("missing version for tool %s in plan", c.ImportPath), op)
+		}
+		toolNames[i] = c.ImportPath + "@" + v
+	}
+	return s.Get(GetOptions{ToolNames: toolNames})
+}
@@ -0,0 +1,113 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/cszatmary/shed/errors"
+	"github.com/cszatmary/shed/internal/util"
+	"github.com/cszatmary/shed/tool"
+)
+
+// installState records the progress of InstallSet.Apply so that it can be resumed.
+type installState struct {
+	// Completed contains the tools that have finished installing with their resolved versions.
+	Completed []string `json:"completed"`
+	// Remaining contains the tools that have not finished installing.
+	Remaining []string `json:"remaining"`
+	// Ephemeral contains the import paths of the tools that must not be added to the lockfile.
+	Ephemeral []string `json:"ephemeral,omitempty"`
+	// Force is InstallSet.Force, so the remaining tools are also downloaded and built again.
+	Force bool `json:"force,omitempty"`
+}
+
+// writeState writes the progress of the install to is.StatePath.
+// completed contains the tools that have finished, keyed by import path.
+func (is *InstallSet) writeState(op errors.Op, completed map[string]tool.Tool) error {
+	if is.StatePath == "" {
+		return nil
+	}
+	state := installState{Completed: []string{}, Remaining: []string{}, Force: is.Force}
+	for _, t := range is.tools {
+		if ct, ok := completed[t.ImportPath]; ok {
+			state.Completed = append(state.Completed, ct.Module())
+		} else {
+			state.Remaining = append(state.Remaining, t.Module())
+		}
+		if is.ephemeral[t.ImportPath] {
+			state.Ephemeral = append(state.Ephemeral, t.ImportPath)
+		}
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return errors.New(errors.Internal, "failed to serialize install state", op, err)
+	}
+	err = util.WriteFileAtomic(is.StatePath, 0o644, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+	if err != nil {
+		return errors.New(errors.IO, fmt.Sprintf("failed to write install state to %q", is.StatePath), op, err)
+	}
+	return nil
+}
+
+// removeState removes the state file once the install is complete.
+func (is *InstallSet) removeState(op errors.Op) error {
+	if is.StatePath == "" {
+		return nil
+	}
+	if err := os.Remove(is.StatePath); err != nil && !os.IsNotExist(err) {
+		return errors.New(errors.IO, fmt.Sprintf("failed to remove install state %q", is.StatePath), op, err)
+	}
+	return nil
+}
+
+// Resume creates an InstallSet from the state file at statePath that was written by
+// a previous call to InstallSet.Apply which did not complete. Tools that were already
+// installed will be skipped, and only the remaining tools will be installed.
+// Force is set if it was set for the previous Apply.
+// The returned InstallSet will continue to record progress to statePath.
+func (s *Shed) Resume(statePath string) (*InstallSet, error) {
+	const op = errors.Op("Shed.Resume")
+	data, err := os.ReadFile(statePath)
+	if err != nil {
+		return nil, errors.New(errors.IO, fmt.Sprintf("failed to read install state %q", statePath), op, err)
+	}
+	var state installState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, errors.New(errors.Invalid, fmt.Sprintf("invalid install state %q", statePath), op, err)
+	}
+
+	is := &InstallSet{
+		StatePath: statePath,
+		Force:     state.Force,
+		s:         s,
+		requested: make(map[string]bool),
+		resumed:   make(map[string]bool),
+	}
+	for _, name := range state.Completed {
+		t, err := tool.ParseLax(name)
+		if err != nil {
+			return nil, errors.New(errors.Invalid, fmt.Sprintf("invalid tool %s in install state %q", name, statePath), op, err)
+		}
+		is.resumed[t.ImportPath] = true
+		is.tools = append(is.tools, t)
+	}
+	for _, name := range state.Remaining {
+		t, err := tool.ParseLax(name)
+		if err != nil {
+			return nil, errors.New(errors.Invalid, fmt.Sprintf("invalid tool %s in install state %q", name, statePath), op, err)
+		}
+		is.tools = append(is.tools, t)
+	}
+	for _, importPath := range state.Ephemeral {
+		if is.ephemeral == nil {
+			is.ephemeral = make(map[string]bool)
+		}
+		is.ephemeral[importPath] = true
+	}
+	return is, nil
+}
@@ -0,0 +1,43 @@
+package client
+
+import (
+	"context"
+)
+
+// Semaphore bounds the number of installs that run concurrently across multiple InstallSets.
+// By default each InstallSet limits its own concurrency, so applying several InstallSets at the same
+// time, for example one per module in a workspace, can run more installs than the machine can handle.
+// Share a Semaphore between them using InstallSet.WithSharedSemaphore to limit the total instead.
+//
+// A Semaphore is safe for concurrent use by multiple goroutines.
+type Semaphore struct {
+	ch chan struct{}
+}
+
+// NewSemaphore creates a Semaphore that allows up to n installs to run at the same time.
+// If n is 0, it defaults to the value of the SHED_CONCURRENCY environment variable if set,
+// otherwise the number of CPUs available.
+func NewSemaphore(n uint) *Semaphore {
+	return &Semaphore{ch: make(chan struct{}, getConcurrency(n))}
+}
+
+// Size returns the max number of installs that can run at the same time.
+func (sem *Semaphore) Size() uint {
+	return uint(cap(sem.ch))
+}
+
+// acquire blocks until an install is allowed to run or ctx is done.
+// If ctx is done first, its error is returned.
+func (sem *Semaphore) acquire(ctx context.Context) error {
+	select {
+	case sem.ch <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// release allows another install to run. It must be called once for each successful call to acquire.
+func (sem *Semaphore) release() {
+	<-sem.ch
+}
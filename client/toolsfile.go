@@ -0,0 +1,94 @@
+package client
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cszatmary/shed/errors"
+	"github.com/cszatmary/shed/internal/util"
+	"github.com/cszatmary/shed/tool"
+	"golang.org/x/mod/modfile"
+)
+
+// GetFromToolsFile is like Get but also installs the tools imported by the tools.go file at toolsPath.
+// This eases migrating from the tools.go pattern, where tool dependencies are tracked using blank imports
+// in a file with a 'tools' build constraint, see tool.ParseToolsFile.
+//
+// The version of each tool is taken from the require directive for its module in the go.mod file
+// of the module containing toolsPath, so the same versions are installed. The go.mod file is found
+// by searching the directory of toolsPath and its parents. If a tool has no matching require directive,
+// an errors.List is returned containing an error for each such tool.
+//
+// The tools are added to opts.ToolNames, so they are unioned with the lockfile exactly like Get does.
+func (s *Shed) GetFromToolsFile(toolsPath string, opts GetOptions) (*InstallSet, error) {
+	const op = errors.Op("Shed.GetFromToolsFile")
+	f, err := os.Open(toolsPath)
+	if err != nil {
+		return nil, errors.Wrap(err, errors.IO, op, fmt.Sprintf("failed to open tools file %q", toolsPath))
+	}
+	tools, err := tool.ParseToolsFile(f)
+	f.Close()
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("failed to parse tools file %q", toolsPath), op, err)
+	}
+
+	modfilePath, err := findGoMod(op, filepath.Dir(toolsPath))
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(modfilePath)
+	if err != nil {
+		return nil, errors.Wrap(err, errors.IO, op, fmt.Sprintf("failed to read file %q", modfilePath))
+	}
+	modFile, err := modfile.ParseLax(modfilePath, data, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, errors.Invalid, op, fmt.Sprintf("failed to parse %q", modfilePath))
+	}
+
+	var toolNames []string
+	var errs errors.List
+	for _, t := range tools {
+		// Find the module that provides the tool, use the longest match in case nested modules are required.
+		var version string
+		var modPath string
+		for _, r := range modFile.Require {
+			if t.ImportPath != r.Mod.Path && !strings.HasPrefix(t.ImportPath, r.Mod.Path+"/") {
+				continue
+			}
+			if len(r.Mod.Path) > len(modPath) {
+				modPath = r.Mod.Path
+				version = r.Mod.Version
+			}
+		}
+		if version == "" {
+			errs = append(errs, errors.Errorf(errors.Invalid, op, "no require directive in %q for tool %s", modfilePath, t))
+			continue
+		}
+		toolNames = append(toolNames, t.WithVersion(version).Module())
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	opts.ToolNames = append(toolNames, opts.ToolNames...)
+	return s.Get(opts)
+}
+
+// findGoMod returns the path to the go.mod file of the module containing dir.
+func findGoMod(op errors.Op, dir string) (string, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", errors.Wrap(err, errors.IO, op, fmt.Sprintf("failed to get absolute path of %q", dir))
+	}
+	for d := absDir; ; d = filepath.Dir(d) {
+		p := filepath.Join(d, "go.mod")
+		if util.FileOrDirExists(p) {
+			return p, nil
+		}
+		if filepath.Dir(d) == d {
+			break
+		}
+	}
+	return "", errors.Errorf(errors.Invalid, op, "no go.mod file found in %q or any parent directory", absDir)
+}
@@ -0,0 +1,105 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/cszatmary/shed/cache"
+	"github.com/cszatmary/shed/errors"
+	"github.com/cszatmary/shed/tool"
+	"github.com/sirupsen/logrus"
+)
+
+// VerifyOptions is used to configure Shed.Verify.
+type VerifyOptions struct {
+	// Fix sets whether tools that are not correctly installed should be reinstalled
+	// at the exact version in the lockfile. If false, Verify only reads the cache.
+	Fix bool
+}
+
+// VerifyResult contains the result of verifying a single tool.
+type VerifyResult struct {
+	// Tool is the tool from the lockfile.
+	Tool tool.Tool
+	// Status is the state the tool was found in before any fixes were made.
+	Status cache.ToolStatus
+	// BinHashMismatch is true if the tool is installed but the hash of its binary does not match
+	// the hash recorded in the lockfile for the current platform. It is never fixed, since
+	// reinstalling would hide that the binary was modified or that the build is not reproducible.
+	BinHashMismatch bool
+	// Fixed is true if the tool was not installed correctly and was reinstalled.
+	// It is only set if VerifyOptions.Fix is true.
+	Fixed bool
+	// Err is the reason the tool could not be fixed.
+	Err error
+}
+
+// OK reports whether the tool is correctly installed, either because it already was or because it was fixed.
+func (r VerifyResult) OK() bool {
+	return (r.Status == cache.StatusInstalled || r.Fixed) && !r.BinHashMismatch
+}
+
+// Verify checks that each tool in the lockfile is installed in the cache at the version in the lockfile.
+// If opts.Fix is true, each tool that is not installed correctly is reinstalled at the exact version
+// in the lockfile. The lockfile is never modified.
+//
+// If the lockfile contains a binary hash of a tool for the current platform, the hash of the
+// installed binary is compared to it. Binary hashes are recorded by installing with GetOptions.Reproducible.
+//
+// A failure to fix a tool is reported in the Err field of its result. A non-nil error is only returned
+// if the cache could not be checked. The returned results are sorted by import path.
+func (s *Shed) Verify(ctx context.Context, opts VerifyOptions) ([]VerifyResult, error) {
+	const op = errors.Op("Shed.Verify")
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var results []VerifyResult
+	var platform string
+	it := s.lf.Iter()
+	for it.Next() {
+		t := it.Value()
+		pathOpt := cache.ForBuildFlags(s.lf.BuildFlags(t.ImportPath)...)
+		status, err := s.cache.Status(t, pathOpt)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("failed to check status of tool %s", t), op, err)
+		}
+		r := VerifyResult{Tool: t, Status: status}
+		if status == cache.StatusInstalled && s.lf.HasBinHashes(t.ImportPath) {
+			if platform == "" {
+				if platform, err = s.binHashPlatform(ctx); err != nil {
+					return nil, errors.New("failed to determine platform for binary hashes", op, err)
+				}
+			}
+			if want := s.lf.BinHash(t.ImportPath, platform); want != "" {
+				got, err := s.cache.BinaryHash(t, pathOpt)
+				if err != nil {
+					return nil, errors.New(fmt.Sprintf("failed to compute binary hash of tool %s", t), op, err)
+				}
+				r.BinHashMismatch = got != want
+			}
+		}
+		results = append(results, r)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Tool.ImportPath < results[j].Tool.ImportPath
+	})
+	if !opts.Fix {
+		return results, nil
+	}
+
+	for i, r := range results {
+		if r.Status == cache.StatusInstalled {
+			continue
+		}
+		s.logger.WithFields(logrus.Fields{
+			"tool":   r.Tool,
+			"status": r.Status,
+		}).Debug("Reinstalling tool")
+		if _, err := s.cache.Install(ctx, r.Tool, s.installOptions(r.Tool)...); err != nil {
+			results[i].Err = errors.New(fmt.Sprintf("failed to reinstall tool %s", r.Tool), op, err)
+			continue
+		}
+		results[i].Fixed = true
+	}
+	return results, nil
+}
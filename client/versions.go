@@ -0,0 +1,132 @@
+package client
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/cszatmary/shed/errors"
+	"github.com/cszatmary/shed/tool"
+)
+
+// VersionResolver provides the versions of tools from a central source, for example a file
+// shared by all the projects in a monorepo. This keeps the versions of tools consistent across
+// many lockfiles. See WithVersionResolver.
+type VersionResolver interface {
+	// Resolve returns the version of the tool with the given import path.
+	// The returned bool is false if the resolver has no version for the tool.
+	Resolve(importPath string) (string, bool)
+}
+
+// WithVersionResolver makes Get use r to find the version of each tool provided without a version,
+// instead of installing the latest version. Tools that r has no version for are installed as usual.
+// The version returned by r must be a valid SemVer. r is not used when updating tools.
+func WithVersionResolver(r VersionResolver) Option {
+	return func(s *Shed) {
+		s.versionResolver = r
+	}
+}
+
+// VersionsFile is a VersionResolver that maps tool import paths to versions.
+// It is usually created by reading a versions file with ReadVersionsFile.
+type VersionsFile map[string]string
+
+// Resolve implements VersionResolver.
+func (vf VersionsFile) Resolve(importPath string) (string, bool) {
+	v, ok := vf[importPath]
+	return v, ok
+}
+
+// ReadVersionsFile reads the versions file at path. A versions file is a YAML mapping of
+// tool import paths to versions, for example:
+//
+//	# Versions shared by all projects
+//	golang.org/x/tools/cmd/stringer: v0.1.5
+//	github.com/golangci/golangci-lint/cmd/golangci-lint: "v1.33.0"
+//
+// Only a flat mapping is supported, each line must be a key value pair, a comment, or blank.
+// Each version must be a valid SemVer. If any lines are invalid, an errors.List is returned
+// containing an error for each invalid line.
+func ReadVersionsFile(path string) (VersionsFile, error) {
+	const op = errors.Op("client.ReadVersionsFile")
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, errors.IO, op, fmt.Sprintf("failed to open versions file %q", path))
+	}
+	defer f.Close()
+	vf, err := parseVersionsFile(op, f)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("failed to read versions file %q", path), op, err)
+	}
+	return vf, nil
+}
+
+// parseVersionsFile parses the versions file in r, see ReadVersionsFile.
+func parseVersionsFile(op errors.Op, r io.Reader) (VersionsFile, error) {
+	vf := make(VersionsFile)
+	var errs errors.List
+	sc := bufio.NewScanner(r)
+	for lineNum := 1; sc.Scan(); lineNum++ {
+		line := sc.Text()
+		if i := strings.IndexByte(line, '#'); i != -1 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" || line == "---" {
+			continue
+		}
+		// Import paths can't contain a colon, so the first one separates the key from the value.
+		i := strings.Index(line, ":")
+		if i == -1 {
+			errs = append(errs, errors.Errorf(errors.Invalid, op, "line %d: expected 'importPath: version', got %q", lineNum, line))
+			continue
+		}
+		importPath := unquoteYAML(strings.TrimSpace(line[:i]))
+		version := unquoteYAML(strings.TrimSpace(line[i+1:]))
+		t, err := tool.Parse(importPath + "@" + version)
+		if err != nil {
+			errs = append(errs, errors.New(fmt.Sprintf("line %d: invalid tool %s", lineNum, importPath), op, err))
+			continue
+		}
+		if _, ok := vf[t.ImportPath]; ok {
+			errs = append(errs, errors.Errorf(errors.Invalid, op, "line %d: duplicate tool %s", lineNum, t.ImportPath))
+			continue
+		}
+		vf[t.ImportPath] = t.Version
+	}
+	if err := sc.Err(); err != nil {
+		return nil, errors.New(errors.IO, "failed to read versions", op, err)
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return vf, nil
+}
+
+// unquoteYAML removes the quotes around s if it is a single or double quoted YAML scalar.
+func unquoteYAML(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// resolveVersion sets the version of t using the version resolver if t has no version.
+// t is returned as is if no resolver is set or it has no version for t.
+func (s *Shed) resolveVersion(op errors.Op, t tool.Tool) (tool.Tool, error) {
+	if s.versionResolver == nil || t.Version != "" {
+		return t, nil
+	}
+	v, ok := s.versionResolver.Resolve(t.ImportPath)
+	if !ok {
+		return t, nil
+	}
+	resolved := t.WithVersion(v)
+	if !resolved.HasSemver() {
+		return t, errors.Errorf(errors.Invalid, op, "version %q of tool %s from version resolver must be a valid SemVer", v, t.ImportPath)
+	}
+	s.logger.Debugf("Using version %s of tool %s from version resolver", v, t.ImportPath)
+	return resolved, nil
+}
@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/cszatmary/shed/client"
+	"github.com/spf13/cobra"
+)
+
+func newApplyCommand(c *container) *cobra.Command {
+	var applyOpts struct {
+		concurrency int
+	}
+
+	applyCmd := &cobra.Command{
+		Use:   "apply <plan>",
+		Args:  cobra.ExactArgs(1),
+		Short: "Install tools from a plan.",
+		Long: `shed apply installs tools using a plan created by 'shed get --plan-out'.
+
+This allows the changes to the lockfile to be reviewed before they are made.
+The lockfile must not have changed since the plan was created, otherwise apply will fail.
+In this case, a new plan should be created.
+
+For example:
+
+	shed get --plan-out plan.json golang.org/x/tools/cmd/stringer
+	shed apply plan.json`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if applyOpts.concurrency < 0 {
+				return &exitError{
+					code: 1,
+					msg:  "Concurrency value must be a positive integer.",
+					err:  fmt.Errorf(`invalid value %d for concurrency flag`, applyOpts.concurrency),
+				}
+			}
+
+			planPath := args[0]
+			data, err := os.ReadFile(planPath)
+			if err != nil {
+				return fmt.Errorf("failed to read install plan %s: %w", planPath, err)
+			}
+			var plan client.Plan
+			if err := json.Unmarshal(data, &plan); err != nil {
+				return &exitError{
+					code: 1,
+					msg:  fmt.Sprintf("Invalid install plan %s. Create a new plan with '%s get --plan-out'.", planPath, cmd.Root().Name()),
+					err:  err,
+				}
+			}
+
+			installSet, err := c.shed.GetPlan(&plan)
+			if err != nil {
+				return fmt.Errorf("unable to use install plan %s: %w", planPath, err)
+			}
+			installSet.Concurrency = uint(applyOpts.concurrency)
+			return applyInstallSet(cmd.Context(), c, installSet)
+		},
+	}
+
+	applyCmd.Flags().IntVarP(&applyOpts.concurrency, "concurrency", "c", 0, "amount of tasks to run concurrently (default: $SHED_CONCURRENCY or number of CPUs)")
+	return applyCmd
+}
@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+func newAuditCommand(c *container) *cobra.Command {
+	auditCmd := &cobra.Command{
+		Use:   "audit",
+		Args:  cobra.NoArgs,
+		Short: "Check tools for known vulnerabilities.",
+		Long: `shed audit checks each tool specified in shed.lock for known vulnerabilities.
+
+The installed binary of each tool is scanned using govulncheck, which reports vulnerabilities
+from the Go vulnerability database that affect the tool's module or any of its dependencies.
+All tools must be installed before running audit.
+
+govulncheck must either be managed by shed or be available in PATH. To have shed manage it, run:
+
+	shed get golang.org/x/vuln/cmd/govulncheck
+
+If any vulnerabilities are found, shed exits with a non-zero status.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			vulns, err := c.shed.Audit(cmd.Context())
+			if err != nil {
+				return err
+			}
+			if len(vulns) == 0 {
+				fmt.Println("No known vulnerabilities found")
+				return nil
+			}
+			for _, v := range vulns {
+				fmt.Printf("%s %s: %s %s@%s", v.Tool.ImportPath, v.Tool.Version, v.ID, v.Module, v.Version)
+				if v.FixedVersion != "" {
+					fmt.Printf(" (fixed in %s)", v.FixedVersion)
+				}
+				fmt.Println()
+				if v.Summary != "" {
+					fmt.Printf("\t%s\n", v.Summary)
+				}
+			}
+			return &exitError{
+				code: 1,
+				msg:  fmt.Sprintf("Found %d known vulnerabilities.", len(vulns)),
+			}
+		},
+	}
+	return auditCmd
+}
@@ -3,10 +3,14 @@ package cmd
 import (
 	"fmt"
 
+	"github.com/cszatmary/shed/cache"
 	"github.com/spf13/cobra"
 )
 
 func newCacheCommand(c *container) *cobra.Command {
+	var sizeBytes bool
+	var repair bool
+
 	cacheCmd := &cobra.Command{
 		Use:   "cache",
 		Short: "Manage cached tools.",
@@ -32,7 +36,91 @@ This is useful for removing any stale tools that are no longer needed.`,
 		},
 	}
 
+	cachePruneCmd := &cobra.Command{
+		Use:   "prune",
+		Args:  cobra.NoArgs,
+		Short: "Removes cached tools that are not in shed.lock.",
+		Long: `Removes all tools from the shed cache that are not in shed.lock, and prints each tool that was removed.
+Every version of a tool that is installed is kept in the cache, so this is useful for freeing up the space
+used by old versions after updating tools. Since the cache is shared between projects, tools that are only
+used by other projects are also removed, they will be re-installed the next time 'shed get' is run there.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			removed, err := c.shed.Prune()
+			for _, t := range removed {
+				fmt.Println(t)
+			}
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Removed %d tools\n", len(removed))
+			return nil
+		},
+	}
+
+	cacheSizeCmd := &cobra.Command{
+		Use:   "size",
+		Args:  cobra.NoArgs,
+		Short: "Prints the size of the shed cache.",
+		Long: `Prints the total size of all files in the shed cache directory in a human-readable format, for example '1.5G'.
+If the cache directory does not exist, the size is 0. Use the '--bytes' flag to print the exact size in bytes.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			size, err := c.shed.CacheSize()
+			if err != nil {
+				return err
+			}
+			if sizeBytes {
+				fmt.Println(size)
+				return nil
+			}
+			fmt.Println(formatSize(size))
+			return nil
+		},
+	}
+	cacheSizeCmd.Flags().BoolVar(&sizeBytes, "bytes", false, "print the size in bytes")
+
+	cacheVerifyCmd := &cobra.Command{
+		Use:   "verify",
+		Args:  cobra.NoArgs,
+		Short: "Checks the shed cache for corrupt tools.",
+		Long: `Checks every tool in the shed cache and prints each tool that is in a bad state. A tool is in a bad state
+if its go.mod is missing, invalid, or requires the wrong version, or if its binary is missing or not executable.
+This can happen if the cache was modified or an install was interrupted. Unlike 'shed verify', this checks all
+tools in the cache, not only the ones in shed.lock.
+
+The '--repair' flag downloads and builds each tool that is in a bad state again, for the same targets it was
+built for. Tools that were downloaded from a binary release and binaries built with build flags are removed
+instead, they will be downloaded or built again the next time 'shed get' is run.
+
+If any tools are in a bad state and were not repaired, shed exits with a non-zero status.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var opts []cache.VerifyOption
+			if repair {
+				opts = append(opts, cache.WithRepair())
+			}
+			bad, err := c.shed.VerifyCache(cmd.Context(), opts...)
+			for _, t := range bad {
+				fmt.Println(t)
+			}
+			if err != nil {
+				return err
+			}
+			if repair {
+				fmt.Printf("Repaired %d tools\n", len(bad))
+				return nil
+			}
+			if len(bad) > 0 {
+				msg := fmt.Sprintf("%d tools are in a bad state. Run '%s cache verify --repair' to repair them.", len(bad), cmd.Root().Name())
+				return &exitError{code: 1, msg: msg}
+			}
+			return nil
+		},
+	}
+	cacheVerifyCmd.Flags().BoolVar(&repair, "repair", false, "download and build tools in a bad state again")
+
 	cacheCmd.AddCommand(cacheCleanCmd)
 	cacheCmd.AddCommand(cacheDirCmd)
+	cacheCmd.AddCommand(cachePruneCmd)
+	cacheCmd.AddCommand(cacheSizeCmd)
+	cacheCmd.AddCommand(cacheVerifyCmd)
 	return cacheCmd
 }
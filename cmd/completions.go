@@ -32,8 +32,8 @@ For example to generate and use bash completions:
 				return &exitError{
 					code: 1,
 					msg: fmt.Sprintf(
-						"Invalid shell value %q. Run 'shed completions --help' to see supported shells.",
-						shell,
+						"Invalid shell value %q. Run '%s completions --help' to see supported shells.",
+						shell, cmd.Root().Name(),
 					),
 				}
 			}
@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/cszatmary/shed/lockfile"
+	"github.com/spf13/cobra"
+)
+
+func newDiffCommand(c *container) *cobra.Command {
+	diffCmd := &cobra.Command{
+		Use:   "diff <old> <new>",
+		Args:  cobra.ExactArgs(2),
+		Short: "Compare the tools in two lockfiles.",
+		Long: `shed diff prints the tools that were added, removed, or changed to a different version
+between two lockfiles. This is useful for reviewing changes to the tools used by a project.
+Tools are compared by import path and printed in order of import path.
+
+For example, to see how tools changed in the last commit:
+
+	git show HEAD~1:shed.lock > old.lock
+	shed diff old.lock shed.lock
+
+Which might print:
+
+	add golang.org/x/tools/cmd/goimports v0.1.5
+	update github.com/golangci/golangci-lint/cmd/golangci-lint v1.28.3 -> v1.33.0
+	remove github.com/cszatmary/go-fish v0.1.0`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			oldLf, err := readLockfile(c, args[0])
+			if err != nil {
+				return err
+			}
+			newLf, err := readLockfile(c, args[1])
+			if err != nil {
+				return err
+			}
+			d := oldLf.Diff(newLf)
+			if d.IsEmpty() {
+				fmt.Println("No changes")
+				return nil
+			}
+			for _, t := range d.Added {
+				fmt.Printf("add %s %s\n", t.ImportPath, t.Version)
+			}
+			for _, change := range d.Changed {
+				fmt.Printf("update %s %s -> %s\n", change.ImportPath, change.OldVersion, change.NewVersion)
+			}
+			for _, t := range d.Removed {
+				fmt.Printf("remove %s %s\n", t.ImportPath, t.Version)
+			}
+			return nil
+		},
+	}
+	return diffCmd
+}
+
+// readLockfile reads and parses the lockfile at path. If strict mode is used, unknown fields are not allowed.
+func readLockfile(c *container, path string) (*lockfile.Lockfile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lockfile %s: %w", path, err)
+	}
+	defer f.Close()
+	parse := lockfile.Parse
+	if c.opts.strict {
+		parse = lockfile.ParseStrict
+	}
+	lf, err := parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse lockfile %s: %w", path, err)
+	}
+	return lf, nil
+}
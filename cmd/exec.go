@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func newExecCommand(c *container) *cobra.Command {
+	execCmd := &cobra.Command{
+		Use:   "exec <tool> [args...]",
+		Args:  cobra.MinimumNArgs(1),
+		Short: "Install and run a tool without using a lockfile.",
+		Long: `shed exec installs a tool if necessary and runs it, passing all arguments to it.
+
+Unlike 'shed run', exec does not read or modify any lockfile. This is useful for one-off
+tool runs where the tool should not be added to a project. The tool is still installed
+in the shed cache so that subsequent runs of the same version are fast.
+
+The tool must be the full import path to the package containing the main executable.
+Tools may specify a version or module query by suffixing it with an '@', just like with 'go get'.
+If no version is provided, the latest version will be used.
+
+All arguments after the tool name will be passed to the tool as is, even if they are flags.
+An optional '--' may be used to separate the tool name from its arguments.
+
+For example to run the latest version of the stringer tool:
+
+	shed exec golang.org/x/tools/cmd/stringer@latest -- -type=Pill`,
+		Annotations: map[string]string{annotationNoLockfile: "true"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			toolName := args[0]
+			toolArgs := args[1:]
+			if len(toolArgs) > 0 && toolArgs[0] == "--" {
+				toolArgs = toolArgs[1:]
+			}
+
+			binPath, err := c.shed.InstallEphemeral(cmd.Context(), toolName)
+			if err != nil {
+				return err
+			}
+			c.logger.WithFields(logrus.Fields{
+				"tool": toolName,
+				"path": binPath,
+			}).Debugf("Found path for tool")
+
+			cwd, err := os.Getwd()
+			if err != nil {
+				return fmt.Errorf("unable to get current working directory: %w", err)
+			}
+			runTool(binPath, toolArgs, cwd)
+			return nil
+		},
+	}
+
+	// Stop parsing flags after first non-flag arg so we can pass them to the command being run
+	execCmd.Flags().SetInterspersed(false)
+	return execCmd
+}
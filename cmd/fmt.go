@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"github.com/cszatmary/shed/client"
+	"github.com/spf13/cobra"
+)
+
+func newFmtCommand(c *container) *cobra.Command {
+	var fmtOpts struct {
+		compact bool
+	}
+
+	fmtCmd := &cobra.Command{
+		Use:   "fmt",
+		Args:  cobra.NoArgs,
+		Short: "Format shed.lock.",
+		Long: `shed fmt rewrites shed.lock with tools sorted by import path. This is useful after editing shed.lock by hand.
+
+By default shed.lock is written as indented JSON. The '--compact' flag writes each tool on a single line instead,
+which makes shed.lock smaller and keeps diffs to one line per changed tool. This is useful for repositories with
+hundreds of tools. Once shed.lock is compact, shed keeps it compact when it is updated, for example by 'shed get'.
+Run 'shed fmt' without '--compact' to switch back to indented JSON.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := c.shed.FormatLockfile(client.FormatOptions{Compact: fmtOpts.compact}); err != nil {
+				return err
+			}
+			c.logger.Debugf("Formatted lockfile %s", c.shed.LockfilePath())
+			return nil
+		},
+	}
+
+	fmtCmd.Flags().BoolVar(&fmtOpts.compact, "compact", false, "write each tool on a single line")
+	return fmtCmd
+}
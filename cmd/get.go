@@ -1,18 +1,49 @@
 package cmd
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
 
+	"github.com/cszatmary/shed/cache"
 	"github.com/cszatmary/shed/client"
 	"github.com/cszatmary/shed/internal/spinner"
+	"github.com/cszatmary/shed/internal/util"
+	"github.com/cszatmary/shed/lockfile"
 	"github.com/cszatmary/shed/tool"
 	"github.com/spf13/cobra"
 )
 
 func newGetCommand(c *container) *cobra.Command {
 	var getOpts struct {
-		update      bool
-		concurrency int
+		update          bool
+		concurrency     int
+		planOut         string
+		dryRun          bool
+		from            string
+		toolsFile       string
+		toolsGo         string
+		merge           bool
+		resume          bool
+		keepGoing       bool
+		trace           bool
+		unify           bool
+		jsonLines       bool
+		minVersions     []string
+		direct          bool
+		reproducible    bool
+		buildFlags      []string
+		offlineFallback bool
+		force           bool
+		releaseRepo     string
+		releaseAsset    string
+		report          string
 	}
 
 	getCmd := &cobra.Command{
@@ -32,9 +63,21 @@ Tools can be uninstalled by using the special '@none' version suffix.
 
 If no tools are provided, then shed will simply install all tools in the lockfile.
 
+References to environment variables in tool names, like $VAR or ${VAR}, are expanded before the tools are parsed.
+This allows versions to be set from the environment, for example in CI. Quote the tool name so the shell doesn't
+expand it first. It is an error to reference a variable that is not set.
+
+	shed get 'golang.org/x/tools/cmd/stringer@${STRINGER_VERSION}'
+
+The '-g, --global' flag makes shed use the global lockfile in the user config directory instead of shed.lock in the
+current directory. This is useful for tools that are not tied to a project. Use '--global' with 'shed list' and
+'shed run' to list and run global tools.
+
 The '-u, --update' flag instructs get to update the provided tools to use newer minor or patch releases when available.
-If no tools are provided, all tools in the lockfile will be updated. When this flag is used, tools are not allowed
-to have a version suffix.
+If no tools are provided, all tools in the lockfile will be updated, except tools pinned to a commit with a pseudo-version
+or tools with a prerelease version, which are only updated if they are provided. When this flag is used, tools are not allowed
+to have a version suffix. A warning is printed if the Go toolchain is a prerelease, such as a release candidate
+or a development build. Use '--strict' to fail instead.
 
 Examples:
 
@@ -60,7 +103,126 @@ Update a specific tool to the latest minor or patch version:
 
 Update all tools in the lockfile to their latest minor or patch version:
 
-	shed get -u`,
+	shed get -u
+
+The '--from' flag installs all tools from another lockfile in addition to the provided tools. By default these tools
+are only installed and are not added to the lockfile, use the '--merge' flag to add them. If a tool in the other
+lockfile has a different version than in the lockfile, the tool must be provided explicitly with the desired version.
+
+	shed get --from ../other-project/shed.lock --merge
+
+The '--tools-file' flag installs the tools listed in a file in addition to the provided tools, similar to a pip
+requirements file. Each line is a tool with an optional version suffix, in the same format as the arguments to get.
+Blank lines and comments starting with '#' are ignored. The tools are added to the lockfile like any provided tool.
+
+	shed get --tools-file tools.txt
+
+The '--tools-go' flag installs the tools imported by a tools.go file, which tracks tool dependencies using blank
+imports in a file with a 'tools' build constraint. The version of each tool is taken from the go.mod of the module
+containing the file. This makes it easy to migrate from the tools.go pattern to shed.
+
+	shed get --tools-go tools.go
+
+The SHED_VERSIONS_FILE environment variable can be set to the path of a versions file, which is a YAML mapping of
+import paths to versions. Tools provided without a version are installed at the version from the file if it has one.
+This keeps the versions of tools consistent across the lockfiles of many projects, for example in a monorepo.
+
+	SHED_VERSIONS_FILE=../tool-versions.yaml shed get golang.org/x/tools/cmd/stringer
+
+The '--resume' flag records the progress of the install. If the install is interrupted or some tools fail to install,
+running 'shed get --resume' again will skip the tools that were already installed and only install the remaining ones.
+If the install used the '--force' flag, the remaining tools are also forced to be installed again when resuming.
+
+Tools that belong to the same module must use the same version of the module. If they don't, get will fail.
+The '--unify-modules' flag resolves this by installing all tools from the module using the highest version.
+Tools updated with '-u' are always unified with the other tools from their module.
+
+The '--min' flag upgrades a tool to the given version only if the version in the lockfile is lower.
+If the tool already has the same or a newer version it is left as is, so newer installs are never downgraded.
+This is useful for making sure tools include a security fix. The flag can be provided multiple times.
+
+	shed get --min golang.org/x/tools/cmd/stringer@v0.1.5
+
+The '--direct' flag downloads the provided tools directly from version control instead of through
+the module proxy, by setting GOPROXY=direct when downloading them. This is recorded in the lockfile so
+the tools are always downloaded directly, for example when installing from the lockfile on another machine.
+Only GOPROXY is changed, the checksums of the tools are still verified using the checksum database set by GOSUMDB.
+Private tools that are not in the checksum database must also be excluded by setting GONOSUMDB or GOPRIVATE.
+
+	shed get --direct example.com/internal/cmd/tool
+	GONOSUMDB=example.com/internal shed get --direct example.com/internal/cmd/tool
+
+The '--release-repo' and '--release-asset' flags download the provided tools as prebuilt binaries from a
+GitHub release instead of building them from source. This is for tools that can't be installed with 'go install'.
+The tools must have an exact version, which is used as the release tag. The asset name may contain the placeholders
+'{os}', '{arch}' and '{version}'. If the asset is a .tar.gz, .tgz or .zip archive, the file with the same name as
+the tool is extracted from it. This is recorded in the lockfile so the tools are always downloaded from the release.
+
+	shed get --release-repo golangci/golangci-lint --release-asset 'golangci-lint-{version}-{os}-{arch}.tar.gz' \
+		github.com/golangci/golangci-lint/cmd/golangci-lint@v1.42.1
+
+The '--reproducible' flag builds the provided tools reproducibly and records the SHA-256 hash of each binary
+in the lockfile, which 'shed verify' uses to check the installed binaries. Builds are only reproducible using the
+same OS, architecture and Go toolchain, so hashes are recorded separately for each platform and toolchain.
+Once a tool has a binary hash, it is always built reproducibly and its hash for the current platform is kept up to date.
+
+	shed get --reproducible golang.org/x/tools/cmd/stringer
+
+The '--build-flag' flag passes an extra flag to 'go build' when building the provided tools, for example to set
+-ldflags or build tags. It can be repeated to pass multiple flags, and each flag must include its value after an '='.
+Only -ldflags, -tags, -gcflags, -asmflags, -trimpath and -buildvcs are allowed, and -ldflags may only contain
+-X, -s and -w.
+The flags are recorded in the lockfile so the tools are always built with them. Changing the flags rebuilds the tools.
+
+	shed get --build-flag='-ldflags=-X main.version=v1.33.0' --build-flag=-tags=netgo \
+		github.com/golangci/golangci-lint/cmd/golangci-lint@v1.33.0
+
+The '--offline-fallback' flag makes shed use a version of a tool that is already in the cache if downloading
+it fails because of a network error, instead of failing. This only applies to tools that are being resolved
+to a new version, like when updating or installing without a version, since tools at an exact version are
+always installed at that version. The highest cached version is used and a warning is printed.
+
+	shed get -u --offline-fallback
+
+The '--force' flag makes shed download and build every tool again, even if it is already installed.
+This is useful if a binary is corrupt or was built with a different Go toolchain.
+
+	shed get --force golang.org/x/tools/cmd/stringer
+
+The '--report' flag writes a JSON summary of the install to the given file once it finishes, even if some
+tools failed to install. It contains the shed and Go versions, each installed tool with how long it took and
+whether it was already in the cache, and each failure. This is useful to upload as a CI artifact.
+
+	shed get --report report.json
+
+The '-c, --concurrency' flag sets how many tools are installed at the same time. If it is not provided, the value of
+the SHED_CONCURRENCY environment variable is used if set, otherwise the number of CPUs. Setting SHED_CONCURRENCY can
+help in containers, where the number of CPUs is often over-reported and too many parallel builds use too much memory.
+
+	SHED_CONCURRENCY=2 shed get
+
+The '--keep-going' flag skips invalid tools instead of failing the whole command. A warning is printed for each
+skipped tool and the remaining valid tools are still installed.
+
+The '--trace-commands' flag prints every go command that was run along with how long it took and its exit code
+after the install finishes. This is useful for debugging and for including in bug reports.
+
+The '--json-lines' flag prints the progress of the install to stdout as it happens instead of showing a spinner.
+Each line is a JSON object describing a single event, for example:
+
+	{"importPath":"golang.org/x/tools/cmd/stringer","version":"v0.1.5","phase":"downloaded"}
+
+The phase is one of: started, downloaded, built, skipped, removed, failed. Failed events also contain an "error" field.
+
+The '--plan-out' flag writes the changes that would be made to the lockfile to a file instead of installing
+the tools. The plan can be reviewed and later installed using 'shed apply'.
+
+	shed get --plan-out plan.json golang.org/x/tools/cmd/stringer
+
+The '--dry-run' flag prints the changes that would be made to the lockfile without installing any tools
+or modifying the lockfile. Tools without an exact version are shown with the query that would be resolved.
+
+	shed get --dry-run -u`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			if getOpts.concurrency < 0 {
 				return &exitError{
@@ -70,49 +232,408 @@ Update all tools in the lockfile to their latest minor or patch version:
 				}
 			}
 
-			installSet, err := c.shed.Get(client.GetOptions{
-				ToolNames: args,
-				Update:    getOpts.update,
-			})
+			if getOpts.dryRun && getOpts.planOut != "" {
+				return &exitError{
+					code: 1,
+					msg:  "The --dry-run and --plan-out flags cannot be used together.",
+				}
+			}
+			if getOpts.toolsFile != "" && getOpts.toolsGo != "" {
+				return &exitError{
+					code: 1,
+					msg:  "The --tools-file and --tools-go flags cannot be used together.",
+				}
+			}
+			if getOpts.merge && getOpts.from == "" {
+				return &exitError{
+					code: 1,
+					msg:  "The --merge flag can only be used with --from.",
+				}
+			}
+			if (getOpts.releaseRepo == "") != (getOpts.releaseAsset == "") {
+				return &exitError{
+					code: 1,
+					msg:  "The --release-repo and --release-asset flags must be used together.",
+				}
+			}
+			if getOpts.update {
+				if err := checkUpdateToolchain(cmd.Context(), c); err != nil {
+					return err
+				}
+			}
+			var from *lockfile.Lockfile
+			if getOpts.from != "" {
+				var err error
+				from, err = readLockfile(c, getOpts.from)
+				if err != nil {
+					return err
+				}
+			}
+
+			var statePath string
+			if getOpts.resume {
+				var err error
+				statePath, err = resumeStatePath(c.opts.lockfilePath)
+				if err != nil {
+					return err
+				}
+			}
+
+			var installSet *client.InstallSet
+			var err error
+			if statePath != "" && util.FileOrDirExists(statePath) {
+				if len(args) > 0 || from != nil || getOpts.toolsFile != "" || getOpts.toolsGo != "" || getOpts.update || len(getOpts.minVersions) > 0 || getOpts.direct || getOpts.reproducible || len(getOpts.buildFlags) > 0 || getOpts.releaseRepo != "" || getOpts.force {
+					return &exitError{
+						code: 1,
+						msg:  fmt.Sprintf("An incomplete install exists. Run '%s get --resume' without any tools or other options to resume it.", cmd.Root().Name()),
+					}
+				}
+				c.logger.Infof("Resuming previous install")
+				installSet, err = c.shed.Resume(statePath)
+			} else {
+				installSet, err = getInstallSet(c, getOpts.toolsFile, getOpts.toolsGo, client.GetOptions{
+					ToolNames:           args,
+					Update:              getOpts.update,
+					From:                from,
+					MergeFrom:           getOpts.merge,
+					KeepGoing:           getOpts.keepGoing,
+					UnifyModuleVersions: getOpts.unify,
+					MinVersions:         getOpts.minVersions,
+					Direct:              getOpts.direct,
+					Reproducible:        getOpts.reproducible,
+					BuildFlags:          getOpts.buildFlags,
+					BinaryRelease:       lockfile.BinaryRelease{Repo: getOpts.releaseRepo, Asset: getOpts.releaseAsset},
+				})
+			}
 			if err != nil {
 				return fmt.Errorf("unable to determine list of tools to install: %w", err)
 			}
 			installSet.Concurrency = uint(getOpts.concurrency)
+			installSet.StatePath = statePath
+			installSet.OfflineFallback = getOpts.offlineFallback
+			// A resumed install uses the force option of the install it continues, see client.Shed.Resume.
+			if getOpts.force {
+				installSet.Force = true
+			}
 
-			s := spinner.NewTTY(spinner.TTYOptions{
-				Options: spinner.Options{
-					Message:         "Installing tools",
-					Count:           installSet.Len(),
-					PersistMessages: c.opts.verbose,
-				},
-				IsaTTY: c.isaTTY,
-			})
-			prevOut := c.logger.Out
-			c.logger.Out = s
-
-			ch := make(chan tool.Tool, installSet.Len())
-			installSet.Notify(ch)
-			go func() {
-				for range ch {
-					s.Inc()
+			if getOpts.planOut != "" {
+				if err := writePlan(getOpts.planOut, installSet.Plan()); err != nil {
+					return err
 				}
-			}()
-
-			s.Start()
-			err = installSet.Apply(cmd.Context())
-			s.Stop()
-			close(ch)
-			c.logger.Out = prevOut
-
-			if err != nil {
-				return fmt.Errorf("failed to install tools: %w", err)
+				c.logger.Infof("Wrote install plan to %s", getOpts.planOut)
+				return nil
+			}
+			if getOpts.dryRun {
+				printPlan(installSet.Plan())
+				return nil
+			}
+			start := time.Now()
+			if getOpts.jsonLines {
+				err = applyInstallSetJSONLines(cmd.Context(), installSet)
+			} else {
+				err = applyInstallSet(cmd.Context(), c, installSet)
 			}
-			c.logger.Info("Finished installing tools")
-			return nil
+			if getOpts.report != "" {
+				// Always write the report, it is most useful when some installs failed.
+				if reportErr := writeReport(cmd.Context(), getOpts.report, installSet, time.Since(start)); reportErr != nil {
+					c.logger.WithError(reportErr).Error("Failed to write install report")
+				}
+			}
+			if getOpts.trace {
+				printCommands(c.commands.Commands())
+			}
+			return err
 		},
 	}
 
 	getCmd.Flags().BoolVarP(&getOpts.update, "update", "u", false, "update tools to their latest minor or patch version")
-	getCmd.Flags().IntVarP(&getOpts.concurrency, "concurrency", "c", 0, "amount of tasks to run concurrently (default: number of CPUs)")
+	getCmd.Flags().IntVarP(&getOpts.concurrency, "concurrency", "c", 0, "amount of tasks to run concurrently (default: $SHED_CONCURRENCY or number of CPUs)")
+	getCmd.Flags().StringVar(&getOpts.from, "from", "", "also install the tools from another lockfile")
+	getCmd.Flags().StringVar(&getOpts.toolsFile, "tools-file", "", "also install the tools listed in the given file, one per line")
+	getCmd.Flags().StringVar(&getOpts.toolsGo, "tools-go", "", "also install the tools imported by the given tools.go file")
+	getCmd.Flags().BoolVar(&getOpts.merge, "merge", false, "add the tools from --from to the lockfile")
+	getCmd.Flags().BoolVar(&getOpts.resume, "resume", false, "record progress so an incomplete install can be resumed")
+	getCmd.Flags().BoolVar(&getOpts.unify, "unify-modules", false, "use the highest version for tools from the same module")
+	getCmd.Flags().StringArrayVar(&getOpts.minVersions, "min", nil, "upgrade a tool to at least the given version, e.g. tool@v1.2.3")
+	getCmd.Flags().BoolVar(&getOpts.reproducible, "reproducible", false, "build the provided tools reproducibly and record the hash of each binary")
+	getCmd.Flags().StringArrayVar(&getOpts.buildFlags, "build-flag", nil, "pass a flag to go build when building the provided tools, e.g. -tags=netgo")
+	getCmd.Flags().BoolVar(&getOpts.direct, "direct", false, "download the provided tools directly from version control, bypassing the module proxy")
+	getCmd.Flags().StringVar(&getOpts.releaseRepo, "release-repo", "", "download the provided tools from a release of the given GitHub repo, e.g. OWNER/NAME")
+	getCmd.Flags().StringVar(&getOpts.releaseAsset, "release-asset", "", "name of the release asset containing the binary, used with --release-repo")
+	getCmd.Flags().BoolVar(&getOpts.offlineFallback, "offline-fallback", false, "use a cached version of a tool if it cannot be downloaded because of a network error")
+	getCmd.Flags().BoolVar(&getOpts.force, "force", false, "download and build tools again even if they are already installed")
+	getCmd.Flags().BoolVar(&getOpts.keepGoing, "keep-going", false, "skip invalid tools instead of failing")
+	getCmd.Flags().BoolVar(&getOpts.trace, "trace-commands", false, "print all go commands that were run")
+	getCmd.Flags().BoolVar(&getOpts.jsonLines, "json-lines", false, "print install progress events as JSON lines")
+	getCmd.Flags().StringVar(&getOpts.report, "report", "", "write a JSON summary of the install to the given file")
+	getCmd.Flags().StringVar(&getOpts.planOut, "plan-out", "", "write the install plan to the given file instead of installing")
+	getCmd.Flags().BoolVar(&getOpts.dryRun, "dry-run", false, "print the changes that would be made to the lockfile instead of installing")
 	return getCmd
 }
+
+// getInstallSet computes the tools to install using opts. If toolsFile is not empty,
+// the tools listed in it are also installed. If toolsGo is not empty, the tools imported
+// by the tools.go file at that path are also installed.
+func getInstallSet(c *container, toolsFile, toolsGo string, opts client.GetOptions) (*client.InstallSet, error) {
+	if toolsGo != "" {
+		return c.shed.GetFromToolsFile(toolsGo, opts)
+	}
+	if toolsFile == "" {
+		return c.shed.Get(opts)
+	}
+	f, err := os.Open(toolsFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open tools file %s: %w", toolsFile, err)
+	}
+	defer f.Close()
+	return c.shed.GetFromReader(f, opts)
+}
+
+// applyInstallSet applies installSet while showing the progress with a spinner.
+func applyInstallSet(ctx context.Context, c *container, installSet *client.InstallSet) error {
+	s := spinner.NewTTY(spinner.TTYOptions{
+		Options: spinner.Options{
+			Message:         "Installing tools",
+			Count:           installSet.Len(),
+			PersistMessages: c.opts.verbose,
+			Frames:          c.spinnerFrames,
+		},
+		IsaTTY: c.isaTTY,
+	})
+	prevOut := c.logger.Out
+	c.logger.Out = s
+	c.progress.set(spinnerMessageWriter{s})
+
+	ch := make(chan tool.Tool, installSet.Len())
+	installSet.Notify(ch)
+	go func() {
+		for range ch {
+			s.Inc()
+		}
+	}()
+
+	s.Start()
+	err := installSet.Apply(ctx)
+	s.Stop()
+	close(ch)
+	c.progress.set(nil)
+	c.logger.Out = prevOut
+
+	if err != nil {
+		return fmt.Errorf("failed to install tools: %w", err)
+	}
+	for _, r := range installSet.Results() {
+		if r.AlreadySatisfied {
+			c.logger.Infof("%s already installed", r.Tool)
+		}
+	}
+	c.logger.Info("Finished installing tools")
+	return nil
+}
+
+// spinnerMessageWriter is an io.Writer that shows each line written to it as the spinner message.
+type spinnerMessageWriter struct {
+	s *spinner.TTYSpinner
+}
+
+func (w spinnerMessageWriter) Write(p []byte) (int, error) {
+	for _, line := range strings.Split(strings.TrimSuffix(string(p), "\n"), "\n") {
+		w.s.UpdateMessage(line)
+	}
+	return len(p), nil
+}
+
+// checkUpdateToolchain warns if the go toolchain is a prerelease, since resolving updates with an
+// unstable toolchain can give surprising results. If strict mode is used, an error is returned instead.
+func checkUpdateToolchain(ctx context.Context, c *container) error {
+	toolchain, err := cache.GoToolchain(ctx)
+	if err != nil {
+		return err
+	}
+	if !cache.IsPrereleaseToolchain(toolchain) {
+		return nil
+	}
+	if c.opts.strict {
+		return &exitError{
+			code: 1,
+			msg:  fmt.Sprintf("Refusing to update tools with prerelease Go toolchain %s since --strict was used.", toolchain),
+		}
+	}
+	c.logger.Warnf("Go toolchain %s is a prerelease, updates may resolve differently than with a stable release", toolchain)
+	return nil
+}
+
+// installEventJSON is the JSON representation of a client.InstallEvent.
+type installEventJSON struct {
+	ImportPath string `json:"importPath"`
+	Version    string `json:"version,omitempty"`
+	Phase      string `json:"phase"`
+	Error      string `json:"error,omitempty"`
+}
+
+// applyInstallSetJSONLines applies installSet while printing each progress event to stdout as a line of JSON.
+func applyInstallSetJSONLines(ctx context.Context, installSet *client.InstallSet) error {
+	ch := make(chan client.InstallEvent, installSet.Len())
+	installSet.NotifyEvents(ch)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// stdout is not buffered so each event is written as soon as it is received
+		enc := json.NewEncoder(os.Stdout)
+		for e := range ch {
+			ej := installEventJSON{ImportPath: e.Tool.ImportPath, Version: e.Tool.Version, Phase: e.Phase.String()}
+			if e.Err != nil {
+				ej.Error = e.Err.Error()
+			}
+			// Nothing useful can be done if stdout can't be written to
+			_ = enc.Encode(ej)
+		}
+	}()
+
+	err := installSet.Apply(ctx)
+	close(ch)
+	<-done
+	if err != nil {
+		return fmt.Errorf("failed to install tools: %w", err)
+	}
+	return nil
+}
+
+// printCommands prints each command in cmds to stderr.
+func printCommands(cmds []cache.Command) {
+	for _, cmd := range cmds {
+		dir := cmd.Dir
+		if dir == "" {
+			dir = "."
+		}
+		fmt.Fprintf(
+			os.Stderr,
+			"go %s (dir: %s, duration: %s, exit code: %d)\n",
+			strings.Join(cmd.Args, " "), dir, cmd.Duration.Round(time.Millisecond), cmd.ExitCode,
+		)
+		for _, env := range cmd.Env {
+			fmt.Fprintf(os.Stderr, "\t%s\n", env)
+		}
+	}
+}
+
+// resumeStatePath returns the path to the file used to record the progress of installs
+// for the lockfile at lockfilePath.
+func resumeStatePath(lockfilePath string) (string, error) {
+	absPath, err := filepath.Abs(lockfilePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to get absolute path of %s: %w", lockfilePath, err)
+	}
+	sum := sha256.Sum256([]byte(absPath))
+	return filepath.Join(os.TempDir(), fmt.Sprintf("shed-install-%x.json", sum[:8])), nil
+}
+
+// installReport is a summary of an install that is written by the --report flag.
+type installReport struct {
+	ShedVersion string `json:"shedVersion"`
+	GoVersion   string `json:"goVersion"`
+	// DurationMs is how long the whole install took in milliseconds.
+	DurationMs  int64              `json:"durationMs"`
+	CacheHits   int                `json:"cacheHits"`
+	CacheMisses int                `json:"cacheMisses"`
+	Tools       []reportTool       `json:"tools"`
+	Failures    []reportToolFailed `json:"failures"`
+}
+
+type reportTool struct {
+	ImportPath       string `json:"importPath"`
+	Version          string `json:"version"`
+	DurationMs       int64  `json:"durationMs"`
+	CacheHit         bool   `json:"cacheHit"`
+	AlreadySatisfied bool   `json:"alreadySatisfied"`
+}
+
+type reportToolFailed struct {
+	ImportPath string `json:"importPath"`
+	Version    string `json:"version,omitempty"`
+	DurationMs int64  `json:"durationMs"`
+	Error      string `json:"error"`
+}
+
+// writeReport writes a summary of the install performed by installSet to the file at path.
+// It must be called after installSet has been applied.
+func writeReport(ctx context.Context, path string, installSet *client.InstallSet, d time.Duration) error {
+	report := installReport{
+		ShedVersion: version,
+		DurationMs:  d.Milliseconds(),
+		Tools:       []reportTool{},
+		Failures:    []reportToolFailed{},
+	}
+	// The Go version is informational, so don't fail if it can't be determined.
+	if toolchain, err := cache.GoToolchain(ctx); err == nil {
+		report.GoVersion = toolchain
+	}
+	for _, r := range installSet.Results() {
+		if r.CacheHit {
+			report.CacheHits++
+		} else {
+			report.CacheMisses++
+		}
+		report.Tools = append(report.Tools, reportTool{
+			ImportPath:       r.Tool.ImportPath,
+			Version:          r.Tool.Version,
+			DurationMs:       r.Duration.Milliseconds(),
+			CacheHit:         r.CacheHit,
+			AlreadySatisfied: r.AlreadySatisfied,
+		})
+	}
+	for _, f := range installSet.Failures() {
+		report.Failures = append(report.Failures, reportToolFailed{
+			ImportPath: f.Tool.ImportPath,
+			Version:    f.Tool.Version,
+			DurationMs: f.Duration.Milliseconds(),
+			Error:      f.Err.Error(),
+		})
+	}
+	// Results are in the order the tools finished, sort them so reports are easy to compare.
+	sort.Slice(report.Tools, func(i, j int) bool {
+		return report.Tools[i].ImportPath < report.Tools[j].ImportPath
+	})
+	sort.Slice(report.Failures, func(i, j int) bool {
+		return report.Failures[i].ImportPath < report.Failures[j].ImportPath
+	})
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to serialize install report: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write install report to %s: %w", path, err)
+	}
+	return nil
+}
+
+// printPlan prints each change in plan to stdout.
+func printPlan(plan *client.Plan) {
+	if len(plan.Changes) == 0 {
+		fmt.Println("No changes")
+		return
+	}
+	for _, change := range plan.Changes {
+		switch change.Action {
+		case client.PlanAdd:
+			fmt.Printf("add %s %s\n", change.ImportPath, change.Version)
+		case client.PlanUpdate:
+			fmt.Printf("update %s %s -> %s\n", change.ImportPath, change.CurrentVersion, change.Version)
+		case client.PlanRemove:
+			fmt.Printf("remove %s %s\n", change.ImportPath, change.CurrentVersion)
+		}
+	}
+}
+
+// writePlan serializes plan as JSON and writes it to the file at path.
+func writePlan(path string, plan *client.Plan) error {
+	data, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to serialize install plan: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write install plan to %s: %w", path, err)
+	}
+	return nil
+}
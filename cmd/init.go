@@ -19,7 +19,8 @@ func newInitCommand(c *container) *cobra.Command {
 In most cases this isn't necessary as shed will automatically create a lockfile when shed get is run.
 
 In some situations however, it may be desirable to explicitly create the lockfile. One reason for this is to
-setup shed in a subdirectory of a project. shed will automatically check parent directories for lockfiles.
+setup shed in a subdirectory of a project. shed will automatically check parent directories for lockfiles,
+stopping at the root of the git repository (the directory containing .git).
 If you wish to have shed get update a lockfile in a subdirectory instead of a parent directory,
 you can use shed init to create a new lockfile.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
 
 	"github.com/cszatmary/shed/client"
@@ -10,12 +11,16 @@ import (
 func newListCommand(c *container) *cobra.Command {
 	var listOpts struct {
 		showUpdates bool
+		majorLock   bool
 		concurrency int
+		sort        string
+		format      string
+		links       bool
 	}
 
 	listCmd := &cobra.Command{
-		Use:   "list",
-		Args:  cobra.NoArgs,
+		Use:   "list [filter]",
+		Args:  cobra.MaximumNArgs(1),
 		Short: "List Go tools specified in shed.lock.",
 		Long: `shed list prints a list of tools specified in shed.lock. Each tool will consist of the import path and the version.
 
@@ -24,7 +29,37 @@ If a newer version is found for a tool, shed will print it in brackets after the
 
 For example, 'shed list -u' might print:
 
-	golang.org/x/tools/cmd/stringer v0.1.0 [v0.1.5]`,
+	golang.org/x/tools/cmd/stringer v0.1.0 [v0.1.5]
+
+An optional filter can be provided to only list tools with a matching import path. If the filter ends with '/...'
+it matches all import paths with that prefix. If it contains a glob character ('*', '?', or '[') it is matched
+against the whole import path, where '*' does not match '/'. Otherwise it matches import paths containing the filter.
+The filter can be combined with other flags, for example to only check updates for tools in golang.org/x:
+
+	shed list -u 'golang.org/x/...'
+
+The '--major-lock' flag can be used with '-u' to only show upgrades that have the same major version as the
+current version of each tool. This avoids suggesting upgrades that may contain breaking changes.
+
+The '--sort' flag sets the order tools are printed in. Valid values are 'path' to sort by import path and
+'name' to sort by tool name, i.e. the name of the binary. The default is 'path'.
+
+The '--links' flag prints a link to the source repository of each tool after its version. Links are only
+printed for tools hosted on github.com, gitlab.com, or golang.org/x. For example, 'shed list --links' might print:
+
+	golang.org/x/tools/cmd/stringer v0.1.0 https://go.googlesource.com/tools
+
+The '--format' flag sets how tools are printed. Valid values are 'text' for the format shown above, and 'json'
+to print a JSON array of objects with the fields 'importPath', 'version', and 'latestVersion', which is omitted
+if no newer version was found. For example, 'shed list --format json -u' might print:
+
+	[
+	  {
+	    "importPath": "golang.org/x/tools/cmd/stringer",
+	    "version": "v0.1.0",
+	    "latestVersion": "v0.1.5"
+	  }
+	]`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			if listOpts.concurrency < 0 {
 				return &exitError{
@@ -34,25 +69,74 @@ For example, 'shed list -u' might print:
 				}
 			}
 
+			if listOpts.format != "text" && listOpts.format != "json" {
+				return &exitError{
+					code: 1,
+					msg:  fmt.Sprintf("Invalid format value '%s', valid values are 'text' or 'json'.", listOpts.format),
+				}
+			}
+
+			var sortOrder client.SortOrder
+			switch listOpts.sort {
+			case "path":
+				sortOrder = client.SortByPath
+			case "name":
+				sortOrder = client.SortByName
+			default:
+				return &exitError{
+					code: 1,
+					msg:  fmt.Sprintf("Invalid sort value '%s', valid values are 'path' or 'name'.", listOpts.sort),
+				}
+			}
+
+			var filter string
+			if len(args) > 0 {
+				filter = args[0]
+			}
 			tools, err := c.shed.List(cmd.Context(), client.ListOptions{
 				ShowUpdates: listOpts.showUpdates,
+				MajorLock:   listOpts.majorLock,
 				Concurrency: uint(listOpts.concurrency),
+				Sort:        sortOrder,
+				Filter:      filter,
 			})
 			if err != nil {
 				return err
 			}
+			if listOpts.format == "json" {
+				if tools == nil {
+					// Print an empty array instead of null
+					tools = []client.ToolInfo{}
+				}
+				data, err := json.MarshalIndent(tools, "", "  ")
+				if err != nil {
+					return fmt.Errorf("failed to marshal tools: %w", err)
+				}
+				fmt.Println(string(data))
+				return nil
+			}
 			for _, info := range tools {
+				line := fmt.Sprintf("%s %s", info.Tool.ImportPath, info.Tool.Version)
 				if info.LatestVersion != "" {
-					fmt.Printf("%s %s [%s]\n", info.Tool.ImportPath, info.Tool.Version, info.LatestVersion)
-					continue
+					line += fmt.Sprintf(" [%s]", info.LatestVersion)
+				}
+				if listOpts.links {
+					// Not all hosts are supported, just omit the link for those tools
+					if url, err := info.Tool.RepoURL(); err == nil {
+						line += " " + url
+					}
 				}
-				fmt.Printf("%s %s\n", info.Tool.ImportPath, info.Tool.Version)
+				fmt.Println(line)
 			}
 			return nil
 		},
 	}
 
 	listCmd.Flags().BoolVarP(&listOpts.showUpdates, "updates", "u", false, "show latest available version for each tool")
-	listCmd.Flags().IntVarP(&listOpts.concurrency, "concurrency", "c", 0, "amount of tasks to run concurrently (default: number of CPUs)")
+	listCmd.Flags().BoolVar(&listOpts.majorLock, "major-lock", false, "only show updates with the same major version")
+	listCmd.Flags().IntVarP(&listOpts.concurrency, "concurrency", "c", 0, "amount of tasks to run concurrently (default: $SHED_CONCURRENCY or number of CPUs)")
+	listCmd.Flags().StringVar(&listOpts.sort, "sort", "path", "order to list tools in, valid values: path, name")
+	listCmd.Flags().StringVar(&listOpts.format, "format", "text", "output format, valid values: text, json")
+	listCmd.Flags().BoolVar(&listOpts.links, "links", false, "print a link to the source repository of each tool")
 	return listCmd
 }
@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/cszatmary/shed/client"
+	"github.com/spf13/cobra"
+)
+
+// exitCodeOutdated is the status shed outdated exits with if any tools are outdated.
+// It is different from the status used for errors, so that scripts can tell outdated tools apart from a failure.
+const exitCodeOutdated = 2
+
+func newOutdatedCommand(c *container) *cobra.Command {
+	var outdatedOpts struct {
+		concurrency int
+		majorLock   bool
+	}
+
+	outdatedCmd := &cobra.Command{
+		Use:   "outdated",
+		Args:  cobra.NoArgs,
+		Short: "Check if any tools in shed.lock have newer versions.",
+		Long: `shed outdated prints the tools in shed.lock that have a newer version available, using the same format as
+'shed list -u'. Tools that are up to date, or pinned to a commit with a pseudo-version, are not printed.
+If any tools are outdated, shed exits with status 2, which makes it possible to fail a CI build
+when tools have drifted. Other errors exit with status 1.
+
+For example, 'shed outdated' might print:
+
+	golang.org/x/tools/cmd/stringer v0.1.0 [v0.1.5]
+
+The '--major-lock' flag only considers newer versions that have the same major version as the current
+version of each tool. This allows ignoring new major versions, which may contain breaking changes.
+
+Run 'shed get -u' to update the outdated tools.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if outdatedOpts.concurrency < 0 {
+				return &exitError{
+					code: 1,
+					msg:  "Concurrency value must be a positive integer.",
+					err:  fmt.Errorf(`invalid value %d for concurrency flag`, outdatedOpts.concurrency),
+				}
+			}
+
+			tools, err := c.shed.List(cmd.Context(), client.ListOptions{
+				ShowUpdates: true,
+				Concurrency: uint(outdatedOpts.concurrency),
+				MajorLock:   outdatedOpts.majorLock,
+			})
+			if err != nil {
+				return err
+			}
+			outdated := 0
+			for _, info := range tools {
+				if info.LatestVersion == "" {
+					continue
+				}
+				outdated++
+				fmt.Printf("%s %s [%s]\n", info.Tool.ImportPath, info.Tool.Version, info.LatestVersion)
+			}
+			if outdated > 0 {
+				return &exitError{
+					code: exitCodeOutdated,
+					msg:  fmt.Sprintf("%d of %d tools are outdated. Run '%s get -u' to update them.", outdated, len(tools), cmd.Root().Name()),
+				}
+			}
+			return nil
+		},
+	}
+
+	outdatedCmd.Flags().IntVarP(&outdatedOpts.concurrency, "concurrency", "c", 0, "amount of tasks to run concurrently (default: $SHED_CONCURRENCY or number of CPUs)")
+	outdatedCmd.Flags().BoolVar(&outdatedOpts.majorLock, "major-lock", false, "only check for updates with the same major version")
+	return outdatedCmd
+}
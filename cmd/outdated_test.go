@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cszatmary/shed/cache"
+	"github.com/cszatmary/shed/client"
+	"github.com/cszatmary/shed/lockfile"
+	"github.com/cszatmary/shed/tool"
+)
+
+func TestOutdatedExitCode(t *testing.T) {
+	tests := []struct {
+		name     string
+		tool     tool.Tool
+		wantCode int
+	}{
+		{
+			name:     "outdated",
+			tool:     tool.Tool{ImportPath: "github.com/Shopify/ejson/cmd/ejson", Version: "v1.1.0"},
+			wantCode: exitCodeOutdated,
+		},
+		{
+			name: "up to date",
+			tool: tool.Tool{ImportPath: "github.com/Shopify/ejson/cmd/ejson", Version: "v1.2.2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			td := t.TempDir()
+			mockGo, err := cache.NewMockGo(map[string]map[string]string{
+				"github.com/Shopify/ejson/cmd/ejson": {
+					"v1.1.0": "v1.1.0",
+					"v1.2.2": "v1.2.2",
+				},
+			})
+			if err != nil {
+				t.Fatalf("failed to create mock go %v", err)
+			}
+			ca := cache.New(filepath.Join(td, "cache"), cache.WithGo(mockGo))
+			if _, err := ca.Install(context.Background(), tt.tool); err != nil {
+				t.Fatalf("failed to install tool %v", err)
+			}
+
+			lf := &lockfile.Lockfile{}
+			if err := lf.PutTool(tt.tool); err != nil {
+				t.Fatalf("failed to add tool %v to lockfile: %v", tt.tool, err)
+			}
+			lockfilePath := filepath.Join(td, "shed.lock")
+			f, err := os.Create(lockfilePath)
+			if err != nil {
+				t.Fatalf("failed to create %s, %v", lockfilePath, err)
+			}
+			if _, err := lf.WriteTo(f); err != nil {
+				f.Close()
+				t.Fatalf("failed to write lockfile, %v", err)
+			}
+			f.Close()
+
+			var c container
+			c.shed, err = client.NewShed(client.WithLockfilePath(lockfilePath), client.WithCache(ca))
+			if err != nil {
+				t.Fatalf("failed to create shed client %v", err)
+			}
+			outdatedCmd := newOutdatedCommand(&c)
+			outdatedCmd.SetArgs([]string{})
+			err = outdatedCmd.ExecuteContext(context.Background())
+			if tt.wantCode == 0 {
+				if err != nil {
+					t.Fatalf("want nil error, got %v", err)
+				}
+				return
+			}
+			ee, ok := err.(*exitError)
+			if !ok {
+				t.Fatalf("got error %v, want *exitError", err)
+			}
+			if ee.code != tt.wantCode {
+				t.Errorf("got exit code %d, want %d", ee.code, tt.wantCode)
+			}
+		})
+	}
+}
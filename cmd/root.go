@@ -3,14 +3,22 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"runtime"
 	"runtime/debug"
+	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/cszatmary/shed/cache"
 	"github.com/cszatmary/shed/client"
 	"github.com/cszatmary/shed/errors"
+	"github.com/cszatmary/shed/internal/spinner"
+	"github.com/cszatmary/shed/lockfile"
+	"github.com/cszatmary/shed/tool"
 	"github.com/mattn/go-isatty"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -42,6 +50,9 @@ func Execute() {
 	if ee, ok := err.(*exitError); ok {
 		c.exitf(ee.code, ee.err, ee.msg)
 	}
+	if hint := toolNameHint(err); hint != "" {
+		c.exitf(1, err, hint)
+	}
 	if rootErr := errors.Root(err); rootErr != nil {
 		// Determine a message to show the user to offer help/suggestions.
 		var msg string
@@ -52,9 +63,9 @@ func Execute() {
 				cmd.CommandPath(),
 			)
 		case errors.NotInstalled:
-			msg = "Run 'shed get' to install the tool(s)."
+			msg = fmt.Sprintf("Run '%s get' to install the tool(s).", rootCmd.Name())
 		case errors.BadState:
-			msg = "Run 'shed get' to have shed resolve the issue and then try again."
+			msg = fmt.Sprintf("Run '%[1]s get' to have %[1]s resolve the issue and then try again.", rootCmd.Name())
 		case errors.Internal:
 			msg = `This is likely a bug. Try running the command again with the '--verbose' flag for more details.
 If the issue persists, consider reporting it at https://github.com/cszatmary/shed/issues.`
@@ -77,18 +88,92 @@ If the issue persists, consider reporting it at https://github.com/cszatmary/she
 	}
 }
 
+// toolNameHint returns a suggestion for how to fix an invalid tool name if err was caused by one.
+// err may wrap an errors.List, in which case the first invalid tool name is used.
+// If err was not caused by an invalid tool name, an empty string is returned.
+func toolNameHint(err error) string {
+	var errs errors.List
+	if !errors.As(err, &errs) {
+		errs = errors.List{err}
+	}
+	for _, e := range errs {
+		if errors.Is(e, tool.ErrInvalidVersion) {
+			return `The version after the '@' must be a semantic version like 'v1.2.3' or a module query like 'latest'.
+To install the latest version of a tool, drop the '@' and the version.`
+		}
+		if errors.Is(e, tool.ErrInvalidImportPath) {
+			return "Tools must be the full import path of the package containing the tool, for example 'golang.org/x/tools/cmd/stringer'."
+		}
+	}
+	return ""
+}
+
 // container stores all the dependencies that can be used by commands.
 type container struct {
 	logger *logrus.Logger
 	shed   *client.Shed
 	isaTTY bool
-	opts   struct {
-		verbose      bool
-		progressMode string
-		lockfilePath string
+	// spinnerFrames are the frames used by progress spinners.
+	spinnerFrames []string
+	// commands records all go commands run by shed.
+	commands commandLog
+	// progress receives install progress messages from the cache.
+	progress progressWriter
+	opts     struct {
+		verbose       bool
+		progressMode  string
+		lockfilePath  string
+		lockfileFlag  string
+		global        bool
+		strict        bool
+		versionFormat string
+		importGuard   string
 	}
 }
 
+// commandLog is a cache.Recorder that keeps all commands in memory.
+type commandLog struct {
+	mu   sync.Mutex
+	cmds []cache.Command
+}
+
+func (cl *commandLog) Record(cmd cache.Command) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	cl.cmds = append(cl.cmds, cmd)
+}
+
+// Commands returns all commands recorded so far.
+func (cl *commandLog) Commands() []cache.Command {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	return append([]cache.Command(nil), cl.cmds...)
+}
+
+// progressWriter is an io.Writer that forwards writes to another writer that can be changed at any time.
+// This allows the cache to be created before it is known where progress should be shown.
+// Writes are discarded if no writer is set.
+type progressWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (pw *progressWriter) Write(p []byte) (int, error) {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	if pw.w == nil {
+		return len(p), nil
+	}
+	return pw.w.Write(p)
+}
+
+// set changes the writer that writes are forwarded to. If w is nil, writes are discarded.
+func (pw *progressWriter) set(w io.Writer) {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	pw.w = w
+}
+
 // exitf prints the given message to stderr then exits the program.
 // It supports printf like formatting. If err is not nil it is also printed.
 func (c *container) exitf(code int, err error, format string, a ...interface{}) {
@@ -113,6 +198,50 @@ func (c *container) exitf(code int, err error, format string, a ...interface{})
 	os.Exit(code)
 }
 
+// parseSize parses a size in bytes. The size may optionally have a K, M, or G suffix
+// which multiplies the size by the corresponding power of 1024.
+func parseSize(s string) (int64, error) {
+	multiplier := int64(1)
+	switch strings.ToUpper(s[len(s)-1:]) {
+	case "K":
+		multiplier = 1 << 10
+	case "M":
+		multiplier = 1 << 20
+	case "G":
+		multiplier = 1 << 30
+	}
+	if multiplier != 1 {
+		s = s[:len(s)-1]
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if n < 0 {
+		return 0, fmt.Errorf("size must not be negative")
+	}
+	return n * multiplier, nil
+}
+
+// formatSize formats size in bytes as a human-readable string using the same suffixes as parseSize.
+// Sizes of at least 1K use the largest suffix possible, for example '1.5M'.
+func formatSize(size int64) string {
+	const unit = 1 << 10
+	if size < unit {
+		return fmt.Sprintf("%dB", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit && exp < 2; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%c", float64(size)/float64(div), "KMG"[exp])
+}
+
+// annotationNoLockfile is a command annotation that signals that the command
+// does not use a lockfile.
+const annotationNoLockfile = "shed_no_lockfile"
+
 // exitError is used to signal that shed should exit with a given code and message.
 type exitError struct {
 	code int
@@ -124,6 +253,43 @@ func (e *exitError) Error() string {
 	return e.msg
 }
 
+// programName returns the name of the shed binary that is running. It is used in suggested commands,
+// so they are correct if shed is renamed or embedded under another name. If the name cannot be
+// determined, 'shed' is returned.
+func programName() string {
+	if len(os.Args) == 0 || os.Args[0] == "" {
+		return "shed"
+	}
+	name := filepath.Base(os.Args[0])
+	name = strings.TrimSuffix(name, filepath.Ext(name))
+	if name == "" || name == "." || name == string(filepath.Separator) {
+		return "shed"
+	}
+	return name
+}
+
+// noColor reports whether the NO_COLOR environment variable is set to disable colour output.
+// See https://no-color.org.
+func noColor() bool {
+	v, ok := os.LookupEnv("NO_COLOR")
+	return ok && v != ""
+}
+
+// supportsUTF8 reports whether the locale indicates that the terminal supports UTF-8.
+// The locale is determined from LC_ALL, LC_CTYPE and LANG in that order of precedence.
+// On Windows, where these are usually unset, UTF-8 is assumed to be supported.
+func supportsUTF8() bool {
+	for _, k := range []string{"LC_ALL", "LC_CTYPE", "LANG"} {
+		v := os.Getenv(k)
+		if v == "" {
+			continue
+		}
+		v = strings.ToLower(v)
+		return strings.Contains(v, "utf-8") || strings.Contains(v, "utf8")
+	}
+	return runtime.GOOS == "windows"
+}
+
 func newRootCommand(c *container) *cobra.Command {
 	// Set version if built from source
 	if version == "" {
@@ -134,7 +300,7 @@ func newRootCommand(c *container) *cobra.Command {
 	}
 
 	rootCmd := &cobra.Command{
-		Use:     "shed",
+		Use:     programName(),
 		Version: version,
 		Short:   "shed is a CLI for easily managing Go tool dependencies.",
 		CompletionOptions: cobra.CompletionOptions{
@@ -166,7 +332,8 @@ func newRootCommand(c *container) *cobra.Command {
 				// Need to force colours since the decision of whether or not to use colour
 				// is made lazily the first time a log is written, and Out may be changed
 				// to a spinner before then.
-				ForceColors: isaTTY,
+				ForceColors:   isaTTY && !noColor(),
+				DisableColors: noColor(),
 			})
 
 			// Check that go is installed with the minimum required version
@@ -183,14 +350,96 @@ func newRootCommand(c *container) *cobra.Command {
 			}
 			logger.Debugf("Go version is %s", goVersion)
 
-			// Find the nearest shed lockfile if it exists
-			cwd, err := os.Getwd()
-			if err != nil {
-				return fmt.Errorf("unable to get current working directory: %w", err)
+			shedOpts := []client.Option{
+				client.WithLogger(logger),
+				client.WithCacheOptions(cache.WithCommandRecorder(&c.commands), cache.WithProgressWriter(&c.progress)),
+			}
+			if v, ok := os.LookupEnv("SHED_CACHE_MAX_SIZE"); ok && v != "" {
+				maxSize, err := parseSize(v)
+				if err != nil {
+					return &exitError{
+						code: 1,
+						msg:  fmt.Sprintf("Invalid value %q for SHED_CACHE_MAX_SIZE. It must be a size in bytes, optionally with a K, M, or G suffix.", v),
+						err:  err,
+					}
+				}
+				logger.Debugf("Using max cache size %d", maxSize)
+				shedOpts = append(shedOpts, client.WithCacheOptions(cache.WithMaxSize(maxSize)))
+			}
+			if v := os.Getenv("SHED_WORK_DIR"); v != "" {
+				logger.Debugf("Using work dir %s", v)
+				shedOpts = append(shedOpts, client.WithCacheOptions(cache.WithWorkDir(v)))
 			}
-			lfp := client.ResolveLockfilePath(cwd)
-			logger.Debugf("Found lockfile: %s", lfp)
-			shed, err := client.NewShed(client.WithLogger(logger), client.WithLockfilePath(lfp))
+			if v := os.Getenv("SHED_VERSIONS_FILE"); v != "" {
+				vf, err := client.ReadVersionsFile(v)
+				if err != nil {
+					return &exitError{
+						code: 1,
+						msg:  fmt.Sprintf("Invalid versions file %s set by SHED_VERSIONS_FILE.", v),
+						err:  err,
+					}
+				}
+				logger.Debugf("Using versions file %s", v)
+				shedOpts = append(shedOpts, client.WithVersionResolver(vf))
+			}
+			if c.opts.strict {
+				shedOpts = append(shedOpts, client.WithStrictLockfile())
+			}
+			switch c.opts.versionFormat {
+			case "exact":
+			case "canonical":
+				shedOpts = append(shedOpts, client.WithVersionFormat(lockfile.VersionFormatCanonical))
+			default:
+				return fmt.Errorf("invalid version-format flag value '%s', valid values are 'exact' or 'canonical'", c.opts.versionFormat)
+			}
+			switch c.opts.importGuard {
+			case "off":
+			case "warn":
+				shedOpts = append(shedOpts, client.WithImportPathGuard(client.ImportPathPolicy{}))
+			case "error":
+				shedOpts = append(shedOpts, client.WithImportPathGuard(client.ImportPathPolicy{Reject: true}))
+			default:
+				return fmt.Errorf("invalid import-path-guard flag value '%s', valid values are 'off', 'warn', or 'error'", c.opts.importGuard)
+			}
+			var lfp string
+			if cmd.Annotations[annotationNoLockfile] == "true" {
+				// Command doesn't need a lockfile so don't look for one.
+				shedOpts = append(shedOpts, client.WithoutLockfile())
+			} else if c.opts.lockfileFlag != "" {
+				if c.opts.global {
+					return fmt.Errorf("the --lockfile and --global flags cannot be used together")
+				}
+				// Use an absolute path so the directory of the lockfile is correct regardless of the current directory.
+				lfp, err = filepath.Abs(c.opts.lockfileFlag)
+				if err != nil {
+					return fmt.Errorf("unable to get absolute path of lockfile %s: %w", c.opts.lockfileFlag, err)
+				}
+				logger.Debugf("Using lockfile: %s", lfp)
+				shedOpts = append(shedOpts, client.WithLockfilePath(lfp))
+			} else if c.opts.global {
+				lfp, err = client.GlobalLockfilePath()
+				if err != nil {
+					return fmt.Errorf("unable to find global lockfile: %w", err)
+				}
+				logger.Debugf("Using global lockfile: %s", lfp)
+				shedOpts = append(shedOpts, client.WithGlobalLockfile())
+			} else {
+				// Find the nearest shed lockfile if it exists
+				cwd, err := os.Getwd()
+				if err != nil {
+					return fmt.Errorf("unable to get current working directory: %w", err)
+				}
+				lfp = client.ResolveLockfilePath(cwd)
+				if lfp != "" && filepath.Dir(lfp) != cwd {
+					// Make it obvious when a lockfile from a parent directory is being used
+					// since it might not be the one the user expects.
+					logger.Infof("Using lockfile %s", lfp)
+				} else {
+					logger.Debugf("Found lockfile: %s", lfp)
+				}
+				shedOpts = append(shedOpts, client.WithLockfilePath(lfp))
+			}
+			shed, err := client.NewShed(shedOpts...)
 			if err != nil {
 				return fmt.Errorf("failed to setup shed: %w", err)
 			}
@@ -199,21 +448,39 @@ func newRootCommand(c *container) *cobra.Command {
 			c.logger = logger
 			c.shed = shed
 			c.isaTTY = isaTTY
+			if noColor() || !supportsUTF8() {
+				c.spinnerFrames = spinner.ASCIIFrames
+			}
 			c.opts.lockfilePath = lfp
 			return nil
 		},
 	}
 
 	rootCmd.AddCommand(
+		newApplyCommand(c),
+		newAuditCommand(c),
 		newCacheCommand(c),
 		newCompletionsCommand(),
+		newDiffCommand(c),
+		newExecCommand(c),
+		newFmtCommand(c),
 		newGetCommand(c),
 		newInitCommand(c),
 		newListCommand(c),
+		newOutdatedCommand(c),
 		newRunCommand(c),
+		newServeCommand(c),
+		newStatsCommand(c),
+		newUninstallCommand(c),
+		newVerifyCommand(c),
 	)
 
 	rootCmd.PersistentFlags().BoolVarP(&c.opts.verbose, "verbose", "v", false, "enable verbose logging")
+	rootCmd.PersistentFlags().BoolVarP(&c.opts.global, "global", "g", false, "use the global lockfile for tools that are not tied to a project")
+	rootCmd.PersistentFlags().StringVar(&c.opts.lockfileFlag, "lockfile", "", "use the lockfile at the given path instead of finding the nearest shed.lock")
+	rootCmd.PersistentFlags().BoolVar(&c.opts.strict, "strict", false, "fail if the lockfile contains unknown fields, or when updating with a prerelease Go toolchain")
+	rootCmd.PersistentFlags().StringVar(&c.opts.versionFormat, "version-format", "exact", "sets how versions are written to the lockfile, valid values: exact, canonical")
+	rootCmd.PersistentFlags().StringVar(&c.opts.importGuard, "import-path-guard", "off", "check tools being installed for suspicious import paths, valid values: off, warn, error")
 	rootCmd.PersistentFlags().StringVar(&c.opts.progressMode, "progress", "auto", "sets if a progress spinner should be used, valid values: on, off, auto")
 	return rootCmd
 }
@@ -1,21 +1,35 @@
 package cmd
 
 import (
-	"errors"
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 
+	"github.com/cszatmary/shed/client"
+	"github.com/cszatmary/shed/errors"
 	"github.com/cszatmary/shed/lockfile"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
 func newRunCommand(c *container) *cobra.Command {
+	var runOpts struct {
+		exec    bool
+		checkGo bool
+		list    bool
+	}
+
 	runCmd := &cobra.Command{
-		Use:   "run <tool> [args...]",
-		Args:  cobra.MinimumNArgs(1),
+		Use: "run <tool> [args...]",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if runOpts.list {
+				return cobra.NoArgs(cmd, args)
+			}
+			return cobra.MinimumNArgs(1)(cmd, args)
+		},
 		Short: "Run installed tools.",
 		Long: `shed run runs an installed tool passing all arguments to it.
 
@@ -31,21 +45,71 @@ For example to run the stringer tool you can either run:
 
 Or:
 
-	shed run golang.org/x/tools/cmd/stringer -type=Pill`,
+	shed run golang.org/x/tools/cmd/stringer -type=Pill
+
+The '--exec' flag makes shed replace itself with the tool instead of running it as a child process.
+This ensures signals, exit codes and TTY handling behave exactly as if the tool was run directly,
+which can help with interactive tools. This flag has no effect on Windows.
+
+	shed run --exec stringer -type=Pill
+
+The '--check-go' flag checks that the installed Go toolchain satisfies the Go version required by the tool,
+as recorded in shed.lock, before running it. This is useful for tools that run the go command themselves,
+like code generators. If no Go version is recorded for the tool, the check is skipped.
+
+	shed run --check-go stringer -type=Pill
+
+Tools installed with 'shed get --global' can be run with the '--global' flag. Unlike tools from a project lockfile,
+which are run in the directory containing shed.lock, global tools are run in the current directory.
+
+	shed run --global stringer -type=Pill
+
+The '--lockfile' flag runs a tool from the given lockfile instead of the nearest shed.lock, for example to run a tool
+from another project regardless of the current directory. The tool is run in the directory containing that lockfile.
+
+	shed run --lockfile ../other-project/shed.lock stringer -type=Pill
+
+The SHED_RUN_WRAPPER environment variable can be set to a command that the tool should be run with,
+for example to run it inside a sandbox. The placeholders '{tool}' and '{args}' are replaced with the path
+to the tool binary and the arguments to the tool respectively. If they are omitted, the tool and its
+arguments are appended to the command.
+
+	SHED_RUN_WRAPPER='firejail --quiet -- {tool} {args}' shed run stringer -type=Pill
+
+The '--list' flag prints the tools that can be run instead of running a tool. Each tool is printed with its name,
+import path, and the path to its binary, sorted by name. Tools that are in shed.lock but are not installed are
+marked as not installed. For example, 'shed run --list' might print:
+
+	go-fish   github.com/cszatmary/go-fish     /home/user/.cache/shed/tools/github.com/cszatmary/go-fish@v0.1.0/go-fish
+	stringer  golang.org/x/tools/cmd/stringer  (not installed)`,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if runOpts.list {
+				return listRunnableTools(cmd.Context(), c)
+			}
 			toolName := args[0]
 			binPath, err := c.shed.ToolPath(toolName)
 			// Handle special cases that are specific to run as they would be difficult for the global error handler to deal with.
 			if errors.Is(err, lockfile.ErrNotFound) {
 				return &exitError{
 					code: 1,
-					msg:  fmt.Sprintf("No tool named %s installed. Run 'shed get' first to install the tool.", toolName),
+					msg:  fmt.Sprintf("No tool named %s installed. Run '%s get' first to install the tool.", toolName, cmd.Root().Name()),
 				}
 			}
 			if errors.Is(err, lockfile.ErrMultipleTools) {
+				// Strip the version if one was provided to get the binary name
+				name := toolName
+				if i := strings.IndexByte(name, '@'); i != -1 {
+					name = name[:i]
+				}
+				var sb strings.Builder
+				fmt.Fprintf(&sb, "Multiple tools named %s found. Specify the full import path of the tool in order to run it.\n", name)
+				sb.WriteString("Did you mean one of:")
+				for _, t := range c.shed.ToolsByName(name) {
+					fmt.Fprintf(&sb, "\n\t%s", t.ImportPath)
+				}
 				return &exitError{
 					code: 1,
-					msg:  fmt.Sprintf("Multiple tools named %s found. Specify the full import path of the tool in order to run it.", toolName),
+					msg:  sb.String(),
 				}
 			}
 			if err != nil {
@@ -55,24 +119,144 @@ Or:
 				"tool": toolName,
 				"path": binPath,
 			}).Debugf("Found path for tool")
+			if runOpts.checkGo {
+				if err := c.shed.CheckGoVersion(cmd.Context(), toolName); err != nil {
+					return &exitError{
+						code: 1,
+						msg:  fmt.Sprintf("The installed Go toolchain cannot be used with %s. Install a newer version of Go.", toolName),
+						err:  err,
+					}
+				}
+			}
 
-			ec := exec.Command(binPath, args[1:]...)
-			ec.Dir = filepath.Dir(c.opts.lockfilePath)
-			ec.Stdout = os.Stdout
-			ec.Stderr = os.Stderr
-			ec.Stdin = os.Stdin
-			if err := ec.Run(); err != nil {
-				code := ec.ProcessState.ExitCode()
-				if code != -1 {
-					os.Exit(code)
+			args = args[1:]
+			if wrapper := os.Getenv("SHED_RUN_WRAPPER"); wrapper != "" {
+				argv, err := wrapCommand(wrapper, binPath, args)
+				if err != nil {
+					return &exitError{
+						code: 1,
+						msg:  fmt.Sprintf("Invalid value %q for SHED_RUN_WRAPPER.", wrapper),
+						err:  err,
+					}
 				}
-				os.Exit(1)
+				wrapperPath, err := exec.LookPath(argv[0])
+				if err != nil {
+					return fmt.Errorf("failed to find run wrapper %s: %w", argv[0], err)
+				}
+				c.logger.Debugf("Running tool with wrapper: %s", strings.Join(argv, " "))
+				binPath, args = wrapperPath, argv[1:]
+			}
+
+			dir := filepath.Dir(c.opts.lockfilePath)
+			if c.opts.global {
+				// Global tools aren't tied to a project so run them in the current directory.
+				dir = ""
 			}
+			if runOpts.exec {
+				return execTool(binPath, args, dir)
+			}
+			runTool(binPath, args, dir)
 			return nil
 		},
 	}
 
 	// Stop parsing flags after first non-flag arg so we can pass them to the command being run
 	runCmd.Flags().SetInterspersed(false)
+	runCmd.Flags().BoolVar(&runOpts.exec, "exec", false, "replace the shed process with the tool")
+	runCmd.Flags().BoolVar(&runOpts.checkGo, "check-go", false, "check the installed go version satisfies the go version required by the tool")
+	runCmd.Flags().BoolVar(&runOpts.list, "list", false, "list the tools that can be run and the paths to their binaries")
 	return runCmd
 }
+
+// listRunnableTools prints the name, import path and binary path of each tool in the lockfile.
+// Tools that are not installed are marked as such instead of having a path.
+func listRunnableTools(ctx context.Context, c *container) error {
+	tools, err := c.shed.List(ctx, client.ListOptions{Sort: client.SortByName})
+	if err != nil {
+		return err
+	}
+	paths := make([]string, len(tools))
+	nameWidth, importPathWidth := 0, 0
+	for i, info := range tools {
+		t := info.Tool
+		binPath, err := c.shed.ToolPath(t.ImportPath)
+		if rootErr := errors.Root(err); rootErr != nil && rootErr.Kind == errors.NotInstalled {
+			binPath = "(not installed)"
+		} else if err != nil {
+			return err
+		}
+		paths[i] = binPath
+		if len(t.Name()) > nameWidth {
+			nameWidth = len(t.Name())
+		}
+		if len(t.ImportPath) > importPathWidth {
+			importPathWidth = len(t.ImportPath)
+		}
+	}
+	for i, info := range tools {
+		fmt.Printf("%-*s  %-*s  %s\n", nameWidth, info.Tool.Name(), importPathWidth, info.Tool.ImportPath, paths[i])
+	}
+	return nil
+}
+
+// runTool runs the binary at binPath with args using dir as the working directory.
+// Stdin, stdout and stderr are passed through to the tool. If the tool fails,
+// runTool exits with the same exit code as the tool.
+func runTool(binPath string, args []string, dir string) {
+	ec := exec.Command(binPath, args...)
+	ec.Dir = dir
+	ec.Stdout = os.Stdout
+	ec.Stderr = os.Stderr
+	ec.Stdin = os.Stdin
+	if err := ec.Run(); err != nil {
+		code := ec.ProcessState.ExitCode()
+		if code != -1 {
+			os.Exit(code)
+		}
+		os.Exit(1)
+	}
+}
+
+// wrapCommand builds the command to run the binary at binPath with args using the wrapper command template.
+// The '{tool}' placeholder is replaced with binPath and the '{args}' placeholder is replaced with args.
+// If the template contains neither placeholder, binPath and args are appended to it.
+// The returned slice contains the wrapper binary followed by its arguments.
+func wrapCommand(wrapper, binPath string, args []string) ([]string, error) {
+	fields := strings.Fields(wrapper)
+	if len(fields) == 0 {
+		return nil, errors.New("wrapper command is empty")
+	}
+	var argv []string
+	hasTool, hasArgs := false, false
+	for _, f := range fields {
+		if f == "{args}" {
+			if hasArgs {
+				return nil, errors.New("{args} can only be used once")
+			}
+			hasArgs = true
+			argv = append(argv, args...)
+			continue
+		}
+		if strings.Contains(f, "{args}") {
+			return nil, errors.New("{args} must be a separate argument")
+		}
+		if strings.Contains(f, "{tool}") {
+			hasTool = true
+			f = strings.ReplaceAll(f, "{tool}", binPath)
+		}
+		argv = append(argv, f)
+	}
+	if hasArgs && !hasTool {
+		return nil, errors.New("{args} cannot be used without {tool}")
+	}
+	if strings.Contains(fields[0], "{tool}") || fields[0] == "{args}" {
+		return nil, errors.New("the first argument must be the wrapper command")
+	}
+	if !hasTool {
+		argv = append(argv, binPath)
+	}
+	if !hasArgs {
+		argv = append(argv, args...)
+	}
+	return argv, nil
+}
@@ -0,0 +1,26 @@
+//go:build !windows
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// execTool replaces the current process with the binary at binPath, passing args to it
+// and using dir as the working directory. The tool inherits the environment, stdio and
+// signal handling of shed as if it was invoked directly. execTool only returns if the
+// process could not be replaced.
+func execTool(binPath string, args []string, dir string) error {
+	if dir != "" {
+		if err := os.Chdir(dir); err != nil {
+			return fmt.Errorf("failed to change directory to %s: %w", dir, err)
+		}
+	}
+	argv := append([]string{binPath}, args...)
+	if err := syscall.Exec(binPath, argv, os.Environ()); err != nil {
+		return fmt.Errorf("failed to exec %s: %w", binPath, err)
+	}
+	return nil
+}
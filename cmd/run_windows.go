@@ -0,0 +1,9 @@
+package cmd
+
+// execTool runs the binary at binPath with args using dir as the working directory.
+// Windows does not support replacing the current process, so this is the same as
+// runTool and will exit with the tool's exit code.
+func execTool(binPath string, args []string, dir string) error {
+	runTool(binPath, args, dir)
+	return nil
+}
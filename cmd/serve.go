@@ -0,0 +1,244 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cszatmary/shed/client"
+	"github.com/cszatmary/shed/errors"
+	"github.com/cszatmary/shed/lockfile"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// shutdownTimeout is how long the server waits for in progress requests to finish when shutting down.
+const shutdownTimeout = 10 * time.Second
+
+func newServeCommand(c *container) *cobra.Command {
+	var serveOpts struct {
+		addr string
+	}
+
+	serveCmd := &cobra.Command{
+		Use:   "serve",
+		Args:  cobra.NoArgs,
+		Short: "Serve an HTTP API for managing tools.",
+		Long: `shed serve starts an HTTP server that exposes a JSON API for managing the tools in shed.lock.
+This allows shed to be used as a backend for other tools like dashboards and editors.
+
+The following endpoints are available:
+
+	GET  /healthz          Reports that the server is running.
+	GET  /tools            Lists all tools. Use '?updates=true' to also check for updates.
+	GET  /tools/<name>     Gets a single tool. The name can be the binary name or the full import path.
+	POST /install          Installs tools. The body is a JSON object like '{"tools": ["..."], "update": false}'
+	                       and the Content-Type must be 'application/json'.
+
+The API is not authenticated, so by default the server only listens on localhost.
+Installs are run one at a time. The server shuts down gracefully on interrupt,
+waiting for in progress requests to finish.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			h := &apiHandler{shed: c.shed, logger: c.logger}
+			mux := http.NewServeMux()
+			mux.HandleFunc("/healthz", h.handleHealth)
+			mux.HandleFunc("/tools", h.handleListTools)
+			mux.HandleFunc("/tools/", h.handleGetTool)
+			mux.HandleFunc("/install", h.handleInstall)
+			srv := &http.Server{Addr: serveOpts.addr, Handler: mux}
+
+			errCh := make(chan error, 1)
+			go func() {
+				errCh <- srv.ListenAndServe()
+			}()
+			c.logger.Infof("Serving shed API on %s", serveOpts.addr)
+
+			select {
+			case err := <-errCh:
+				return fmt.Errorf("failed to serve shed API: %w", err)
+			case <-cmd.Context().Done():
+			}
+
+			c.logger.Info("Shutting down server")
+			ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+			defer cancel()
+			if err := srv.Shutdown(ctx); err != nil {
+				return fmt.Errorf("failed to shut down server: %w", err)
+			}
+			return nil
+		},
+	}
+
+	serveCmd.Flags().StringVar(&serveOpts.addr, "addr", "localhost:8080", "address to listen on")
+	return serveCmd
+}
+
+// apiHandler contains the handlers for the shed HTTP API.
+type apiHandler struct {
+	shed   *client.Shed
+	logger logrus.FieldLogger
+	// mu makes sure installs don't run concurrently with each other or with reads,
+	// since installing modifies the lockfile.
+	mu sync.RWMutex
+}
+
+type apiTool struct {
+	ImportPath    string `json:"importPath"`
+	Version       string `json:"version"`
+	LatestVersion string `json:"latestVersion,omitempty"`
+	Installed     *bool  `json:"installed,omitempty"`
+}
+
+type apiInstallRequest struct {
+	Tools  []string `json:"tools"`
+	Update bool     `json:"update"`
+}
+
+type apiInstallResult struct {
+	ImportPath       string `json:"importPath"`
+	Version          string `json:"version"`
+	AlreadySatisfied bool   `json:"alreadySatisfied"`
+}
+
+func (h *apiHandler) handleHealth(w http.ResponseWriter, r *http.Request) {
+	if !h.allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	h.writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func (h *apiHandler) handleListTools(w http.ResponseWriter, r *http.Request) {
+	if !h.allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	tools, err := h.shed.List(r.Context(), client.ListOptions{
+		ShowUpdates: r.URL.Query().Get("updates") == "true",
+	})
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	resp := make([]apiTool, len(tools))
+	for i, info := range tools {
+		resp[i] = apiTool{
+			ImportPath:    info.Tool.ImportPath,
+			Version:       info.Tool.Version,
+			LatestVersion: info.LatestVersion,
+		}
+	}
+	h.writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *apiHandler) handleGetTool(w http.ResponseWriter, r *http.Request) {
+	if !h.allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	name := strings.TrimPrefix(r.URL.Path, "/tools/")
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	t, err := h.shed.LookupTool(name)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	_, err = h.shed.ToolPath(t.ImportPath)
+	installed := err == nil
+	h.writeJSON(w, http.StatusOK, apiTool{ImportPath: t.ImportPath, Version: t.Version, Installed: &installed})
+}
+
+func (h *apiHandler) handleInstall(w http.ResponseWriter, r *http.Request) {
+	if !h.allowMethod(w, r, http.MethodPost) {
+		return
+	}
+	// Requiring JSON prevents browsers from sending installs using cross-site form posts,
+	// since they can't set this content type without a CORS preflight.
+	if mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || mediaType != "application/json" {
+		h.writeJSON(w, http.StatusUnsupportedMediaType, map[string]string{"error": "content type must be application/json"})
+		return
+	}
+	var req apiInstallRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("invalid request body: %v", err)})
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	installSet, err := h.shed.Get(client.GetOptions{ToolNames: req.Tools, Update: req.Update})
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	if err := installSet.Apply(r.Context()); err != nil {
+		h.writeError(w, err)
+		return
+	}
+	var resp []apiInstallResult
+	for _, res := range installSet.Results() {
+		resp = append(resp, apiInstallResult{
+			ImportPath:       res.Tool.ImportPath,
+			Version:          res.Tool.Version,
+			AlreadySatisfied: res.AlreadySatisfied,
+		})
+	}
+	h.writeJSON(w, http.StatusOK, resp)
+}
+
+// allowMethod checks that r uses method. If it doesn't, an error response is written
+// and false is returned.
+func (h *apiHandler) allowMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method == method {
+		return true
+	}
+	w.Header().Set("Allow", method)
+	h.writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+	return false
+}
+
+// writeError writes err as a JSON response using a status code based on the kind of error.
+func (h *apiHandler) writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	if errors.Is(err, lockfile.ErrNotFound) {
+		status = http.StatusNotFound
+	} else if errors.Is(err, lockfile.ErrMultipleTools) || errors.Is(err, lockfile.ErrIncorrectVersion) {
+		status = http.StatusBadRequest
+	} else if errors.Is(err, context.Canceled) {
+		// Client went away, the response won't be read anyways.
+		status = http.StatusServiceUnavailable
+	} else if rootErr := rootError(err); rootErr != nil {
+		switch rootErr.Kind {
+		case errors.Invalid:
+			status = http.StatusBadRequest
+		case errors.NotInstalled:
+			status = http.StatusNotFound
+		}
+	}
+	h.logger.WithFields(logrus.Fields{
+		"status": status,
+		"error":  err,
+	}).Debug("API request failed")
+	h.writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// rootError is like errors.Root but also looks at the first error if err is an errors.List.
+func rootError(err error) *errors.Error {
+	if errs, ok := err.(errors.List); ok && len(errs) > 0 {
+		err = errs[0]
+	}
+	return errors.Root(err)
+}
+
+func (h *apiHandler) writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		h.logger.WithError(err).Debug("failed to write API response")
+	}
+}
@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/spf13/cobra"
+)
+
+func newStatsCommand(c *container) *cobra.Command {
+	statsCmd := &cobra.Command{
+		Use:   "stats",
+		Args:  cobra.NoArgs,
+		Short: "Summarize the tools specified in shed.lock.",
+		Long: `shed stats prints the number of tools in shed.lock for each host, for example github.com or golang.org.
+This shows where the tools used by a project come from. Hosts are sorted by the number of tools, most first.
+
+For example, 'shed stats' might print:
+
+	golang.org  2
+	github.com  1
+
+	3 tools`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			stats := c.shed.StatsByHost()
+			hosts := make([]string, 0, len(stats))
+			total := 0
+			width := 0
+			for host, n := range stats {
+				hosts = append(hosts, host)
+				total += n
+				if len(host) > width {
+					width = len(host)
+				}
+			}
+			sort.Slice(hosts, func(i, j int) bool {
+				if stats[hosts[i]] != stats[hosts[j]] {
+					return stats[hosts[i]] > stats[hosts[j]]
+				}
+				return hosts[i] < hosts[j]
+			})
+			for _, host := range hosts {
+				fmt.Printf("%-*s  %d\n", width, host, stats[host])
+			}
+			if len(hosts) > 0 {
+				fmt.Println()
+			}
+			fmt.Printf("%d tools\n", total)
+			return nil
+		},
+	}
+	return statsCmd
+}
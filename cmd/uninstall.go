@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+func newUninstallCommand(c *container) *cobra.Command {
+	uninstallCmd := &cobra.Command{
+		Use:   "uninstall tools...",
+		Args:  cobra.MinimumNArgs(1),
+		Short: "Remove tools from the lockfile.",
+		Long: `shed uninstall removes the given tools from shed.lock.
+Each tool can either be the name of the binary or the full import path.
+If the binary name is ambiguous, that is multiple tools have the same binary name, the full import path must be used.
+
+If any of the tools are not in shed.lock, an error is returned and shed.lock is not modified.
+
+This is equivalent to running 'shed get' with the '@none' version suffix for each tool, except that
+the tools do not need to be specified using the full import path.
+
+Examples:
+
+	shed uninstall stringer
+	shed uninstall golang.org/x/tools/cmd/stringer golangci-lint`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			removed, err := c.shed.Uninstall(args...)
+			if err != nil {
+				return err
+			}
+			c.logger.Infof("Removed %d tools from lockfile", len(removed))
+			return nil
+		},
+	}
+	return uninstallCmd
+}
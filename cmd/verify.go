@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/cszatmary/shed/client"
+	"github.com/spf13/cobra"
+)
+
+func newVerifyCommand(c *container) *cobra.Command {
+	var verifyOpts struct {
+		fix  bool
+		json bool
+	}
+
+	verifyCmd := &cobra.Command{
+		Use:   "verify",
+		Args:  cobra.NoArgs,
+		Short: "Check that the tools in shed.lock are installed.",
+		Long: `shed verify checks that each tool in shed.lock is installed in the cache at the version in shed.lock.
+By default verify only reads the cache and never downloads or builds anything, which makes it suitable as a CI check.
+
+A tool can have one of the following statuses:
+
+	installed         The tool is downloaded and built.
+	not downloaded    The tool has not been downloaded.
+	version mismatch  The downloaded tool does not match the version in shed.lock.
+	not built         The tool was downloaded but the binary is missing.
+
+If shed.lock contains a binary hash for a tool on the current platform, recorded by 'shed get --reproducible',
+the hash of the installed binary is also checked. A tool whose binary does not match is reported as a binary
+hash mismatch, and is never fixed since it means the binary was modified or the build is not reproducible.
+
+The '--fix' flag reinstalls each tool that is not installed at the exact version in shed.lock,
+and reports which tools were fixed. shed.lock is never modified.
+
+The '--json' flag prints the result for each tool as a JSON array instead.
+
+If any tool is not installed after verify finishes, shed exits with a non-zero status.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			results, err := c.shed.Verify(cmd.Context(), client.VerifyOptions{Fix: verifyOpts.fix})
+			if err != nil {
+				return err
+			}
+
+			var failed, fixed int
+			for _, r := range results {
+				if r.Fixed {
+					fixed++
+				}
+				if !r.OK() {
+					failed++
+				}
+			}
+			if verifyOpts.json {
+				if err := printVerifyResultsJSON(results); err != nil {
+					return err
+				}
+			} else {
+				for _, r := range results {
+					switch {
+					case r.Fixed:
+						fmt.Printf("%s %s: fixed (was %s)\n", r.Tool.ImportPath, r.Tool.Version, r.Status)
+					case r.BinHashMismatch:
+						fmt.Printf("%s %s: binary hash mismatch\n", r.Tool.ImportPath, r.Tool.Version)
+					case r.Err != nil:
+						fmt.Printf("%s %s: %s, failed to fix: %v\n", r.Tool.ImportPath, r.Tool.Version, r.Status, r.Err)
+					default:
+						fmt.Printf("%s %s: %s\n", r.Tool.ImportPath, r.Tool.Version, r.Status)
+					}
+				}
+				if verifyOpts.fix {
+					fmt.Printf("Fixed %d tools\n", fixed)
+				}
+			}
+
+			if failed > 0 {
+				msg := fmt.Sprintf("%d tools are not installed correctly.", failed)
+				if !verifyOpts.fix {
+					msg += fmt.Sprintf(" Run '%s verify --fix' to install them.", cmd.Root().Name())
+				}
+				return &exitError{code: 1, msg: msg}
+			}
+			return nil
+		},
+	}
+
+	verifyCmd.Flags().BoolVar(&verifyOpts.fix, "fix", false, "reinstall tools that are not installed at the version in the lockfile")
+	verifyCmd.Flags().BoolVar(&verifyOpts.json, "json", false, "print results as JSON")
+	return verifyCmd
+}
+
+// verifyResultJSON is the JSON representation of a client.VerifyResult.
+type verifyResultJSON struct {
+	ImportPath      string `json:"importPath"`
+	Version         string `json:"version"`
+	Status          string `json:"status"`
+	Fixed           bool   `json:"fixed"`
+	BinHashMismatch bool   `json:"binHashMismatch,omitempty"`
+	OK              bool   `json:"ok"`
+	Error           string `json:"error,omitempty"`
+}
+
+func printVerifyResultsJSON(results []client.VerifyResult) error {
+	out := make([]verifyResultJSON, len(results))
+	for i, r := range results {
+		out[i] = verifyResultJSON{
+			ImportPath:      r.Tool.ImportPath,
+			Version:         r.Tool.Version,
+			Status:          r.Status.String(),
+			Fixed:           r.Fixed,
+			OK:              r.OK(),
+			BinHashMismatch: r.BinHashMismatch,
+		}
+		if r.Err != nil {
+			out[i].Error = r.Err.Error()
+		}
+	}
+	data, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal verify results: %w", err)
+	}
+	fmt.Println(string(data))
+	return nil
+}
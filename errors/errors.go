@@ -91,6 +91,22 @@ func New(args ...interface{}) error {
 	return e
 }
 
+// Errorf creates an error with the given kind and op whose reason is formatted according to
+// format and args, like fmt.Sprintf. It is shorthand for New(kind, fmt.Sprintf(format, args...), op).
+// Use Wrap to create an error that wraps an underlying error.
+func Errorf(kind Kind, op Op, format string, args ...interface{}) error {
+	return New(kind, fmt.Sprintf(format, args...), op)
+}
+
+// Wrap creates an error with the given kind, op and reason that wraps err.
+// It is shorthand for New(kind, msg, op, err). If err is nil, Wrap returns nil.
+func Wrap(err error, kind Kind, op Op, msg string) error {
+	if err == nil {
+		return nil
+	}
+	return New(kind, msg, op, err)
+}
+
 func (e *Error) Error() string {
 	sb := &strings.Builder{}
 	if e.Kind != Unspecified {
@@ -199,3 +215,8 @@ func Str(s string) error {
 func Is(err, target error) bool {
 	return stderrors.Is(err, target)
 }
+
+// As is errors.As from the standard library.
+func As(err error, target interface{}) bool {
+	return stderrors.As(err, target)
+}
@@ -58,6 +58,29 @@ func TestFormat(t *testing.T) {
 			format: "%+v",
 			want:   "Shed.ToolPath: bad state: cannot find tool:\n\tCache.ToolPath: tool not installed: no binary for tool stringer: file not exist",
 		},
+		{
+			name:   "Errorf detailed format",
+			err:    errors.Errorf(errors.Invalid, errors.Op("Lockfile.SetAlias"), "invalid alias %q for tool %s", "a/b", "stringer"),
+			format: "%+v",
+			want:   `Lockfile.SetAlias: invalid operation: invalid alias "a/b" for tool stringer`,
+		},
+		{
+			name: "Wrap detailed format with nested error",
+			err: errors.Wrap(
+				errors.Wrap(fmt.Errorf("file not exist"), errors.NotInstalled, errors.Op("Cache.ToolPath"), "no binary for tool stringer"),
+				errors.BadState,
+				errors.Op("Shed.ToolPath"),
+				"cannot find tool",
+			),
+			format: "%+v",
+			want:   "Shed.ToolPath: bad state: cannot find tool:\n\tCache.ToolPath: tool not installed: no binary for tool stringer: file not exist",
+		},
+		{
+			name:   "Wrap unspecified kind",
+			err:    errors.Wrap(fmt.Errorf("dir not exist"), errors.Unspecified, errors.Op("Cache.Install"), "unable to create go.mod"),
+			format: "%+v",
+			want:   "Cache.Install: unable to create go.mod: dir not exist",
+		},
 	}
 
 	for _, tt := range tests {
@@ -70,6 +93,44 @@ func TestFormat(t *testing.T) {
 	}
 }
 
+func TestHelpersMatchNew(t *testing.T) {
+	op := errors.Op("Cache.Install")
+	cause := fmt.Errorf("dir not exist")
+	tests := []struct {
+		name string
+		got  error
+		want error
+	}{
+		{
+			name: "Errorf",
+			got:  errors.Errorf(errors.IO, op, "unable to create %s", "go.mod"),
+			want: errors.New(errors.IO, "unable to create go.mod", op),
+		},
+		{
+			name: "Wrap",
+			got:  errors.Wrap(cause, errors.IO, op, "unable to create go.mod"),
+			want: errors.New(errors.IO, "unable to create go.mod", op, cause),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, want := fmt.Sprintf("%+v", tt.got), fmt.Sprintf("%+v", tt.want)
+			if got != want {
+				t.Errorf("got\n\t%s\nwant\n\t%s", got, want)
+			}
+			if *errors.Root(tt.got) != *errors.Root(tt.want) {
+				t.Errorf("got\n\t%#v\nwant\n\t%#v", errors.Root(tt.got), errors.Root(tt.want))
+			}
+		})
+	}
+}
+
+func TestWrapNil(t *testing.T) {
+	if err := errors.Wrap(nil, errors.IO, errors.Op("Cache.Install"), "unable to create go.mod"); err != nil {
+		t.Errorf("got %v, want nil", err)
+	}
+}
+
 func TestRoot(t *testing.T) {
 	tests := []struct {
 		name string
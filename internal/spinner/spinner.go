@@ -12,11 +12,17 @@ import (
 	"unicode/utf8"
 )
 
-var frames = [...]string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+// DefaultFrames are the frames used by a spinner if no frames are provided.
+var DefaultFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+// ASCIIFrames are spinner frames that only use ASCII characters. They can be used
+// as a fallback when the terminal does not support UTF-8.
+var ASCIIFrames = []string{"|", "/", "-", "\\"}
 
 // Spinner represents the state of the spinner.
 type Spinner struct {
 	interval time.Duration
+	frames   []string
 	out      io.Writer
 	mu       *sync.RWMutex
 	// stopChan is used to stop the spinner
@@ -44,6 +50,9 @@ type Options struct {
 	// Interval is how often the spinner updates. This controls the speed of the spinner.
 	// The default value is 100ms.
 	Interval time.Duration
+	// Frames are the frames of the spinner animation, written in order on each update.
+	// The default value is DefaultFrames.
+	Frames []string
 	// Out is where the spinner is written. The default value is os.Stderr.
 	Out io.Writer
 	// Message is the text written after the spinner.
@@ -63,6 +72,9 @@ func New(opts Options) *Spinner {
 	if opts.Interval == 0 {
 		opts.Interval = 100 * time.Millisecond
 	}
+	if len(opts.Frames) == 0 {
+		opts.Frames = DefaultFrames
+	}
 	if opts.Out == nil {
 		opts.Out = os.Stderr
 	}
@@ -71,6 +83,7 @@ func New(opts Options) *Spinner {
 	}
 	s := &Spinner{
 		interval:    opts.Interval,
+		frames:      opts.Frames,
 		out:         opts.Out,
 		mu:          &sync.RWMutex{},
 		stopChan:    make(chan struct{}, 1),
@@ -185,7 +198,7 @@ func (s *Spinner) Write(p []byte) (int, error) {
 // it will run forever until it receives a value on s.stopChan.
 func (s *Spinner) run() {
 	for {
-		for i := 0; i < len(frames); i++ {
+		for i := 0; i < len(s.frames); i++ {
 			select {
 			case <-s.stopChan:
 				return
@@ -197,7 +210,7 @@ func (s *Spinner) run() {
 				}
 				s.erase()
 
-				line := fmt.Sprintf("\r%s%s ", frames[i], s.msg)
+				line := fmt.Sprintf("\r%s%s ", s.frames[i], s.msg)
 				if s.count > 1 {
 					line += fmt.Sprintf("(%d/%d) ", s.completed, s.count)
 				}
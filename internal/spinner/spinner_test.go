@@ -234,6 +234,31 @@ func TestSpinnerMaxMessageLength(t *testing.T) {
 	}
 }
 
+func TestSpinnerFrames(t *testing.T) {
+	out := &syncBuffer{}
+	s := spinner.New(spinner.Options{
+		Interval: 10 * time.Millisecond,
+		Frames:   spinner.ASCIIFrames,
+		Out:      out,
+		Message:  "Cloning repos",
+	})
+	s.Start()
+	time.Sleep(50 * time.Millisecond)
+	s.Stop()
+
+	// wait a bit because the spinner still has to erase before stopping
+	time.Sleep(25 * time.Millisecond)
+	got := out.String()
+
+	wantFrames := `|/-\`
+	if !containsAll(got, wantFrames) {
+		t.Errorf("got %q, want to contain all %q", got, wantFrames)
+	}
+	if containsAll(got, "⠋") {
+		t.Errorf("got %q, want no default frames", got)
+	}
+}
+
 func containsAll(s string, chars string) bool {
 	for _, r := range chars {
 		if !strings.ContainsRune(s, r) {
@@ -1,7 +1,9 @@
 package util
 
 import (
+	"io"
 	"os"
+	"path/filepath"
 )
 
 // FileOrDirExists returns true if the given path exists on the OS filesystem.
@@ -11,3 +13,36 @@ func FileOrDirExists(path string) bool {
 	}
 	return true
 }
+
+// WriteFileAtomic writes the contents written by write to the file at path.
+// The contents are written to a temporary file in the same directory which is then
+// renamed to path. This guarantees that path either contains the previous contents
+// or the new contents, even if writing fails or the process is killed part way through.
+func WriteFileAtomic(path string, perm os.FileMode, write func(w io.Writer) error) (err error) {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := f.Name()
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(tmpPath)
+		}
+	}()
+	if err := f.Chmod(perm); err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		return err
+	}
+	// Make sure the contents are on disk before the rename, otherwise a crash
+	// could leave an empty file at path.
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
@@ -1,6 +1,9 @@
 package util_test
 
 import (
+	"errors"
+	"io"
+	"os"
 	"path/filepath"
 	"testing"
 
@@ -28,3 +31,56 @@ func TestFileOrDirExists(t *testing.T) {
 		})
 	}
 }
+
+func TestWriteFileAtomic(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "shed.lock")
+	err := util.WriteFileAtomic(p, 0o644, func(w io.Writer) error {
+		_, err := io.WriteString(w, "new contents")
+		return err
+	})
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	assertFileContents(t, p, "new contents")
+}
+
+func TestWriteFileAtomicError(t *testing.T) {
+	dir := t.TempDir()
+	p := filepath.Join(dir, "shed.lock")
+	if err := os.WriteFile(p, []byte("old contents"), 0o644); err != nil {
+		t.Fatalf("failed to write file %v", err)
+	}
+
+	// Simulate the write being interrupted part way through
+	writeErr := errors.New("write interrupted")
+	err := util.WriteFileAtomic(p, 0o644, func(w io.Writer) error {
+		if _, err := io.WriteString(w, "new con"); err != nil {
+			return err
+		}
+		return writeErr
+	})
+	if !errors.Is(err, writeErr) {
+		t.Errorf("got error %v, want %v", err, writeErr)
+	}
+	assertFileContents(t, p, "old contents")
+
+	// The temp file should have been cleaned up
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("failed to read dir %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("got %d files in %s, want 1", len(entries), dir)
+	}
+}
+
+func assertFileContents(t *testing.T, path, want string) {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read file %v", err)
+	}
+	if got := string(b); got != want {
+		t.Errorf("got contents %q, want %q", got, want)
+	}
+}
@@ -2,13 +2,17 @@
 package lockfile
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
 	"path"
+	"sort"
+	"strings"
 
 	"github.com/cszatmary/shed/errors"
 	"github.com/cszatmary/shed/tool"
+	"golang.org/x/mod/semver"
 )
 
 // ErrNotFound is returned when a tool is not found in a lockfile.
@@ -44,6 +48,95 @@ type Lockfile struct {
 	// if multiple tools exist with the same binary name, in which
 	// case the full import path is required to retrieve the tool.
 	nameMap map[string][]int
+	// modules is a map of tool import paths to the path of the module
+	// that provides the tool. It is optional, a tool may not have
+	// a module recorded, in which case it must be resolved.
+	modules map[string]string
+	// direct is the set of tool import paths that must be downloaded
+	// directly from version control, bypassing the module proxy.
+	direct map[string]bool
+	// hashes is a map of tool import paths to the hash of the content of the module
+	// that provides the tool, as recorded in go.sum. It is optional.
+	hashes map[string]string
+	// binHashes is a map of tool import paths to the hashes of the built binary of the tool,
+	// keyed by platform. It is optional and only recorded for reproducible builds.
+	binHashes map[string]map[string]string
+	// releases is a map of tool import paths to the binary release the tool is downloaded from.
+	// It is only set for tools that are not built from source.
+	releases map[string]BinaryRelease
+	// releaseHashes is a map of tool import paths to the hashes of the binary release assets
+	// the tool was downloaded from, keyed by platform. It is only set for tools with a binary release.
+	releaseHashes map[string]map[string]string
+	// goVersions is a map of tool import paths to the Go version required by the module
+	// that provides the tool, as declared by the go directive in its go.mod. It is optional.
+	goVersions map[string]string
+	// aliases is a map of tool import paths to an alternative name the tool can be referred to by.
+	// The binary of the tool is also installed under the alias. It is optional.
+	aliases map[string]string
+	// buildFlags is a map of tool import paths to extra flags passed to go build when building the tool,
+	// for example to set -ldflags or build tags. It is optional.
+	buildFlags map[string][]string
+	// toolchain is the version of the Go toolchain used to build all tools, for example '1.21.0'.
+	// It is optional, if it is empty the installed Go toolchain is used.
+	toolchain string
+	// versionFormat controls how versions are normalized by PutTool.
+	versionFormat VersionFormat
+	// compact is set if WriteTo should write each tool on a single line.
+	compact bool
+}
+
+// VersionFormat controls how tool versions are normalized before being stored in a lockfile.
+type VersionFormat int
+
+const (
+	// VersionFormatExact stores versions exactly as provided. Versions must already be
+	// full canonical semantic versions, otherwise PutTool returns ErrInvalidVersion.
+	// This is the default.
+	VersionFormatExact VersionFormat = iota
+	// VersionFormatCanonical converts valid semantic versions to their canonical form before
+	// storing them. This strips build metadata, for example 'v1.2.3+meta' becomes 'v1.2.3', and
+	// expands shorthands, for example 'v1.2' becomes 'v1.2.0'. Invalid versions are still rejected.
+	VersionFormatCanonical
+)
+
+// SetVersionFormat sets how versions are normalized by PutTool. It does not change
+// the versions of tools that are already in the lockfile.
+func (lf *Lockfile) SetVersionFormat(f VersionFormat) {
+	lf.versionFormat = f
+}
+
+// SetCompact sets whether WriteTo uses the compact format, where each tool is written on a single line
+// without indentation. This makes large lockfiles smaller and keeps diffs to one line per changed tool.
+// By default the lockfile is written as indented JSON. Parse detects the format of the lockfile it reads,
+// so a compact lockfile stays compact when it is written again.
+func (lf *Lockfile) SetCompact(compact bool) {
+	lf.compact = compact
+}
+
+// Compact reports whether WriteTo uses the compact format. See SetCompact.
+func (lf *Lockfile) Compact() bool {
+	return lf.compact
+}
+
+// Toolchain returns the version of the Go toolchain that should be used to build tools, for example '1.21.0'.
+// If no toolchain is set, an empty string is returned, meaning the installed Go toolchain is used.
+func (lf *Lockfile) Toolchain() string {
+	return lf.toolchain
+}
+
+// SetToolchain sets the version of the Go toolchain that should be used to build tools, for example '1.21.0'.
+// This makes builds reproducible across machines with different Go installations, since Go 1.21 and newer
+// download the requested toolchain if needed. goVersion must be a full release version, since that is what
+// GOTOOLCHAIN requires, and at least 1.21.0. If goVersion is empty, the toolchain is removed.
+//
+// This is stored as the top level 'goVersion' field. It is unrelated to GoVersion, which is the Go version
+// required by an individual tool.
+func (lf *Lockfile) SetToolchain(goVersion string) error {
+	if goVersion != "" && !isToolchainVersion(goVersion) {
+		return fmt.Errorf("lockfile: invalid toolchain go version %q, must be a release like %s or newer", goVersion, minToolchainVersion)
+	}
+	lf.toolchain = goVersion
+	return nil
 }
 
 // LenTools returns the number of tools stored in the lockfile.
@@ -51,30 +144,67 @@ func (lf *Lockfile) LenTools() int {
 	return len(lf.tools)
 }
 
+// StatsByHost returns the number of tools in the lockfile for each host, keyed by host.
+// The host is the first element of the import path of a tool, for example 'github.com'.
+func (lf *Lockfile) StatsByHost() map[string]int {
+	stats := make(map[string]int)
+	for _, t := range lf.tools {
+		host := t.ImportPath
+		if i := strings.Index(host, "/"); i != -1 {
+			host = host[:i]
+		}
+		stats[host]++
+	}
+	return stats
+}
+
 // GetTool retrieves the tool with the given name from the lockfile.
 // Name can either be the name of the tool itself (i.e. the name of the binary)
-// or it can be the full import path.
+// or it can be the full import path. Either form may contain a version suffix,
+// for example 'stringer@v0.1.0'.
+//
+// If name is the alias of a tool, see SetAlias, that tool is returned. Aliases take precedence
+// over binary names, which allows a specific tool to be referred to when multiple tools have
+// the same binary name.
 //
-// If no tool is found, ErrNotFound is returned. If the name is a full import path
-// and it contains a version, then the version will be checked against the tool found.
-// If the versions do not match, then ErrIncorrectVersion will be returned along with
-// the found version of the tool.
+// If no tool is found, ErrNotFound is returned. If the name contains a version,
+// then the version will be checked against the tool found. If the versions do not
+// match, then ErrIncorrectVersion will be returned along with the found version of the tool.
 func (lf *Lockfile) GetTool(name string) (tool.Tool, error) {
+	// A short name may have a version, i.e. NAME@VERSION. Split it off first
+	// so the fast path can still be used. Import paths are left as is and
+	// are handled by the long way below.
+	shortName, version := name, ""
+	if i := strings.IndexByte(name, '@'); i != -1 && strings.IndexByte(name[:i], '/') == -1 {
+		shortName, version = name[:i], name[i+1:]
+	}
+
+	if t, ok := lf.toolByAlias(shortName); ok {
+		if version != "" && version != t.Version {
+			return t, fmt.Errorf("%w: wanted %s", ErrIncorrectVersion, version)
+		}
+		return t, nil
+	}
+
 	// Fast way, assume the name is just the tool name and see if we get a match
-	bucket, ok := lf.nameMap[name]
+	bucket, ok := lf.nameMap[shortName]
 	if ok {
 		// Tool names must be unique to use the shorthand, otherwise we have no idea
 		// which tool was intended
 		if len(bucket) > 1 {
-			err := fmt.Errorf("%w: %d tools named %s found", ErrMultipleTools, len(bucket), name)
+			err := fmt.Errorf("%w: %d tools named %s found", ErrMultipleTools, len(bucket), shortName)
 			return tool.Tool{}, err
 		}
-		return lf.tools[bucket[0]], nil
+		t := lf.tools[bucket[0]]
+		if version != "" && version != t.Version {
+			return t, fmt.Errorf("%w: wanted %s", ErrIncorrectVersion, version)
+		}
+		return t, nil
 	}
 
 	// Check if it was short name so we can report not found instead of trying to parse
-	if path.Base(name) == name {
-		return tool.Tool{}, fmt.Errorf("%w: %s", ErrNotFound, name)
+	if path.Base(shortName) == shortName {
+		return tool.Tool{}, fmt.Errorf("%w: %s", ErrNotFound, shortName)
 	}
 
 	// Long way, parse the tool name which should be an import path
@@ -102,19 +232,74 @@ func (lf *Lockfile) GetTool(name string) (tool.Tool, error) {
 	return tool.Tool{}, fmt.Errorf("%w: %s", ErrNotFound, toolName)
 }
 
+// toolByAlias returns the tool whose alias is alias, if one exists.
+func (lf *Lockfile) toolByAlias(alias string) (tool.Tool, bool) {
+	for importPath, a := range lf.aliases {
+		if a != alias {
+			continue
+		}
+		for _, ti := range lf.nameMap[path.Base(importPath)] {
+			if t := lf.tools[ti]; t.ImportPath == importPath {
+				return t, true
+			}
+		}
+	}
+	return tool.Tool{}, false
+}
+
+// ToolsByName returns all tools in the lockfile whose binary name is name.
+// The tools are sorted by import path. If no tools match, nil is returned.
+//
+// This is useful to find the candidates when GetTool returns ErrMultipleTools.
+func (lf *Lockfile) ToolsByName(name string) []tool.Tool {
+	bucket := lf.nameMap[name]
+	if len(bucket) == 0 {
+		return nil
+	}
+	tools := make([]tool.Tool, len(bucket))
+	for i, ti := range bucket {
+		tools[i] = lf.tools[ti]
+	}
+	sort.Slice(tools, func(i, j int) bool {
+		return tools[i].ImportPath < tools[j].ImportPath
+	})
+	return tools
+}
+
+// Tools returns all tools in the lockfile sorted by import path.
+// The returned slice is a copy, so it is safe to modify and remains valid
+// if tools are later added to or deleted from the lockfile.
+func (lf *Lockfile) Tools() []tool.Tool {
+	tools := make([]tool.Tool, len(lf.tools))
+	copy(tools, lf.tools)
+	sort.Slice(tools, func(i, j int) bool {
+		return tools[i].ImportPath < tools[j].ImportPath
+	})
+	return tools
+}
+
 // PutTool adds or replaces the given tool in the lockfile.
+// The version of t is normalized based on the version format of the lockfile, see SetVersionFormat.
 //
-// t.Version must be a valid SemVer, that is t.HasSemver() must return true.
-// If t.Version is not a valid SemVer, ErrInvalidVersion will be returned.
+// t must be valid, that is t.Validate() must return nil. In particular t.Version
+// must be a valid SemVer. If t.Version is not a valid SemVer, ErrInvalidVersion
+// will be returned.
 func (lf *Lockfile) PutTool(t tool.Tool) error {
-	if lf.nameMap == nil {
-		lf.nameMap = make(map[string][]int)
+	if lf.versionFormat == VersionFormatCanonical && semver.IsValid(t.Version) {
+		t = t.WithVersion(semver.Canonical(t.Version))
 	}
 
 	// Invariant check: A tool inserted into the lockfile must have Version set to
 	// a valid SemVer otherwise it defeats the purpose of a lockfile.
-	if !t.HasSemver() {
-		return fmt.Errorf("%w: %v", ErrInvalidVersion, t)
+	if err := t.Validate(); err != nil {
+		if !t.HasSemver() {
+			return fmt.Errorf("%w: %v", ErrInvalidVersion, err)
+		}
+		return fmt.Errorf("lockfile: invalid tool %v: %w", t, err)
+	}
+
+	if lf.nameMap == nil {
+		lf.nameMap = make(map[string][]int)
 	}
 
 	toolName := t.Name()
@@ -134,6 +319,15 @@ func (lf *Lockfile) PutTool(t tool.Tool) error {
 
 	// If an existing tool was found then easy, just update it
 	if foundIndex != -1 {
+		// The module may be different for another version so it can't be trusted anymore.
+		// The hash is always different for another version.
+		if lf.tools[foundIndex].Version != t.Version {
+			delete(lf.modules, t.ImportPath)
+			delete(lf.hashes, t.ImportPath)
+			delete(lf.binHashes, t.ImportPath)
+			delete(lf.releaseHashes, t.ImportPath)
+			delete(lf.goVersions, t.ImportPath)
+		}
 		lf.tools[foundIndex] = t
 		return nil
 	}
@@ -172,14 +366,29 @@ func (lf *Lockfile) DeleteTool(t tool.Tool) {
 	if foundIndex == -1 {
 		return
 	}
+	lf.deleteMetadata(t.ImportPath)
 
 	// To efficiently delete, simply replace the the tool at the found index with the last
 	// tool, then resize the slice to drop the last element
-	lf.tools[foundIndex] = lf.tools[len(lf.tools)-1]
-	lf.tools = lf.tools[:len(lf.tools)-1]
+	lastIndex := len(lf.tools) - 1
+	lf.tools[foundIndex] = lf.tools[lastIndex]
+	lf.tools = lf.tools[:lastIndex]
 	// Use the same technique for the bucket
 	bucket[bucketIndex] = bucket[len(bucket)-1]
 	bucket = bucket[:len(bucket)-1]
+	// The last tool was moved so its index needs to be updated in its bucket
+	if foundIndex != lastIndex {
+		movedBucket := bucket
+		if movedName := lf.tools[foundIndex].Name(); movedName != toolName {
+			movedBucket = lf.nameMap[movedName]
+		}
+		for i, ti := range movedBucket {
+			if ti == lastIndex {
+				movedBucket[i] = foundIndex
+				break
+			}
+		}
+	}
 
 	// If bucket is empty, delete it from the map, since no tools with this name exist anymore
 	if len(bucket) == 0 {
@@ -189,6 +398,678 @@ func (lf *Lockfile) DeleteTool(t tool.Tool) {
 	lf.nameMap[toolName] = bucket
 }
 
+// deleteMetadata removes all metadata of the tool with the given import path, like its module and hash.
+func (lf *Lockfile) deleteMetadata(importPath string) {
+	delete(lf.modules, importPath)
+	delete(lf.direct, importPath)
+	delete(lf.hashes, importPath)
+	delete(lf.binHashes, importPath)
+	delete(lf.releases, importPath)
+	delete(lf.releaseHashes, importPath)
+	delete(lf.goVersions, importPath)
+	delete(lf.aliases, importPath)
+	delete(lf.buildFlags, importPath)
+}
+
+// clone returns a deep copy of lf, which can be modified without affecting lf.
+func (lf *Lockfile) clone() *Lockfile {
+	c := *lf
+	c.tools = append([]tool.Tool(nil), lf.tools...)
+	c.nameMap = make(map[string][]int, len(lf.nameMap))
+	for name, bucket := range lf.nameMap {
+		c.nameMap[name] = append([]int(nil), bucket...)
+	}
+	c.modules = copyStringMap(lf.modules)
+	c.hashes = copyStringMap(lf.hashes)
+	c.goVersions = copyStringMap(lf.goVersions)
+	c.aliases = copyStringMap(lf.aliases)
+	c.direct = make(map[string]bool, len(lf.direct))
+	for importPath, direct := range lf.direct {
+		c.direct[importPath] = direct
+	}
+	c.binHashes = make(map[string]map[string]string, len(lf.binHashes))
+	for importPath, hashes := range lf.binHashes {
+		c.binHashes[importPath] = copyStringMap(hashes)
+	}
+	c.releases = make(map[string]BinaryRelease, len(lf.releases))
+	for importPath, br := range lf.releases {
+		c.releases[importPath] = br
+	}
+	c.releaseHashes = make(map[string]map[string]string, len(lf.releaseHashes))
+	for importPath, hashes := range lf.releaseHashes {
+		c.releaseHashes[importPath] = copyStringMap(hashes)
+	}
+	c.buildFlags = make(map[string][]string, len(lf.buildFlags))
+	for importPath, flags := range lf.buildFlags {
+		c.buildFlags[importPath] = append([]string(nil), flags...)
+	}
+	return &c
+}
+
+// copyStringMap returns a copy of m.
+func copyStringMap(m map[string]string) map[string]string {
+	c := make(map[string]string, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+// Module returns the path of the module that provides the tool with the given import path.
+// If the module is not known an empty string is returned, and it must be resolved some other way.
+func (lf *Lockfile) Module(importPath string) string {
+	return lf.modules[importPath]
+}
+
+// SetModule records that the tool with the given import path is provided by
+// the module with path modulePath. If the tool does not exist in the lockfile,
+// ErrNotFound is returned.
+func (lf *Lockfile) SetModule(importPath, modulePath string) error {
+	if err := lf.checkExists(importPath); err != nil {
+		return err
+	}
+	if modulePath == "" {
+		delete(lf.modules, importPath)
+		return nil
+	}
+	if err := checkModule(importPath, modulePath); err != nil {
+		return err
+	}
+	if lf.modules == nil {
+		lf.modules = make(map[string]string)
+	}
+	lf.modules[importPath] = modulePath
+	return nil
+}
+
+// Direct reports whether the tool with the given import path must be downloaded directly
+// from version control instead of through the module proxy.
+func (lf *Lockfile) Direct(importPath string) bool {
+	return lf.direct[importPath]
+}
+
+// SetDirect sets whether the tool with the given import path must be downloaded directly
+// from version control instead of through the module proxy. Unlike the module, this is kept
+// when the version of the tool changes. If the tool does not exist in the lockfile,
+// ErrNotFound is returned.
+func (lf *Lockfile) SetDirect(importPath string, direct bool) error {
+	if err := lf.checkExists(importPath); err != nil {
+		return err
+	}
+	if !direct {
+		delete(lf.direct, importPath)
+		return nil
+	}
+	if lf.direct == nil {
+		lf.direct = make(map[string]bool)
+	}
+	lf.direct[importPath] = true
+	return nil
+}
+
+// Hash returns the hash of the content of the module that provides the tool with the given import path.
+// It has the same format as the hashes in go.sum, for example 'h1:...'. If no hash is recorded,
+// an empty string is returned, in which case the module can't be verified.
+func (lf *Lockfile) Hash(importPath string) string {
+	return lf.hashes[importPath]
+}
+
+// SetHash records the hash of the content of the module that provides the tool with the given
+// import path, for the version of the tool in the lockfile. The hash is cleared if the version
+// of the tool changes. If hash is empty, the recorded hash is removed. If the tool does not
+// exist in the lockfile, ErrNotFound is returned.
+func (lf *Lockfile) SetHash(importPath, hash string) error {
+	if err := lf.checkExists(importPath); err != nil {
+		return err
+	}
+	if hash == "" {
+		delete(lf.hashes, importPath)
+		return nil
+	}
+	if err := checkHash(importPath, hash); err != nil {
+		return err
+	}
+	if lf.hashes == nil {
+		lf.hashes = make(map[string]string)
+	}
+	lf.hashes[importPath] = hash
+	return nil
+}
+
+// BinHash returns the hash of the binary built for the tool with the given import path on platform.
+// platform identifies the OS, architecture and Go toolchain used to build the binary, since the same
+// tool produces a different binary on each. If no hash is recorded for platform, an empty string is returned.
+func (lf *Lockfile) BinHash(importPath, platform string) string {
+	return lf.binHashes[importPath][platform]
+}
+
+// HasBinHashes reports whether any binary hashes are recorded for the tool with the given import path.
+func (lf *Lockfile) HasBinHashes(importPath string) bool {
+	return len(lf.binHashes[importPath]) > 0
+}
+
+// SetBinHash records the hash of the binary built for the tool with the given import path on platform.
+// Hashes for other platforms are kept. All binary hashes are cleared if the version of the tool changes.
+// If hash is empty, the recorded hash for platform is removed. If the tool does not exist in the lockfile,
+// ErrNotFound is returned.
+func (lf *Lockfile) SetBinHash(importPath, platform, hash string) error {
+	if err := lf.checkExists(importPath); err != nil {
+		return err
+	}
+	if hash == "" {
+		delete(lf.binHashes[importPath], platform)
+		if len(lf.binHashes[importPath]) == 0 {
+			delete(lf.binHashes, importPath)
+		}
+		return nil
+	}
+	if platform == "" {
+		return fmt.Errorf("lockfile: platform of binary hash for tool %s must not be empty", importPath)
+	}
+	if err := checkHash(importPath, hash); err != nil {
+		return err
+	}
+	if lf.binHashes == nil {
+		lf.binHashes = make(map[string]map[string]string)
+	}
+	if lf.binHashes[importPath] == nil {
+		lf.binHashes[importPath] = make(map[string]string)
+	}
+	lf.binHashes[importPath][platform] = hash
+	return nil
+}
+
+// BinaryRelease describes a prebuilt binary of a tool that is published as a GitHub release asset.
+// It is used for tools that cannot be built from source with the go command.
+type BinaryRelease struct {
+	// Repo is the GitHub repository that publishes the releases, with the format 'OWNER/NAME'.
+	Repo string
+	// Asset is the name of the release asset that contains the binary. It may contain the
+	// placeholders '{os}', '{arch}' and '{version}', which are replaced by the GOOS, GOARCH
+	// and version of the tool, for example 'tool_{version}_{os}_{arch}.tar.gz'.
+	Asset string
+}
+
+// IsZero reports whether br is the zero value, meaning the tool is built from source.
+func (br BinaryRelease) IsZero() bool {
+	return br == BinaryRelease{}
+}
+
+// BinaryRelease returns the binary release that the tool with the given import path is downloaded from.
+// If the tool is built from source, the zero value is returned.
+func (lf *Lockfile) BinaryRelease(importPath string) BinaryRelease {
+	return lf.releases[importPath]
+}
+
+// SetBinaryRelease records that the tool with the given import path is downloaded from the binary release br
+// instead of being built from source. Like direct, this is kept when the version of the tool changes.
+// If br is the zero value, the tool is built from source again. If the tool does not exist in the lockfile,
+// ErrNotFound is returned.
+func (lf *Lockfile) SetBinaryRelease(importPath string, br BinaryRelease) error {
+	if err := lf.checkExists(importPath); err != nil {
+		return err
+	}
+	if br.IsZero() {
+		delete(lf.releases, importPath)
+		delete(lf.releaseHashes, importPath)
+		return nil
+	}
+	if err := checkBinaryRelease(importPath, br); err != nil {
+		return err
+	}
+	// The hashes are for a different asset
+	if lf.releases[importPath] != br {
+		delete(lf.releaseHashes, importPath)
+	}
+	if lf.releases == nil {
+		lf.releases = make(map[string]BinaryRelease)
+	}
+	lf.releases[importPath] = br
+	return nil
+}
+
+// ReleaseHash returns the hash of the binary release asset the tool with the given import path
+// was downloaded from on platform, which has the format 'GOOS/GOARCH'. If no hash is recorded,
+// an empty string is returned.
+func (lf *Lockfile) ReleaseHash(importPath, platform string) string {
+	return lf.releaseHashes[importPath][platform]
+}
+
+// SetReleaseHash records the hash of the binary release asset the tool with the given import path
+// was downloaded from on platform, which has the format 'GOOS/GOARCH'. Each platform downloads a different
+// asset, so hashes for other platforms are kept. All release hashes are cleared if the version or binary
+// release of the tool changes. If hash is empty, the recorded hash for platform is removed.
+// If the tool does not exist in the lockfile, ErrNotFound is returned, and if it is not downloaded
+// from a binary release, an error is returned.
+func (lf *Lockfile) SetReleaseHash(importPath, platform, hash string) error {
+	if err := lf.checkExists(importPath); err != nil {
+		return err
+	}
+	if hash == "" {
+		delete(lf.releaseHashes[importPath], platform)
+		if len(lf.releaseHashes[importPath]) == 0 {
+			delete(lf.releaseHashes, importPath)
+		}
+		return nil
+	}
+	if _, ok := lf.releases[importPath]; !ok {
+		return fmt.Errorf("lockfile: tool %s is not downloaded from a binary release", importPath)
+	}
+	if err := checkReleaseHash(importPath, platform, hash); err != nil {
+		return err
+	}
+	if lf.releaseHashes == nil {
+		lf.releaseHashes = make(map[string]map[string]string)
+	}
+	if lf.releaseHashes[importPath] == nil {
+		lf.releaseHashes[importPath] = make(map[string]string)
+	}
+	lf.releaseHashes[importPath][platform] = hash
+	return nil
+}
+
+// checkReleaseHash checks that hash is a valid hash of a release asset for platform.
+func checkReleaseHash(importPath, platform, hash string) error {
+	if parts := strings.Split(platform, "/"); len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return fmt.Errorf("lockfile: invalid platform %q of release hash for tool %s, must have the format GOOS/GOARCH", platform, importPath)
+	}
+	return checkHash(importPath, hash)
+}
+
+// Validate checks that br has a repo with the format 'OWNER/NAME' and an asset name.
+func (br BinaryRelease) Validate() error {
+	parts := strings.Split(br.Repo, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return fmt.Errorf("invalid binary release repo %q, must have the format OWNER/NAME", br.Repo)
+	}
+	if br.Asset == "" || strings.ContainsAny(br.Asset, "/\\") {
+		return fmt.Errorf("invalid binary release asset %q", br.Asset)
+	}
+	return nil
+}
+
+// checkBinaryRelease checks that br is valid for the tool with the given import path.
+func checkBinaryRelease(importPath string, br BinaryRelease) error {
+	if err := br.Validate(); err != nil {
+		return fmt.Errorf("lockfile: tool %s: %w", importPath, err)
+	}
+	return nil
+}
+
+// GoVersion returns the Go version required by the module that provides the tool with the
+// given import path, for example '1.17'. If no Go version is recorded, an empty string is returned.
+func (lf *Lockfile) GoVersion(importPath string) string {
+	return lf.goVersions[importPath]
+}
+
+// SetGoVersion records the Go version required by the module that provides the tool with the
+// given import path, for the version of the tool in the lockfile. It is cleared if the version
+// of the tool changes. If goVersion is empty, the recorded Go version is removed. If the tool does
+// not exist in the lockfile, ErrNotFound is returned.
+func (lf *Lockfile) SetGoVersion(importPath, goVersion string) error {
+	if err := lf.checkExists(importPath); err != nil {
+		return err
+	}
+	if goVersion == "" {
+		delete(lf.goVersions, importPath)
+		return nil
+	}
+	if err := checkGoVersion(importPath, goVersion); err != nil {
+		return err
+	}
+	if lf.goVersions == nil {
+		lf.goVersions = make(map[string]string)
+	}
+	lf.goVersions[importPath] = goVersion
+	return nil
+}
+
+// Alias returns the alias of the tool with the given import path.
+// If the tool has no alias, an empty string is returned.
+func (lf *Lockfile) Alias(importPath string) string {
+	return lf.aliases[importPath]
+}
+
+// SetAlias sets an alias for the tool with the given import path. The alias can be used instead of
+// the binary name to get the tool, see GetTool, and the binary of the tool is installed under the alias.
+// This allows tools with the same binary name to be distinguished without using the full import path.
+// Like direct, the alias is kept when the version of the tool changes.
+//
+// alias must be a valid file name, that is it must not contain a path separator or '@'.
+// It must also not be the alias of another tool. If alias is empty, the alias is removed.
+// If the tool does not exist in the lockfile, ErrNotFound is returned.
+func (lf *Lockfile) SetAlias(importPath, alias string) error {
+	if err := lf.checkExists(importPath); err != nil {
+		return err
+	}
+	if alias == "" {
+		delete(lf.aliases, importPath)
+		return nil
+	}
+	if err := checkAlias(importPath, alias); err != nil {
+		return err
+	}
+	for otherPath, a := range lf.aliases {
+		if a == alias && otherPath != importPath {
+			return fmt.Errorf("lockfile: alias %q for tool %s is already used by tool %s", alias, importPath, otherPath)
+		}
+	}
+	if lf.aliases == nil {
+		lf.aliases = make(map[string]string)
+	}
+	lf.aliases[importPath] = alias
+	return nil
+}
+
+// BuildFlags returns the extra flags passed to go build when building the tool with the given import path.
+// If the tool has no build flags, nil is returned. The returned slice is a copy and can be modified.
+func (lf *Lockfile) BuildFlags(importPath string) []string {
+	flags := lf.buildFlags[importPath]
+	if len(flags) == 0 {
+		return nil
+	}
+	return append([]string(nil), flags...)
+}
+
+// SetBuildFlags sets extra flags that are passed to go build when building the tool with the given import path,
+// for example '-ldflags=-X main.version=v1.0.0' or '-tags=netgo'. Like the alias, the build flags are kept
+// when the version of the tool changes.
+//
+// The flags must be valid according to tool.ValidateBuildFlags.
+// If flags is empty, the build flags are removed. If the tool does not exist in the lockfile, ErrNotFound is returned.
+func (lf *Lockfile) SetBuildFlags(importPath string, flags []string) error {
+	if err := lf.checkExists(importPath); err != nil {
+		return err
+	}
+	if len(flags) == 0 {
+		delete(lf.buildFlags, importPath)
+		return nil
+	}
+	if err := tool.ValidateBuildFlags(flags); err != nil {
+		return fmt.Errorf("lockfile: tool %s: %w", importPath, err)
+	}
+	if lf.buildFlags == nil {
+		lf.buildFlags = make(map[string][]string)
+	}
+	lf.buildFlags[importPath] = append([]string(nil), flags...)
+	return nil
+}
+
+// checkAlias checks that alias can be used as the name of a binary.
+func checkAlias(importPath, alias string) error {
+	if alias == "." || alias == ".." || strings.ContainsAny(alias, "/\\@") {
+		return fmt.Errorf("lockfile: invalid alias %q for tool %s", alias, importPath)
+	}
+	return nil
+}
+
+// checkGoVersion checks that goVersion is a Go version like the ones in go directives, for example '1.17'.
+func checkGoVersion(importPath, goVersion string) error {
+	if !isGoVersion(goVersion) {
+		return fmt.Errorf("lockfile: invalid go version %q for tool %s", goVersion, importPath)
+	}
+	return nil
+}
+
+// isGoVersion reports whether v is a release version of Go without the 'go' prefix, for example '1.17' or '1.21.0'.
+func isGoVersion(v string) bool {
+	// The semver package requires strings to be prefixed with 'v' to be considered valid
+	return semver.IsValid("v"+v) && semver.Prerelease("v"+v) == "" && semver.Build("v"+v) == ""
+}
+
+// minToolchainVersion is the first version of Go that supports selecting the toolchain with GOTOOLCHAIN.
+const minToolchainVersion = "1.21.0"
+
+// isToolchainVersion reports whether v is a full release version of Go without the 'go' prefix that can be used
+// with GOTOOLCHAIN, for example '1.21.0'. Versions like '1.21' only name a language version, not a release.
+func isToolchainVersion(v string) bool {
+	if !isGoVersion(v) || strings.Count(v, ".") != 2 {
+		return false
+	}
+	return semver.Compare("v"+v, "v"+minToolchainVersion) >= 0
+}
+
+// checkHash checks that hash has the form '<algorithm>:<digest>', like the hashes in go.sum.
+func checkHash(importPath, hash string) error {
+	if i := strings.Index(hash, ":"); i <= 0 || i == len(hash)-1 {
+		return fmt.Errorf("lockfile: invalid hash %q for tool %s", hash, importPath)
+	}
+	return nil
+}
+
+// checkExists returns ErrNotFound if there is no tool with the given import path in the lockfile.
+func (lf *Lockfile) checkExists(importPath string) error {
+	t, err := tool.ParseLax(importPath)
+	if err != nil {
+		return err
+	}
+	for _, ti := range lf.nameMap[t.Name()] {
+		if lf.tools[ti].ImportPath == importPath {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrNotFound, importPath)
+}
+
+// checkModule checks that modulePath is a valid module path for the tool with the given import path.
+// That is, the import path must be within the module.
+func checkModule(importPath, modulePath string) error {
+	if importPath != modulePath && !strings.HasPrefix(importPath, modulePath+"/") {
+		return fmt.Errorf("lockfile: module %s does not contain tool %s", modulePath, importPath)
+	}
+	return nil
+}
+
+// MergeStrategy controls which tool is kept by Merge when both lockfiles contain a tool with the same import path.
+type MergeStrategy int
+
+const (
+	// PreferOther replaces the tool in the lockfile with the tool from the other lockfile.
+	// This is the default.
+	PreferOther MergeStrategy = iota
+	// PreferReceiver keeps the tool in the lockfile and ignores the tool from the other lockfile.
+	PreferReceiver
+	// PreferHigherVersion keeps whichever tool has the higher version, as determined by semver.Compare.
+	// If both versions are equal, the tool in the lockfile is kept.
+	PreferHigherVersion
+)
+
+// String returns the name of the merge strategy.
+func (ms MergeStrategy) String() string {
+	switch ms {
+	case PreferOther:
+		return "PreferOther"
+	case PreferReceiver:
+		return "PreferReceiver"
+	case PreferHigherVersion:
+		return "PreferHigherVersion"
+	}
+	return fmt.Sprintf("MergeStrategy(%d)", int(ms))
+}
+
+// Merge adds all tools in other to the lockfile. If a tool with the same import path already exists
+// in the lockfile, strategy determines which one is kept. The metadata of a tool, like its module and hash,
+// is kept or replaced along with the tool. This can be used to resolve conflicts between the lockfiles
+// of two branches that each added or updated tools.
+//
+// The toolchain is resolved using the same strategy, where a lockfile without a toolchain
+// never replaces the toolchain of the other lockfile.
+//
+// Merge is atomic, if an error is returned the lockfile is not modified. This can happen if the
+// merged tools can't coexist, for example if two tools end up with the same alias.
+func (lf *Lockfile) Merge(other *Lockfile, strategy MergeStrategy) error {
+	switch strategy {
+	case PreferOther, PreferReceiver, PreferHigherVersion:
+	default:
+		return fmt.Errorf("lockfile: invalid merge strategy %s", strategy)
+	}
+	// Merge into a copy so that the lockfile is left as is if any tool can't be merged.
+	merged := lf.clone()
+	if other.toolchain != "" && preferOther(strategy, lf.toolchain == "", "v"+lf.toolchain, "v"+other.toolchain) {
+		merged.toolchain = other.toolchain
+	}
+	var replaced []tool.Tool
+	for _, t := range other.tools {
+		existing, ok := lf.lookup(t.ImportPath)
+		if !preferOther(strategy, !ok, existing.Version, t.Version) {
+			continue
+		}
+		if err := merged.PutTool(t); err != nil {
+			return err
+		}
+		// None of the metadata of the existing tool is kept, only what other has for the tool.
+		// Clear it for all tools first, so that an alias moving between tools doesn't conflict.
+		merged.deleteMetadata(t.ImportPath)
+		replaced = append(replaced, t)
+	}
+	for _, t := range replaced {
+		if err := merged.mergeMetadata(other, t.ImportPath); err != nil {
+			return err
+		}
+	}
+	*lf = *merged
+	return nil
+}
+
+// mergeMetadata sets the metadata of the tool with the given import path to the metadata in other.
+func (lf *Lockfile) mergeMetadata(other *Lockfile, importPath string) error {
+	if mod := other.Module(importPath); mod != "" {
+		if err := lf.SetModule(importPath, mod); err != nil {
+			return err
+		}
+	}
+	if hash := other.Hash(importPath); hash != "" {
+		if err := lf.SetHash(importPath, hash); err != nil {
+			return err
+		}
+	}
+	for platform, hash := range other.binHashes[importPath] {
+		if err := lf.SetBinHash(importPath, platform, hash); err != nil {
+			return err
+		}
+	}
+	if other.Direct(importPath) {
+		if err := lf.SetDirect(importPath, true); err != nil {
+			return err
+		}
+	}
+	if br := other.BinaryRelease(importPath); !br.IsZero() {
+		if err := lf.SetBinaryRelease(importPath, br); err != nil {
+			return err
+		}
+	}
+	for platform, hash := range other.releaseHashes[importPath] {
+		if err := lf.SetReleaseHash(importPath, platform, hash); err != nil {
+			return err
+		}
+	}
+	if goVersion := other.GoVersion(importPath); goVersion != "" {
+		if err := lf.SetGoVersion(importPath, goVersion); err != nil {
+			return err
+		}
+	}
+	if alias := other.Alias(importPath); alias != "" {
+		if err := lf.SetAlias(importPath, alias); err != nil {
+			return err
+		}
+	}
+	if flags := other.BuildFlags(importPath); len(flags) > 0 {
+		if err := lf.SetBuildFlags(importPath, flags); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// preferOther reports whether Merge should use the value from the other lockfile, which has version otherVersion,
+// over the value in the receiver, which has version version. missing reports whether the receiver has no value.
+func preferOther(strategy MergeStrategy, missing bool, version, otherVersion string) bool {
+	if missing {
+		return true
+	}
+	switch strategy {
+	case PreferReceiver:
+		return false
+	case PreferHigherVersion:
+		return semver.Compare(otherVersion, version) > 0
+	}
+	return true
+}
+
+// lookup returns the tool with the given import path in the lockfile, if it exists.
+func (lf *Lockfile) lookup(importPath string) (tool.Tool, bool) {
+	t, err := tool.ParseLax(importPath)
+	if err != nil {
+		return tool.Tool{}, false
+	}
+	for _, ti := range lf.nameMap[t.Name()] {
+		if lf.tools[ti].ImportPath == importPath {
+			return lf.tools[ti], true
+		}
+	}
+	return tool.Tool{}, false
+}
+
+// ToolChange describes a tool whose version differs between two lockfiles.
+type ToolChange struct {
+	ImportPath string
+	OldVersion string
+	NewVersion string
+}
+
+// LockfileDiff contains the differences between two lockfiles. Tools are compared by
+// import path, and each list is sorted by import path.
+type LockfileDiff struct {
+	// Added contains the tools that are only in the new lockfile.
+	Added []tool.Tool
+	// Removed contains the tools that are only in the old lockfile.
+	Removed []tool.Tool
+	// Changed contains the tools that are in both lockfiles with different versions.
+	Changed []ToolChange
+}
+
+// IsEmpty reports whether the lockfiles have the same tools with the same versions.
+func (d LockfileDiff) IsEmpty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// Diff compares the lockfile to other, treating lf as the old lockfile and other as the new one.
+// Only the tools and their versions are compared, other metadata like hashes is ignored.
+func (lf *Lockfile) Diff(other *Lockfile) LockfileDiff {
+	var d LockfileDiff
+	oldVersions := make(map[string]string, len(lf.tools))
+	for _, t := range lf.tools {
+		oldVersions[t.ImportPath] = t.Version
+	}
+	inNew := make(map[string]bool, len(other.tools))
+	for _, t := range other.tools {
+		inNew[t.ImportPath] = true
+		oldVersion, ok := oldVersions[t.ImportPath]
+		switch {
+		case !ok:
+			d.Added = append(d.Added, t)
+		case oldVersion != t.Version:
+			d.Changed = append(d.Changed, ToolChange{ImportPath: t.ImportPath, OldVersion: oldVersion, NewVersion: t.Version})
+		}
+	}
+	for _, t := range lf.tools {
+		if !inNew[t.ImportPath] {
+			d.Removed = append(d.Removed, t)
+		}
+	}
+
+	sort.Slice(d.Added, func(i, j int) bool {
+		return d.Added[i].ImportPath < d.Added[j].ImportPath
+	})
+	sort.Slice(d.Removed, func(i, j int) bool {
+		return d.Removed[i].ImportPath < d.Removed[j].ImportPath
+	})
+	sort.Slice(d.Changed, func(i, j int) bool {
+		return d.Changed[i].ImportPath < d.Changed[j].ImportPath
+	})
+	return d
+}
+
 // Iterator allows for iteration over the tools within a Lockfile.
 // An iterator provides two methods that can be used for iteration, Next and Value.
 // Next advances the iterator to the next element and returns a bool indicating if
@@ -229,13 +1110,14 @@ func (it *Iterator) Value() tool.Tool {
 // WriteTo serializes and writes the lockfile to w. It returns the
 // number of bytes written and any error that occurred.
 func (lf *Lockfile) WriteTo(w io.Writer) (int64, error) {
-	// Convert lockfile to format that can be serialized into JSON
-	lfSchema := lockfileSchema{Tools: make(map[string]toolSchema)}
-	for _, t := range lf.tools {
-		lfSchema.Tools[t.ImportPath] = toolSchema{Version: t.Version}
+	lfSchema := lf.toSchema()
+	var data []byte
+	var err error
+	if lf.compact {
+		data, err = lfSchema.marshalCompact()
+	} else {
+		data, err = json.MarshalIndent(lfSchema, "", "  ")
 	}
-
-	data, err := json.MarshalIndent(lfSchema, "", "  ")
 	if err != nil {
 		return 0, fmt.Errorf("lockfile: failed to serialize as JSON: %w", err)
 	}
@@ -253,26 +1135,307 @@ func (lf *Lockfile) WriteTo(w io.Writer) (int64, error) {
 	return int64(n), nil
 }
 
+// MarshalJSON implements json.Marshaler. The lockfile is serialized in the same format as WriteTo,
+// so that it can be embedded in a larger JSON document. The output is always compact JSON.
+func (lf *Lockfile) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(lf.toSchema())
+	if err != nil {
+		return nil, fmt.Errorf("lockfile: failed to serialize as JSON: %w", err)
+	}
+	return data, nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler. data is parsed the same way as Parse and replaces
+// the tools in lf. Settings that aren't part of the JSON, like the version format and whether
+// the lockfile is compact, are kept, since the format of embedded JSON can't be detected.
+func (lf *Lockfile) UnmarshalJSON(data []byte) error {
+	parsed, err := Parse(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	parsed.versionFormat = lf.versionFormat
+	parsed.compact = lf.compact
+	*lf = *parsed
+	return nil
+}
+
+// toSchema converts lf to the format that is serialized into JSON.
+func (lf *Lockfile) toSchema() outLockfileSchema {
+	// Tools are sorted explicitly so the output is always byte for byte identical
+	// for the same tools, regardless of the order they were added in.
+	lfSchema := outLockfileSchema{Tools: make(sortedTools, 0, len(lf.tools)), GoVersion: lf.toolchain}
+	for _, t := range lf.tools {
+		tlSchema := toolSchema{
+			Version:    t.Version,
+			Module:     lf.modules[t.ImportPath],
+			Direct:     lf.direct[t.ImportPath],
+			Hash:       lf.hashes[t.ImportPath],
+			BinHash:    lf.binHashes[t.ImportPath],
+			Go:         lf.goVersions[t.ImportPath],
+			Alias:      lf.aliases[t.ImportPath],
+			BuildFlags: lf.buildFlags[t.ImportPath],
+		}
+		if br, ok := lf.releases[t.ImportPath]; ok {
+			tlSchema.BinaryRelease = &binaryReleaseSchema{Repo: br.Repo, Asset: br.Asset, Hashes: lf.releaseHashes[t.ImportPath]}
+		}
+		lfSchema.Tools = append(lfSchema.Tools, sortedTool{importPath: t.ImportPath, schema: tlSchema})
+	}
+	sort.Slice(lfSchema.Tools, func(i, j int) bool {
+		return lfSchema.Tools[i].importPath < lfSchema.Tools[j].importPath
+	})
+	return lfSchema
+}
+
 type toolSchema struct {
 	Version string `json:"version"`
+	// Module is the path of the module that provides the tool. It is optional.
+	Module string `json:"module,omitempty"`
+	// Direct is set if the tool must be downloaded directly from version control. It is optional.
+	Direct bool `json:"direct,omitempty"`
+	// Hash is the go.sum hash of the content of the module that provides the tool. It is optional.
+	Hash string `json:"hash,omitempty"`
+	// BinHash contains the hashes of the built binary keyed by platform. It is optional.
+	BinHash map[string]string `json:"binHash,omitempty"`
+	// BinaryRelease is set if the tool is downloaded from a binary release instead of being built. It is optional.
+	BinaryRelease *binaryReleaseSchema `json:"binaryRelease,omitempty"`
+	// Go is the Go version required by the module that provides the tool. It is optional.
+	Go string `json:"go,omitempty"`
+	// Alias is an alternative name for the tool and its binary. It is optional.
+	Alias string `json:"alias,omitempty"`
+	// BuildFlags are extra flags passed to go build when building the tool. It is optional.
+	BuildFlags []string `json:"buildFlags,omitempty"`
+}
+
+type binaryReleaseSchema struct {
+	Repo  string `json:"repo"`
+	Asset string `json:"asset"`
+	// Hashes contains the hashes of the downloaded asset keyed by platform. It is optional.
+	Hashes map[string]string `json:"hashes,omitempty"`
 }
 
 type lockfileSchema struct {
 	Tools map[string]toolSchema `json:"tools"`
+	// GoVersion is the version of the Go toolchain used to build tools. It is optional.
+	GoVersion string `json:"goVersion,omitempty"`
+}
+
+// outLockfileSchema is the same as lockfileSchema but is used for writing.
+// The tools are serialized as a JSON object in the order of the slice.
+type outLockfileSchema struct {
+	Tools     sortedTools `json:"tools"`
+	GoVersion string      `json:"goVersion,omitempty"`
+}
+
+type sortedTool struct {
+	importPath string
+	schema     toolSchema
+}
+
+// sortedTools is a list of tools that is serialized as a JSON object keyed by import path.
+// Unlike a map, the keys are written in the order of the slice.
+type sortedTools []sortedTool
+
+func (st sortedTools) MarshalJSON() ([]byte, error) {
+	return st.marshal(",")
+}
+
+// compactPrefix is the start of a lockfile written in the compact format.
+const compactPrefix = `{"tools":{`
+
+// marshalCompact serializes lfSchema as a complete lockfile in the compact format,
+// where each tool is on its own line.
+func (lfSchema outLockfileSchema) marshalCompact() ([]byte, error) {
+	tools, err := lfSchema.Tools.marshal(",\n")
+	if err != nil {
+		return nil, err
+	}
+	data := []byte(compactPrefix)
+	if len(lfSchema.Tools) > 0 {
+		// Put the first and last tools on their own lines as well.
+		data = append(data, '\n')
+		data = append(data, tools[1:len(tools)-1]...)
+		data = append(data, '\n')
+	}
+	data = append(data, '}')
+	// The tools must come first so the compact format can be detected, see readLockfileData.
+	if lfSchema.GoVersion != "" {
+		goVersion, err := json.Marshal(lfSchema.GoVersion)
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, `,"goVersion":`...)
+		data = append(data, goVersion...)
+	}
+	return append(data, '}'), nil
+}
+
+// marshal serializes st as a JSON object using sep to separate tools.
+func (st sortedTools) marshal(sep string) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, t := range st {
+		if i > 0 {
+			buf.WriteString(sep)
+		}
+		key, err := json.Marshal(t.importPath)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(t.schema)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// readLockfileData reads all of r and reports whether the lockfile uses the compact format.
+func readLockfileData(r io.Reader) ([]byte, bool, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, false, fmt.Errorf("lockfile: failed to read: %w", err)
+	}
+	return data, bytes.HasPrefix(data, []byte(compactPrefix)), nil
+}
+
+// checkDuplicateTools returns an error for each import path that appears more than once in the
+// tools object of the lockfile JSON in data. Decoding into a map would silently keep the last one,
+// hiding a mistake, for example from resolving a merge conflict in the lockfile.
+// data must already be known to be valid JSON.
+func checkDuplicateTools(data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	// Opening brace of the lockfile object
+	if _, err := dec.Token(); err != nil {
+		return fmt.Errorf("lockfile: failed to deserialize JSON: %w", err)
+	}
+	var errs errors.List
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return fmt.Errorf("lockfile: failed to deserialize JSON: %w", err)
+		}
+		if key != "tools" {
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return fmt.Errorf("lockfile: failed to deserialize JSON: %w", err)
+			}
+			continue
+		}
+		// tools may be null, in which case there are no tools to check
+		if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+			continue
+		}
+		seen := make(map[string]bool)
+		for dec.More() {
+			tok, err := dec.Token()
+			if err != nil {
+				return fmt.Errorf("lockfile: failed to deserialize JSON: %w", err)
+			}
+			importPath, _ := tok.(string)
+			if seen[importPath] {
+				errs = append(errs, fmt.Errorf("lockfile: duplicate tool %s", importPath))
+			}
+			seen[importPath] = true
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return fmt.Errorf("lockfile: failed to deserialize JSON: %w", err)
+			}
+		}
+		// Closing brace of the tools object
+		if _, err := dec.Token(); err != nil {
+			return fmt.Errorf("lockfile: failed to deserialize JSON: %w", err)
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
 }
 
 // Parse reads from r and parses the data into a Lockfile struct.
+// Unknown fields are ignored so that lockfiles written by newer versions of shed
+// can still be read. Use ParseStrict to report them as errors instead.
+//
+// An error is returned if the same import path appears more than once. Distinct import paths
+// that have the same binary name are allowed, but GetTool returns ErrMultipleTools for the
+// binary name, so the full import path must be used to get them.
 func Parse(r io.Reader) (*Lockfile, error) {
+	data, compact, err := readLockfileData(r)
+	if err != nil {
+		return nil, err
+	}
 	lfSchema := lockfileSchema{}
-	err := json.NewDecoder(r).Decode(&lfSchema)
+	if err := json.NewDecoder(bytes.NewReader(data)).Decode(&lfSchema); err != nil {
+		return nil, fmt.Errorf("lockfile: failed to deserialize JSON: %w", err)
+	}
+	if err := checkDuplicateTools(data); err != nil {
+		return nil, err
+	}
+	lf, err := fromSchema(lfSchema)
+	if err != nil {
+		return nil, err
+	}
+	lf.compact = compact
+	return lf, nil
+}
+
+// ParseStrict is like Parse but returns an error if the lockfile contains any unknown fields.
+// This is useful to catch mistakes in hand edited lockfiles, like misspelling 'version'.
+func ParseStrict(r io.Reader) (*Lockfile, error) {
+	var rawSchema struct {
+		Tools     map[string]json.RawMessage `json:"tools"`
+		GoVersion string                     `json:"goVersion"`
+	}
+	data, compact, err := readLockfileData(r)
 	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&rawSchema); err != nil {
 		return nil, fmt.Errorf("lockfile: failed to deserialize JSON: %w", err)
 	}
+	if err := checkDuplicateTools(data); err != nil {
+		return nil, err
+	}
 
+	// Decode each tool separately so the error can say which tool has the unknown field.
+	lfSchema := lockfileSchema{Tools: make(map[string]toolSchema, len(rawSchema.Tools)), GoVersion: rawSchema.GoVersion}
+	var errs errors.List
+	for importPath, raw := range rawSchema.Tools {
+		var tlSchema toolSchema
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&tlSchema); err != nil {
+			errs = append(errs, fmt.Errorf("lockfile: failed to deserialize tool %s: %w", importPath, err))
+			continue
+		}
+		lfSchema.Tools[importPath] = tlSchema
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	lf, err := fromSchema(lfSchema)
+	if err != nil {
+		return nil, err
+	}
+	lf.compact = compact
+	return lf, nil
+}
+
+// fromSchema creates a Lockfile from the deserialized lockfile.
+func fromSchema(lfSchema lockfileSchema) (*Lockfile, error) {
 	lf := &Lockfile{nameMap: make(map[string][]int)}
 	// Parse all the tools in the lockfile. If errors are encountered, save
 	// them and continue. This way multiple errors can be reported at once.
 	var errs errors.List
+	if err := lf.SetToolchain(lfSchema.GoVersion); err != nil {
+		errs = append(errs, err)
+	}
 	for importPath, tlSchema := range lfSchema.Tools {
 		t, err := tool.Parse(importPath + "@" + tlSchema.Version)
 		if err != nil {
@@ -284,6 +1447,112 @@ func Parse(r io.Reader) (*Lockfile, error) {
 		bucket := lf.nameMap[toolName]
 		lf.nameMap[toolName] = append(bucket, len(lf.tools))
 		lf.tools = append(lf.tools, t)
+		if tlSchema.Hash != "" {
+			if err := checkHash(t.ImportPath, tlSchema.Hash); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			if lf.hashes == nil {
+				lf.hashes = make(map[string]string)
+			}
+			lf.hashes[t.ImportPath] = tlSchema.Hash
+		}
+		for platform, hash := range tlSchema.BinHash {
+			if err := checkHash(t.ImportPath, hash); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			if lf.binHashes == nil {
+				lf.binHashes = make(map[string]map[string]string)
+			}
+			if lf.binHashes[t.ImportPath] == nil {
+				lf.binHashes[t.ImportPath] = make(map[string]string)
+			}
+			lf.binHashes[t.ImportPath][platform] = hash
+		}
+		if tlSchema.Go != "" {
+			if err := checkGoVersion(t.ImportPath, tlSchema.Go); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			if lf.goVersions == nil {
+				lf.goVersions = make(map[string]string)
+			}
+			lf.goVersions[t.ImportPath] = tlSchema.Go
+		}
+		if tlSchema.BinaryRelease != nil {
+			br := BinaryRelease{Repo: tlSchema.BinaryRelease.Repo, Asset: tlSchema.BinaryRelease.Asset}
+			if err := checkBinaryRelease(t.ImportPath, br); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			if lf.releases == nil {
+				lf.releases = make(map[string]BinaryRelease)
+			}
+			lf.releases[t.ImportPath] = br
+			for platform, hash := range tlSchema.BinaryRelease.Hashes {
+				if err := checkReleaseHash(t.ImportPath, platform, hash); err != nil {
+					errs = append(errs, err)
+					continue
+				}
+				if lf.releaseHashes == nil {
+					lf.releaseHashes = make(map[string]map[string]string)
+				}
+				if lf.releaseHashes[t.ImportPath] == nil {
+					lf.releaseHashes[t.ImportPath] = make(map[string]string)
+				}
+				lf.releaseHashes[t.ImportPath][platform] = hash
+			}
+		}
+		if tlSchema.Direct {
+			if lf.direct == nil {
+				lf.direct = make(map[string]bool)
+			}
+			lf.direct[t.ImportPath] = true
+		}
+		if tlSchema.Alias != "" {
+			if err := checkAlias(t.ImportPath, tlSchema.Alias); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			if lf.aliases == nil {
+				lf.aliases = make(map[string]string)
+			}
+			lf.aliases[t.ImportPath] = tlSchema.Alias
+		}
+		if len(tlSchema.BuildFlags) > 0 {
+			if err := tool.ValidateBuildFlags(tlSchema.BuildFlags); err != nil {
+				errs = append(errs, fmt.Errorf("lockfile: tool %s: %w", t.ImportPath, err))
+				continue
+			}
+			if lf.buildFlags == nil {
+				lf.buildFlags = make(map[string][]string)
+			}
+			lf.buildFlags[t.ImportPath] = tlSchema.BuildFlags
+		}
+		if tlSchema.Module != "" {
+			if err := checkModule(t.ImportPath, tlSchema.Module); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			if lf.modules == nil {
+				lf.modules = make(map[string]string)
+			}
+			lf.modules[t.ImportPath] = tlSchema.Module
+		}
+	}
+	// Check aliases after all tools are parsed, since the order of tools in the map is random.
+	aliasPaths := make(map[string]string, len(lf.aliases))
+	for importPath, alias := range lf.aliases {
+		if otherPath, ok := aliasPaths[alias]; ok {
+			// Sort so the error is deterministic
+			if otherPath > importPath {
+				otherPath, importPath = importPath, otherPath
+			}
+			errs = append(errs, fmt.Errorf("lockfile: alias %q for tool %s is already used by tool %s", alias, importPath, otherPath))
+			continue
+		}
+		aliasPaths[alias] = importPath
 	}
 	if len(errs) > 0 {
 		return nil, errs
@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"reflect"
 	"sort"
 	"strings"
@@ -61,7 +63,31 @@ func TestLockfileGet(t *testing.T) {
 			wantTool: tool.Tool{ImportPath: "example.org/z/random/stringer/v2/cmd/stringer", Version: "v2.1.0"},
 			wantErr:  nil,
 		},
+		{
+			name:     "short name with version",
+			toolName: "go-fish@v0.1.0",
+			wantTool: tool.Tool{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"},
+			wantErr:  nil,
+		},
 		// Errors
+		{
+			name:     "short name with incorrect version",
+			toolName: "golangci-lint@v1.28.3",
+			wantTool: tool.Tool{ImportPath: "github.com/golangci/golangci-lint/cmd/golangci-lint", Version: "v1.33.0"},
+			wantErr:  lockfile.ErrIncorrectVersion,
+		},
+		{
+			name:     "short name with version multiple found",
+			toolName: "stringer@v2.1.0",
+			wantTool: tool.Tool{},
+			wantErr:  lockfile.ErrMultipleTools,
+		},
+		{
+			name:     "not found short name with version",
+			toolName: "stress@v0.1.0",
+			wantTool: tool.Tool{},
+			wantErr:  lockfile.ErrNotFound,
+		},
 		{
 			name:     "short name multiple found",
 			toolName: "stringer",
@@ -117,6 +143,30 @@ func TestLockfileGet(t *testing.T) {
 	}
 }
 
+func BenchmarkLockfileGetShortName(b *testing.B) {
+	lf := &lockfile.Lockfile{}
+	for _, tl := range []tool.Tool{
+		{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"},
+		{ImportPath: "github.com/golangci/golangci-lint/cmd/golangci-lint", Version: "v1.33.0"},
+		{ImportPath: "golang.org/x/tools/cmd/stringer", Version: "v0.0.0-20201211185031-d93e913c1a58"},
+	} {
+		if err := lf.PutTool(tl); err != nil {
+			b.Fatalf("failed to add tool %v to lockfile: %v", tl, err)
+		}
+	}
+
+	for _, name := range []string{"golangci-lint", "golangci-lint@v1.33.0"} {
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := lf.GetTool(name); err != nil {
+					b.Fatalf("want nil error, got %v", err)
+				}
+			}
+		})
+	}
+}
+
 func TestLockfilePutReplace(t *testing.T) {
 	lf := &lockfile.Lockfile{}
 	want := tool.Tool{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"}
@@ -175,6 +225,10 @@ func TestLockfilePutError(t *testing.T) {
 			name: "shorthand semver",
 			tool: tool.Tool{ImportPath: "github.com/cszatmary/go-fish", Version: "v1.2"},
 		},
+		{
+			name: "build metadata",
+			tool: tool.Tool{ImportPath: "github.com/cszatmary/go-fish", Version: "v1.2.3+build.1"},
+		},
 	}
 
 	for _, tt := range tests {
@@ -188,6 +242,60 @@ func TestLockfilePutError(t *testing.T) {
 	}
 }
 
+func TestLockfilePutCanonicalVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		version string
+		want    string
+	}{
+		{"build metadata", "v1.2.3+build.1", "v1.2.3"},
+		{"prerelease build metadata", "v1.2.3-rc.1+20210101", "v1.2.3-rc.1"},
+		{"shorthand semver", "v1.2", "v1.2.0"},
+		{"canonical", "v1.2.3", "v1.2.3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lf := &lockfile.Lockfile{}
+			lf.SetVersionFormat(lockfile.VersionFormatCanonical)
+			err := lf.PutTool(tool.Tool{ImportPath: "github.com/cszatmary/go-fish", Version: tt.version})
+			if err != nil {
+				t.Fatalf("want nil error, got %v", err)
+			}
+			got, err := lf.GetTool("go-fish")
+			if err != nil {
+				t.Fatalf("want nil error, got %v", err)
+			}
+			if got.Version != tt.want {
+				t.Errorf("got version %q, want %q", got.Version, tt.want)
+			}
+		})
+	}
+}
+
+func TestLockfilePutCanonicalVersionError(t *testing.T) {
+	lf := &lockfile.Lockfile{}
+	lf.SetVersionFormat(lockfile.VersionFormatCanonical)
+	err := lf.PutTool(tool.Tool{ImportPath: "github.com/cszatmary/go-fish", Version: "master"})
+	if !errors.Is(err, lockfile.ErrInvalidVersion) {
+		t.Errorf("got error %v, want %v", err, lockfile.ErrInvalidVersion)
+	}
+}
+
+func TestLockfilePutInvalidImportPath(t *testing.T) {
+	lf := &lockfile.Lockfile{}
+	err := lf.PutTool(tool.Tool{ImportPath: "golang/x/tools/cmd/stringer", Version: "v0.1.0"})
+	if err == nil {
+		t.Error("want non-nil error, got nil")
+	}
+	if errors.Is(err, lockfile.ErrInvalidVersion) {
+		t.Errorf("got error %v, did not want %v", err, lockfile.ErrInvalidVersion)
+	}
+	if lf.LenTools() != 0 {
+		t.Errorf("got %d tools, want 0", lf.LenTools())
+	}
+}
+
 func TestLockfileDelete(t *testing.T) {
 	tools := []tool.Tool{
 		{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"},
@@ -250,6 +358,136 @@ func TestLockfileDelete(t *testing.T) {
 	}
 }
 
+func TestLockfileDeleteKeepsOthers(t *testing.T) {
+	tools := []tool.Tool{
+		{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"},
+		{ImportPath: "github.com/golangci/golangci-lint/cmd/golangci-lint", Version: "v1.33.0"},
+		{ImportPath: "golang.org/x/tools/cmd/stringer", Version: "v0.0.0-20201211185031-d93e913c1a58"},
+	}
+	lf := newLockfile(t, tools)
+	// Delete the first tool so the last tool must be moved
+	lf.DeleteTool(tools[0])
+
+	for _, want := range tools[1:] {
+		tl, err := lf.GetTool(want.Name())
+		if err != nil {
+			t.Errorf("want nil error, got %v", err)
+		}
+		if tl != want {
+			t.Errorf("got %+v, want %+v", tl, want)
+		}
+	}
+}
+
+func TestLockfileToolsByName(t *testing.T) {
+	lf := newLockfile(t, []tool.Tool{
+		{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"},
+		{ImportPath: "golang.org/x/tools/cmd/stringer", Version: "v0.0.0-20201211185031-d93e913c1a58"},
+		{ImportPath: "example.org/z/random/stringer/v2/cmd/stringer", Version: "v2.1.0"},
+	})
+
+	tests := []struct {
+		name     string
+		toolName string
+		want     []tool.Tool
+	}{
+		{
+			name:     "single tool",
+			toolName: "go-fish",
+			want:     []tool.Tool{{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"}},
+		},
+		{
+			name:     "multiple tools",
+			toolName: "stringer",
+			want: []tool.Tool{
+				{ImportPath: "example.org/z/random/stringer/v2/cmd/stringer", Version: "v2.1.0"},
+				{ImportPath: "golang.org/x/tools/cmd/stringer", Version: "v0.0.0-20201211185031-d93e913c1a58"},
+			},
+		},
+		{
+			name:     "no tools",
+			toolName: "golangci-lint",
+			want:     nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := lf.ToolsByName(tt.toolName)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLockfileStatsByHost(t *testing.T) {
+	lf := &lockfile.Lockfile{}
+	tools := []tool.Tool{
+		{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"},
+		{ImportPath: "github.com/golangci/golangci-lint/cmd/golangci-lint", Version: "v1.33.0"},
+		{ImportPath: "golang.org/x/tools/cmd/stringer", Version: "v0.1.0"},
+		{ImportPath: "golang.org/x/tools/cmd/goimports", Version: "v0.1.0"},
+		{ImportPath: "golang.org/x/vuln/cmd/govulncheck", Version: "v1.0.0"},
+		{ImportPath: "example.org/z/random/stringer/v2/cmd/stringer", Version: "v2.1.0"},
+	}
+	for _, tl := range tools {
+		if err := lf.PutTool(tl); err != nil {
+			t.Fatalf("failed to put tool %v", err)
+		}
+	}
+
+	got := lf.StatsByHost()
+	want := map[string]int{
+		"github.com":  2,
+		"golang.org":  3,
+		"example.org": 1,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got := (&lockfile.Lockfile{}).StatsByHost(); len(got) != 0 {
+		t.Errorf("got %v, want empty", got)
+	}
+}
+
+func TestLockfileTools(t *testing.T) {
+	lf := newLockfile(t, []tool.Tool{
+		{ImportPath: "golang.org/x/tools/cmd/stringer", Version: "v0.0.0-20201211185031-d93e913c1a58"},
+		{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"},
+		{ImportPath: "example.org/z/random/stringer/v2/cmd/stringer", Version: "v2.1.0"},
+	})
+
+	want := []tool.Tool{
+		{ImportPath: "example.org/z/random/stringer/v2/cmd/stringer", Version: "v2.1.0"},
+		{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"},
+		{ImportPath: "golang.org/x/tools/cmd/stringer", Version: "v0.0.0-20201211185031-d93e913c1a58"},
+	}
+	got := lf.Tools()
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	// Modifying the returned slice must not affect the lockfile
+	got[0].Version = "v2.2.0"
+	if tl, err := lf.GetTool(want[0].ImportPath); err != nil || tl.Version != "v2.1.0" {
+		t.Errorf("got tool %+v, %v, want version v2.1.0", tl, err)
+	}
+	// The snapshot is unaffected by later changes to the lockfile
+	lf.DeleteTool(tool.Tool{ImportPath: "github.com/cszatmary/go-fish"})
+	if !reflect.DeepEqual(got[1], want[1]) {
+		t.Errorf("got %+v, want %+v", got[1], want[1])
+	}
+	if n := len(lf.Tools()); n != 2 {
+		t.Errorf("got %d tools, want 2", n)
+	}
+
+	var empty lockfile.Lockfile
+	if tools := empty.Tools(); len(tools) != 0 {
+		t.Errorf("got %+v, want no tools", tools)
+	}
+}
+
 func TestLockfileIter(t *testing.T) {
 	lf := newLockfile(t, []tool.Tool{
 		{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"},
@@ -324,6 +562,194 @@ func TestLockfileWriteTo(t *testing.T) {
 	}
 }
 
+func TestLockfileJSON(t *testing.T) {
+	lf := newLockfile(t, []tool.Tool{
+		{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"},
+		{ImportPath: "golang.org/x/tools/cmd/stringer", Version: "v0.1.0"},
+		{ImportPath: "example.org/z/random/stringer/v2/cmd/stringer", Version: "v2.1.0"},
+	})
+	if err := lf.SetModule("golang.org/x/tools/cmd/stringer", "golang.org/x/tools"); err != nil {
+		t.Fatalf("failed to set module %v", err)
+	}
+	if err := lf.SetAlias("golang.org/x/tools/cmd/stringer", "xstringer"); err != nil {
+		t.Fatalf("failed to set alias %v", err)
+	}
+	if err := lf.SetToolchain("1.21.0"); err != nil {
+		t.Fatalf("failed to set toolchain %v", err)
+	}
+
+	type document struct {
+		Name     string             `json:"name"`
+		Lockfile *lockfile.Lockfile `json:"lockfile"`
+	}
+	data, err := json.Marshal(document{Name: "project", Lockfile: lf})
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	want := `{"name":"project","lockfile":{"tools":{` +
+		`"example.org/z/random/stringer/v2/cmd/stringer":{"version":"v2.1.0"},` +
+		`"github.com/cszatmary/go-fish":{"version":"v0.1.0"},` +
+		`"golang.org/x/tools/cmd/stringer":{"version":"v0.1.0","module":"golang.org/x/tools","alias":"xstringer"}` +
+		`},"goVersion":"1.21.0"}}`
+	if string(data) != want {
+		t.Errorf("got\n%s\nwant\n%s", data, want)
+	}
+
+	var doc document
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if doc.Name != "project" {
+		t.Errorf("got name %q, want %q", doc.Name, "project")
+	}
+	if !reflect.DeepEqual(doc.Lockfile.Tools(), lf.Tools()) {
+		t.Errorf("got tools %v, want %v", doc.Lockfile.Tools(), lf.Tools())
+	}
+	if doc.Lockfile.Compact() {
+		t.Error("want unmarshaled lockfile to not be compact")
+	}
+	// The name map is rebuilt so tools can be looked up by binary name and alias
+	if tl, err := doc.Lockfile.GetTool("go-fish"); err != nil || tl.ImportPath != "github.com/cszatmary/go-fish" {
+		t.Errorf("got %v, %v for go-fish, want go-fish, nil", tl, err)
+	}
+	if tl, err := doc.Lockfile.GetTool("xstringer"); err != nil || tl.ImportPath != "golang.org/x/tools/cmd/stringer" {
+		t.Errorf("got %v, %v for xstringer, want stringer, nil", tl, err)
+	}
+	if _, err := doc.Lockfile.GetTool("stringer"); !errors.Is(err, lockfile.ErrMultipleTools) {
+		t.Errorf("got error %v, want %v", err, lockfile.ErrMultipleTools)
+	}
+
+	// Writing the unmarshaled lockfile produces the same output as the original
+	var buf1, buf2 bytes.Buffer
+	if _, err := lf.WriteTo(&buf1); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if _, err := doc.Lockfile.WriteTo(&buf2); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if buf1.String() != buf2.String() {
+		t.Errorf("got\n%s\nwant\n%s", buf2.String(), buf1.String())
+	}
+
+	// Invalid lockfiles are rejected
+	err = json.Unmarshal([]byte(`{"lockfile":{"tools":{"golang.org/x/tools/cmd/stringer":{"version":"bad"}}}}`), &doc)
+	if err == nil {
+		t.Error("want error for invalid lockfile, got nil")
+	}
+}
+
+func TestLockfileWriteToDeterministic(t *testing.T) {
+	tools := []tool.Tool{
+		{ImportPath: "golang.org/x/tools/cmd/stringer", Version: "v0.1.0"},
+		{ImportPath: "github.com/golangci/golangci-lint/cmd/golangci-lint", Version: "v1.33.0"},
+		{ImportPath: "example.org/z/random/stringer/v2/cmd/stringer", Version: "v2.1.0"},
+		{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"},
+	}
+	reversed := make([]tool.Tool, len(tools))
+	for i, tl := range tools {
+		reversed[len(tools)-1-i] = tl
+	}
+
+	var outputs [][]byte
+	for _, order := range [][]tool.Tool{tools, reversed} {
+		lf := newLockfile(t, order)
+		if err := lf.SetModule("golang.org/x/tools/cmd/stringer", "golang.org/x/tools"); err != nil {
+			t.Fatalf("failed to set module %v", err)
+		}
+		buf := &bytes.Buffer{}
+		if _, err := lf.WriteTo(buf); err != nil {
+			t.Fatalf("want nil error, got %v", err)
+		}
+		outputs = append(outputs, buf.Bytes())
+	}
+
+	want := `{
+  "tools": {
+    "example.org/z/random/stringer/v2/cmd/stringer": {
+      "version": "v2.1.0"
+    },
+    "github.com/cszatmary/go-fish": {
+      "version": "v0.1.0"
+    },
+    "github.com/golangci/golangci-lint/cmd/golangci-lint": {
+      "version": "v1.33.0"
+    },
+    "golang.org/x/tools/cmd/stringer": {
+      "version": "v0.1.0",
+      "module": "golang.org/x/tools"
+    }
+  }
+}`
+	for i, got := range outputs {
+		if string(got) != want {
+			t.Errorf("output %d: got\n%s\nwant\n%s", i, got, want)
+		}
+	}
+}
+
+func TestLockfileWriteToCompact(t *testing.T) {
+	tools := []tool.Tool{
+		{ImportPath: "golang.org/x/tools/cmd/stringer", Version: "v0.1.0"},
+		{ImportPath: "github.com/golangci/golangci-lint/cmd/golangci-lint", Version: "v1.33.0"},
+		{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"},
+	}
+	lf := newLockfile(t, tools)
+	if err := lf.SetModule("golang.org/x/tools/cmd/stringer", "golang.org/x/tools"); err != nil {
+		t.Fatalf("failed to set module %v", err)
+	}
+	lf.SetCompact(true)
+	buf := &bytes.Buffer{}
+	if _, err := lf.WriteTo(buf); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	want := `{"tools":{
+"github.com/cszatmary/go-fish":{"version":"v0.1.0"},
+"github.com/golangci/golangci-lint/cmd/golangci-lint":{"version":"v1.33.0"},
+"golang.org/x/tools/cmd/stringer":{"version":"v0.1.0","module":"golang.org/x/tools"}
+}}`
+	if buf.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", buf.String(), want)
+	}
+
+	// The format is detected when parsing so it is kept
+	for _, parse := range []func(io.Reader) (*lockfile.Lockfile, error){lockfile.Parse, lockfile.ParseStrict} {
+		parsed, err := parse(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatalf("want nil error, got %v", err)
+		}
+		if !parsed.Compact() {
+			t.Error("want parsed lockfile to be compact")
+		}
+		if parsed.LenTools() != len(tools) {
+			t.Errorf("got %d tools, want %d", parsed.LenTools(), len(tools))
+		}
+	}
+
+	empty := &lockfile.Lockfile{}
+	empty.SetCompact(true)
+	buf.Reset()
+	if _, err := empty.WriteTo(buf); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if got := buf.String(); got != `{"tools":{}}` {
+		t.Errorf("got %s, want %s", got, `{"tools":{}}`)
+	}
+
+	// Indented lockfiles are not compact
+	lf.SetCompact(false)
+	buf.Reset()
+	if _, err := lf.WriteTo(buf); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	parsed, err := lockfile.Parse(buf)
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if parsed.Compact() {
+		t.Error("want parsed lockfile to not be compact")
+	}
+}
+
 func TestParse(t *testing.T) {
 	r := strings.NewReader(`{
 		"tools": {
@@ -385,3 +811,1303 @@ func TestParse(t *testing.T) {
 		t.Errorf("got %+v, want %+v", tl, want)
 	}
 }
+
+func TestParseSameBinaryName(t *testing.T) {
+	r := strings.NewReader(`{
+		"tools": {
+		  "golang.org/x/tools/cmd/stringer": {
+			"version": "v0.1.0"
+		  },
+		  "example.org/z/random/stringer/v2/cmd/stringer": {
+			"version": "v2.1.0"
+		  }
+		}
+	  }`)
+	lf, err := lockfile.Parse(r)
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	// The binary name is ambiguous so it can't be used, regardless of the order of the tools in the file
+	for _, name := range []string{"stringer", "stringer@v0.1.0"} {
+		if _, err := lf.GetTool(name); !errors.Is(err, lockfile.ErrMultipleTools) {
+			t.Errorf("got error %v for %s, want %v", err, name, lockfile.ErrMultipleTools)
+		}
+	}
+	if got := len(lf.ToolsByName("stringer")); got != 2 {
+		t.Errorf("got %d tools named stringer, want 2", got)
+	}
+	tl, err := lf.GetTool("golang.org/x/tools/cmd/stringer")
+	if err != nil {
+		t.Errorf("want nil error, got %v", err)
+	}
+	want := tool.Tool{ImportPath: "golang.org/x/tools/cmd/stringer", Version: "v0.1.0"}
+	if tl != want {
+		t.Errorf("got %+v, want %+v", tl, want)
+	}
+}
+
+func TestParseDuplicateTool(t *testing.T) {
+	data := `{
+		"tools": {
+		  "golang.org/x/tools/cmd/stringer": {
+			"version": "v0.1.0"
+		  },
+		  "github.com/cszatmary/go-fish": {
+			"version": "v0.1.0"
+		  },
+		  "golang.org/x/tools/cmd/stringer": {
+			"version": "v0.1.5"
+		  }
+		}
+	  }`
+	for _, parse := range []func(io.Reader) (*lockfile.Lockfile, error){lockfile.Parse, lockfile.ParseStrict} {
+		_, err := parse(strings.NewReader(data))
+		if err == nil {
+			t.Fatal("want error for duplicate tool, got nil")
+		}
+		if !strings.Contains(err.Error(), "duplicate tool golang.org/x/tools/cmd/stringer") {
+			t.Errorf("got error %v, want duplicate tool error", err)
+		}
+	}
+}
+
+func TestLockfileMerge(t *testing.T) {
+	lf := newLockfile(t, []tool.Tool{
+		{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"},
+		{ImportPath: "github.com/golangci/golangci-lint/cmd/golangci-lint", Version: "v1.33.0"},
+	})
+	other := newLockfile(t, []tool.Tool{
+		{ImportPath: "github.com/golangci/golangci-lint/cmd/golangci-lint", Version: "v1.28.3"},
+		{ImportPath: "golang.org/x/tools/cmd/stringer", Version: "v0.0.0-20201211185031-d93e913c1a58"},
+	})
+
+	if err := lf.Merge(other, lockfile.PreferOther); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	want := []tool.Tool{
+		{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"},
+		{ImportPath: "github.com/golangci/golangci-lint/cmd/golangci-lint", Version: "v1.28.3"},
+		{ImportPath: "golang.org/x/tools/cmd/stringer", Version: "v0.0.0-20201211185031-d93e913c1a58"},
+	}
+	if lf.LenTools() != len(want) {
+		t.Errorf("got len %d, want %d", lf.LenTools(), len(want))
+	}
+	for _, wantTool := range want {
+		tl, err := lf.GetTool(wantTool.ImportPath)
+		if err != nil {
+			t.Errorf("want nil error, got %v", err)
+		}
+		if tl != wantTool {
+			t.Errorf("got %+v, want %+v", tl, wantTool)
+		}
+	}
+	// other must not be modified
+	if other.LenTools() != 2 {
+		t.Errorf("got len %d, want 2", other.LenTools())
+	}
+}
+
+func TestLockfileMergeStrategy(t *testing.T) {
+	const (
+		lint      = "github.com/golangci/golangci-lint/cmd/golangci-lint"
+		stringer  = "golang.org/x/tools/cmd/stringer"
+		goimports = "golang.org/x/tools/cmd/goimports"
+		godoc     = "golang.org/x/tools/cmd/godoc"
+		ejson     = "github.com/Shopify/ejson/cmd/ejson"
+		goFish    = "github.com/cszatmary/go-fish"
+		stringer2 = "example.org/x/tools/cmd/stringer"
+	)
+	tests := []struct {
+		name          string
+		strategy      lockfile.MergeStrategy
+		wantVersions  map[string]string
+		wantGodocHash string
+		wantToolchain string
+	}{
+		{
+			name:     "prefer other",
+			strategy: lockfile.PreferOther,
+			wantVersions: map[string]string{
+				lint:      "v1.28.3",
+				stringer:  "v0.1.5",
+				goimports: "v0.1.0",
+				godoc:     "v0.1.0",
+				ejson:     "v1.1.0",
+				goFish:    "v0.1.0",
+				stringer2: "v1.0.0",
+			},
+			wantGodocHash: "h1:other=",
+			wantToolchain: "1.21.1",
+		},
+		{
+			name:     "prefer receiver",
+			strategy: lockfile.PreferReceiver,
+			wantVersions: map[string]string{
+				lint:      "v1.33.0",
+				stringer:  "v0.1.0",
+				goimports: "v0.1.0-rc.1",
+				godoc:     "v0.1.0",
+				ejson:     "v0.0.0-20201211185031-d93e913c1a58",
+				goFish:    "v0.1.0",
+				stringer2: "v1.0.0",
+			},
+			wantGodocHash: "h1:receiver=",
+			wantToolchain: "1.22.0",
+		},
+		{
+			name:     "prefer higher version",
+			strategy: lockfile.PreferHigherVersion,
+			wantVersions: map[string]string{
+				// Higher in receiver
+				lint: "v1.33.0",
+				// Higher in other
+				stringer: "v0.1.5",
+				// Release is higher than prerelease
+				goimports: "v0.1.0",
+				// Equal versions keep the receiver
+				godoc: "v0.1.0",
+				// Release is higher than pseudo-version
+				ejson: "v1.1.0",
+				// Only in one lockfile
+				goFish:    "v0.1.0",
+				stringer2: "v1.0.0",
+			},
+			wantGodocHash: "h1:receiver=",
+			wantToolchain: "1.22.0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lf := newLockfile(t, []tool.Tool{
+				{ImportPath: lint, Version: "v1.33.0"},
+				{ImportPath: stringer, Version: "v0.1.0"},
+				{ImportPath: goimports, Version: "v0.1.0-rc.1"},
+				{ImportPath: godoc, Version: "v0.1.0"},
+				{ImportPath: ejson, Version: "v0.0.0-20201211185031-d93e913c1a58"},
+				{ImportPath: goFish, Version: "v0.1.0"},
+			})
+			other := newLockfile(t, []tool.Tool{
+				{ImportPath: lint, Version: "v1.28.3"},
+				{ImportPath: stringer, Version: "v0.1.5"},
+				{ImportPath: goimports, Version: "v0.1.0"},
+				{ImportPath: godoc, Version: "v0.1.0"},
+				{ImportPath: ejson, Version: "v1.1.0"},
+				{ImportPath: stringer2, Version: "v1.0.0"},
+			})
+			if err := lf.SetHash(godoc, "h1:receiver="); err != nil {
+				t.Fatalf("failed to set hash %v", err)
+			}
+			if err := other.SetHash(godoc, "h1:other="); err != nil {
+				t.Fatalf("failed to set hash %v", err)
+			}
+			if err := lf.SetToolchain("1.22.0"); err != nil {
+				t.Fatalf("failed to set toolchain %v", err)
+			}
+			if err := other.SetToolchain("1.21.1"); err != nil {
+				t.Fatalf("failed to set toolchain %v", err)
+			}
+
+			if err := lf.Merge(other, tt.strategy); err != nil {
+				t.Fatalf("want nil error, got %v", err)
+			}
+			got := make(map[string]string)
+			it := lf.Iter()
+			for it.Next() {
+				got[it.Value().ImportPath] = it.Value().Version
+			}
+			if !reflect.DeepEqual(got, tt.wantVersions) {
+				t.Errorf("got versions %v, want %v", got, tt.wantVersions)
+			}
+			if got := lf.Hash(godoc); got != tt.wantGodocHash {
+				t.Errorf("got hash %q, want %q", got, tt.wantGodocHash)
+			}
+			if got := lf.Toolchain(); got != tt.wantToolchain {
+				t.Errorf("got toolchain %q, want %q", got, tt.wantToolchain)
+			}
+		})
+	}
+}
+
+func TestLockfileMergeInvalidStrategy(t *testing.T) {
+	lf := newLockfile(t, []tool.Tool{{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"}})
+	other := newLockfile(t, []tool.Tool{{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.2.0"}})
+	if err := lf.Merge(other, lockfile.MergeStrategy(-1)); err == nil {
+		t.Error("want error for invalid strategy, got nil")
+	}
+	if got, _ := lf.GetTool("github.com/cszatmary/go-fish"); got.Version != "v0.1.0" {
+		t.Errorf("got version %s, want v0.1.0", got.Version)
+	}
+}
+
+func TestLockfileMergeReplacesMetadata(t *testing.T) {
+	const (
+		lint   = "github.com/golangci/golangci-lint/cmd/golangci-lint"
+		goFish = "github.com/cszatmary/go-fish"
+	)
+	lf := newLockfile(t, []tool.Tool{
+		{ImportPath: lint, Version: "v1.33.0"},
+		{ImportPath: goFish, Version: "v0.1.0"},
+	})
+	other := newLockfile(t, []tool.Tool{
+		{ImportPath: lint, Version: "v1.28.3"},
+		{ImportPath: goFish, Version: "v0.1.0"},
+	})
+	if err := lf.SetAlias(lint, "lint"); err != nil {
+		t.Fatalf("failed to set alias %v", err)
+	}
+	if err := lf.SetDirect(lint, true); err != nil {
+		t.Fatalf("failed to set direct %v", err)
+	}
+	if err := lf.SetBuildFlags(lint, []string{"-tags=netgo"}); err != nil {
+		t.Fatalf("failed to set build flags %v", err)
+	}
+	if err := lf.SetModule(goFish, goFish); err != nil {
+		t.Fatalf("failed to set module %v", err)
+	}
+	if err := other.SetBuildFlags(goFish, []string{"-trimpath"}); err != nil {
+		t.Fatalf("failed to set build flags %v", err)
+	}
+
+	if err := lf.Merge(other, lockfile.PreferOther); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	// Only the metadata from other is kept for the tools that were replaced
+	if got := lf.Alias(lint); got != "" {
+		t.Errorf("got alias %q, want empty", got)
+	}
+	if lf.Direct(lint) {
+		t.Error("got direct true, want false")
+	}
+	if got := lf.BuildFlags(lint); got != nil {
+		t.Errorf("got build flags %q, want nil", got)
+	}
+	if got := lf.Module(goFish); got != "" {
+		t.Errorf("got module %q, want empty", got)
+	}
+	if got, want := lf.BuildFlags(goFish), []string{"-trimpath"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got build flags %q, want %q", got, want)
+	}
+}
+
+func TestLockfileMergeConflictingAlias(t *testing.T) {
+	const (
+		lint     = "github.com/golangci/golangci-lint/cmd/golangci-lint"
+		stringer = "golang.org/x/tools/cmd/stringer"
+		goFish   = "github.com/cszatmary/go-fish"
+	)
+	lf := newLockfile(t, []tool.Tool{
+		{ImportPath: lint, Version: "v1.33.0"},
+		{ImportPath: stringer, Version: "v0.1.0"},
+	})
+	other := newLockfile(t, []tool.Tool{
+		{ImportPath: goFish, Version: "v0.1.0"},
+		{ImportPath: stringer, Version: "v0.1.5"},
+		{ImportPath: lint, Version: "v1.28.3"},
+	})
+	if err := lf.SetAlias(lint, "lint"); err != nil {
+		t.Fatalf("failed to set alias %v", err)
+	}
+	if err := lf.SetAlias(stringer, "str"); err != nil {
+		t.Fatalf("failed to set alias %v", err)
+	}
+	if err := other.SetAlias(goFish, "lint"); err != nil {
+		t.Fatalf("failed to set alias %v", err)
+	}
+
+	// lint is kept in the receiver along with its alias, so go-fish can't use it
+	if err := lf.Merge(other, lockfile.PreferHigherVersion); err == nil {
+		t.Fatal("want error for conflicting alias, got nil")
+	}
+	// The lockfile must not be modified
+	want := []tool.Tool{
+		{ImportPath: lint, Version: "v1.33.0"},
+		{ImportPath: stringer, Version: "v0.1.0"},
+	}
+	if got := lf.Tools(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got tools %v, want %v", got, want)
+	}
+	if got := lf.Alias(stringer); got != "str" {
+		t.Errorf("got alias %q, want %q", got, "str")
+	}
+	if _, err := lf.GetTool(goFish); !errors.Is(err, lockfile.ErrNotFound) {
+		t.Errorf("got error %v, want %v", err, lockfile.ErrNotFound)
+	}
+
+	// The alias is free once lint is replaced by the version in other, which has no alias
+	if err := lf.Merge(other, lockfile.PreferOther); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if got := lf.Alias(goFish); got != "lint" {
+		t.Errorf("got alias %q, want %q", got, "lint")
+	}
+	if got := lf.Alias(lint); got != "" {
+		t.Errorf("got alias %q, want empty", got)
+	}
+}
+
+func TestLockfileDiff(t *testing.T) {
+	oldLf := newLockfile(t, []tool.Tool{
+		{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"},
+		{ImportPath: "github.com/golangci/golangci-lint/cmd/golangci-lint", Version: "v1.28.3"},
+		{ImportPath: "golang.org/x/tools/cmd/stringer", Version: "v0.1.0"},
+		{ImportPath: "github.com/Shopify/ejson/cmd/ejson", Version: "v1.2.2"},
+	})
+	newLf := newLockfile(t, []tool.Tool{
+		{ImportPath: "golang.org/x/tools/cmd/stringer", Version: "v0.1.0"},
+		{ImportPath: "golang.org/x/tools/cmd/goimports", Version: "v0.1.5"},
+		{ImportPath: "github.com/golangci/golangci-lint/cmd/golangci-lint", Version: "v1.33.0"},
+		{ImportPath: "example.org/z/random/stringer/v2/cmd/stringer", Version: "v2.1.0"},
+	})
+
+	got := oldLf.Diff(newLf)
+	want := lockfile.LockfileDiff{
+		Added: []tool.Tool{
+			{ImportPath: "example.org/z/random/stringer/v2/cmd/stringer", Version: "v2.1.0"},
+			{ImportPath: "golang.org/x/tools/cmd/goimports", Version: "v0.1.5"},
+		},
+		Removed: []tool.Tool{
+			{ImportPath: "github.com/Shopify/ejson/cmd/ejson", Version: "v1.2.2"},
+			{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"},
+		},
+		Changed: []lockfile.ToolChange{
+			{ImportPath: "github.com/golangci/golangci-lint/cmd/golangci-lint", OldVersion: "v1.28.3", NewVersion: "v1.33.0"},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if got.IsEmpty() {
+		t.Error("want non-empty diff")
+	}
+
+	// Unchanged tools are not included
+	if got := oldLf.Diff(oldLf); !got.IsEmpty() {
+		t.Errorf("got %+v, want empty diff", got)
+	}
+	if got := (&lockfile.Lockfile{}).Diff(&lockfile.Lockfile{}); !got.IsEmpty() {
+		t.Errorf("got %+v, want empty diff", got)
+	}
+}
+
+func TestLockfileModule(t *testing.T) {
+	r := strings.NewReader(`{
+		"tools": {
+		  "github.com/cszatmary/go-fish": {
+			"version": "v0.1.0"
+		  },
+		  "golang.org/x/tools/cmd/stringer": {
+			"version": "v0.0.0-20201211185031-d93e913c1a58",
+			"module": "golang.org/x/tools"
+		  }
+		}
+	  }`)
+	lf, err := lockfile.Parse(r)
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if got := lf.Module("golang.org/x/tools/cmd/stringer"); got != "golang.org/x/tools" {
+		t.Errorf("got module %q, want %q", got, "golang.org/x/tools")
+	}
+	if got := lf.Module("github.com/cszatmary/go-fish"); got != "" {
+		t.Errorf("got module %q, want empty", got)
+	}
+
+	if err := lf.SetModule("github.com/cszatmary/go-fish", "github.com/cszatmary/go-fish"); err != nil {
+		t.Errorf("want nil error, got %v", err)
+	}
+	if err := lf.SetModule("github.com/cszatmary/go-fish", "github.com/cszatmary/go"); err == nil {
+		t.Error("want error for module that doesn't contain tool, got nil")
+	}
+	if err := lf.SetModule("github.com/golangci/golangci-lint/cmd/golangci-lint", "github.com/golangci/golangci-lint"); !errors.Is(err, lockfile.ErrNotFound) {
+		t.Errorf("got error %v, want %v", err, lockfile.ErrNotFound)
+	}
+
+	// Changing the version clears the module since it may not be the same anymore
+	err = lf.PutTool(tool.Tool{ImportPath: "golang.org/x/tools/cmd/stringer", Version: "v0.1.0"})
+	if err != nil {
+		t.Fatalf("failed to put tool %v", err)
+	}
+	if got := lf.Module("golang.org/x/tools/cmd/stringer"); got != "" {
+		t.Errorf("got module %q, want empty", got)
+	}
+
+	buf := &bytes.Buffer{}
+	if _, err := lf.WriteTo(buf); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	want := map[string]interface{}{
+		"tools": map[string]interface{}{
+			"github.com/cszatmary/go-fish": map[string]interface{}{
+				"version": "v0.1.0",
+				"module":  "github.com/cszatmary/go-fish",
+			},
+			"golang.org/x/tools/cmd/stringer": map[string]interface{}{
+				"version": "v0.1.0",
+			},
+		},
+	}
+	var got interface{}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Errorf("want nil error, got %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestLockfileDirect(t *testing.T) {
+	r := strings.NewReader(`{
+		"tools": {
+		  "github.com/cszatmary/go-fish": {
+			"version": "v0.1.0",
+			"direct": true
+		  },
+		  "golang.org/x/tools/cmd/stringer": {
+			"version": "v0.1.0"
+		  }
+		}
+	  }`)
+	lf, err := lockfile.Parse(r)
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if !lf.Direct("github.com/cszatmary/go-fish") {
+		t.Error("want go-fish to be direct")
+	}
+	if lf.Direct("golang.org/x/tools/cmd/stringer") {
+		t.Error("want stringer to not be direct")
+	}
+	if err := lf.SetDirect("github.com/golangci/golangci-lint/cmd/golangci-lint", true); !errors.Is(err, lockfile.ErrNotFound) {
+		t.Errorf("got error %v, want %v", err, lockfile.ErrNotFound)
+	}
+
+	// Changing the version keeps direct since it does not depend on the version
+	err = lf.PutTool(tool.Tool{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.2.0"})
+	if err != nil {
+		t.Fatalf("failed to put tool %v", err)
+	}
+	if !lf.Direct("github.com/cszatmary/go-fish") {
+		t.Error("want go-fish to still be direct")
+	}
+	if err := lf.SetDirect("golang.org/x/tools/cmd/stringer", true); err != nil {
+		t.Errorf("want nil error, got %v", err)
+	}
+	if err := lf.SetDirect("github.com/cszatmary/go-fish", false); err != nil {
+		t.Errorf("want nil error, got %v", err)
+	}
+
+	buf := &bytes.Buffer{}
+	if _, err := lf.WriteTo(buf); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	want := map[string]interface{}{
+		"tools": map[string]interface{}{
+			"github.com/cszatmary/go-fish": map[string]interface{}{
+				"version": "v0.2.0",
+			},
+			"golang.org/x/tools/cmd/stringer": map[string]interface{}{
+				"version": "v0.1.0",
+				"direct":  true,
+			},
+		},
+	}
+	var got interface{}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Errorf("want nil error, got %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	// Deleting the tool removes direct so it isn't applied if the tool is added again
+	lf.DeleteTool(tool.Tool{ImportPath: "golang.org/x/tools/cmd/stringer"})
+	err = lf.PutTool(tool.Tool{ImportPath: "golang.org/x/tools/cmd/stringer", Version: "v0.1.0"})
+	if err != nil {
+		t.Fatalf("failed to put tool %v", err)
+	}
+	if lf.Direct("golang.org/x/tools/cmd/stringer") {
+		t.Error("want stringer to not be direct")
+	}
+}
+
+func TestLockfileAlias(t *testing.T) {
+	r := strings.NewReader(`{
+		"tools": {
+		  "golang.org/x/tools/cmd/stringer": {
+			"version": "v0.1.0",
+			"alias": "xstringer"
+		  },
+		  "example.org/z/random/stringer/v2/cmd/stringer": {
+			"version": "v2.1.0"
+		  }
+		}
+	  }`)
+	lf, err := lockfile.Parse(r)
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if got := lf.Alias("golang.org/x/tools/cmd/stringer"); got != "xstringer" {
+		t.Errorf("got alias %q, want %q", got, "xstringer")
+	}
+
+	// The alias can be used even though the binary name is ambiguous
+	stringer := tool.Tool{ImportPath: "golang.org/x/tools/cmd/stringer", Version: "v0.1.0"}
+	for _, name := range []string{"xstringer", "xstringer@v0.1.0"} {
+		tl, err := lf.GetTool(name)
+		if err != nil {
+			t.Errorf("want nil error for %s, got %v", name, err)
+		}
+		if tl != stringer {
+			t.Errorf("got %+v for %s, want %+v", tl, name, stringer)
+		}
+	}
+	if _, err := lf.GetTool("xstringer@v0.2.0"); !errors.Is(err, lockfile.ErrIncorrectVersion) {
+		t.Errorf("got error %v, want %v", err, lockfile.ErrIncorrectVersion)
+	}
+	if _, err := lf.GetTool("stringer"); !errors.Is(err, lockfile.ErrMultipleTools) {
+		t.Errorf("got error %v, want %v", err, lockfile.ErrMultipleTools)
+	}
+
+	// Aliases take precedence over binary names
+	v2 := tool.Tool{ImportPath: "example.org/z/random/stringer/v2/cmd/stringer", Version: "v2.1.0"}
+	if err := lf.SetAlias(v2.ImportPath, "stringer"); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if tl, err := lf.GetTool("stringer"); err != nil || tl != v2 {
+		t.Errorf("got %+v, %v, want %+v, nil", tl, err, v2)
+	}
+
+	if err := lf.SetAlias(v2.ImportPath, "xstringer"); err == nil {
+		t.Error("want error for alias used by another tool, got nil")
+	}
+	for _, alias := range []string{"a/b", `a\b`, "a@v1", ".."} {
+		if err := lf.SetAlias(v2.ImportPath, alias); err == nil {
+			t.Errorf("want error for invalid alias %q, got nil", alias)
+		}
+	}
+	if err := lf.SetAlias("github.com/cszatmary/go-fish", "fish"); !errors.Is(err, lockfile.ErrNotFound) {
+		t.Errorf("got error %v, want %v", err, lockfile.ErrNotFound)
+	}
+
+	// Changing the version keeps the alias
+	if err := lf.PutTool(stringer.WithVersion("v0.2.0")); err != nil {
+		t.Fatalf("failed to put tool %v", err)
+	}
+	if err := lf.SetAlias(v2.ImportPath, ""); err != nil {
+		t.Errorf("want nil error, got %v", err)
+	}
+
+	buf := &bytes.Buffer{}
+	if _, err := lf.WriteTo(buf); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	want := map[string]interface{}{
+		"tools": map[string]interface{}{
+			"golang.org/x/tools/cmd/stringer": map[string]interface{}{
+				"version": "v0.2.0",
+				"alias":   "xstringer",
+			},
+			"example.org/z/random/stringer/v2/cmd/stringer": map[string]interface{}{
+				"version": "v2.1.0",
+			},
+		},
+	}
+	var got interface{}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Errorf("want nil error, got %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	// Deleting the tool removes the alias
+	lf.DeleteTool(stringer.WithoutVersion())
+	if _, err := lf.GetTool("xstringer"); !errors.Is(err, lockfile.ErrNotFound) {
+		t.Errorf("got error %v, want %v", err, lockfile.ErrNotFound)
+	}
+}
+
+func TestParseInvalidAlias(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{
+			"invalid alias",
+			`{"tools": {"golang.org/x/tools/cmd/stringer": {"version": "v0.1.0", "alias": "x/stringer"}}}`,
+		},
+		{
+			"duplicate alias",
+			`{"tools": {
+				"golang.org/x/tools/cmd/stringer": {"version": "v0.1.0", "alias": "str"},
+				"example.org/z/random/stringer/v2/cmd/stringer": {"version": "v2.1.0", "alias": "str"}
+			}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := lockfile.Parse(strings.NewReader(tt.input)); err == nil {
+				t.Error("want error, got nil")
+			}
+		})
+	}
+}
+
+func TestLockfileBuildFlags(t *testing.T) {
+	r := strings.NewReader(`{
+		"tools": {
+		  "golang.org/x/tools/cmd/stringer": {
+			"version": "v0.1.0",
+			"buildFlags": ["-ldflags=-X main.version=v0.1.0", "-tags=netgo"]
+		  },
+		  "github.com/cszatmary/go-fish": {
+			"version": "v0.1.0"
+		  }
+		}
+	  }`)
+	lf, err := lockfile.Parse(r)
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	wantFlags := []string{"-ldflags=-X main.version=v0.1.0", "-tags=netgo"}
+	if got := lf.BuildFlags("golang.org/x/tools/cmd/stringer"); !reflect.DeepEqual(got, wantFlags) {
+		t.Errorf("got build flags %q, want %q", got, wantFlags)
+	}
+	if got := lf.BuildFlags("github.com/cszatmary/go-fish"); got != nil {
+		t.Errorf("got build flags %q, want nil", got)
+	}
+
+	fish := tool.Tool{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"}
+	if err := lf.SetBuildFlags(fish.ImportPath, []string{"-trimpath"}); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	for _, flags := range [][]string{{"netgo"}, {"-o", "fish"}, {"-o=fish"}, {"-ldflags=-s\n-w"}, {"-toolexec=/bin/sh"}, {"-exec=/bin/sh"}} {
+		if err := lf.SetBuildFlags(fish.ImportPath, flags); err == nil {
+			t.Errorf("want error for invalid build flags %q, got nil", flags)
+		}
+	}
+	if err := lf.SetBuildFlags("example.org/z/random/stringer/v2/cmd/stringer", []string{"-trimpath"}); !errors.Is(err, lockfile.ErrNotFound) {
+		t.Errorf("got error %v, want %v", err, lockfile.ErrNotFound)
+	}
+
+	// Changing the version keeps the build flags
+	stringer := tool.Tool{ImportPath: "golang.org/x/tools/cmd/stringer", Version: "v0.1.0"}
+	if err := lf.PutTool(stringer.WithVersion("v0.2.0")); err != nil {
+		t.Fatalf("failed to put tool %v", err)
+	}
+
+	buf := &bytes.Buffer{}
+	if _, err := lf.WriteTo(buf); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	want := map[string]interface{}{
+		"tools": map[string]interface{}{
+			"golang.org/x/tools/cmd/stringer": map[string]interface{}{
+				"version":    "v0.2.0",
+				"buildFlags": []interface{}{"-ldflags=-X main.version=v0.1.0", "-tags=netgo"},
+			},
+			"github.com/cszatmary/go-fish": map[string]interface{}{
+				"version":    "v0.1.0",
+				"buildFlags": []interface{}{"-trimpath"},
+			},
+		},
+	}
+	var got interface{}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Errorf("want nil error, got %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	// Setting no flags removes them
+	if err := lf.SetBuildFlags(fish.ImportPath, nil); err != nil {
+		t.Errorf("want nil error, got %v", err)
+	}
+	if got := lf.BuildFlags(fish.ImportPath); got != nil {
+		t.Errorf("got build flags %q, want nil", got)
+	}
+
+	// Deleting the tool removes the build flags
+	lf.DeleteTool(stringer.WithoutVersion())
+	if err := lf.PutTool(stringer); err != nil {
+		t.Fatalf("failed to put tool %v", err)
+	}
+	if got := lf.BuildFlags(stringer.ImportPath); got != nil {
+		t.Errorf("got build flags %q, want nil", got)
+	}
+}
+
+func TestParseInvalidBuildFlags(t *testing.T) {
+	for _, flag := range []string{"netgo", "-o=stringer", "", "-toolexec=/bin/sh", "-exec=/bin/sh"} {
+		input := fmt.Sprintf(`{"tools": {"golang.org/x/tools/cmd/stringer": {"version": "v0.1.0", "buildFlags": [%q]}}}`, flag)
+		if _, err := lockfile.Parse(strings.NewReader(input)); err == nil {
+			t.Errorf("want error for build flag %q, got nil", flag)
+		}
+	}
+}
+
+func TestLockfileBinaryRelease(t *testing.T) {
+	r := strings.NewReader(`{
+		"tools": {
+		  "github.com/golangci/golangci-lint/cmd/golangci-lint": {
+			"version": "v1.42.1",
+			"binaryRelease": {
+			  "repo": "golangci/golangci-lint",
+			  "asset": "golangci-lint-{version}-{os}-{arch}.tar.gz"
+			}
+		  },
+		  "golang.org/x/tools/cmd/stringer": {
+			"version": "v0.1.0"
+		  }
+		}
+	  }`)
+	lf, err := lockfile.Parse(r)
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	want := lockfile.BinaryRelease{Repo: "golangci/golangci-lint", Asset: "golangci-lint-{version}-{os}-{arch}.tar.gz"}
+	if got := lf.BinaryRelease("github.com/golangci/golangci-lint/cmd/golangci-lint"); got != want {
+		t.Errorf("got binary release %+v, want %+v", got, want)
+	}
+	if got := lf.BinaryRelease("golang.org/x/tools/cmd/stringer"); !got.IsZero() {
+		t.Errorf("got binary release %+v, want zero value", got)
+	}
+	if err := lf.SetBinaryRelease("github.com/cszatmary/go-fish", want); !errors.Is(err, lockfile.ErrNotFound) {
+		t.Errorf("got error %v, want %v", err, lockfile.ErrNotFound)
+	}
+	if err := lf.SetBinaryRelease("golang.org/x/tools/cmd/stringer", lockfile.BinaryRelease{Repo: "golang", Asset: "stringer"}); err == nil {
+		t.Error("want error for invalid repo, got nil")
+	}
+
+	// Changing the version keeps the binary release since it does not depend on the version
+	err = lf.PutTool(tool.Tool{ImportPath: "github.com/golangci/golangci-lint/cmd/golangci-lint", Version: "v1.43.0"})
+	if err != nil {
+		t.Fatalf("failed to put tool %v", err)
+	}
+	if got := lf.BinaryRelease("github.com/golangci/golangci-lint/cmd/golangci-lint"); got != want {
+		t.Errorf("got binary release %+v, want %+v", got, want)
+	}
+
+	buf := &bytes.Buffer{}
+	if _, err := lf.WriteTo(buf); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	wantJSON := map[string]interface{}{
+		"tools": map[string]interface{}{
+			"github.com/golangci/golangci-lint/cmd/golangci-lint": map[string]interface{}{
+				"version": "v1.43.0",
+				"binaryRelease": map[string]interface{}{
+					"repo":  "golangci/golangci-lint",
+					"asset": "golangci-lint-{version}-{os}-{arch}.tar.gz",
+				},
+			},
+			"golang.org/x/tools/cmd/stringer": map[string]interface{}{
+				"version": "v0.1.0",
+			},
+		},
+	}
+	var got interface{}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Errorf("want nil error, got %v", err)
+	}
+	if !reflect.DeepEqual(got, wantJSON) {
+		t.Errorf("got %+v, want %+v", got, wantJSON)
+	}
+
+	// Deleting the tool removes the binary release so it isn't applied if the tool is added again
+	lf.DeleteTool(tool.Tool{ImportPath: "github.com/golangci/golangci-lint/cmd/golangci-lint"})
+	err = lf.PutTool(tool.Tool{ImportPath: "github.com/golangci/golangci-lint/cmd/golangci-lint", Version: "v1.43.0"})
+	if err != nil {
+		t.Fatalf("failed to put tool %v", err)
+	}
+	if got := lf.BinaryRelease("github.com/golangci/golangci-lint/cmd/golangci-lint"); !got.IsZero() {
+		t.Errorf("got binary release %+v, want zero value", got)
+	}
+}
+
+func TestLockfileReleaseHash(t *testing.T) {
+	const ejson = "github.com/Shopify/ejson/cmd/ejson"
+	r := strings.NewReader(`{
+		"tools": {
+		  "github.com/Shopify/ejson/cmd/ejson": {
+			"version": "v1.2.2",
+			"binaryRelease": {
+			  "repo": "Shopify/ejson",
+			  "asset": "ejson-{os}",
+			  "hashes": {
+				"linux/amd64": "sha256:abc"
+			  }
+			}
+		  },
+		  "golang.org/x/tools/cmd/stringer": {
+			"version": "v0.1.0"
+		  }
+		}
+	  }`)
+	lf, err := lockfile.Parse(r)
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if got := lf.ReleaseHash(ejson, "linux/amd64"); got != "sha256:abc" {
+		t.Errorf("got release hash %q, want %q", got, "sha256:abc")
+	}
+	if got := lf.ReleaseHash(ejson, "darwin/arm64"); got != "" {
+		t.Errorf("got release hash %q, want empty", got)
+	}
+	if err := lf.SetReleaseHash("golang.org/x/tools/cmd/stringer", "linux/amd64", "sha256:abc"); err == nil {
+		t.Error("want error for tool without binary release, got nil")
+	}
+	if err := lf.SetReleaseHash(ejson, "linux", "sha256:abc"); err == nil {
+		t.Error("want error for invalid platform, got nil")
+	}
+	if err := lf.SetReleaseHash(ejson, "darwin/arm64", "sha256:def"); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+
+	buf := &bytes.Buffer{}
+	if _, err := lf.WriteTo(buf); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	wantJSON := map[string]interface{}{
+		"tools": map[string]interface{}{
+			ejson: map[string]interface{}{
+				"version": "v1.2.2",
+				"binaryRelease": map[string]interface{}{
+					"repo":  "Shopify/ejson",
+					"asset": "ejson-{os}",
+					"hashes": map[string]interface{}{
+						"darwin/arm64": "sha256:def",
+						"linux/amd64":  "sha256:abc",
+					},
+				},
+			},
+			"golang.org/x/tools/cmd/stringer": map[string]interface{}{
+				"version": "v0.1.0",
+			},
+		},
+	}
+	var got interface{}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Errorf("want nil error, got %v", err)
+	}
+	if !reflect.DeepEqual(got, wantJSON) {
+		t.Errorf("got %+v, want %+v", got, wantJSON)
+	}
+
+	// Changing the version removes the hashes since they are for a different asset
+	if err := lf.PutTool(tool.Tool{ImportPath: ejson, Version: "v1.3.0"}); err != nil {
+		t.Fatalf("failed to put tool %v", err)
+	}
+	if got := lf.ReleaseHash(ejson, "linux/amd64"); got != "" {
+		t.Errorf("got release hash %q, want empty", got)
+	}
+
+	// Changing the binary release removes the hashes
+	if err := lf.SetReleaseHash(ejson, "linux/amd64", "sha256:abc"); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if err := lf.SetBinaryRelease(ejson, lockfile.BinaryRelease{Repo: "Shopify/ejson", Asset: "ejson"}); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if got := lf.ReleaseHash(ejson, "linux/amd64"); got != "" {
+		t.Errorf("got release hash %q, want empty", got)
+	}
+
+	_, err = lockfile.Parse(strings.NewReader(`{
+		"tools": {
+		  "github.com/Shopify/ejson/cmd/ejson": {
+			"version": "v1.2.2",
+			"binaryRelease": {"repo": "Shopify/ejson", "asset": "ejson", "hashes": {"linux": "sha256:abc"}}
+		  }
+		}
+	  }`))
+	if err == nil {
+		t.Error("want error for invalid release hash platform, got nil")
+	}
+}
+
+func TestLockfileGoVersion(t *testing.T) {
+	r := strings.NewReader(`{
+		"tools": {
+		  "github.com/cszatmary/go-fish": {
+			"version": "v0.1.0"
+		  },
+		  "golang.org/x/tools/cmd/stringer": {
+			"version": "v0.1.0",
+			"go": "1.17"
+		  }
+		}
+	  }`)
+	lf, err := lockfile.Parse(r)
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if got := lf.GoVersion("golang.org/x/tools/cmd/stringer"); got != "1.17" {
+		t.Errorf("got go version %q, want %q", got, "1.17")
+	}
+	if got := lf.GoVersion("github.com/cszatmary/go-fish"); got != "" {
+		t.Errorf("got go version %q, want empty", got)
+	}
+	if err := lf.SetGoVersion("github.com/cszatmary/go-fish", "go1.16"); err == nil {
+		t.Error("want error for invalid go version, got nil")
+	}
+	if err := lf.SetGoVersion("example.org/tool", "1.16"); !errors.Is(err, lockfile.ErrNotFound) {
+		t.Errorf("got error %v, want %v", err, lockfile.ErrNotFound)
+	}
+	if err := lf.SetGoVersion("github.com/cszatmary/go-fish", "1.16"); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+
+	// Changing the version clears the go version since the new version may require a different one
+	err = lf.PutTool(tool.Tool{ImportPath: "golang.org/x/tools/cmd/stringer", Version: "v0.1.5"})
+	if err != nil {
+		t.Fatalf("failed to put tool %v", err)
+	}
+	if got := lf.GoVersion("golang.org/x/tools/cmd/stringer"); got != "" {
+		t.Errorf("got go version %q, want empty", got)
+	}
+
+	buf := &bytes.Buffer{}
+	if _, err := lf.WriteTo(buf); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	wantJSON := map[string]interface{}{
+		"tools": map[string]interface{}{
+			"github.com/cszatmary/go-fish": map[string]interface{}{
+				"version": "v0.1.0",
+				"go":      "1.16",
+			},
+			"golang.org/x/tools/cmd/stringer": map[string]interface{}{
+				"version": "v0.1.5",
+			},
+		},
+	}
+	var got interface{}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Errorf("want nil error, got %v", err)
+	}
+	if !reflect.DeepEqual(got, wantJSON) {
+		t.Errorf("got %+v, want %+v", got, wantJSON)
+	}
+
+	_, err = lockfile.Parse(strings.NewReader(`{"tools": {"golang.org/x/tools/cmd/stringer": {"version": "v0.1.0", "go": "latest"}}}`))
+	if err == nil {
+		t.Error("want error for invalid go version, got nil")
+	}
+}
+
+func TestLockfileToolchain(t *testing.T) {
+	r := strings.NewReader(`{
+		"tools": {
+		  "golang.org/x/tools/cmd/stringer": {
+			"version": "v0.1.0",
+			"go": "1.17"
+		  }
+		},
+		"goVersion": "1.21.0"
+	  }`)
+	lf, err := lockfile.Parse(r)
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if got := lf.Toolchain(); got != "1.21.0" {
+		t.Errorf("got toolchain %q, want %q", got, "1.21.0")
+	}
+	// The toolchain is separate from the go version of each tool
+	if got := lf.GoVersion("golang.org/x/tools/cmd/stringer"); got != "1.17" {
+		t.Errorf("got go version %q, want %q", got, "1.17")
+	}
+	// GOTOOLCHAIN requires a full release version of at least go1.21.0
+	for _, v := range []string{"go1.21.0", "1", "1.21", "1.20.5", "1.22rc1"} {
+		if err := lf.SetToolchain(v); err == nil {
+			t.Errorf("want error for invalid toolchain %q, got nil", v)
+		}
+	}
+	if err := lf.SetToolchain("1.22.1"); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+
+	for _, compact := range []bool{false, true} {
+		lf.SetCompact(compact)
+		buf := &bytes.Buffer{}
+		if _, err := lf.WriteTo(buf); err != nil {
+			t.Fatalf("want nil error, got %v", err)
+		}
+		for _, parse := range []func(io.Reader) (*lockfile.Lockfile, error){lockfile.Parse, lockfile.ParseStrict} {
+			parsed, err := parse(bytes.NewReader(buf.Bytes()))
+			if err != nil {
+				t.Fatalf("want nil error, got %v", err)
+			}
+			if got := parsed.Toolchain(); got != "1.22.1" {
+				t.Errorf("got toolchain %q, want %q", got, "1.22.1")
+			}
+			if parsed.Compact() != compact {
+				t.Errorf("got compact %t, want %t", parsed.Compact(), compact)
+			}
+		}
+	}
+
+	// Removing the toolchain omits the field
+	if err := lf.SetToolchain(""); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	lf.SetCompact(true)
+	buf := &bytes.Buffer{}
+	if _, err := lf.WriteTo(buf); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if strings.Contains(buf.String(), "goVersion") {
+		t.Errorf("want no goVersion field, got %s", buf.String())
+	}
+
+	_, err = lockfile.Parse(strings.NewReader(`{"tools": {}, "goVersion": "latest"}`))
+	if err == nil {
+		t.Error("want error for invalid toolchain, got nil")
+	}
+}
+
+func TestLockfileMergeToolchain(t *testing.T) {
+	lf := &lockfile.Lockfile{}
+	if err := lf.SetToolchain("1.21.0"); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	// An empty toolchain doesn't replace the existing one
+	if err := lf.Merge(&lockfile.Lockfile{}, lockfile.PreferOther); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if got := lf.Toolchain(); got != "1.21.0" {
+		t.Errorf("got toolchain %q, want %q", got, "1.21.0")
+	}
+	other := &lockfile.Lockfile{}
+	if err := other.SetToolchain("1.22.0"); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if err := lf.Merge(other, lockfile.PreferOther); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if got := lf.Toolchain(); got != "1.22.0" {
+		t.Errorf("got toolchain %q, want %q", got, "1.22.0")
+	}
+}
+
+func TestLockfileHash(t *testing.T) {
+	r := strings.NewReader(`{
+		"tools": {
+		  "github.com/cszatmary/go-fish": {
+			"version": "v0.1.0"
+		  },
+		  "golang.org/x/tools/cmd/stringer": {
+			"version": "v0.1.0",
+			"hash": "h1:abc="
+		  }
+		}
+	  }`)
+	lf, err := lockfile.Parse(r)
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if got := lf.Hash("golang.org/x/tools/cmd/stringer"); got != "h1:abc=" {
+		t.Errorf("got hash %q, want %q", got, "h1:abc=")
+	}
+	if got := lf.Hash("github.com/cszatmary/go-fish"); got != "" {
+		t.Errorf("got hash %q, want empty", got)
+	}
+	if err := lf.SetHash("github.com/cszatmary/go-fish", "h1:def="); err != nil {
+		t.Errorf("want nil error, got %v", err)
+	}
+	if err := lf.SetHash("github.com/cszatmary/go-fish", "def"); err == nil {
+		t.Error("want error for invalid hash, got nil")
+	}
+	if err := lf.SetHash("github.com/golangci/golangci-lint/cmd/golangci-lint", "h1:abc="); !errors.Is(err, lockfile.ErrNotFound) {
+		t.Errorf("got error %v, want %v", err, lockfile.ErrNotFound)
+	}
+
+	// Changing the version clears the hash since it only applies to the old version
+	err = lf.PutTool(tool.Tool{ImportPath: "golang.org/x/tools/cmd/stringer", Version: "v0.1.5"})
+	if err != nil {
+		t.Fatalf("failed to put tool %v", err)
+	}
+	if got := lf.Hash("golang.org/x/tools/cmd/stringer"); got != "" {
+		t.Errorf("got hash %q, want empty", got)
+	}
+
+	buf := &bytes.Buffer{}
+	if _, err := lf.WriteTo(buf); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	want := map[string]interface{}{
+		"tools": map[string]interface{}{
+			"github.com/cszatmary/go-fish": map[string]interface{}{
+				"version": "v0.1.0",
+				"hash":    "h1:def=",
+			},
+			"golang.org/x/tools/cmd/stringer": map[string]interface{}{
+				"version": "v0.1.5",
+			},
+		},
+	}
+	var got interface{}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Errorf("want nil error, got %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestParseInvalidHash(t *testing.T) {
+	r := strings.NewReader(`{
+		"tools": {
+		  "golang.org/x/tools/cmd/stringer": {
+			"version": "v0.1.0",
+			"hash": "abc"
+		  }
+		}
+	  }`)
+	_, err := lockfile.Parse(r)
+	if err == nil {
+		t.Error("want error for invalid hash, got nil")
+	}
+}
+
+func TestLockfileBinHash(t *testing.T) {
+	r := strings.NewReader(`{
+		"tools": {
+		  "github.com/cszatmary/go-fish": {
+			"version": "v0.1.0"
+		  },
+		  "golang.org/x/tools/cmd/stringer": {
+			"version": "v0.1.0",
+			"binHash": {
+			  "linux/amd64/go1.17.3": "sha256:abc"
+			}
+		  }
+		}
+	  }`)
+	lf, err := lockfile.Parse(r)
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	if got := lf.BinHash("golang.org/x/tools/cmd/stringer", "linux/amd64/go1.17.3"); got != "sha256:abc" {
+		t.Errorf("got binary hash %q, want %q", got, "sha256:abc")
+	}
+	if got := lf.BinHash("golang.org/x/tools/cmd/stringer", "darwin/arm64/go1.17.3"); got != "" {
+		t.Errorf("got binary hash %q, want empty", got)
+	}
+	if lf.HasBinHashes("github.com/cszatmary/go-fish") {
+		t.Error("want no binary hashes for github.com/cszatmary/go-fish")
+	}
+	if err := lf.SetBinHash("github.com/cszatmary/go-fish", "linux/amd64/go1.17.3", "sha256:def"); err != nil {
+		t.Errorf("want nil error, got %v", err)
+	}
+	if err := lf.SetBinHash("github.com/cszatmary/go-fish", "darwin/arm64/go1.17.3", "sha256:ghi"); err != nil {
+		t.Errorf("want nil error, got %v", err)
+	}
+	if err := lf.SetBinHash("github.com/cszatmary/go-fish", "", "sha256:def"); err == nil {
+		t.Error("want error for empty platform, got nil")
+	}
+	if err := lf.SetBinHash("github.com/cszatmary/go-fish", "linux/amd64/go1.17.3", "def"); err == nil {
+		t.Error("want error for invalid hash, got nil")
+	}
+	if err := lf.SetBinHash("github.com/golangci/golangci-lint/cmd/golangci-lint", "linux/amd64/go1.17.3", "sha256:abc"); !errors.Is(err, lockfile.ErrNotFound) {
+		t.Errorf("got error %v, want %v", err, lockfile.ErrNotFound)
+	}
+
+	// Changing the version clears the hashes for all platforms
+	err = lf.PutTool(tool.Tool{ImportPath: "golang.org/x/tools/cmd/stringer", Version: "v0.1.5"})
+	if err != nil {
+		t.Fatalf("failed to put tool %v", err)
+	}
+	if lf.HasBinHashes("golang.org/x/tools/cmd/stringer") {
+		t.Error("want no binary hashes after changing the version")
+	}
+
+	buf := &bytes.Buffer{}
+	if _, err := lf.WriteTo(buf); err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	want := map[string]interface{}{
+		"tools": map[string]interface{}{
+			"github.com/cszatmary/go-fish": map[string]interface{}{
+				"version": "v0.1.0",
+				"binHash": map[string]interface{}{
+					"darwin/arm64/go1.17.3": "sha256:ghi",
+					"linux/amd64/go1.17.3":  "sha256:def",
+				},
+			},
+			"golang.org/x/tools/cmd/stringer": map[string]interface{}{
+				"version": "v0.1.5",
+			},
+		},
+	}
+	var got interface{}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Errorf("want nil error, got %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestParseInvalidModule(t *testing.T) {
+	r := strings.NewReader(`{
+		"tools": {
+		  "golang.org/x/tools/cmd/stringer": {
+			"version": "v0.1.0",
+			"module": "github.com/cszatmary/go-fish"
+		  }
+		}
+	  }`)
+	if _, err := lockfile.Parse(r); err == nil {
+		t.Error("want error for module that doesn't contain tool, got nil")
+	}
+}
+
+func TestParseStrict(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{
+			name:    "valid",
+			data:    `{"tools": {"github.com/cszatmary/go-fish": {"version": "v0.1.0", "module": "github.com/cszatmary/go-fish"}}}`,
+			wantErr: "",
+		},
+		{
+			name:    "misspelled tool field",
+			data:    `{"tools": {"github.com/cszatmary/go-fish": {"verison": "v0.1.0"}}}`,
+			wantErr: `tool github.com/cszatmary/go-fish: json: unknown field "verison"`,
+		},
+		{
+			name:    "misspelled top level field",
+			data:    `{"tool": {"github.com/cszatmary/go-fish": {"version": "v0.1.0"}}}`,
+			wantErr: `json: unknown field "tool"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lf, err := lockfile.ParseStrict(strings.NewReader(tt.data))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("want nil error, got %v", err)
+				}
+				if lf.LenTools() != 1 {
+					t.Errorf("got len %d, want 1", lf.LenTools())
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("want error to contain %q, got %v", tt.wantErr, err)
+			}
+
+			// Parse ignores unknown fields
+			if _, err := lockfile.Parse(strings.NewReader(tt.data)); err != nil && strings.Contains(err.Error(), "unknown field") {
+				t.Errorf("want unknown field to be ignored, got %v", err)
+			}
+		})
+	}
+}
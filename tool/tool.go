@@ -6,13 +6,24 @@ import (
 	"fmt"
 	"path"
 	"path/filepath"
+	"runtime"
 	"strings"
+	"unicode"
 
 	"github.com/cszatmary/shed/errors"
 	"golang.org/x/mod/module"
 	"golang.org/x/mod/semver"
 )
 
+// ErrInvalidImportPath is wrapped by errors returned when a tool has an invalid import path.
+// Use errors.Is to check for it.
+var ErrInvalidImportPath = errors.Str("tool: invalid import path")
+
+// ErrInvalidVersion is wrapped by errors returned when a tool has an invalid version,
+// for example a version that is not a valid semantic version when one is required.
+// Use errors.Is to check for it.
+var ErrInvalidVersion = errors.Str("tool: invalid version")
+
 // Tool represents a tool managed by shed.
 // In most cases this corresponds to a Go module.
 type Tool struct {
@@ -44,6 +55,19 @@ func (t Tool) Module() string {
 	return t.ImportPath + "@" + t.Version
 }
 
+// WithVersion returns a copy of t with Version set to v. t is not modified.
+func (t Tool) WithVersion(v string) Tool {
+	t.Version = v
+	return t
+}
+
+// WithoutVersion returns a copy of t without a version. t is not modified.
+// This is useful to refer to a tool regardless of its version, for example
+// when removing it from a lockfile.
+func (t Tool) WithoutVersion() Tool {
+	return t.WithVersion("")
+}
+
 // HasSemver reports whether t.Version is a valid semantic version.
 // HasSemver requires t.Version to be a full semantic version. It does
 // not allow shorthands like vMAJOR or vMAJOR.MINOR.
@@ -52,6 +76,29 @@ func (t Tool) HasSemver() bool {
 	return semver.IsValid(t.Version) && t.Version == semver.Canonical(t.Version)
 }
 
+// IsPseudoVersion reports whether t.Version is a pseudo-version, for example
+// 'v0.0.0-20201211185031-d93e913c1a58'. A pseudo-version refers to a specific commit
+// rather than a tagged release, which usually means the tool was pinned to a commit on purpose.
+func (t Tool) IsPseudoVersion() bool {
+	return module.IsPseudoVersion(t.Version)
+}
+
+// Validate checks that t is a valid tool that can be stored in a lockfile.
+// ImportPath must be a valid import path and Version must be a valid
+// SemVer, that is t.HasSemver() must return true.
+// If t is not valid, an error with kind errors.Invalid is returned that
+// wraps either ErrInvalidImportPath or ErrInvalidVersion.
+func (t Tool) Validate() error {
+	const op = errors.Op("Tool.Validate")
+	if err := module.CheckPath(t.ImportPath); err != nil {
+		return errors.New(errors.Invalid, fmt.Sprintf("invalid import path %q", t.ImportPath), op, fmt.Errorf("%w: %v", ErrInvalidImportPath, err))
+	}
+	if !t.HasSemver() {
+		return errors.New(errors.Invalid, fmt.Sprintf("not a valid semantic version %q", t.Version), op, ErrInvalidVersion)
+	}
+	return nil
+}
+
 // String returns a string representation of the tool.
 func (t Tool) String() string {
 	// While this may seem shallow, String serves a different purpose
@@ -95,12 +142,246 @@ func (t Tool) BinaryFilepath() (string, error) {
 	return filepath.Join(fp, t.Name()), nil
 }
 
+// aliasDir is the directory in the tool directory that contains the binaries installed under an alias.
+// Elements of import paths can't start with a dot, so it never conflicts with the binary of the tool,
+// and an alias can never replace the binary or any other file in the tool directory.
+const aliasDir = ".alias"
+
+// AliasBinaryFilepath is like BinaryFilepath but the binary is named alias instead of the name of the tool.
+// This allows a tool to be installed under a different name. The binary is placed in a separate directory
+// so that it doesn't conflict with other files of the tool, for example the alias can be the name of the tool.
+// On Windows, '.exe' is added to alias so that it can be executed. If alias is empty, AliasBinaryFilepath
+// is the same as BinaryFilepath. If alias is not a valid file name, an error with kind errors.Invalid is returned.
+func (t Tool) AliasBinaryFilepath(alias string) (string, error) {
+	const op = errors.Op("Tool.AliasBinaryFilepath")
+	if alias == "" {
+		return t.BinaryFilepath()
+	}
+	if alias == "." || alias == ".." || strings.ContainsAny(alias, "/\\@") {
+		return "", errors.New(errors.Invalid, fmt.Sprintf("invalid alias %q for tool %s", alias, t), op)
+	}
+	fp, err := t.Filepath()
+	if err != nil {
+		return "", err
+	}
+	if runtime.GOOS == "windows" && !strings.HasSuffix(strings.ToLower(alias), ".exe") {
+		alias += ".exe"
+	}
+	return filepath.Join(fp, aliasDir, alias), nil
+}
+
+// repoHosts maps import path prefixes to the URL of the source repository. elems is the number
+// of path elements after the prefix that identify the repository, which is appended to url.
+var repoHosts = []struct {
+	prefix string
+	url    string
+	elems  int
+}{
+	{"github.com/", "https://github.com/", 2},
+	{"gitlab.com/", "https://gitlab.com/", 2},
+	{"golang.org/x/", "https://go.googlesource.com/", 1},
+}
+
+// RepoURL returns an HTTPS URL where the source of the tool can be browsed. This is the URL of
+// the repository containing the tool, for example 'https://github.com/golangci/golangci-lint' for
+// the import path 'github.com/golangci/golangci-lint/cmd/golangci-lint'. Only import paths on
+// github.com, gitlab.com, and golang.org/x are supported. For any other import path an error
+// with kind errors.Invalid is returned.
+func (t Tool) RepoURL() (string, error) {
+	const op = errors.Op("Tool.RepoURL")
+	for _, h := range repoHosts {
+		if !strings.HasPrefix(t.ImportPath, h.prefix) {
+			continue
+		}
+		elems := strings.SplitN(strings.TrimPrefix(t.ImportPath, h.prefix), "/", h.elems+1)
+		if len(elems) < h.elems {
+			return "", errors.New(errors.Invalid, fmt.Sprintf("import path %q does not contain a repository", t.ImportPath), op)
+		}
+		for _, e := range elems[:h.elems] {
+			if e == "" {
+				return "", errors.New(errors.Invalid, fmt.Sprintf("import path %q does not contain a repository", t.ImportPath), op)
+			}
+		}
+		return h.url + strings.Join(elems[:h.elems], "/"), nil
+	}
+	return "", errors.New(errors.Invalid, fmt.Sprintf("unknown source host for import path %q", t.ImportPath), op)
+}
+
+// Target is a platform that a tool binary can be built for, identified
+// by the GOOS and GOARCH values used by the go command.
+// The zero value represents the host platform.
+type Target struct {
+	GOOS   string
+	GOARCH string
+}
+
+// IsHost reports whether tg is the zero value, which represents the host platform.
+func (tg Target) IsHost() bool {
+	return tg == Target{}
+}
+
+// String returns the target with the format 'GOOS_GOARCH', which is the format
+// used by go install for cross-compiled binaries. If tg is the host, String returns
+// an empty string.
+func (tg Target) String() string {
+	if tg.IsHost() {
+		return ""
+	}
+	return tg.GOOS + "_" + tg.GOARCH
+}
+
+// Validate checks that tg is a valid target. GOOS and GOARCH must either both
+// be empty or both be set, and they must only contain lower case letters and digits.
+// If tg is not valid, an error with kind errors.Invalid is returned.
+func (tg Target) Validate() error {
+	const op = errors.Op("Target.Validate")
+	if tg.IsHost() {
+		return nil
+	}
+	for _, s := range []string{tg.GOOS, tg.GOARCH} {
+		if s == "" || strings.Trim(s, "abcdefghijklmnopqrstuvwxyz0123456789") != "" {
+			return errors.New(errors.Invalid, fmt.Sprintf("invalid target GOOS=%q GOARCH=%q", tg.GOOS, tg.GOARCH), op)
+		}
+	}
+	return nil
+}
+
+// buildFlagNames are the go build flags that can be used with ValidateBuildFlags. Flags like -toolexec
+// and -exec run arbitrary programs, and -o would change where the binary is written, so they are not allowed.
+// The value is whether the flag is a boolean flag that can be used without a value.
+var buildFlagNames = map[string]bool{
+	"ldflags":  false,
+	"tags":     false,
+	"gcflags":  false,
+	"asmflags": false,
+	"trimpath": true,
+	"buildvcs": true,
+}
+
+// ValidateBuildFlags checks that flags can be passed to go build when building a tool.
+// Only -ldflags, -tags, -gcflags, -asmflags, -trimpath and -buildvcs are allowed. Each flag must be a single
+// argument that includes its value after an '=', for example '-tags=netgo'. The value can only be omitted
+// for -trimpath and -buildvcs. The linker can also run arbitrary programs, for example using -extld,
+// so -ldflags may only contain -X, -s and -w. If flags are not valid, an error with kind errors.Invalid is returned.
+func ValidateBuildFlags(flags []string) error {
+	const op = errors.Op("tool.ValidateBuildFlags")
+	for _, f := range flags {
+		name := strings.TrimPrefix(f, "-")
+		if name == f || strings.IndexFunc(f, unicode.IsControl) != -1 {
+			return errors.New(errors.Invalid, fmt.Sprintf("invalid build flag %q", f), op)
+		}
+		// The go command accepts flags starting with either '-' or '--'
+		name = strings.TrimPrefix(name, "-")
+		i := strings.IndexByte(name, '=')
+		if i != -1 {
+			name = name[:i]
+		}
+		isBool, ok := buildFlagNames[name]
+		if !ok {
+			return errors.New(errors.Invalid, fmt.Sprintf("build flag %q is not allowed", f), op)
+		}
+		if i == -1 && !isBool {
+			return errors.New(errors.Invalid, fmt.Sprintf("build flag %q must include a value after '='", f), op)
+		}
+		if name == "ldflags" {
+			if err := checkLdflags(f[strings.IndexByte(f, '=')+1:]); err != nil {
+				return errors.New(errors.Invalid, fmt.Sprintf("build flag %q is not allowed", f), op, err)
+			}
+		}
+	}
+	return nil
+}
+
+// checkLdflags checks that the value of -ldflags only contains the linker flags -X, -s and -w.
+// The value has the same format that go build accepts, that is a list of flags separated by spaces
+// that can be quoted, optionally preceded by a package pattern and an '='.
+func checkLdflags(value string) error {
+	if value != "" && value[0] != '-' {
+		// Flags only apply to packages matching the pattern
+		i := strings.IndexByte(value, '=')
+		if i == -1 {
+			return fmt.Errorf("missing '=' after package pattern %q", value)
+		}
+		value = value[i+1:]
+	}
+	args, err := splitQuoted(value)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		name := strings.TrimPrefix(strings.TrimPrefix(arg, "-"), "-")
+		if name == arg {
+			return fmt.Errorf("unexpected argument %q", arg)
+		}
+		switch {
+		case name == "s" || name == "w" || strings.HasPrefix(name, "s=") || strings.HasPrefix(name, "w="):
+			// Boolean flags, the value is part of the same argument
+		case name == "X":
+			// The value is the next argument
+			if i++; i == len(args) {
+				return fmt.Errorf("missing value for linker flag %q", arg)
+			}
+		case strings.HasPrefix(name, "X="):
+		default:
+			return fmt.Errorf("linker flag %q is not allowed", arg)
+		}
+	}
+	return nil
+}
+
+// splitQuoted splits s into fields separated by spaces. Like the go command, a field can be quoted
+// using single or double quotes to include spaces, there are no escape sequences.
+func splitQuoted(s string) ([]string, error) {
+	var fields []string
+	for {
+		s = strings.TrimLeft(s, " \t")
+		if s == "" {
+			return fields, nil
+		}
+		if q := s[0]; q == '\'' || q == '"' {
+			i := strings.IndexByte(s[1:], q)
+			if i == -1 {
+				return nil, fmt.Errorf("unterminated %c string", q)
+			}
+			fields = append(fields, s[1:i+1])
+			s = s[i+2:]
+			continue
+		}
+		i := strings.IndexAny(s, " \t")
+		if i == -1 {
+			i = len(s)
+		}
+		fields = append(fields, s[:i])
+		s = s[i:]
+	}
+}
+
+// TargetBinaryFilepath is like BinaryFilepath but returns the path to the binary built for target.
+// Binaries for targets other than the host are placed in a directory named after the target,
+// so that they don't collide with the host binary. For example, stringer built for linux/arm64
+// is at 'golang.org/x/tools/cmd/stringer@v0.1.0/linux_arm64/stringer'. If target is the host,
+// TargetBinaryFilepath is the same as BinaryFilepath.
+func (t Tool) TargetBinaryFilepath(target Target) (string, error) {
+	if target.IsHost() {
+		return t.BinaryFilepath()
+	}
+	fp, err := t.Filepath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(fp, target.String(), t.Name()), nil
+}
+
 // Parse parses the given tool name and returns a tool containing the
 // import path and version. name must be a valid import path and a version
 // with the format 'IMPORT_PATH@VERSION'. This format is the same as what would be
 // passed to a command like 'go get'. The version must be a valid semantic version
 // and it must be prefixed with 'v' (ex: 'v1.2.3'). If a shorthand semantic version
 // is used, it will be canonicalized (ex: 'v1' will become 'v1.0.0').
+//
+// If name is invalid, the returned error wraps ErrInvalidImportPath if the import path is invalid,
+// or ErrInvalidVersion if the version is invalid, so the cause can be checked using errors.Is.
 func Parse(name string) (Tool, error) {
 	return parseTool(errors.Op("tool.Parse"), name, true)
 }
@@ -116,6 +397,8 @@ func Parse(name string) (Tool, error) {
 // ParseLax allows the version to be omitted in which case it is assumed to mean
 // the latest version. That is, 'golang/x/tools/cmd/stringer' is functionally
 // equivalent to 'golang/x/tools/cmd/stringer@latest'.
+//
+// Like Parse, the returned error wraps ErrInvalidImportPath or ErrInvalidVersion if name is invalid.
 func ParseLax(name string) (Tool, error) {
 	return parseTool(errors.Op("tool.ParseLax"), name, false)
 }
@@ -130,13 +413,13 @@ func parseTool(op errors.Op, name string, strict bool) (Tool, error) {
 
 		// Make sure there isn't a dangling '@'
 		if t.Version == "" {
-			return t, errors.New(errors.Invalid, "missing version after '@'", op)
+			return t, errors.New(errors.Invalid, "missing version after '@'", op, ErrInvalidVersion)
 		}
 	}
 
 	// Validations
 	if err := module.CheckPath(t.ImportPath); err != nil {
-		return t, errors.New(errors.Invalid, fmt.Sprintf("invalid import path %q", t.ImportPath), op, err)
+		return t, errors.New(errors.Invalid, fmt.Sprintf("invalid import path %q", t.ImportPath), op, fmt.Errorf("%w: %v", ErrInvalidImportPath, err))
 	}
 	// Version validation is ignored if not strict
 	if !strict {
@@ -144,7 +427,7 @@ func parseTool(op errors.Op, name string, strict bool) (Tool, error) {
 	}
 
 	if !semver.IsValid(t.Version) {
-		return t, errors.New(errors.Invalid, fmt.Sprintf("not a valid semantic version %q", t.Version), op)
+		return t, errors.New(errors.Invalid, fmt.Sprintf("not a valid semantic version %q", t.Version), op, ErrInvalidVersion)
 	}
 	// The semver package allows vMAJOR and vMAJOR.MINOR as shorthands.
 	// Use the canonical version to ensure it is a full semantic version.
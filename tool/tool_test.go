@@ -2,8 +2,12 @@ package tool_test
 
 import (
 	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
 	"testing"
 
+	"github.com/cszatmary/shed/errors"
 	"github.com/cszatmary/shed/tool"
 )
 
@@ -89,6 +93,213 @@ func TestTool(t *testing.T) {
 	}
 }
 
+func TestToolWithVersion(t *testing.T) {
+	orig := tool.Tool{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.1.0"}
+	tl := orig
+
+	updated := tl.WithVersion("v0.2.0")
+	want := tool.Tool{ImportPath: "github.com/cszatmary/go-fish", Version: "v0.2.0"}
+	if updated != want {
+		t.Errorf("got %v, want %v", updated, want)
+	}
+	if tl != orig {
+		t.Errorf("WithVersion modified original tool, got %v, want %v", tl, orig)
+	}
+
+	noVersion := tl.WithoutVersion()
+	want = tool.Tool{ImportPath: "github.com/cszatmary/go-fish"}
+	if noVersion != want {
+		t.Errorf("got %v, want %v", noVersion, want)
+	}
+	if tl != orig {
+		t.Errorf("WithoutVersion modified original tool, got %v, want %v", tl, orig)
+	}
+
+	// Modifying the copy must not affect the original
+	updated.Version = "v0.3.0"
+	if tl != orig {
+		t.Errorf("modifying copy modified original tool, got %v, want %v", tl, orig)
+	}
+}
+
+func TestToolTargetBinaryFilepath(t *testing.T) {
+	tl := tool.Tool{ImportPath: "github.com/Shopify/ejson/cmd/ejson", Version: "v1.2.2"}
+	tests := []struct {
+		name   string
+		target tool.Target
+		want   string
+	}{
+		{"host", tool.Target{}, filepath.FromSlash("github.com/!shopify/ejson/cmd/ejson@v1.2.2/ejson")},
+		{"linux arm64", tool.Target{GOOS: "linux", GOARCH: "arm64"}, filepath.FromSlash("github.com/!shopify/ejson/cmd/ejson@v1.2.2/linux_arm64/ejson")},
+		{"darwin amd64", tool.Target{GOOS: "darwin", GOARCH: "amd64"}, filepath.FromSlash("github.com/!shopify/ejson/cmd/ejson@v1.2.2/darwin_amd64/ejson")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tl.TargetBinaryFilepath(tt.target)
+			if err != nil {
+				t.Errorf("want nil error, got %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestToolAliasBinaryFilepath(t *testing.T) {
+	tl := tool.Tool{ImportPath: "github.com/Shopify/ejson/cmd/ejson", Version: "v1.2.2"}
+	tests := []struct {
+		name  string
+		alias string
+		want  string
+	}{
+		{"no alias", "", filepath.FromSlash("github.com/!shopify/ejson/cmd/ejson@v1.2.2/ejson")},
+		{"alias", "shopify-ejson", filepath.FromSlash("github.com/!shopify/ejson/cmd/ejson@v1.2.2/.alias/shopify-ejson")},
+		// Aliases are in a separate directory so they never replace other files
+		{"alias is tool name", "ejson", filepath.FromSlash("github.com/!shopify/ejson/cmd/ejson@v1.2.2/.alias/ejson")},
+		{"alias is go.mod", "go.mod", filepath.FromSlash("github.com/!shopify/ejson/cmd/ejson@v1.2.2/.alias/go.mod")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tl.AliasBinaryFilepath(tt.alias)
+			if err != nil {
+				t.Errorf("want nil error, got %v", err)
+			}
+			if runtime.GOOS == "windows" && tt.alias != "" {
+				tt.want += ".exe"
+			}
+			if got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	for _, alias := range []string{"../ejson", `a\b`, "ejson@v1", ".."} {
+		_, err := tl.AliasBinaryFilepath(alias)
+		if rootErr := errors.Root(err); rootErr == nil || rootErr.Kind != errors.Invalid {
+			t.Errorf("got error %v for alias %q, want kind %v", err, alias, errors.Invalid)
+		}
+	}
+}
+
+func TestToolRepoURL(t *testing.T) {
+	tests := []struct {
+		name       string
+		importPath string
+		want       string
+	}{
+		{"github", "github.com/golangci/golangci-lint/cmd/golangci-lint", "https://github.com/golangci/golangci-lint"},
+		{"github repo root", "github.com/cszatmary/go-fish", "https://github.com/cszatmary/go-fish"},
+		{"gitlab", "gitlab.com/gitlab-org/cli/cmd/glab", "https://gitlab.com/gitlab-org/cli"},
+		{"golang.org/x", "golang.org/x/tools/cmd/stringer", "https://go.googlesource.com/tools"},
+		{"golang.org/x major version", "golang.org/x/tools/gopls/v2", "https://go.googlesource.com/tools"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tool.Tool{ImportPath: tt.importPath, Version: "v1.0.0"}.RepoURL()
+			if err != nil {
+				t.Errorf("want nil error, got %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	for _, importPath := range []string{"example.org/x/tools/cmd/stringer", "github.com/cszatmary", "golang.org/x", "mvdan.cc/gofumpt"} {
+		_, err := tool.Tool{ImportPath: importPath}.RepoURL()
+		if rootErr := errors.Root(err); rootErr == nil || rootErr.Kind != errors.Invalid {
+			t.Errorf("got error %v for import path %q, want kind %v", err, importPath, errors.Invalid)
+		}
+	}
+}
+
+func TestTargetValidate(t *testing.T) {
+	tests := []struct {
+		target  tool.Target
+		wantErr bool
+	}{
+		{tool.Target{}, false},
+		{tool.Target{GOOS: "linux", GOARCH: "arm64"}, false},
+		{tool.Target{GOOS: "linux"}, true},
+		{tool.Target{GOARCH: "amd64"}, true},
+		{tool.Target{GOOS: "../linux", GOARCH: "amd64"}, true},
+		{tool.Target{GOOS: "Linux", GOARCH: "amd64"}, true},
+	}
+	for _, tt := range tests {
+		err := tt.target.Validate()
+		if tt.wantErr {
+			if rootErr := errors.Root(err); rootErr == nil || rootErr.Kind != errors.Invalid {
+				t.Errorf("%+v: want invalid error, got %v", tt.target, err)
+			}
+		} else if err != nil {
+			t.Errorf("%+v: want nil error, got %v", tt.target, err)
+		}
+	}
+}
+
+func TestValidateBuildFlags(t *testing.T) {
+	tests := []struct {
+		flags   []string
+		wantErr bool
+	}{
+		{nil, false},
+		{[]string{"-ldflags=-s -w", "-tags=netgo", "-gcflags=all=-N -l", "-asmflags=-trimpath", "-trimpath", "-buildvcs=false"}, false},
+		{[]string{"--tags=netgo", "-trimpath=true", "-buildvcs"}, false},
+		{[]string{"-toolexec=/bin/sh"}, true},
+		{[]string{"-toolexec", "/bin/sh"}, true},
+		{[]string{"-exec=/bin/sh"}, true},
+		{[]string{"--toolexec=/bin/sh"}, true},
+		{[]string{"-o=stringer"}, true},
+		{[]string{"-tags"}, true},
+		{[]string{"-tags", "netgo"}, true},
+		{[]string{"netgo"}, true},
+		{[]string{""}, true},
+		{[]string{"-ldflags=-s\n-w"}, true},
+		{[]string{"-ldflags=-X main.version=v1.0.0 -X 'main.name=my tool' -s -w"}, false},
+		{[]string{"-ldflags=all=-X=main.version=v1.0.0"}, false},
+		{[]string{"-ldflags=-linkmode=external -extld=/bin/sh -extldflags=-c touch /tmp/pwned"}, true},
+		{[]string{"-ldflags=-extld=/bin/sh"}, true},
+		{[]string{"-ldflags=all=-extldflags=-c"}, true},
+		{[]string{"-ldflags=-X"}, true},
+		{[]string{"-ldflags=-X 'main.version=v1"}, true},
+		{[]string{"-ldflags=main.version=v1"}, true},
+	}
+	for _, tt := range tests {
+		err := tool.ValidateBuildFlags(tt.flags)
+		if tt.wantErr {
+			if rootErr := errors.Root(err); rootErr == nil || rootErr.Kind != errors.Invalid {
+				t.Errorf("%q: want invalid error, got %v", tt.flags, err)
+			}
+		} else if err != nil {
+			t.Errorf("%q: want nil error, got %v", tt.flags, err)
+		}
+	}
+}
+
+func TestToolFilepathCaseInsensitive(t *testing.T) {
+	// Paths that only differ in case must map to different paths on case-insensitive filesystems.
+	tools := []tool.Tool{
+		{ImportPath: "github.com/Shopify/ejson/cmd/ejson", Version: "v1.2.2"},
+		{ImportPath: "github.com/shopify/ejson/cmd/ejson", Version: "v1.2.2"},
+		{ImportPath: "github.com/shopify/EJSON/cmd/ejson", Version: "v1.2.2"},
+		{ImportPath: "github.com/shopify/ejson/cmd/ejson", Version: "v1.2.2-RC"},
+		{ImportPath: "github.com/shopify/ejson/cmd/ejson", Version: "v1.2.2-rc"},
+	}
+	seen := make(map[string]tool.Tool)
+	for _, tl := range tools {
+		fp, err := tl.Filepath()
+		if err != nil {
+			t.Fatalf("want nil error, got %v", err)
+		}
+		key := strings.ToLower(fp)
+		if other, ok := seen[key]; ok {
+			t.Errorf("tools %v and %v both map to %s", other, tl, fp)
+		}
+		seen[key] = tl
+	}
+}
+
 func TestToolHasSemver(t *testing.T) {
 	tests := []struct {
 		name string
@@ -137,6 +348,83 @@ func TestToolHasSemver(t *testing.T) {
 	}
 }
 
+func TestToolIsPseudoVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		version string
+		want    bool
+	}{
+		{"pseudo-version without tag", "v0.0.0-20201211185031-d93e913c1a58", true},
+		{"pseudo-version after release", "v1.2.4-0.20201211185031-d93e913c1a58", true},
+		{"pseudo-version after prerelease", "v1.2.4-rc.1.0.20201211185031-d93e913c1a58", true},
+		{"prerelease", "v1.2.4-rc.1", false},
+		{"release", "v1.2.3", false},
+		{"no version", "", false},
+		{"commit SHA", "d93e913c1a58", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tl := tool.Tool{ImportPath: "golang.org/x/tools/cmd/stringer", Version: tt.version}
+			if got := tl.IsPseudoVersion(); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestToolValidate(t *testing.T) {
+	tl := tool.Tool{ImportPath: "golang.org/x/tools/cmd/stringer", Version: "v0.0.0-20201211185031-d93e913c1a58"}
+	if err := tl.Validate(); err != nil {
+		t.Errorf("want nil error, got %v", err)
+	}
+}
+
+func TestToolValidateError(t *testing.T) {
+	tests := []struct {
+		name    string
+		tool    tool.Tool
+		wantErr error
+	}{
+		{
+			name:    "invalid import path",
+			tool:    tool.Tool{ImportPath: "golang/x/tools/cmd/stringer", Version: "v0.1.0"},
+			wantErr: tool.ErrInvalidImportPath,
+		},
+		{
+			name:    "missing version",
+			tool:    tool.Tool{ImportPath: "github.com/cszatmary/go-fish", Version: ""},
+			wantErr: tool.ErrInvalidVersion,
+		},
+		{
+			name:    "not version",
+			tool:    tool.Tool{ImportPath: "github.com/cszatmary/go-fish", Version: "master"},
+			wantErr: tool.ErrInvalidVersion,
+		},
+		{
+			name:    "invalid semver",
+			tool:    tool.Tool{ImportPath: "github.com/cszatmary/go-fish", Version: "3.5.7.124"},
+			wantErr: tool.ErrInvalidVersion,
+		},
+		{
+			name:    "shorthand semver",
+			tool:    tool.Tool{ImportPath: "github.com/cszatmary/go-fish", Version: "v1.2"},
+			wantErr: tool.ErrInvalidVersion,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.tool.Validate()
+			if rootErr := errors.Root(err); rootErr == nil || rootErr.Kind != errors.Invalid {
+				t.Errorf("got error %v, want kind %v", err, errors.Invalid)
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("got error %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func TestToolFilepathError(t *testing.T) {
 	tests := []struct {
 		name string
@@ -229,40 +517,47 @@ func TestParse(t *testing.T) {
 
 func TestParseError(t *testing.T) {
 	tests := []struct {
-		name   string
-		module string
+		name    string
+		module  string
+		wantErr error
 	}{
 		{
-			name:   "invalid domain",
-			module: "golang/x/tools/cmd/stringer@v0.0.0-20201211185031-d93e913c1a58",
+			name:    "invalid domain",
+			module:  "golang/x/tools/cmd/stringer@v0.0.0-20201211185031-d93e913c1a58",
+			wantErr: tool.ErrInvalidImportPath,
 		},
 		{
-			name:   "invalid version",
-			module: "golang.org/x/tools/cmd/stringer@v0..0-20201211185031-d93e913c1a58",
+			name:    "invalid version",
+			module:  "golang.org/x/tools/cmd/stringer@v0..0-20201211185031-d93e913c1a58",
+			wantErr: tool.ErrInvalidVersion,
 		},
 		{
-			name:   "no version",
-			module: "github.com/cszatmary/go-fish",
+			name:    "no version",
+			module:  "github.com/cszatmary/go-fish",
+			wantErr: tool.ErrInvalidVersion,
 		},
 		{
-			name:   "dangling @",
-			module: "github.com/Shopify/ejson/cmd/ejson@",
+			name:    "dangling @",
+			module:  "github.com/Shopify/ejson/cmd/ejson@",
+			wantErr: tool.ErrInvalidVersion,
 		},
 		{
-			name:   "branch name",
-			module: "github.com/golangci/golangci-lint/cmd/golangci-lint@master",
+			name:    "branch name",
+			module:  "github.com/golangci/golangci-lint/cmd/golangci-lint@master",
+			wantErr: tool.ErrInvalidVersion,
 		},
 		{
-			name:   "git SHA",
-			module: "github.com/cszatmary/go-fish@22d10c9b658df297b17b33c836a60fb943ef5a5f",
+			name:    "git SHA",
+			module:  "github.com/cszatmary/go-fish@22d10c9b658df297b17b33c836a60fb943ef5a5f",
+			wantErr: tool.ErrInvalidVersion,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			_, err := tool.Parse(tt.module)
-			if err == nil {
-				t.Error("want non-nil error, got nil")
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("got error %v, want %v", err, tt.wantErr)
 			}
 		})
 	}
@@ -336,22 +631,78 @@ func TestParseLax(t *testing.T) {
 
 func TestParseLaxError(t *testing.T) {
 	tests := []struct {
-		name   string
-		module string
+		name    string
+		module  string
+		wantErr error
 	}{
 		{
-			name:   "invalid domain",
-			module: "golang/x/tools/cmd/stringer@v0.0.0-20201211185031-d93e913c1a58",
+			name:    "invalid domain",
+			module:  "golang/x/tools/cmd/stringer@v0.0.0-20201211185031-d93e913c1a58",
+			wantErr: tool.ErrInvalidImportPath,
 		},
 		{
-			name:   "dangling @",
-			module: "github.com/Shopify/ejson/cmd/ejson@",
+			name:    "dangling @",
+			module:  "github.com/Shopify/ejson/cmd/ejson@",
+			wantErr: tool.ErrInvalidVersion,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			_, err := tool.ParseLax(tt.module)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("got error %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseToolsFile(t *testing.T) {
+	r := strings.NewReader(`//go:build tools
+// +build tools
+
+package tools
+
+import (
+	"fmt"
+
+	_ "github.com/golangci/golangci-lint/cmd/golangci-lint"
+	_ "golang.org/x/tools/cmd/stringer"
+)
+
+var _ = fmt.Sprint
+`)
+	tools, err := tool.ParseToolsFile(r)
+	if err != nil {
+		t.Fatalf("want nil error, got %v", err)
+	}
+	want := []tool.Tool{
+		{ImportPath: "github.com/golangci/golangci-lint/cmd/golangci-lint"},
+		{ImportPath: "golang.org/x/tools/cmd/stringer"},
+	}
+	if !reflect.DeepEqual(tools, want) {
+		t.Errorf("got %+v, want %+v", tools, want)
+	}
+}
+
+func TestParseToolsFileError(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+	}{
+		{
+			name: "invalid go file",
+			src:  "import _ \"golang.org/x/tools/cmd/stringer\"",
+		},
+		{
+			name: "invalid import path",
+			src:  "package tools\n\nimport _ \"golang/x/tools/cmd/stringer\"\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tool.ParseToolsFile(strings.NewReader(tt.src))
 			if err == nil {
 				t.Error("want non-nil error, got nil")
 			}
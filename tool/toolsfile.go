@@ -0,0 +1,60 @@
+package tool
+
+import (
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io"
+	"strconv"
+
+	"github.com/cszatmary/shed/errors"
+)
+
+// ParseToolsFile parses the Go source file in r and returns a tool for each blank import.
+// This supports the common pattern of tracking tool dependencies in a tools.go file with
+// a 'tools' build constraint, for example:
+//
+//	//go:build tools
+//
+//	package tools
+//
+//	import (
+//		_ "golang.org/x/tools/cmd/stringer"
+//	)
+//
+// Imports that are not blank imports are ignored. The returned tools have no version,
+// since the version is determined by the go.mod of the module containing the file.
+// If an import path is invalid, an errors.List with an error for each invalid import is returned.
+func ParseToolsFile(r io.Reader) ([]Tool, error) {
+	const op = errors.Op("tool.ParseToolsFile")
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", r, parser.ImportsOnly)
+	if err != nil {
+		return nil, errors.Wrap(err, errors.Invalid, op, "failed to parse tools file")
+	}
+
+	var tools []Tool
+	var errs errors.List
+	for _, imp := range f.Imports {
+		if imp.Name == nil || imp.Name.Name != "_" {
+			continue
+		}
+		importPath, err := strconv.Unquote(imp.Path.Value)
+		if err != nil {
+			// Shouldn't happen since the file was parsed successfully, but handle just to be safe.
+			errs = append(errs, errors.Wrap(err, errors.Invalid, op, fmt.Sprintf("invalid import %s", imp.Path.Value)))
+			continue
+		}
+		t, err := ParseLax(importPath)
+		if err != nil {
+			pos := fset.Position(imp.Pos())
+			errs = append(errs, errors.New(fmt.Sprintf("line %d: invalid tool import %s", pos.Line, importPath), op, err))
+			continue
+		}
+		tools = append(tools, t)
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return tools, nil
+}